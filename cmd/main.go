@@ -1,12 +1,20 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/AntonyIS/usafi-hub-user-service/config"
 	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/app"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/breached"
 	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/logger"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/migrations"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/notifier"
 	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/repository"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
 	"github.com/AntonyIS/usafi-hub-user-service/internal/core/services"
 )
 
@@ -25,16 +33,128 @@ func RunService() {
 		panic(err)
 	}
 	logger.Info("Loaded configurations successfully...")
-	roleRepo, _ := repository.NewRolePostgresClient(*config)
-	userRepo, _ := repository.NewUserPostgresClient(*config)
-	userRoleRepo, _ := repository.NewUserRolePostgresClient(*config)
+
+	db, err := repository.NewPostgresDB(*config)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to connect to database: %v", err))
+		os.Exit(1)
+	}
+
+	if config.AUTO_MIGRATE {
+		migrator, err := migrations.NewMigrator(db, *config, logger)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to load migrations: %v", err))
+			os.Exit(1)
+		}
+		count, err := migrator.Up()
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to apply migrations: %v", err))
+			os.Exit(1)
+		}
+		logger.Info(fmt.Sprintf("Applied %d migration(s)", count))
+	}
+
+	factory := repository.NewRepositoryFactory(db, *config)
+	roleRepo := factory.RoleRepository()
+	userRepo := factory.UserRepository()
+	userRoleRepo := factory.UserRoleRepository()
+	passwordResetRepo := factory.PasswordResetRepository()
+	tokenRepo := factory.TokenRepository()
+	revocationRepo := factory.RevocationRepository()
 
 	logger.Info("Service repository running successfully...")
 
-	userService := services.NewUserService(userRepo, logger, []byte(config.SECRET_KEY))
+	var breachedPasswords ports.BreachedPasswordChecker
+	if config.BREACHED_PASSWORDS_FILE != "" {
+		list, err := breached.NewPasswordList(config.BREACHED_PASSWORDS_FILE)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to load breached passwords: %v", err))
+			os.Exit(1)
+		}
+		logger.Info(fmt.Sprintf("Loaded %d breached password hashes", list.Size()))
+		breachedPasswords = list
+	}
+	passwordPolicy := services.NewPasswordPolicy(domain.PasswordRules{
+		MinLength:     config.PASSWORD_MIN_LENGTH,
+		RequireUpper:  config.PASSWORD_REQUIRE_UPPER,
+		RequireLower:  config.PASSWORD_REQUIRE_LOWER,
+		RequireDigit:  config.PASSWORD_REQUIRE_DIGIT,
+		RequireSymbol: config.PASSWORD_REQUIRE_SYMBOL,
+	}, breachedPasswords, logger)
+
+	if !domain.ValidSigningAlgorithm(config.JWT_SIGNING_ALGORITHM) {
+		logger.Error(fmt.Sprintf("Invalid JWT_SIGNING_ALGORITHM %q", config.JWT_SIGNING_ALGORITHM))
+		os.Exit(1)
+	}
+	// Retired keys stay published for the overlap, which must outlast the
+	// access tokens they signed.
+	if config.KEY_ROTATION_OVERLAP < config.ACCESS_TOKEN_TTL || config.KEY_ROTATION_INTERVAL <= config.KEY_ROTATION_OVERLAP {
+		logger.Error("KEY_ROTATION_OVERLAP must be at least ACCESS_TOKEN_TTL and less than KEY_ROTATION_INTERVAL")
+		os.Exit(1)
+	}
+	keyRingService := services.NewKeyRingService(factory.SigningKeyRepository(), logger, config.JWT_SIGNING_ALGORITHM, config.JWT_ACCEPT_LEGACY_HS256, []byte(config.SECRET_KEY), config.KEY_ROTATION_INTERVAL, config.KEY_ROTATION_OVERLAP)
+	if err := keyRingService.RotateKeys(context.Background()); err != nil {
+		logger.Error(fmt.Sprintf("Failed to prepare signing keys: %v", err))
+		os.Exit(1)
+	}
+	go rotateKeys(keyRingService, config.KEY_ROTATION_CHECK_INTERVAL, logger)
+
+	tokenService := services.NewTokenService(tokenRepo, repository.NewRevocationCache(revocationRepo, config.REVOCATION_CACHE_TTL), factory.SessionRepository(), userRepo, userRoleRepo, logger, keyRingService, config.ACCESS_TOKEN_TTL, config.REFRESH_TOKEN_TTL)
+	loginThrottle := services.NewLoginThrottleService(factory.LoginAttemptRepository(), domain.LoginThrottleRules{
+		MaxAccountFailures: config.LOGIN_MAX_FAILURES,
+		MaxIPFailures:      config.LOGIN_IP_MAX_FAILURES,
+		FailureWindow:      config.LOGIN_FAILURE_WINDOW,
+		BackoffBase:        config.LOGIN_BACKOFF_BASE,
+		BackoffMax:         config.LOGIN_BACKOFF_MAX,
+		LockoutDuration:    config.LOGIN_LOCKOUT_DURATION,
+	}, logger)
+	emailPolicy := domain.EmailVerificationPolicy(config.EMAIL_VERIFICATION_POLICY)
+	if !emailPolicy.Valid() {
+		logger.Error(fmt.Sprintf("Invalid EMAIL_VERIFICATION_POLICY %q", config.EMAIL_VERIFICATION_POLICY))
+		os.Exit(1)
+	}
+	mfaService := services.NewMFAService(userRepo, factory.MFARepository(), tokenService, loginThrottle, logger, []byte(config.SECRET_KEY), config.MFA_ISSUER, config.MFA_CHALLENGE_TTL)
+	userService := services.NewUserService(userRepo, factory.UserRoleRepository(), tokenService, mfaService, passwordPolicy, loginThrottle, emailPolicy, logger)
 	roleService := services.NewRoleService(roleRepo)
 	userRoleService := services.NewUserRoleService(userRoleRepo)
+	emailNotifier := notifier.NewLogNotifier(logger)
+	passwordResetService := services.NewPasswordResetService(userRepo, passwordResetRepo, tokenService, emailNotifier, passwordPolicy, logger, config.PASSWORD_RESET_URL, config.PASSWORD_RESET_TTL)
+	emailVerificationService := services.NewEmailVerificationService(userRepo, emailNotifier, logger, []byte(config.SECRET_KEY), config.EMAIL_VERIFICATION_URL, config.EMAIL_VERIFICATION_TTL)
+
+	var smsSender ports.SMSSender = notifier.NewLogSMSSender(logger)
+	if config.SMS_OUTBOX_FILE != "" {
+		smsSender = notifier.NewFileSMSSender(config.SMS_OUTBOX_FILE)
+	}
+	oneTimeCodeRules := domain.OneTimeCodeRules{
+		Length:         config.OTP_LENGTH,
+		TTL:            config.OTP_TTL,
+		MaxAttempts:    config.OTP_MAX_ATTEMPTS,
+		ResendInterval: config.OTP_RESEND_INTERVAL,
+	}
+	phoneVerificationService := services.NewPhoneVerificationService(userRepo, factory.OneTimeCodeRepository(), smsSender, logger, oneTimeCodeRules, []byte(config.SECRET_KEY))
+	passwordlessRules := oneTimeCodeRules
+	passwordlessRules.TTL = config.PASSWORDLESS_TTL
+	passwordlessService := services.NewPasswordlessService(userRepo, factory.OneTimeCodeRepository(), mfaService, loginThrottle, emailNotifier, smsSender, emailPolicy, logger, passwordlessRules, []byte(config.SECRET_KEY), config.PASSWORDLESS_LINK_URL)
+	// ID tokens signed with the shared secret cannot be verified by clients.
+	if config.JWT_SIGNING_ALGORITHM == domain.SigningAlgorithmHS256 {
+		logger.Warning("JWT_SIGNING_ALGORITHM is HS256, OpenID Connect clients will not be able to verify ID tokens")
+	}
+	oidcService := services.NewOIDCService(userRepo, factory.OAuthRepository(), factory.SessionRepository(), tokenService, keyRingService, logger, config.OIDC_ISSUER, config.OIDC_LOGIN_URL, config.JWT_SIGNING_ALGORITHM, config.AUTHORIZATION_CODE_TTL, config.ID_TOKEN_TTL)
+	apiKeyService := services.NewAPIKeyService(factory.APIKeyRepository(), roleRepo, logger)
+	impersonationService := services.NewImpersonationService(userRepo, userRoleRepo, factory.AuditRepository(), tokenService, logger, config.IMPERSONATION_TOKEN_TTL)
 
 	logger.Info("Services running successfully...")
-	app.InitGinRoutes(userService, roleService, userRoleService, *config, logger)
+	app.InitGinRoutes(userService, roleService, userRoleService, passwordResetService, emailVerificationService, phoneVerificationService, passwordlessService, mfaService, tokenService, keyRingService, oidcService, apiKeyService, impersonationService, *config, logger)
+}
+
+// rotateKeys checks the signing keys on every tick, publishing the next key
+// ahead of time and dropping expired ones. Failures are retried on the next tick.
+func rotateKeys(keyRing ports.KeyRingService, interval time.Duration, logger ports.LoggerService) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := keyRing.RotateKeys(context.Background()); err != nil {
+			logger.Warning(fmt.Sprintf("Failed to rotate signing keys: %v", err))
+		}
+	}
 }
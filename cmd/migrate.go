@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/AntonyIS/usafi-hub-user-service/config"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/logger"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/migrations"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/repository"
+)
+
+const migrateUsage = "usage: migrate up | down [steps] | status"
+
+// RunMigrations implements the `migrate` command.
+func RunMigrations(args []string) {
+	logger, err := logger.NewDefaultLogger()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load logger: %v\n", err)
+		os.Exit(1)
+	}
+
+	config, err := config.NewConfig(logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	db, err := repository.NewPostgresDB(*config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	migrator, err := migrations.NewMigrator(db, *config, logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load migrations: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "up":
+		count, err := migrator.Up()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to apply migrations: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Applied %d migration(s)\n", count)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				fmt.Fprintln(os.Stderr, migrateUsage)
+				os.Exit(2)
+			}
+		}
+		count, err := migrator.Down(steps)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to roll back migrations: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Rolled back %d migration(s)\n", count)
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read migration status: %v\n", err)
+			os.Exit(1)
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(writer, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		writer.Flush()
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+}
@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
 	"github.com/joho/godotenv"
@@ -21,6 +23,93 @@ type Config struct {
 	USER_ROLE_TABLE   string
 	DEBUG             bool
 	TEST              bool
+
+	PASSWORD_RESET_TABLE string
+	PASSWORD_RESET_URL   string
+	PASSWORD_RESET_TTL   time.Duration
+
+	REFRESH_TOKEN_TABLE string
+	ACCESS_TOKEN_TTL    time.Duration
+	REFRESH_TOKEN_TTL   time.Duration
+
+	REVOKED_TOKEN_TABLE   string
+	USER_REVOCATION_TABLE string
+	REVOCATION_CACHE_TTL  time.Duration
+
+	PERMISSION_TABLE      string
+	ROLE_PERMISSION_TABLE string
+
+	SCHEMA_MIGRATION_TABLE string
+	AUTO_MIGRATE           bool
+
+	DB_MAX_OPEN_CONNS     int
+	DB_MAX_IDLE_CONNS     int
+	DB_CONN_MAX_LIFETIME  time.Duration
+	DB_CONN_MAX_IDLE_TIME time.Duration
+	DB_STATEMENT_TIMEOUT  time.Duration
+
+	REQUEST_TIMEOUT time.Duration
+
+	PASSWORD_MIN_LENGTH     int
+	PASSWORD_REQUIRE_UPPER  bool
+	PASSWORD_REQUIRE_LOWER  bool
+	PASSWORD_REQUIRE_DIGIT  bool
+	PASSWORD_REQUIRE_SYMBOL bool
+	BREACHED_PASSWORDS_FILE string
+
+	LOGIN_ATTEMPT_TABLE    string
+	LOGIN_MAX_FAILURES     int
+	LOGIN_IP_MAX_FAILURES  int
+	LOGIN_FAILURE_WINDOW   time.Duration
+	LOGIN_BACKOFF_BASE     time.Duration
+	LOGIN_BACKOFF_MAX      time.Duration
+	LOGIN_LOCKOUT_DURATION time.Duration
+
+	TRUSTED_PROXIES string
+
+	EMAIL_VERIFICATION_URL    string
+	EMAIL_VERIFICATION_TTL    time.Duration
+	EMAIL_VERIFICATION_POLICY string
+
+	ONE_TIME_CODE_TABLE string
+	OTP_LENGTH          int
+	OTP_TTL             time.Duration
+	OTP_MAX_ATTEMPTS    int
+	OTP_RESEND_INTERVAL time.Duration
+	SMS_OUTBOX_FILE     string
+
+	PASSWORDLESS_TTL      time.Duration
+	PASSWORDLESS_LINK_URL string
+
+	TOTP_SECRET_TABLE                string
+	RECOVERY_CODE_TABLE              string
+	MFA_ISSUER                       string
+	MFA_CHALLENGE_TTL                time.Duration
+	MFA_REQUIRED_FOR_ROLE_MANAGEMENT bool
+
+	SIGNING_KEY_TABLE           string
+	JWT_SIGNING_ALGORITHM       string
+	JWT_ACCEPT_LEGACY_HS256     bool
+	KEY_ROTATION_INTERVAL       time.Duration
+	KEY_ROTATION_OVERLAP        time.Duration
+	KEY_ROTATION_CHECK_INTERVAL time.Duration
+
+	OAUTH_CLIENT_TABLE       string
+	AUTHORIZATION_CODE_TABLE string
+	OIDC_ISSUER              string
+	OIDC_LOGIN_URL           string
+	AUTHORIZATION_CODE_TTL   time.Duration
+	ID_TOKEN_TTL             time.Duration
+
+	SERVICE_ACCOUNT_TABLE string
+	API_KEY_TABLE         string
+
+	AUTH_COOKIE_NAME string
+
+	SESSION_TABLE string
+
+	AUDIT_LOG_TABLE         string
+	IMPERSONATION_TOKEN_TTL time.Duration
 }
 
 func NewConfig(logger ports.LoggerService) (*Config, error) {
@@ -49,6 +138,93 @@ func NewConfig(logger ports.LoggerService) (*Config, error) {
 		USER_ROLE_TABLE   = ""
 		DEBUG             = false
 		TEST              = false
+
+		PASSWORD_RESET_TABLE = "PasswordResetTokens"
+		PASSWORD_RESET_URL   = getEnv("PASSWORD_RESET_URL", "http://localhost:3000/reset-password")
+		PASSWORD_RESET_TTL   = getEnvDuration("PASSWORD_RESET_TTL", 30*time.Minute)
+
+		REFRESH_TOKEN_TABLE = "RefreshTokens"
+		ACCESS_TOKEN_TTL    = getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute)
+		REFRESH_TOKEN_TTL   = getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+
+		REVOKED_TOKEN_TABLE   = "RevokedTokens"
+		USER_REVOCATION_TABLE = "UserTokenRevocations"
+		REVOCATION_CACHE_TTL  = getEnvDuration("REVOCATION_CACHE_TTL", 30*time.Second)
+
+		PERMISSION_TABLE      = "Permissions"
+		ROLE_PERMISSION_TABLE = "RolePermissions"
+
+		SCHEMA_MIGRATION_TABLE = "SchemaMigrations"
+		AUTO_MIGRATE           = getEnv("AUTO_MIGRATE", "true") == "true"
+
+		DB_MAX_OPEN_CONNS     = getEnvInt("DB_MAX_OPEN_CONNS", 25)
+		DB_MAX_IDLE_CONNS     = getEnvInt("DB_MAX_IDLE_CONNS", 25)
+		DB_CONN_MAX_LIFETIME  = getEnvDuration("DB_CONN_MAX_LIFETIME", 30*time.Minute)
+		DB_CONN_MAX_IDLE_TIME = getEnvDuration("DB_CONN_MAX_IDLE_TIME", 5*time.Minute)
+		DB_STATEMENT_TIMEOUT  = getEnvDuration("DB_STATEMENT_TIMEOUT", 10*time.Second)
+
+		REQUEST_TIMEOUT = getEnvDuration("REQUEST_TIMEOUT", 10*time.Second)
+
+		PASSWORD_MIN_LENGTH     = getEnvInt("PASSWORD_MIN_LENGTH", 8)
+		PASSWORD_REQUIRE_UPPER  = getEnv("PASSWORD_REQUIRE_UPPER", "true") == "true"
+		PASSWORD_REQUIRE_LOWER  = getEnv("PASSWORD_REQUIRE_LOWER", "true") == "true"
+		PASSWORD_REQUIRE_DIGIT  = getEnv("PASSWORD_REQUIRE_DIGIT", "true") == "true"
+		PASSWORD_REQUIRE_SYMBOL = getEnv("PASSWORD_REQUIRE_SYMBOL", "false") == "true"
+		BREACHED_PASSWORDS_FILE = getEnv("BREACHED_PASSWORDS_FILE", "")
+
+		LOGIN_ATTEMPT_TABLE    = "LoginAttempts"
+		LOGIN_MAX_FAILURES     = getEnvInt("LOGIN_MAX_FAILURES", 5)
+		LOGIN_IP_MAX_FAILURES  = getEnvInt("LOGIN_IP_MAX_FAILURES", 50)
+		LOGIN_FAILURE_WINDOW   = getEnvDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute)
+		LOGIN_BACKOFF_BASE     = getEnvDuration("LOGIN_BACKOFF_BASE", time.Second)
+		LOGIN_BACKOFF_MAX      = getEnvDuration("LOGIN_BACKOFF_MAX", time.Minute)
+		LOGIN_LOCKOUT_DURATION = getEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute)
+
+		TRUSTED_PROXIES = getEnv("TRUSTED_PROXIES", "")
+
+		EMAIL_VERIFICATION_URL    = getEnv("EMAIL_VERIFICATION_URL", "http://localhost:3000/verify-email")
+		EMAIL_VERIFICATION_TTL    = getEnvDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour)
+		EMAIL_VERIFICATION_POLICY = getEnv("EMAIL_VERIFICATION_POLICY", "optional")
+
+		ONE_TIME_CODE_TABLE = "OneTimeCodes"
+		OTP_LENGTH          = getEnvInt("OTP_LENGTH", 6)
+		OTP_TTL             = getEnvDuration("OTP_TTL", 10*time.Minute)
+		OTP_MAX_ATTEMPTS    = getEnvInt("OTP_MAX_ATTEMPTS", 5)
+		OTP_RESEND_INTERVAL = getEnvDuration("OTP_RESEND_INTERVAL", time.Minute)
+		SMS_OUTBOX_FILE     = getEnv("SMS_OUTBOX_FILE", "")
+
+		PASSWORDLESS_TTL      = getEnvDuration("PASSWORDLESS_TTL", 5*time.Minute)
+		PASSWORDLESS_LINK_URL = getEnv("PASSWORDLESS_LINK_URL", "http://localhost:3000/passwordless")
+
+		TOTP_SECRET_TABLE                = "TOTPSecrets"
+		RECOVERY_CODE_TABLE              = "RecoveryCodes"
+		MFA_ISSUER                       = getEnv("MFA_ISSUER", "UsafiHub")
+		MFA_CHALLENGE_TTL                = getEnvDuration("MFA_CHALLENGE_TTL", 5*time.Minute)
+		MFA_REQUIRED_FOR_ROLE_MANAGEMENT = getEnv("MFA_REQUIRED_FOR_ROLE_MANAGEMENT", "false") == "true"
+
+		SIGNING_KEY_TABLE           = "SigningKeys"
+		JWT_SIGNING_ALGORITHM       = getEnv("JWT_SIGNING_ALGORITHM", "RS256")
+		JWT_ACCEPT_LEGACY_HS256     = getEnv("JWT_ACCEPT_LEGACY_HS256", "false") == "true"
+		KEY_ROTATION_INTERVAL       = getEnvDuration("KEY_ROTATION_INTERVAL", 30*24*time.Hour)
+		KEY_ROTATION_OVERLAP        = getEnvDuration("KEY_ROTATION_OVERLAP", 24*time.Hour)
+		KEY_ROTATION_CHECK_INTERVAL = getEnvDuration("KEY_ROTATION_CHECK_INTERVAL", time.Hour)
+
+		OAUTH_CLIENT_TABLE       = "OAuthClients"
+		AUTHORIZATION_CODE_TABLE = "AuthorizationCodes"
+		OIDC_ISSUER              = getEnv("OIDC_ISSUER", "http://localhost:5000")
+		OIDC_LOGIN_URL           = getEnv("OIDC_LOGIN_URL", "http://localhost:3000/login")
+		AUTHORIZATION_CODE_TTL   = getEnvDuration("AUTHORIZATION_CODE_TTL", time.Minute)
+		ID_TOKEN_TTL             = getEnvDuration("ID_TOKEN_TTL", time.Hour)
+
+		SERVICE_ACCOUNT_TABLE = "ServiceAccounts"
+		API_KEY_TABLE         = "APIKeys"
+
+		AUTH_COOKIE_NAME = getEnv("AUTH_COOKIE_NAME", "")
+
+		SESSION_TABLE = "Sessions"
+
+		AUDIT_LOG_TABLE         = "AuditLog"
+		IMPERSONATION_TOKEN_TTL = getEnvDuration("IMPERSONATION_TOKEN_TTL", 10*time.Minute)
 	)
 
 	switch ENV {
@@ -62,6 +238,24 @@ func NewConfig(logger ports.LoggerService) (*Config, error) {
 		USER_TABLE = "Prod_Test_Users"
 		ROLE_TABLE = "Prod_Test_Roles"
 		USER_ROLE_TABLE = "Prod_Test_UserRoles"
+		PASSWORD_RESET_TABLE = "Prod_Test_PasswordResetTokens"
+		REFRESH_TOKEN_TABLE = "Prod_Test_RefreshTokens"
+		REVOKED_TOKEN_TABLE = "Prod_Test_RevokedTokens"
+		USER_REVOCATION_TABLE = "Prod_Test_UserTokenRevocations"
+		PERMISSION_TABLE = "Prod_Test_Permissions"
+		ROLE_PERMISSION_TABLE = "Prod_Test_RolePermissions"
+		SCHEMA_MIGRATION_TABLE = "Prod_Test_SchemaMigrations"
+		LOGIN_ATTEMPT_TABLE = "Prod_Test_LoginAttempts"
+		ONE_TIME_CODE_TABLE = "Prod_Test_OneTimeCodes"
+		TOTP_SECRET_TABLE = "Prod_Test_TOTPSecrets"
+		RECOVERY_CODE_TABLE = "Prod_Test_RecoveryCodes"
+		SIGNING_KEY_TABLE = "Prod_Test_SigningKeys"
+		OAUTH_CLIENT_TABLE = "Prod_Test_OAuthClients"
+		AUTHORIZATION_CODE_TABLE = "Prod_Test_AuthorizationCodes"
+		SERVICE_ACCOUNT_TABLE = "Prod_Test_ServiceAccounts"
+		API_KEY_TABLE = "Prod_Test_APIKeys"
+		SESSION_TABLE = "Prod_Test_Sessions"
+		AUDIT_LOG_TABLE = "Prod_Test_AuditLog"
 
 	case "development":
 		TEST = true
@@ -70,6 +264,24 @@ func NewConfig(logger ports.LoggerService) (*Config, error) {
 		USER_TABLE = "Dev_Users"
 		ROLE_TABLE = "Dev_Roles"
 		USER_ROLE_TABLE = "Dev_UserRoles"
+		PASSWORD_RESET_TABLE = "Dev_PasswordResetTokens"
+		REFRESH_TOKEN_TABLE = "Dev_RefreshTokens"
+		REVOKED_TOKEN_TABLE = "Dev_RevokedTokens"
+		USER_REVOCATION_TABLE = "Dev_UserTokenRevocations"
+		PERMISSION_TABLE = "Dev_Permissions"
+		ROLE_PERMISSION_TABLE = "Dev_RolePermissions"
+		SCHEMA_MIGRATION_TABLE = "Dev_SchemaMigrations"
+		LOGIN_ATTEMPT_TABLE = "Dev_LoginAttempts"
+		ONE_TIME_CODE_TABLE = "Dev_OneTimeCodes"
+		TOTP_SECRET_TABLE = "Dev_TOTPSecrets"
+		RECOVERY_CODE_TABLE = "Dev_RecoveryCodes"
+		SIGNING_KEY_TABLE = "Dev_SigningKeys"
+		OAUTH_CLIENT_TABLE = "Dev_OAuthClients"
+		AUTHORIZATION_CODE_TABLE = "Dev_AuthorizationCodes"
+		SERVICE_ACCOUNT_TABLE = "Dev_ServiceAccounts"
+		API_KEY_TABLE = "Dev_APIKeys"
+		SESSION_TABLE = "Dev_Sessions"
+		AUDIT_LOG_TABLE = "Dev_AuditLog"
 
 	case "development_test":
 		TEST = true
@@ -80,6 +292,24 @@ func NewConfig(logger ports.LoggerService) (*Config, error) {
 		USER_TABLE = "Test_Users"
 		ROLE_TABLE = "Test_Roles"
 		USER_ROLE_TABLE = "Test_UserRoles"
+		PASSWORD_RESET_TABLE = "Test_PasswordResetTokens"
+		REFRESH_TOKEN_TABLE = "Test_RefreshTokens"
+		REVOKED_TOKEN_TABLE = "Test_RevokedTokens"
+		USER_REVOCATION_TABLE = "Test_UserTokenRevocations"
+		PERMISSION_TABLE = "Test_Permissions"
+		ROLE_PERMISSION_TABLE = "Test_RolePermissions"
+		SCHEMA_MIGRATION_TABLE = "Test_SchemaMigrations"
+		LOGIN_ATTEMPT_TABLE = "Test_LoginAttempts"
+		ONE_TIME_CODE_TABLE = "Test_OneTimeCodes"
+		TOTP_SECRET_TABLE = "Test_TOTPSecrets"
+		RECOVERY_CODE_TABLE = "Test_RecoveryCodes"
+		SIGNING_KEY_TABLE = "Test_SigningKeys"
+		OAUTH_CLIENT_TABLE = "Test_OAuthClients"
+		AUTHORIZATION_CODE_TABLE = "Test_AuthorizationCodes"
+		SERVICE_ACCOUNT_TABLE = "Test_ServiceAccounts"
+		API_KEY_TABLE = "Test_APIKeys"
+		SESSION_TABLE = "Test_Sessions"
+		AUDIT_LOG_TABLE = "Test_AuditLog"
 
 	case "docker":
 		TEST = true
@@ -87,6 +317,24 @@ func NewConfig(logger ports.LoggerService) (*Config, error) {
 		USER_TABLE = "Docker_Users"
 		ROLE_TABLE = "Docker_Roles"
 		USER_ROLE_TABLE = "Docker_UserRoles"
+		PASSWORD_RESET_TABLE = "Docker_PasswordResetTokens"
+		REFRESH_TOKEN_TABLE = "Docker_RefreshTokens"
+		REVOKED_TOKEN_TABLE = "Docker_RevokedTokens"
+		USER_REVOCATION_TABLE = "Docker_UserTokenRevocations"
+		PERMISSION_TABLE = "Docker_Permissions"
+		ROLE_PERMISSION_TABLE = "Docker_RolePermissions"
+		SCHEMA_MIGRATION_TABLE = "Docker_SchemaMigrations"
+		LOGIN_ATTEMPT_TABLE = "Docker_LoginAttempts"
+		ONE_TIME_CODE_TABLE = "Docker_OneTimeCodes"
+		TOTP_SECRET_TABLE = "Docker_TOTPSecrets"
+		RECOVERY_CODE_TABLE = "Docker_RecoveryCodes"
+		SIGNING_KEY_TABLE = "Docker_SigningKeys"
+		OAUTH_CLIENT_TABLE = "Docker_OAuthClients"
+		AUTHORIZATION_CODE_TABLE = "Docker_AuthorizationCodes"
+		SERVICE_ACCOUNT_TABLE = "Docker_ServiceAccounts"
+		API_KEY_TABLE = "Docker_APIKeys"
+		SESSION_TABLE = "Docker_Sessions"
+		AUDIT_LOG_TABLE = "Docker_AuditLog"
 
 	case "docker_test":
 		TEST = true
@@ -94,6 +342,24 @@ func NewConfig(logger ports.LoggerService) (*Config, error) {
 		USER_TABLE = "Docker_Test_Users"
 		ROLE_TABLE = "Docker_Test_Roles"
 		USER_ROLE_TABLE = "Docker_Test_UserRoles"
+		PASSWORD_RESET_TABLE = "Docker_Test_PasswordResetTokens"
+		REFRESH_TOKEN_TABLE = "Docker_Test_RefreshTokens"
+		REVOKED_TOKEN_TABLE = "Docker_Test_RevokedTokens"
+		USER_REVOCATION_TABLE = "Docker_Test_UserTokenRevocations"
+		PERMISSION_TABLE = "Docker_Test_Permissions"
+		ROLE_PERMISSION_TABLE = "Docker_Test_RolePermissions"
+		SCHEMA_MIGRATION_TABLE = "Docker_Test_SchemaMigrations"
+		LOGIN_ATTEMPT_TABLE = "Docker_Test_LoginAttempts"
+		ONE_TIME_CODE_TABLE = "Docker_Test_OneTimeCodes"
+		TOTP_SECRET_TABLE = "Docker_Test_TOTPSecrets"
+		RECOVERY_CODE_TABLE = "Docker_Test_RecoveryCodes"
+		SIGNING_KEY_TABLE = "Docker_Test_SigningKeys"
+		OAUTH_CLIENT_TABLE = "Docker_Test_OAuthClients"
+		AUTHORIZATION_CODE_TABLE = "Docker_Test_AuthorizationCodes"
+		SERVICE_ACCOUNT_TABLE = "Docker_Test_ServiceAccounts"
+		API_KEY_TABLE = "Docker_Test_APIKeys"
+		SESSION_TABLE = "Docker_Test_Sessions"
+		AUDIT_LOG_TABLE = "Docker_Test_AuditLog"
 	}
 
 	config := Config{
@@ -110,7 +376,125 @@ func NewConfig(logger ports.LoggerService) (*Config, error) {
 		USER_ROLE_TABLE:   USER_ROLE_TABLE,
 		DEBUG:             DEBUG,
 		TEST:              TEST,
+
+		PASSWORD_RESET_TABLE: PASSWORD_RESET_TABLE,
+		PASSWORD_RESET_URL:   PASSWORD_RESET_URL,
+		PASSWORD_RESET_TTL:   PASSWORD_RESET_TTL,
+
+		REFRESH_TOKEN_TABLE: REFRESH_TOKEN_TABLE,
+		ACCESS_TOKEN_TTL:    ACCESS_TOKEN_TTL,
+		REFRESH_TOKEN_TTL:   REFRESH_TOKEN_TTL,
+
+		REVOKED_TOKEN_TABLE:   REVOKED_TOKEN_TABLE,
+		USER_REVOCATION_TABLE: USER_REVOCATION_TABLE,
+		REVOCATION_CACHE_TTL:  REVOCATION_CACHE_TTL,
+
+		PERMISSION_TABLE:      PERMISSION_TABLE,
+		ROLE_PERMISSION_TABLE: ROLE_PERMISSION_TABLE,
+
+		SCHEMA_MIGRATION_TABLE: SCHEMA_MIGRATION_TABLE,
+		AUTO_MIGRATE:           AUTO_MIGRATE,
+
+		DB_MAX_OPEN_CONNS:     DB_MAX_OPEN_CONNS,
+		DB_MAX_IDLE_CONNS:     DB_MAX_IDLE_CONNS,
+		DB_CONN_MAX_LIFETIME:  DB_CONN_MAX_LIFETIME,
+		DB_CONN_MAX_IDLE_TIME: DB_CONN_MAX_IDLE_TIME,
+		DB_STATEMENT_TIMEOUT:  DB_STATEMENT_TIMEOUT,
+
+		REQUEST_TIMEOUT: REQUEST_TIMEOUT,
+
+		PASSWORD_MIN_LENGTH:     PASSWORD_MIN_LENGTH,
+		PASSWORD_REQUIRE_UPPER:  PASSWORD_REQUIRE_UPPER,
+		PASSWORD_REQUIRE_LOWER:  PASSWORD_REQUIRE_LOWER,
+		PASSWORD_REQUIRE_DIGIT:  PASSWORD_REQUIRE_DIGIT,
+		PASSWORD_REQUIRE_SYMBOL: PASSWORD_REQUIRE_SYMBOL,
+		BREACHED_PASSWORDS_FILE: BREACHED_PASSWORDS_FILE,
+
+		LOGIN_ATTEMPT_TABLE:    LOGIN_ATTEMPT_TABLE,
+		LOGIN_MAX_FAILURES:     LOGIN_MAX_FAILURES,
+		LOGIN_IP_MAX_FAILURES:  LOGIN_IP_MAX_FAILURES,
+		LOGIN_FAILURE_WINDOW:   LOGIN_FAILURE_WINDOW,
+		LOGIN_BACKOFF_BASE:     LOGIN_BACKOFF_BASE,
+		LOGIN_BACKOFF_MAX:      LOGIN_BACKOFF_MAX,
+		LOGIN_LOCKOUT_DURATION: LOGIN_LOCKOUT_DURATION,
+
+		TRUSTED_PROXIES: TRUSTED_PROXIES,
+
+		EMAIL_VERIFICATION_URL:    EMAIL_VERIFICATION_URL,
+		EMAIL_VERIFICATION_TTL:    EMAIL_VERIFICATION_TTL,
+		EMAIL_VERIFICATION_POLICY: EMAIL_VERIFICATION_POLICY,
+
+		ONE_TIME_CODE_TABLE: ONE_TIME_CODE_TABLE,
+		OTP_LENGTH:          OTP_LENGTH,
+		OTP_TTL:             OTP_TTL,
+		OTP_MAX_ATTEMPTS:    OTP_MAX_ATTEMPTS,
+		OTP_RESEND_INTERVAL: OTP_RESEND_INTERVAL,
+		SMS_OUTBOX_FILE:     SMS_OUTBOX_FILE,
+
+		PASSWORDLESS_TTL:      PASSWORDLESS_TTL,
+		PASSWORDLESS_LINK_URL: PASSWORDLESS_LINK_URL,
+
+		TOTP_SECRET_TABLE:                TOTP_SECRET_TABLE,
+		RECOVERY_CODE_TABLE:              RECOVERY_CODE_TABLE,
+		MFA_ISSUER:                       MFA_ISSUER,
+		MFA_CHALLENGE_TTL:                MFA_CHALLENGE_TTL,
+		MFA_REQUIRED_FOR_ROLE_MANAGEMENT: MFA_REQUIRED_FOR_ROLE_MANAGEMENT,
+
+		SIGNING_KEY_TABLE:           SIGNING_KEY_TABLE,
+		JWT_SIGNING_ALGORITHM:       JWT_SIGNING_ALGORITHM,
+		JWT_ACCEPT_LEGACY_HS256:     JWT_ACCEPT_LEGACY_HS256,
+		KEY_ROTATION_INTERVAL:       KEY_ROTATION_INTERVAL,
+		KEY_ROTATION_OVERLAP:        KEY_ROTATION_OVERLAP,
+		KEY_ROTATION_CHECK_INTERVAL: KEY_ROTATION_CHECK_INTERVAL,
+
+		OAUTH_CLIENT_TABLE:       OAUTH_CLIENT_TABLE,
+		AUTHORIZATION_CODE_TABLE: AUTHORIZATION_CODE_TABLE,
+		OIDC_ISSUER:              OIDC_ISSUER,
+		OIDC_LOGIN_URL:           OIDC_LOGIN_URL,
+		AUTHORIZATION_CODE_TTL:   AUTHORIZATION_CODE_TTL,
+		ID_TOKEN_TTL:             ID_TOKEN_TTL,
+
+		SERVICE_ACCOUNT_TABLE: SERVICE_ACCOUNT_TABLE,
+		API_KEY_TABLE:         API_KEY_TABLE,
+
+		AUTH_COOKIE_NAME: AUTH_COOKIE_NAME,
+
+		SESSION_TABLE: SESSION_TABLE,
+
+		AUDIT_LOG_TABLE:         AUDIT_LOG_TABLE,
+		IMPERSONATION_TOKEN_TTL: IMPERSONATION_TOKEN_TTL,
 	}
 
 	return &config, nil
 }
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback
+	}
+	return number
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return fallback
+	}
+	return duration
+}
@@ -1,13 +1,23 @@
 package app
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
 	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
+// jwksMaxAge is how long clients may cache the JWKS. Keys are published well
+// before they start signing, so this only has to be short next to the
+// rotation overlap.
+const jwksMaxAge = 5 * time.Minute
+
 type GinHandler interface {
 	Home(ctx *gin.Context)
 	Healthcheck(ctx *gin.Context)
@@ -18,30 +28,95 @@ type GinHandler interface {
 	GetUserByEmail(ctx *gin.Context)
 	UpdateUser(ctx *gin.Context)
 	DeleteUser(ctx *gin.Context)
+	ChangePassword(ctx *gin.Context)
+	SetPassword(ctx *gin.Context)
+	UnlockUser(ctx *gin.Context)
 	CreateRole(ctx *gin.Context)
 	GetRoleById(ctx *gin.Context)
 	GetRoles(ctx *gin.Context)
 	UpdateRole(ctx *gin.Context)
 	DeleteRole(ctx *gin.Context)
+	CreatePermission(ctx *gin.Context)
+	GetPermissions(ctx *gin.Context)
+	GetRolePermissions(ctx *gin.Context)
+	GrantRolePermission(ctx *gin.Context)
+	RevokeRolePermission(ctx *gin.Context)
 	AddUserRole(ctx *gin.Context)
 	RemoveUserRole(ctx *gin.Context)
 	SignupUser(ctx *gin.Context)
 	LoginUser(ctx *gin.Context)
+	RequestPasswordlessLogin(ctx *gin.Context)
+	PasswordlessLogin(ctx *gin.Context)
+	RefreshToken(ctx *gin.Context)
+	Logout(ctx *gin.Context)
+	LogoutEverywhere(ctx *gin.Context)
+	GetSessions(ctx *gin.Context)
+	RevokeSession(ctx *gin.Context)
+	GetUserSessions(ctx *gin.Context)
+	RevokeUserSession(ctx *gin.Context)
+	Impersonate(ctx *gin.Context)
+	GetImpersonationAuditLog(ctx *gin.Context)
 	ForgotPassword(ctx *gin.Context)
+	ResetPassword(ctx *gin.Context)
+	VerifyEmail(ctx *gin.Context)
+	ResendVerificationEmail(ctx *gin.Context)
+	RequestPhoneVerification(ctx *gin.Context)
+	VerifyPhone(ctx *gin.Context)
+	VerifyMFA(ctx *gin.Context)
+	EnrollTOTP(ctx *gin.Context)
+	ConfirmTOTP(ctx *gin.Context)
+	DisableTOTP(ctx *gin.Context)
 	GenerateToken(ctx *gin.Context)
+	JWKS(ctx *gin.Context)
+	OpenIDConfiguration(ctx *gin.Context)
+	Authorize(ctx *gin.Context)
+	ApproveAuthorization(ctx *gin.Context)
+	Token(ctx *gin.Context)
+	UserInfo(ctx *gin.Context)
+	RegisterClient(ctx *gin.Context)
+	GetClients(ctx *gin.Context)
+	DeleteClient(ctx *gin.Context)
+	CreateServiceAccount(ctx *gin.Context)
+	GetServiceAccounts(ctx *gin.Context)
+	DeleteServiceAccount(ctx *gin.Context)
+	CreateAPIKey(ctx *gin.Context)
+	GetAPIKeys(ctx *gin.Context)
+	RevokeAPIKey(ctx *gin.Context)
 }
 
 type handler struct {
-	userService     ports.UserService
-	roleService     ports.RoleService
-	userRoleService ports.UserRoleService
+	userService              ports.UserService
+	roleService              ports.RoleService
+	userRoleService          ports.UserRoleService
+	passwordResetService     ports.PasswordResetService
+	emailVerificationService ports.EmailVerificationService
+	phoneVerificationService ports.PhoneVerificationService
+	passwordlessService      ports.PasswordlessService
+	mfaService               ports.MFAService
+	tokenService             ports.TokenService
+	keyRingService           ports.KeyRingService
+	oidcService              ports.OIDCService
+	apiKeyService            ports.APIKeyService
+	impersonationService     ports.ImpersonationService
+	policy                   accessPolicy
 }
 
-func NewGinHandler(userService ports.UserService, roleService ports.RoleService, userRoleService ports.UserRoleService) GinHandler {
+func NewGinHandler(userService ports.UserService, roleService ports.RoleService, userRoleService ports.UserRoleService, passwordResetService ports.PasswordResetService, emailVerificationService ports.EmailVerificationService, phoneVerificationService ports.PhoneVerificationService, passwordlessService ports.PasswordlessService, mfaService ports.MFAService, tokenService ports.TokenService, keyRingService ports.KeyRingService, oidcService ports.OIDCService, apiKeyService ports.APIKeyService, impersonationService ports.ImpersonationService, emailPolicy domain.EmailVerificationPolicy) GinHandler {
 	routerHandler := handler{
-		userService:     userService,
-		roleService:     roleService,
-		userRoleService: userRoleService,
+		userService:              userService,
+		roleService:              roleService,
+		userRoleService:          userRoleService,
+		passwordResetService:     passwordResetService,
+		emailVerificationService: emailVerificationService,
+		phoneVerificationService: phoneVerificationService,
+		passwordlessService:      passwordlessService,
+		mfaService:               mfaService,
+		tokenService:             tokenService,
+		keyRingService:           keyRingService,
+		oidcService:              oidcService,
+		apiKeyService:            apiKeyService,
+		impersonationService:     impersonationService,
+		policy:                   newAccessPolicy(roleService, userRoleService, emailPolicy),
 	}
 	return routerHandler
 }
@@ -61,8 +136,8 @@ func (h handler) Healthcheck(ctx *gin.Context) {
 }
 
 func (h handler) CreateUser(ctx *gin.Context) {
-	var user domain.User
-	if err := ctx.ShouldBindJSON(&user); err != nil {
+	var request signupRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"responseMessage": err.Error(),
 			"responseCode":    http.StatusBadRequest,
@@ -70,29 +145,24 @@ func (h handler) CreateUser(ctx *gin.Context) {
 		return
 	}
 
-	dbUser, err := h.userService.CreateUser(user)
+	dbUser, err := h.userService.CreateUser(ctx.Request.Context(), request.toDomain())
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"responseMessage": err.Error(),
-			"responseCode":    http.StatusInternalServerError,
-		})
+		respondWithError(ctx, err)
 		return
 	}
+	h.sendVerificationEmail(ctx, *dbUser)
 
 	ctx.JSON(http.StatusCreated, gin.H{
 		"responseMessage": "User created successfully",
 		"responseCode":    http.StatusCreated,
-		"data":            dbUser,
+		"data":            newUserResponse(*dbUser, h.userViewer(ctx)(*dbUser)),
 	})
 }
 
 func (h handler) GetUsers(ctx *gin.Context) {
-	users, err := h.userService.GetUsers()
+	users, err := h.userService.GetUsers(ctx.Request.Context())
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"responseMessage": err.Error(),
-			"responseCode":    http.StatusInternalServerError,
-		})
+		respondWithError(ctx, err)
 		return
 	}
 
@@ -100,47 +170,42 @@ func (h handler) GetUsers(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, gin.H{
 			"responseMessage": "No users found",
 			"responseCode":    http.StatusOK,
-			"response":        users,
+			"response":        []userResponse{},
 		})
 	} else {
-		ctx.JSON(http.StatusOK, users)
+		ctx.JSON(http.StatusOK, newUserResponses(users, h.userViewer(ctx)))
 	}
 }
 
 func (h handler) GetUsersWithRole(ctx *gin.Context) {
 	roleName := ctx.Param("role_name")
 
-	users, err := h.userService.GetUsersWithRole(roleName)
+	users, err := h.userService.GetUsersWithRole(ctx.Request.Context(), roleName)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"responseMessage": err.Error(),
-			"responseCode":    http.StatusInternalServerError,
-		})
+		respondWithError(ctx, err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, users)
+	ctx.JSON(http.StatusOK, newUserResponses(users, h.userViewer(ctx)))
 }
 
 func (h handler) GetUserById(ctx *gin.Context) {
 	userId := ctx.Param("user_id")
-	user, err := h.userService.GetUserById(userId)
+	user, err := h.userService.GetUserById(ctx.Request.Context(), userId)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"responseMessage": err.Error(),
-			"responseCode":    http.StatusInternalServerError,
-		})
+		respondWithError(ctx, err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, user)
+	ctx.JSON(http.StatusOK, newUserResponse(*user, h.userViewer(ctx)(*user)))
 }
 
 func (h handler) GetUserByEmail(ctx *gin.Context) {
 	var user struct {
 		Email string
 	}
-	if err := ctx.ShouldBindJSON(&user); err != nil {
+	// The route's guard has already read the body.
+	if err := ctx.ShouldBindBodyWith(&user, binding.JSON); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"responseMessage": err.Error(),
 			"responseCode":    http.StatusBadRequest,
@@ -148,57 +213,148 @@ func (h handler) GetUserByEmail(ctx *gin.Context) {
 		return
 	}
 
-	dbUser, err := h.userService.GetUserByEmail(user.Email)
+	dbUser, err := h.userService.GetUserByEmail(ctx.Request.Context(), user.Email)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"responseMessage": err.Error(),
-			"responseCode":    http.StatusInternalServerError,
-		})
+		respondWithError(ctx, err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, dbUser)
+	ctx.JSON(http.StatusOK, newUserResponse(*dbUser, privateView))
 }
 
+// UpdateUser applies a partial update. Holders of users:write may also change
+// the email address, except an admin's unless they are admins themselves;
+// users updating their own account may only edit their profile.
 func (h handler) UpdateUser(ctx *gin.Context) {
-	var user domain.User
-	if err := ctx.ShouldBindJSON(&user); err != nil {
+	claims, _ := CurrentClaims(ctx)
+	canWrite, err := h.policy.HasPermission(ctx.Request.Context(), claims, domain.PermissionUsersWrite)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	var request adminUpdateRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"responseMessage": err.Error(),
 			"responseCode":    http.StatusBadRequest,
 		})
 		return
 	}
+	if !canWrite && request.Email != nil {
+		respondWithError(ctx, domain.ErrPermissionDenied)
+		return
+	}
 
-	dbUser, err := h.userService.UpdateUser(user)
+	user, err := h.userService.GetUserById(ctx.Request.Context(), ctx.Param("user_id"))
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"responseMessage": err.Error(),
-			"responseCode":    http.StatusInternalServerError,
-		})
+		respondWithError(ctx, err)
+		return
+	}
+	if request.Email != nil && *request.Email != user.Email {
+		if err := h.userService.AuthorizeCredentialChange(ctx.Request.Context(), claims, user.UserId); err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+	}
+	previousEmail := user.Email
+	request.apply(user)
+
+	dbUser, err := h.userService.UpdateUser(ctx.Request.Context(), *user)
+	if err != nil {
+		respondWithError(ctx, err)
 		return
 	}
+	// Only a new address needs verifying; other edits leave it as it was.
+	if dbUser.Email != previousEmail {
+		h.sendVerificationEmail(ctx, *dbUser)
+	}
 
 	ctx.JSON(http.StatusOK, gin.H{
 		"responseMessage": "User updated successfully",
 		"responseCode":    http.StatusOK,
-		"data":            dbUser,
+		"data":            newUserResponse(*dbUser, privateView),
 	})
 }
 
 func (h handler) DeleteUser(ctx *gin.Context) {
-	userId := ctx.Param("userId")
-	err := h.userService.DeleteUser(userId)
+	userId := ctx.Param("user_id")
+	err := h.userService.DeleteUser(ctx.Request.Context(), userId)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "User deleted successfully",
+		"responseCode":    http.StatusOK,
+	})
+}
+
+// ChangePassword lets authenticated users change their own password.
+func (h handler) ChangePassword(ctx *gin.Context) {
+	userId := CurrentUserId(ctx)
+	if userId == "" {
+		respondWithError(ctx, domain.ErrUnauthenticated)
+		return
+	}
+
+	var request changePasswordRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"responseMessage": err.Error(),
+			"responseCode":    http.StatusBadRequest,
+		})
+		return
+	}
+
+	err := h.userService.ChangePassword(ctx.Request.Context(), userId, request.CurrentPassword, request.NewPassword)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "Password changed successfully, please log in again",
+		"responseCode":    http.StatusOK,
+	})
+}
+
+// SetPassword lets administrators replace any user's password. Only admins may
+// replace another admin's.
+func (h handler) SetPassword(ctx *gin.Context) {
+	claims, _ := CurrentClaims(ctx)
+	var request setPasswordRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
 			"responseMessage": err.Error(),
-			"responseCode":    http.StatusInternalServerError,
+			"responseCode":    http.StatusBadRequest,
 		})
 		return
 	}
 
+	err := h.userService.SetPassword(ctx.Request.Context(), claims, ctx.Param("user_id"), request.Password)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
 	ctx.JSON(http.StatusOK, gin.H{
-		"responseMessage": "User deleted successfully",
+		"responseMessage": "Password set successfully",
+		"responseCode":    http.StatusOK,
+	})
+}
+
+// UnlockUser lets administrators lift a lockout caused by failed logins.
+func (h handler) UnlockUser(ctx *gin.Context) {
+	err := h.userService.UnlockUser(ctx.Request.Context(), ctx.Param("user_id"))
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "User unlocked successfully",
 		"responseCode":    http.StatusOK,
 	})
 }
@@ -213,13 +369,10 @@ func (h handler) CreateRole(ctx *gin.Context) {
 		return
 	}
 
-	newRole, err := h.roleService.CreateRole(role)
+	newRole, err := h.roleService.CreateRole(ctx.Request.Context(), role)
 
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"responseMessage": err.Error(),
-			"responseCode":    http.StatusInternalServerError,
-		})
+		respondWithError(ctx, err)
 		return
 	}
 
@@ -232,20 +385,9 @@ func (h handler) CreateRole(ctx *gin.Context) {
 
 func (h handler) GetRoleById(ctx *gin.Context) {
 	roleID := ctx.Param("role_id")
-	role, err := h.roleService.GetRoleById(roleID)
+	role, err := h.roleService.GetRoleById(ctx.Request.Context(), roleID)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"responseMessage": err.Error(),
-			"responseCode":    http.StatusInternalServerError,
-		})
-		return
-	}
-
-	if role == nil {
-		ctx.JSON(http.StatusNotFound, gin.H{
-			"responseMessage": "Role not found",
-			"responseCode":    http.StatusNotFound,
-		})
+		respondWithError(ctx, err)
 		return
 	}
 
@@ -253,12 +395,9 @@ func (h handler) GetRoleById(ctx *gin.Context) {
 }
 
 func (h handler) GetRoles(ctx *gin.Context) {
-	roles, err := h.roleService.GetRoles()
+	roles, err := h.roleService.GetRoles(ctx.Request.Context())
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"responseMessage": err.Error(),
-			"responseCode":    http.StatusInternalServerError,
-		})
+		respondWithError(ctx, err)
 		return
 	}
 	if len(roles) == 0 {
@@ -285,11 +424,8 @@ func (h handler) UpdateRole(ctx *gin.Context) {
 	}
 
 	role.RoleId = roleID
-	if err := h.roleService.UpdateRole(role); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"responseMessage": err.Error(),
-			"responseCode":    http.StatusInternalServerError,
-		})
+	if err := h.roleService.UpdateRole(ctx.Request.Context(), role); err != nil {
+		respondWithError(ctx, err)
 		return
 	}
 
@@ -301,32 +437,96 @@ func (h handler) UpdateRole(ctx *gin.Context) {
 
 func (h handler) DeleteRole(ctx *gin.Context) {
 	roleID := ctx.Param("role_id")
-	role, err := h.roleService.GetRoleById(roleID)
-	if err != nil {
-		ctx.JSON(http.StatusNotFound, gin.H{
-			"responseMessage": err.Error(),
-			"responseCode":    http.StatusNotFound,
-		})
+	if err := h.roleService.DeleteRole(ctx.Request.Context(), roleID); err != nil {
+		respondWithError(ctx, err)
 		return
 	}
 
-	if role == nil {
-		ctx.JSON(http.StatusNotFound, gin.H{
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "Role deleted successfully",
+		"responseCode":    http.StatusOK,
+	})
+}
+
+func (h handler) CreatePermission(ctx *gin.Context) {
+	var permission domain.Permission
+	if err := ctx.ShouldBindJSON(&permission); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
 			"responseMessage": err.Error(),
-			"responseCode":    http.StatusNotFound,
+			"responseCode":    http.StatusBadRequest,
 		})
 		return
 	}
-	if err := h.roleService.DeleteRole(roleID); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
+
+	newPermission, err := h.roleService.CreatePermission(ctx.Request.Context(), permission)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"responseMessage": "Permission created successfully",
+		"responseCode":    http.StatusCreated,
+		"data":            newPermission,
+	})
+}
+
+func (h handler) GetPermissions(ctx *gin.Context) {
+	permissions, err := h.roleService.GetPermissions(ctx.Request.Context())
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, permissions)
+}
+
+func (h handler) GetRolePermissions(ctx *gin.Context) {
+	roleID := ctx.Param("role_id")
+	permissions, err := h.roleService.GetRolePermissions(ctx.Request.Context(), roleID)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, permissions)
+}
+
+func (h handler) GrantRolePermission(ctx *gin.Context) {
+	var rolePermission domain.RolePermission
+	if err := ctx.ShouldBindJSON(&rolePermission); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
 			"responseMessage": err.Error(),
-			"responseCode":    http.StatusInternalServerError,
+			"responseCode":    http.StatusBadRequest,
 		})
 		return
 	}
 
+	rolePermission.RoleId = ctx.Param("role_id")
+	if err := h.roleService.GrantPermission(ctx.Request.Context(), rolePermission); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"responseMessage": "Permission granted successfully",
+		"responseCode":    http.StatusCreated,
+	})
+}
+
+func (h handler) RevokeRolePermission(ctx *gin.Context) {
+	rolePermission := domain.RolePermission{
+		RoleId:       ctx.Param("role_id"),
+		PermissionId: ctx.Param("permission_id"),
+	}
+
+	if err := h.roleService.RevokePermission(ctx.Request.Context(), rolePermission); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
 	ctx.JSON(http.StatusOK, gin.H{
-		"responseMessage": "Role deleted successfully",
+		"responseMessage": "Permission revoked successfully",
 		"responseCode":    http.StatusOK,
 	})
 }
@@ -341,12 +541,9 @@ func (h handler) AddUserRole(ctx *gin.Context) {
 		return
 	}
 
-	err := h.userRoleService.AddUserRole(userRole)
+	err := h.userRoleService.AddUserRole(ctx.Request.Context(), userRole)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"responseMessage": err.Error(),
-			"responseCode":    http.StatusInternalServerError,
-		})
+		respondWithError(ctx, err)
 		return
 	}
 
@@ -357,21 +554,14 @@ func (h handler) AddUserRole(ctx *gin.Context) {
 }
 
 func (h handler) RemoveUserRole(ctx *gin.Context) {
-	var userRole domain.UserRole
-	if err := ctx.ShouldBindJSON(&userRole); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{
-			"responseMessage": err.Error(),
-			"responseCode":    http.StatusBadRequest,
-		})
-		return
+	userRole := domain.UserRole{
+		UserId: ctx.Param("user_id"),
+		RoleId: ctx.Param("role_id"),
 	}
 
-	err := h.userRoleService.RemoveUserRole(userRole)
+	err := h.userRoleService.RemoveUserRole(ctx.Request.Context(), userRole)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"responseMessage": err.Error(),
-			"responseCode":    http.StatusInternalServerError,
-		})
+		respondWithError(ctx, err)
 		return
 	}
 
@@ -382,8 +572,8 @@ func (h handler) RemoveUserRole(ctx *gin.Context) {
 }
 
 func (h handler) SignupUser(ctx *gin.Context) {
-	var user domain.User
-	if err := ctx.ShouldBindJSON(&user); err != nil {
+	var request signupRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"responseMessage": err.Error(),
 			"responseCode":    http.StatusBadRequest,
@@ -391,30 +581,25 @@ func (h handler) SignupUser(ctx *gin.Context) {
 		return
 	}
 
-	dbUser, err := h.userService.CreateUser(user)
+	dbUser, err := h.userService.CreateUser(ctx.Request.Context(), request.toDomain())
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"responseMessage": err.Error(),
-			"responseCode":    http.StatusInternalServerError,
-		})
+		respondWithError(ctx, err)
 		return
 	}
+	h.sendVerificationEmail(ctx, *dbUser)
 
 	ctx.JSON(http.StatusCreated, gin.H{
 		"responseMessage": "User created successfully",
 		"responseCode":    http.StatusCreated,
-		"data":            dbUser,
+		"data":            newUserResponse(*dbUser, privateView),
 	})
 }
 
+// LoginUser checks an email and password. Users with two-factor authentication
+// get an MFA challenge token to complete at VerifyMFA instead of tokens.
 func (h handler) LoginUser(ctx *gin.Context) {
-	type User struct {
-		Email        string `json:"email"`
-		PasswordHash string `json:"password"`
-	}
-	var user User
-
-	if err := ctx.ShouldBindJSON(&user); err != nil {
+	var request loginRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"responseMessage": err.Error(),
 			"responseCode":    http.StatusBadRequest,
@@ -422,30 +607,42 @@ func (h handler) LoginUser(ctx *gin.Context) {
 		return
 	}
 
-	token, err := h.userService.LoginUser(user.Email, user.PasswordHash)
+	result, err := h.userService.LoginUser(ctx.Request.Context(), request.toDomain(ctx))
 	if err != nil {
-		if err.Error() == "sql: no rows in result set" {
-			ctx.JSON(http.StatusUnauthorized, gin.H{
-				"responseMessage": "Invalid email or password",
-				"responseCode":    http.StatusUnauthorized,
-			})
-			return
-		}
-		ctx.JSON(http.StatusInternalServerError, gin.H{
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+// RequestPasswordlessLogin sends a login code or link to a verified email
+// address or phone number. The response is the same whether or not one was sent.
+func (h handler) RequestPasswordlessLogin(ctx *gin.Context) {
+	var request passwordlessRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
 			"responseMessage": err.Error(),
-			"responseCode":    http.StatusInternalServerError,
+			"responseCode":    http.StatusBadRequest,
 		})
 		return
 	}
 
+	if err := h.passwordlessService.RequestPasswordlessLogin(ctx.Request.Context(), request.toDomain()); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
 	ctx.JSON(http.StatusOK, gin.H{
-		"access_token": token,
+		"responseMessage": "If a verified account exists for this address, a login code has been sent",
+		"responseCode":    http.StatusOK,
 	})
 }
 
-func (h handler) ForgotPassword(ctx *gin.Context) {
-	var user domain.User
-	if err := ctx.ShouldBindJSON(&user); err != nil {
+// PasswordlessLogin exchanges a login code, or the code from a login link, for tokens.
+func (h handler) PasswordlessLogin(ctx *gin.Context) {
+	var request passwordlessVerifyRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"responseMessage": err.Error(),
 			"responseCode":    http.StatusBadRequest,
@@ -453,29 +650,20 @@ func (h handler) ForgotPassword(ctx *gin.Context) {
 		return
 	}
 
-	dbUser, err := h.userService.CreateUser(user)
+	result, err := h.passwordlessService.LoginWithCode(ctx.Request.Context(), request.toDomain(ctx))
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"responseMessage": err.Error(),
-			"responseCode":    http.StatusInternalServerError,
-		})
+		respondWithError(ctx, err)
 		return
 	}
 
-	ctx.JSON(http.StatusCreated, gin.H{
-		"responseMessage": "User created successfully",
-		"responseCode":    http.StatusCreated,
-		"data":            dbUser,
-	})
+	ctx.JSON(http.StatusOK, result)
 }
 
-func (h handler) GenerateToken(ctx *gin.Context) {
-	type User struct {
-		Email        string `json:"email"`
-		PasswordHash string `json:"password_hash"`
+func (h handler) RefreshToken(ctx *gin.Context) {
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
 	}
-	var user User
-	if err := ctx.ShouldBindJSON(&user); err != nil {
+	if err := ctx.ShouldBindJSON(&request); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"responseMessage": err.Error(),
 			"responseCode":    http.StatusBadRequest,
@@ -483,23 +671,789 @@ func (h handler) GenerateToken(ctx *gin.Context) {
 		return
 	}
 
-	token, err := h.userService.LoginUser(user.Email, user.PasswordHash)
+	tokens, err := h.tokenService.RefreshTokens(ctx.Request.Context(), request.RefreshToken, "")
 	if err != nil {
-		if err.Error() == "sql: no rows in result set" {
-			ctx.JSON(http.StatusUnauthorized, gin.H{
-				"responseMessage": "Invalid email or password",
-				"responseCode":    http.StatusUnauthorized,
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+func (h handler) Logout(ctx *gin.Context) {
+	claims, ok := CurrentClaims(ctx)
+	if !ok {
+		respondWithError(ctx, domain.ErrUnauthenticated)
+		return
+	}
+
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"responseMessage": err.Error(),
+				"responseCode":    http.StatusBadRequest,
 			})
 			return
 		}
-		ctx.JSON(http.StatusInternalServerError, gin.H{
+	}
+
+	if err := h.tokenService.Logout(ctx.Request.Context(), claims, request.RefreshToken); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "Logged out successfully",
+		"responseCode":    http.StatusOK,
+	})
+}
+
+func (h handler) LogoutEverywhere(ctx *gin.Context) {
+	userId := CurrentUserId(ctx)
+	if userId == "" {
+		respondWithError(ctx, domain.ErrUnauthenticated)
+		return
+	}
+
+	if err := h.tokenService.LogoutEverywhere(ctx.Request.Context(), userId); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "Logged out of all sessions successfully",
+		"responseCode":    http.StatusOK,
+	})
+}
+
+// GetSessions lists where the caller is logged in, marking the session of the
+// access token they called with.
+func (h handler) GetSessions(ctx *gin.Context) {
+	userId := CurrentUserId(ctx)
+	if userId == "" {
+		respondWithError(ctx, domain.ErrUnauthenticated)
+		return
+	}
+	h.respondWithSessions(ctx, userId)
+}
+
+// RevokeSession logs the caller out of one of their sessions.
+func (h handler) RevokeSession(ctx *gin.Context) {
+	userId := CurrentUserId(ctx)
+	if userId == "" {
+		respondWithError(ctx, domain.ErrUnauthenticated)
+		return
+	}
+	h.revokeSession(ctx, userId)
+}
+
+// GetUserSessions lists where a user is logged in, for admins.
+func (h handler) GetUserSessions(ctx *gin.Context) {
+	h.respondWithSessions(ctx, ctx.Param("user_id"))
+}
+
+// RevokeUserSession logs a user out of one of their sessions, for admins.
+func (h handler) RevokeUserSession(ctx *gin.Context) {
+	h.revokeSession(ctx, ctx.Param("user_id"))
+}
+
+func (h handler) respondWithSessions(ctx *gin.Context, userId string) {
+	sessions, err := h.tokenService.GetSessions(ctx.Request.Context(), userId)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	claims, _ := CurrentClaims(ctx)
+	for _, session := range sessions {
+		session.Current = session.SessionId == claims.SessionId
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "Sessions retrieved successfully",
+		"responseCode":    http.StatusOK,
+		"data":            sessions,
+	})
+}
+
+func (h handler) revokeSession(ctx *gin.Context, userId string) {
+	if err := h.tokenService.RevokeSession(ctx.Request.Context(), userId, ctx.Param("session_id")); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "Session revoked successfully",
+		"responseCode":    http.StatusOK,
+	})
+}
+
+// Impersonate issues the caller a short-lived access token for a user, for
+// support staff reproducing what the user sees. The token cannot be refreshed,
+// and every request made with it is audited.
+func (h handler) Impersonate(ctx *gin.Context) {
+	claims, ok := CurrentClaims(ctx)
+	if !ok {
+		respondWithError(ctx, domain.ErrUnauthenticated)
+		return
+	}
+
+	var request impersonationRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
 			"responseMessage": err.Error(),
-			"responseCode":    http.StatusInternalServerError,
+			"responseCode":    http.StatusBadRequest,
 		})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{
-		"token": token,
+	tokens, err := h.impersonationService.Impersonate(ctx.Request.Context(), claims, ctx.Param("user_id"), request.Reason, requestDevice(ctx))
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"responseMessage": "Impersonation token issued successfully",
+		"responseCode":    http.StatusCreated,
+		"data":            tokens,
 	})
 }
+
+// GetImpersonationAuditLog lists impersonations and the requests made during
+// them, newest first, optionally filtered by actor_id and user_id.
+func (h handler) GetImpersonationAuditLog(ctx *gin.Context) {
+	var request auditLogRequest
+	if err := ctx.ShouldBindQuery(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"responseMessage": err.Error(),
+			"responseCode":    http.StatusBadRequest,
+		})
+		return
+	}
+
+	entries, err := h.impersonationService.GetAuditLog(ctx.Request.Context(), request.toDomain())
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "Audit log retrieved successfully",
+		"responseCode":    http.StatusOK,
+		"data":            entries,
+	})
+}
+
+func (h handler) ForgotPassword(ctx *gin.Context) {
+	var request struct {
+		Email string `json:"email"`
+	}
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"responseMessage": err.Error(),
+			"responseCode":    http.StatusBadRequest,
+		})
+		return
+	}
+
+	if err := h.passwordResetService.RequestPasswordReset(ctx.Request.Context(), request.Email); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "If an account exists for this email, a password reset link has been sent",
+		"responseCode":    http.StatusOK,
+	})
+}
+
+func (h handler) ResetPassword(ctx *gin.Context) {
+	var request struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"responseMessage": err.Error(),
+			"responseCode":    http.StatusBadRequest,
+		})
+		return
+	}
+
+	err := h.passwordResetService.ResetPassword(ctx.Request.Context(), request.Token, request.Password)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "Password reset successfully",
+		"responseCode":    http.StatusOK,
+	})
+}
+
+// VerifyEmail marks the email a verification link was sent to as verified.
+func (h handler) VerifyEmail(ctx *gin.Context) {
+	var request struct {
+		Token string `json:"token"`
+	}
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"responseMessage": err.Error(),
+			"responseCode":    http.StatusBadRequest,
+		})
+		return
+	}
+
+	dbUser, err := h.emailVerificationService.VerifyEmail(ctx.Request.Context(), request.Token)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "Email verified successfully",
+		"responseCode":    http.StatusOK,
+		"data":            newUserResponse(*dbUser, privateView),
+	})
+}
+
+func (h handler) ResendVerificationEmail(ctx *gin.Context) {
+	var request struct {
+		Email string `json:"email"`
+	}
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"responseMessage": err.Error(),
+			"responseCode":    http.StatusBadRequest,
+		})
+		return
+	}
+
+	if err := h.emailVerificationService.ResendVerificationEmail(ctx.Request.Context(), request.Email); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "If an unverified account exists for this email, a verification link has been sent",
+		"responseCode":    http.StatusOK,
+	})
+}
+
+// RequestPhoneVerification texts the caller a code to verify their phone number.
+func (h handler) RequestPhoneVerification(ctx *gin.Context) {
+	userId := CurrentUserId(ctx)
+	if userId == "" {
+		respondWithError(ctx, domain.ErrUnauthenticated)
+		return
+	}
+
+	if err := h.phoneVerificationService.RequestPhoneVerification(ctx.Request.Context(), userId); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "A verification code has been sent to your phone number",
+		"responseCode":    http.StatusOK,
+	})
+}
+
+func (h handler) VerifyPhone(ctx *gin.Context) {
+	userId := CurrentUserId(ctx)
+	if userId == "" {
+		respondWithError(ctx, domain.ErrUnauthenticated)
+		return
+	}
+
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"responseMessage": err.Error(),
+			"responseCode":    http.StatusBadRequest,
+		})
+		return
+	}
+
+	dbUser, err := h.phoneVerificationService.VerifyPhone(ctx.Request.Context(), userId, request.Code)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "Phone number verified successfully",
+		"responseCode":    http.StatusOK,
+		"data":            newUserResponse(*dbUser, privateView),
+	})
+}
+
+// VerifyMFA completes a login that returned an MFA challenge, exchanging the
+// challenge token and a TOTP or recovery code for tokens.
+func (h handler) VerifyMFA(ctx *gin.Context) {
+	var request struct {
+		MFAToken string `json:"mfa_token"`
+		Code     string `json:"code"`
+	}
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"responseMessage": err.Error(),
+			"responseCode":    http.StatusBadRequest,
+		})
+		return
+	}
+
+	tokens, err := h.mfaService.CompleteLogin(ctx.Request.Context(), request.MFAToken, request.Code, requestDevice(ctx))
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+// EnrollTOTP starts two-factor enrolment for the caller, returning the secret
+// and otpauth:// URI to show as a QR code.
+func (h handler) EnrollTOTP(ctx *gin.Context) {
+	userId := CurrentUserId(ctx)
+	if userId == "" {
+		respondWithError(ctx, domain.ErrUnauthenticated)
+		return
+	}
+
+	enrollment, err := h.mfaService.EnrollTOTP(ctx.Request.Context(), userId)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "Scan the QR code with your authenticator app and confirm with a code",
+		"responseCode":    http.StatusOK,
+		"data":            enrollment,
+	})
+}
+
+// ConfirmTOTP enables two-factor authentication for the caller and returns
+// their recovery codes.
+func (h handler) ConfirmTOTP(ctx *gin.Context) {
+	userId := CurrentUserId(ctx)
+	if userId == "" {
+		respondWithError(ctx, domain.ErrUnauthenticated)
+		return
+	}
+
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"responseMessage": err.Error(),
+			"responseCode":    http.StatusBadRequest,
+		})
+		return
+	}
+
+	recoveryCodes, err := h.mfaService.ConfirmTOTP(ctx.Request.Context(), userId, request.Code, requestDevice(ctx))
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "Two-factor authentication enabled. Store these recovery codes somewhere safe",
+		"responseCode":    http.StatusOK,
+		"data": gin.H{
+			"recovery_codes": recoveryCodes,
+		},
+	})
+}
+
+// DisableTOTP turns two-factor authentication off for the caller, given a
+// current TOTP code or an unused recovery code.
+func (h handler) DisableTOTP(ctx *gin.Context) {
+	userId := CurrentUserId(ctx)
+	if userId == "" {
+		respondWithError(ctx, domain.ErrUnauthenticated)
+		return
+	}
+
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"responseMessage": err.Error(),
+			"responseCode":    http.StatusBadRequest,
+		})
+		return
+	}
+
+	if err := h.mfaService.DisableTOTP(ctx.Request.Context(), userId, request.Code, requestDevice(ctx)); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "Two-factor authentication disabled",
+		"responseCode":    http.StatusOK,
+	})
+}
+
+func (h handler) GenerateToken(ctx *gin.Context) {
+	var request loginRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"responseMessage": err.Error(),
+			"responseCode":    http.StatusBadRequest,
+		})
+		return
+	}
+
+	result, err := h.userService.LoginUser(ctx.Request.Context(), request.toDomain(ctx))
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	if result.MFARequired {
+		ctx.JSON(http.StatusOK, result)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"token": result.AccessToken,
+	})
+}
+
+// JWKS publishes the public keys access tokens are signed with, so that other
+// services can verify them without sharing a secret.
+func (h handler) JWKS(ctx *gin.Context) {
+	keys, err := h.keyRingService.JWKS(ctx.Request.Context())
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(jwksMaxAge.Seconds())))
+	ctx.JSON(http.StatusOK, keys)
+}
+
+// OpenIDConfiguration publishes the OpenID Connect discovery document.
+func (h handler) OpenIDConfiguration(ctx *gin.Context) {
+	ctx.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(jwksMaxAge.Seconds())))
+	ctx.JSON(http.StatusOK, h.oidcService.Discovery())
+}
+
+// Authorize starts the authorization code flow. Valid requests are sent on to
+// the login page; invalid ones are returned to the client's redirect_uri,
+// unless the client or redirect_uri itself is unknown, in which case the user
+// agent is not redirected at all.
+func (h handler) Authorize(ctx *gin.Context) {
+	var request authorizationRequest
+	if err := ctx.ShouldBindQuery(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"responseMessage": err.Error(),
+			"responseCode":    http.StatusBadRequest,
+		})
+		return
+	}
+
+	_, err := h.oidcService.ValidateAuthorizationRequest(ctx.Request.Context(), request.toDomain())
+	var domainErr *domain.Error
+	if err != nil && errors.As(err, &domainErr) && !errors.Is(err, domain.ErrOAuthClientNotFound) && !errors.Is(err, domain.ErrInvalidRedirectURI) {
+		// The redirect_uri is registered for the client, so it parses.
+		redirectURI, _ := url.Parse(request.RedirectURI)
+		query := redirectURI.Query()
+		query.Set("error", domainErr.Code)
+		query.Set("error_description", domainErr.Message)
+		if request.State != "" {
+			query.Set("state", request.State)
+		}
+		redirectURI.RawQuery = query.Encode()
+		ctx.Redirect(http.StatusFound, redirectURI.String())
+		return
+	}
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.Redirect(http.StatusFound, h.oidcService.LoginRedirect(request.toDomain()))
+}
+
+// ApproveAuthorization is called by the login page with the authorization
+// parameters once the user has logged in, and returns the client redirect_uri
+// carrying the authorization code.
+func (h handler) ApproveAuthorization(ctx *gin.Context) {
+	claims, ok := CurrentClaims(ctx)
+	if !ok {
+		respondWithError(ctx, domain.ErrUnauthenticated)
+		return
+	}
+
+	var request authorizationRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"responseMessage": err.Error(),
+			"responseCode":    http.StatusBadRequest,
+		})
+		return
+	}
+
+	redirectURI, err := h.oidcService.Authorize(ctx.Request.Context(), claims, request.toDomain())
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "Authorization granted",
+		"responseCode":    http.StatusOK,
+		"data": gin.H{
+			"redirect_uri": redirectURI,
+		},
+	})
+}
+
+// Token is the OAuth 2.0 token endpoint. Requests are form-encoded and
+// responses follow RFC 6749 rather than this API's usual envelope.
+func (h handler) Token(ctx *gin.Context) {
+	var request tokenRequest
+	if err := ctx.ShouldBind(&request); err != nil {
+		respondWithOAuthError(ctx, domain.ErrOAuthInvalidRequest)
+		return
+	}
+
+	tokens, err := h.oidcService.ExchangeToken(ctx.Request.Context(), request.toDomain(ctx))
+	if err != nil {
+		respondWithOAuthError(ctx, err)
+		return
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Header("Pragma", "no-cache")
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+// UserInfo returns the OpenID Connect claims about the caller that their
+// access token's scope releases.
+func (h handler) UserInfo(ctx *gin.Context) {
+	claims, ok := CurrentClaims(ctx)
+	if !ok {
+		respondWithError(ctx, domain.ErrUnauthenticated)
+		return
+	}
+
+	userInfo, err := h.oidcService.UserInfo(ctx.Request.Context(), claims)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, userInfo)
+}
+
+// RegisterClient registers an OAuth client. The secret of a confidential
+// client is only ever returned here.
+func (h handler) RegisterClient(ctx *gin.Context) {
+	var request clientRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"responseMessage": err.Error(),
+			"responseCode":    http.StatusBadRequest,
+		})
+		return
+	}
+
+	client, secret, err := h.oidcService.RegisterClient(ctx.Request.Context(), request.toDomain(), request.Confidential)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	data := gin.H{"client": client}
+	if secret != "" {
+		data["client_secret"] = secret
+	}
+	ctx.JSON(http.StatusCreated, gin.H{
+		"responseMessage": "Client registered successfully",
+		"responseCode":    http.StatusCreated,
+		"data":            data,
+	})
+}
+
+func (h handler) GetClients(ctx *gin.Context) {
+	clients, err := h.oidcService.GetClients(ctx.Request.Context())
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "Clients retrieved successfully",
+		"responseCode":    http.StatusOK,
+		"data":            clients,
+	})
+}
+
+func (h handler) DeleteClient(ctx *gin.Context) {
+	if err := h.oidcService.DeleteClient(ctx.Request.Context(), ctx.Param("client_id")); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "Client deleted successfully",
+		"responseCode":    http.StatusOK,
+	})
+}
+
+func (h handler) CreateServiceAccount(ctx *gin.Context) {
+	var request serviceAccountRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"responseMessage": err.Error(),
+			"responseCode":    http.StatusBadRequest,
+		})
+		return
+	}
+
+	account, err := h.apiKeyService.CreateServiceAccount(ctx.Request.Context(), request.toDomain())
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"responseMessage": "Service account created successfully",
+		"responseCode":    http.StatusCreated,
+		"data":            account,
+	})
+}
+
+func (h handler) GetServiceAccounts(ctx *gin.Context) {
+	accounts, err := h.apiKeyService.GetServiceAccounts(ctx.Request.Context())
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "Service accounts retrieved successfully",
+		"responseCode":    http.StatusOK,
+		"data":            accounts,
+	})
+}
+
+func (h handler) DeleteServiceAccount(ctx *gin.Context) {
+	if err := h.apiKeyService.DeleteServiceAccount(ctx.Request.Context(), ctx.Param("service_account_id")); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "Service account deleted successfully",
+		"responseCode":    http.StatusOK,
+	})
+}
+
+// CreateAPIKey issues an API key for a service account. Callers may only
+// grant permissions they hold themselves, and the key is only ever returned here.
+func (h handler) CreateAPIKey(ctx *gin.Context) {
+	claims, ok := CurrentClaims(ctx)
+	if !ok {
+		respondWithError(ctx, domain.ErrUnauthenticated)
+		return
+	}
+
+	var request apiKeyRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"responseMessage": err.Error(),
+			"responseCode":    http.StatusBadRequest,
+		})
+		return
+	}
+	for _, scope := range request.Scopes {
+		allowed, err := h.policy.HasPermission(ctx.Request.Context(), claims, scope)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		if !allowed {
+			respondWithError(ctx, domain.ErrPermissionDenied)
+			return
+		}
+	}
+
+	key, apiKey, err := h.apiKeyService.CreateAPIKey(ctx.Request.Context(), ctx.Param("service_account_id"), request.Scopes, request.ExpiresAt)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"responseMessage": "API key created. Store it somewhere safe, it will not be shown again",
+		"responseCode":    http.StatusCreated,
+		"data": gin.H{
+			"key":     key,
+			"api_key": apiKey,
+		},
+	})
+}
+
+func (h handler) GetAPIKeys(ctx *gin.Context) {
+	keys, err := h.apiKeyService.GetAPIKeys(ctx.Request.Context(), ctx.Param("service_account_id"))
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "API keys retrieved successfully",
+		"responseCode":    http.StatusOK,
+		"data":            keys,
+	})
+}
+
+func (h handler) RevokeAPIKey(ctx *gin.Context) {
+	if err := h.apiKeyService.RevokeAPIKey(ctx.Request.Context(), ctx.Param("service_account_id"), ctx.Param("key_id")); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "API key revoked successfully",
+		"responseCode":    http.StatusOK,
+	})
+}
+
+// sendVerificationEmail sends a verification link for the user's email unless
+// it is already verified. The account change that prompted it has already
+// succeeded, so failures are only logged and the user can ask for a new link.
+func (h handler) sendVerificationEmail(ctx *gin.Context, user domain.User) {
+	_ = h.emailVerificationService.SendVerificationEmail(ctx.Request.Context(), user)
+}
+
+// userViewer returns how much of a user the caller may see: everything for
+// their own account or when they hold users:read, and the public profile otherwise.
+func (h handler) userViewer(ctx *gin.Context) func(user domain.User) userView {
+	claims, ok := CurrentClaims(ctx)
+	canRead := false
+	if ok {
+		allowed, err := h.policy.HasPermission(ctx.Request.Context(), claims, domain.PermissionUsersRead)
+		canRead = err == nil && allowed
+	}
+	return func(user domain.User) userView {
+		if canRead || (ok && claims.UserId == user.UserId) {
+			return privateView
+		}
+		return publicView
+	}
+}
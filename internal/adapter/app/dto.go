@@ -0,0 +1,305 @@
+package app
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// Request and response bodies for the user endpoints. Handlers never bind to
+// or serialize domain.User directly, so the domain type can change without
+// changing the API and secrets such as the password hash never leave the service.
+
+type signupRequest struct {
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	Email       string `json:"email"`
+	FullName    string `json:"fullname"`
+	PhoneNumber string `json:"phone_number"`
+	Avatar      string `json:"avatar"`
+	Address     string `json:"address"`
+}
+
+func (r signupRequest) toDomain() domain.User {
+	return domain.User{
+		Username:     r.Username,
+		PasswordHash: r.Password,
+		Email:        r.Email,
+		FullName:     r.FullName,
+		PhoneNumber:  r.PhoneNumber,
+		Avatar:       r.Avatar,
+		Address:      r.Address,
+	}
+}
+
+type loginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// toDomain adds the client details used to throttle failed logins.
+func (r loginRequest) toDomain(ctx *gin.Context) domain.LoginRequest {
+	return domain.LoginRequest{
+		Email:     r.Email,
+		Password:  r.Password,
+		IPAddress: ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+	}
+}
+
+// requestDevice describes the client that sent the request.
+func requestDevice(ctx *gin.Context) domain.Device {
+	return domain.Device{
+		IPAddress: ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+	}
+}
+
+type passwordlessRequest struct {
+	Email       string `json:"email"`
+	PhoneNumber string `json:"phone_number"`
+	Method      string `json:"method"`
+}
+
+// toDomain sends a code unless a link was asked for.
+func (r passwordlessRequest) toDomain() domain.PasswordlessRequest {
+	method := r.Method
+	if method == "" {
+		method = domain.PasswordlessCode
+	}
+	return domain.PasswordlessRequest{
+		Email:       r.Email,
+		PhoneNumber: r.PhoneNumber,
+		Method:      method,
+	}
+}
+
+type passwordlessVerifyRequest struct {
+	Email       string `json:"email"`
+	PhoneNumber string `json:"phone_number"`
+	Code        string `json:"code"`
+}
+
+func (r passwordlessVerifyRequest) toDomain(ctx *gin.Context) domain.PasswordlessLogin {
+	return domain.PasswordlessLogin{
+		Email:       r.Email,
+		PhoneNumber: r.PhoneNumber,
+		Code:        r.Code,
+		IPAddress:   ctx.ClientIP(),
+		UserAgent:   ctx.Request.UserAgent(),
+	}
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type setPasswordRequest struct {
+	Password string `json:"password"`
+}
+
+// profileUpdateRequest holds the fields users may change on their own account.
+// Omitted fields are left unchanged.
+type profileUpdateRequest struct {
+	Username    *string `json:"username"`
+	FullName    *string `json:"fullname"`
+	PhoneNumber *string `json:"phone_number"`
+	Avatar      *string `json:"avatar"`
+	Address     *string `json:"address"`
+}
+
+func (r profileUpdateRequest) apply(user *domain.User) {
+	setIfPresent(&user.Username, r.Username)
+	setIfPresent(&user.FullName, r.FullName)
+	setIfPresent(&user.PhoneNumber, r.PhoneNumber)
+	setIfPresent(&user.Avatar, r.Avatar)
+	setIfPresent(&user.Address, r.Address)
+}
+
+// adminUpdateRequest holds the fields holders of users:write may change on any account.
+type adminUpdateRequest struct {
+	profileUpdateRequest
+	Email *string `json:"email"`
+}
+
+func (r adminUpdateRequest) apply(user *domain.User) {
+	r.profileUpdateRequest.apply(user)
+	setIfPresent(&user.Email, r.Email)
+}
+
+func setIfPresent(field *string, value *string) {
+	if value != nil {
+		*field = *value
+	}
+}
+
+// userView controls which user fields a caller may see.
+type userView int
+
+const (
+	// publicView exposes only what identifies a user to other users.
+	publicView userView = iota
+	// privateView adds contact details and is shown to the user themselves
+	// and to callers holding users:read.
+	privateView
+)
+
+type userResponse struct {
+	UserId          string     `json:"user_id"`
+	Username        string     `json:"username"`
+	FullName        string     `json:"fullname"`
+	Avatar          string     `json:"avatar"`
+	Email           string     `json:"email,omitempty"`
+	PhoneNumber     string     `json:"phone_number,omitempty"`
+	Address         string     `json:"address,omitempty"`
+	CreatedAt       *time.Time `json:"created_at,omitempty"`
+	UpdatedAt       *time.Time `json:"updated_at,omitempty"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	PhoneVerifiedAt *time.Time `json:"phone_verified_at,omitempty"`
+	MFAEnabledAt    *time.Time `json:"mfa_enabled_at,omitempty"`
+}
+
+func newUserResponse(user domain.User, view userView) userResponse {
+	response := userResponse{
+		UserId:   user.UserId,
+		Username: user.Username,
+		FullName: user.FullName,
+		Avatar:   user.Avatar,
+	}
+	if view == privateView {
+		response.Email = user.Email
+		response.PhoneNumber = user.PhoneNumber
+		response.Address = user.Address
+		response.CreatedAt = &user.CreatedAt
+		response.UpdatedAt = &user.UpdatedAt
+		response.EmailVerifiedAt = user.EmailVerifiedAt
+		response.PhoneVerifiedAt = user.PhoneVerifiedAt
+		response.MFAEnabledAt = user.MFAEnabledAt
+	}
+	return response
+}
+
+func newUserResponses(users []*domain.User, view func(user domain.User) userView) []userResponse {
+	responses := []userResponse{}
+	for _, user := range users {
+		responses = append(responses, newUserResponse(*user, view(*user)))
+	}
+	return responses
+}
+
+// authorizationRequest holds the OAuth 2.0 authorization parameters, read from
+// the query string by the authorize endpoint and posted back as JSON by the
+// login page once the user has logged in.
+type authorizationRequest struct {
+	ResponseType        string `form:"response_type" json:"response_type"`
+	ClientId            string `form:"client_id" json:"client_id"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	Nonce               string `form:"nonce" json:"nonce"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+}
+
+func (r authorizationRequest) toDomain() domain.AuthorizationRequest {
+	return domain.AuthorizationRequest{
+		ResponseType:        r.ResponseType,
+		ClientId:            r.ClientId,
+		RedirectURI:         r.RedirectURI,
+		Scope:               r.Scope,
+		State:               r.State,
+		Nonce:               r.Nonce,
+		CodeChallenge:       r.CodeChallenge,
+		CodeChallengeMethod: r.CodeChallengeMethod,
+	}
+}
+
+// tokenRequest holds the form-encoded parameters of the OAuth 2.0 token endpoint.
+type tokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	ClientId     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+}
+
+// toDomain reads client credentials from HTTP Basic authentication when they
+// are present (client_secret_basic) and from the form otherwise
+// (client_secret_post). The client details describe the session the tokens start.
+func (r tokenRequest) toDomain(ctx *gin.Context) domain.TokenRequest {
+	clientId, clientSecret := r.ClientId, r.ClientSecret
+	if username, password, ok := ctx.Request.BasicAuth(); ok {
+		clientId, _ = url.QueryUnescape(username)
+		clientSecret, _ = url.QueryUnescape(password)
+	}
+	return domain.TokenRequest{
+		GrantType:    r.GrantType,
+		Code:         r.Code,
+		RedirectURI:  r.RedirectURI,
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		CodeVerifier: r.CodeVerifier,
+		RefreshToken: r.RefreshToken,
+		IPAddress:    ctx.ClientIP(),
+		UserAgent:    ctx.Request.UserAgent(),
+	}
+}
+
+type clientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	Confidential bool     `json:"confidential"`
+}
+
+func (r clientRequest) toDomain() domain.OAuthClient {
+	return domain.OAuthClient{
+		Name:         r.Name,
+		RedirectURIs: r.RedirectURIs,
+		Scopes:       r.Scopes,
+	}
+}
+
+type serviceAccountRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+func (r serviceAccountRequest) toDomain() domain.ServiceAccount {
+	return domain.ServiceAccount{
+		Name:        r.Name,
+		Description: r.Description,
+	}
+}
+
+// apiKeyRequest asks for an API key granting the listed permissions. Keys
+// without expires_at do not expire.
+type apiKeyRequest struct {
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// impersonationRequest says why an admin needs to act as a user. The reason
+// is kept in the audit log.
+type impersonationRequest struct {
+	Reason string `json:"reason"`
+}
+
+type auditLogRequest struct {
+	ActorId string `form:"actor_id"`
+	UserId  string `form:"user_id"`
+	Limit   int    `form:"limit"`
+}
+
+func (r auditLogRequest) toDomain() domain.AuditFilter {
+	return domain.AuditFilter{
+		ActorId: r.ActorId,
+		UserId:  r.UserId,
+		Limit:   r.Limit,
+	}
+}
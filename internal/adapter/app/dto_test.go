@@ -0,0 +1,74 @@
+package app
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+)
+
+func TestUserResponse(t *testing.T) {
+	user := domain.User{
+		UserId:       "1",
+		Username:     "john_doe",
+		PasswordHash: "$2a$10$secret",
+		Email:        "john.doe@example.com",
+		FullName:     "John Doe",
+		PhoneNumber:  "1234567890",
+		Avatar:       "avatar_url",
+		Address:      "123 Main St",
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	t.Run("Test private view never includes the password hash", func(t *testing.T) {
+		body, err := json.Marshal(newUserResponse(user, privateView))
+		if err != nil {
+			t.Fatalf("failed to marshal user: %v", err)
+		}
+		if strings.Contains(string(body), user.PasswordHash) {
+			t.Errorf("expected password hash to be omitted, got %s", body)
+		}
+		if !strings.Contains(string(body), user.Email) {
+			t.Errorf("expected email to be included, got %s", body)
+		}
+	})
+
+	t.Run("Test public view omits contact details", func(t *testing.T) {
+		body, err := json.Marshal(newUserResponse(user, publicView))
+		if err != nil {
+			t.Fatalf("failed to marshal user: %v", err)
+		}
+		for _, value := range []string{user.PasswordHash, user.Email, user.PhoneNumber, user.Address} {
+			if strings.Contains(string(body), value) {
+				t.Errorf("expected %q to be omitted, got %s", value, body)
+			}
+		}
+	})
+
+	t.Run("Test domain user never serializes the password hash", func(t *testing.T) {
+		body, err := json.Marshal(user)
+		if err != nil {
+			t.Fatalf("failed to marshal user: %v", err)
+		}
+		if strings.Contains(string(body), user.PasswordHash) {
+			t.Errorf("expected password hash to be omitted, got %s", body)
+		}
+	})
+}
+
+func TestAdminUpdateRequest(t *testing.T) {
+	t.Run("Test omitted fields are left unchanged", func(t *testing.T) {
+		user := domain.User{Username: "john_doe", Email: "john.doe@example.com", FullName: "John Doe"}
+		var request adminUpdateRequest
+		if err := json.Unmarshal([]byte(`{"fullname":"Johnny Doe","email":"johnny@example.com"}`), &request); err != nil {
+			t.Fatalf("failed to unmarshal request: %v", err)
+		}
+		request.apply(&user)
+		if user.FullName != "Johnny Doe" || user.Email != "johnny@example.com" || user.Username != "john_doe" {
+			t.Errorf("unexpected user after update: %+v", user)
+		}
+	})
+}
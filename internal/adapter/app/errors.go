@@ -0,0 +1,87 @@
+package app
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// errorStatuses maps each kind of domain error onto an HTTP status and the
+// error code used when the error carries no more specific one.
+var errorStatuses = []struct {
+	kind   error
+	status int
+	code   string
+}{
+	{domain.ErrNotFound, http.StatusNotFound, "not_found"},
+	{domain.ErrAlreadyExists, http.StatusConflict, "already_exists"},
+	{domain.ErrConflict, http.StatusConflict, "conflict"},
+	{domain.ErrInvalidCredentials, http.StatusUnauthorized, "invalid_credentials"},
+	{domain.ErrValidation, http.StatusUnprocessableEntity, "validation_failed"},
+	{domain.ErrForbidden, http.StatusForbidden, "forbidden"},
+	{domain.ErrTooManyRequests, http.StatusTooManyRequests, "too_many_requests"},
+}
+
+// respondWithError writes err as a JSON error response and aborts the request.
+// Errors that are not domain errors are reported as internal errors without
+// exposing their details to the client.
+func respondWithError(ctx *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	code := "internal_error"
+	message := "An internal error occurred"
+
+	for _, mapping := range errorStatuses {
+		if errors.Is(err, mapping.kind) {
+			status = mapping.status
+			code = mapping.code
+			message = err.Error()
+			break
+		}
+	}
+	response := gin.H{}
+	var domainErr *domain.Error
+	if status != http.StatusInternalServerError && errors.As(err, &domainErr) {
+		code = domainErr.Code
+		message = domainErr.Message
+		if len(domainErr.Violations) > 0 {
+			response["violations"] = domainErr.Violations
+		}
+		if domainErr.RetryAfter > 0 {
+			seconds := int(math.Ceil(domainErr.RetryAfter.Seconds()))
+			ctx.Header("Retry-After", strconv.Itoa(seconds))
+		}
+	}
+
+	response["responseMessage"] = message
+	response["responseCode"] = status
+	response["errorCode"] = code
+	ctx.AbortWithStatusJSON(status, response)
+}
+
+// respondWithOAuthError writes err in the error format of RFC 6749 used by
+// the token endpoint. Failed client authentication is reported with 401 and
+// every other domain error with 400.
+func respondWithOAuthError(ctx *gin.Context, err error) {
+	var domainErr *domain.Error
+	if !errors.As(err, &domainErr) {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":             "server_error",
+			"error_description": "An internal error occurred",
+		})
+		return
+	}
+
+	status := http.StatusBadRequest
+	if errors.Is(err, domain.ErrOAuthInvalidClient) {
+		status = http.StatusUnauthorized
+		ctx.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	ctx.AbortWithStatusJSON(status, gin.H{
+		"error":             domainErr.Code,
+		"error_description": domainErr.Message,
+	})
+}
@@ -3,77 +3,75 @@ package app
 import (
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/AntonyIS/usafi-hub-user-service/config"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
 	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
-func InitGinRoutes(userService ports.UserService, roleService ports.RoleService, userRoleService ports.UserRoleService, config config.Config, logger ports.LoggerService) {
+func InitGinRoutes(userService ports.UserService, roleService ports.RoleService, userRoleService ports.UserRoleService, passwordResetService ports.PasswordResetService, emailVerificationService ports.EmailVerificationService, phoneVerificationService ports.PhoneVerificationService, passwordlessService ports.PasswordlessService, mfaService ports.MFAService, tokenService ports.TokenService, keyRingService ports.KeyRingService, oidcService ports.OIDCService, apiKeyService ports.APIKeyService, impersonationService ports.ImpersonationService, config config.Config, logger ports.LoggerService) {
 	gin.SetMode(gin.DebugMode)
 
 	router := gin.Default()
+	// Client addresses are used to throttle logins, so X-Forwarded-For is only
+	// trusted when the request comes through one of the configured proxies.
+	if err := router.SetTrustedProxies(splitList(config.TRUSTED_PROXIES)); err != nil {
+		logger.Error(fmt.Sprintf("Invalid trusted proxies %q: %v", config.TRUSTED_PROXIES, err))
+		log.Fatal(err)
+	}
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", apiKeyHeader},
+		ExposeHeaders:    []string{"Content-Length", "WWW-Authenticate"},
 		AllowCredentials: true,
 	}))
 
+	emailPolicy := domain.EmailVerificationPolicy(config.EMAIL_VERIFICATION_POLICY)
+	middleware := NewMiddleware(userService, tokenService, apiKeyService, impersonationService, roleService, userRoleService, emailPolicy, config.AUTH_COOKIE_NAME, logger)
+	router.Use(middleware.RequestTimeout(config.REQUEST_TIMEOUT))
+
 	handler := NewGinHandler(
 		userService,
 		roleService,
 		userRoleService,
+		passwordResetService,
+		emailVerificationService,
+		phoneVerificationService,
+		passwordlessService,
+		mfaService,
+		tokenService,
+		keyRingService,
+		oidcService,
+		apiKeyService,
+		impersonationService,
+		emailPolicy,
 	)
 
-	homeRoutes := router.Group("/")
-	userRoutes := router.Group("/users/v1")
-	roleRoutes := router.Group("/roles/v1")
-	userRoleRoutes := router.Group("/user_roles/v1")
-	authRoutes := router.Group("/auth/v1")
-
-	middleware := NewMiddleware(userService, logger, config.SECRET_KEY)
-
-	homeRoutes.Use(middleware.AuthorizeToken)
-	userRoutes.Use(middleware.AuthorizeToken)
-	roleRoutes.Use(middleware.AuthorizeToken)
-	userRoleRoutes.Use(middleware.AuthorizeToken)
-
-	{
-		homeRoutes.GET("/", handler.Home)
-		homeRoutes.GET("/health-check", handler.Healthcheck)
-	}
-
-	{
-		userRoutes.POST("/", handler.CreateUser)
-		userRoutes.POST("/get", handler.GetUserByEmail)
-		userRoutes.GET("/:user_id", handler.GetUserById)
-		userRoutes.GET("/", handler.GetUsers)
-		userRoutes.GET("/roles/:role_name", handler.GetUsersWithRole)
-		userRoutes.PUT(":user_id", handler.UpdateUser)
-		userRoutes.DELETE("/:user_id", handler.DeleteUser)
+	routes := withRouteListing(apiRoutes(handler))
+	if err := checkRoutes(routes); err != nil {
+		logger.Error(fmt.Sprintf("Invalid routes: %v", err))
+		log.Fatal(err)
 	}
-	{
-		roleRoutes.POST("/", handler.CreateRole)
-		roleRoutes.GET("/:role_id", handler.GetRoleById)
-		roleRoutes.GET("/", handler.GetRoles)
-		roleRoutes.PUT(":role_id", handler.UpdateRole)
-		roleRoutes.DELETE("/:role_id", handler.DeleteRole)
-	}
-
-	{
-		userRoleRoutes.POST("/", handler.AddUserRole)
-		userRoleRoutes.GET("/:user_role_id", handler.RemoveUserRole)
-	}
-
-	{
-		authRoutes.POST("/signup", handler.SignupUser)
-		authRoutes.POST("/login", handler.LoginUser)
-		authRoutes.POST("/forgot-password", handler.ForgotPassword)
+	if err := registerRoutes(router, routes, middleware, config.MFA_REQUIRED_FOR_ROLE_MANAGEMENT); err != nil {
+		logger.Error(fmt.Sprintf("Invalid routes: %v", err))
+		log.Fatal(err)
 	}
 	log.Printf("Server running on port 0.0.0.0:%s", config.SERVER_PORT)
 	logger.Info(fmt.Sprintf("Server running on port 0.0.0.0:%s", config.SERVER_PORT))
 	router.Run(fmt.Sprintf(":%s", config.SERVER_PORT))
 }
+
+// splitList parses a comma-separated setting, ignoring blank entries.
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -1,99 +1,425 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
 	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
+	"github.com/gin-gonic/gin/binding"
 )
 
+const claimsContextKey = "claims"
+
+// apiKeyHeader carries an API key for callers that do not send it as a
+// bearer token.
+const apiKeyHeader = "X-API-Key"
+
+// bearerRealm is the realm named in WWW-Authenticate challenges.
+const bearerRealm = "usafi-hub"
+
+// bearerTokenPattern is the b64token syntax of RFC 6750, section 2.1.
+var bearerTokenPattern = regexp.MustCompile(`^[A-Za-z0-9\-._~+/]+=*$`)
+
 type middleware struct {
-	svc       ports.UserService
-	logger    ports.LoggerService
-	secretKey string
+	svc           ports.UserService
+	tokenService  ports.TokenService
+	apiKeyService ports.APIKeyService
+	impersonation ports.ImpersonationService
+	policy        accessPolicy
+	cookieName    string
+	logger        ports.LoggerService
 }
 
-func NewMiddleware(svc ports.UserService, logger ports.LoggerService, secretKey string) *middleware {
+func NewMiddleware(svc ports.UserService, tokenService ports.TokenService, apiKeyService ports.APIKeyService, impersonationService ports.ImpersonationService, roleService ports.RoleService, userRoleService ports.UserRoleService, emailPolicy domain.EmailVerificationPolicy, cookieName string, logger ports.LoggerService) *middleware {
 	return &middleware{
-		svc:       svc,
-		logger:    logger,
-		secretKey: secretKey,
+		svc:           svc,
+		tokenService:  tokenService,
+		apiKeyService: apiKeyService,
+		impersonation: impersonationService,
+		policy:        newAccessPolicy(roleService, userRoleService, emailPolicy),
+		cookieName:    cookieName,
+		logger:        logger,
 	}
 }
 
-func (m middleware) GenerateToken(userId string) (string, error) {
-	user, err := m.svc.GetUserById(userId)
+func (m middleware) GenerateToken(ctx context.Context, userId string) (string, error) {
+	user, err := m.svc.GetUserById(ctx, userId)
 	if err != nil {
 		m.logger.Error(fmt.Sprintf("Failed to get user : %v", err))
 		return "", err
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":    user.UserId,
-		"email": user.Email,
-		"exp":   time.Now().Add(time.Hour * 72).Unix(),
-	})
 
-	tokenString, err := token.SignedString(m.secretKey)
+	tokens, err := m.tokenService.IssueTokens(ctx, *user, domain.Authentication{})
 	if err != nil {
 		m.logger.Error(fmt.Sprintf("Failed to token string : %v", err))
 		return "", err
 	}
 
-	return tokenString, nil
+	return tokens.AccessToken, nil
 }
 
-func (m middleware) AuthorizeToken(ctx *gin.Context) {
-	tokenString := ctx.GetHeader("access_token")
+// RequestTimeout bounds how long a request may spend in the service. The
+// deadline is attached to the request context, so database calls made on its
+// behalf are cancelled once it passes or the client disconnects.
+func (m middleware) RequestTimeout(timeout time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		requestCtx, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
+		defer cancel()
+
+		ctx.Request = ctx.Request.WithContext(requestCtx)
+		ctx.Next()
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			m.logger.Error(fmt.Sprintf("unexpected signing method: %v", token.Header["sub"]))
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["sub"])
+		if errors.Is(requestCtx.Err(), context.DeadlineExceeded) {
+			m.logger.Warning(fmt.Sprintf("Request %s %s exceeded timeout of %s", ctx.Request.Method, ctx.Request.URL.Path, timeout))
+			if !ctx.Writer.Written() {
+				ctx.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{
+					"responseCode":    http.StatusGatewayTimeout,
+					"responseMessage": "Request timed out",
+				})
+			}
 		}
-		return []byte(m.secretKey), nil
+	}
+}
+
+// AuthorizeToken authenticates users by an RFC 6750 bearer token, sent in the
+// Authorization header or, for browser clients, in the configured cookie. The
+// verified claims are available to later handlers through CurrentClaims.
+// Tokens issued to OAuth clients carry a scope and are refused, since they
+// only grant what the user consented to; see AuthorizeClientToken.
+func (m middleware) AuthorizeToken(ctx *gin.Context) {
+	m.authorizeToken(ctx, false)
+}
+
+// AuthorizeClientToken is AuthorizeToken for the routes OAuth clients may call
+// with the scoped tokens issued to them, such as userinfo.
+func (m middleware) AuthorizeClientToken(ctx *gin.Context) {
+	m.authorizeToken(ctx, true)
+}
+
+func (m middleware) authorizeToken(ctx *gin.Context, allowScoped bool) {
+	tokenString, err := m.bearerToken(ctx)
+	if err != nil {
+		m.challenge(ctx, err)
+		return
+	}
+
+	claims, err := m.tokenService.ValidateAccessToken(ctx.Request.Context(), tokenString)
+	if err != nil {
+		m.logger.Error(fmt.Sprintf("Failed to verify token string : %v", err))
+		m.challenge(ctx, err)
+		return
+	}
+	if claims.Scope != "" && !allowScoped {
+		m.abortForbidden(ctx, *claims, "")
+		return
+	}
+
+	ctx.Set(claimsContextKey, *claims)
+	if claims.Impersonated() {
+		m.auditImpersonation(ctx, *claims)
+		return
+	}
+	ctx.Next()
+}
+
+// auditImpersonation serves a request made with an impersonation token,
+// recording it in the audit log first and its response status afterwards.
+// Requests that cannot be recorded are refused.
+func (m middleware) auditImpersonation(ctx *gin.Context, claims domain.Claims) {
+	entry, err := m.impersonation.RecordRequest(ctx.Request.Context(), domain.AuditEntry{
+		ActorId:   claims.Actor,
+		UserId:    claims.UserId,
+		TokenId:   claims.TokenId,
+		Method:    ctx.Request.Method,
+		Path:      ctx.Request.URL.Path,
+		IPAddress: ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
 	})
+	if err != nil {
+		m.logger.Error(fmt.Sprintf("Failed to audit request by %s acting as %s : %v", claims.Actor, claims.UserId, err))
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.Next()
+
+	if err := m.impersonation.CompleteRequest(ctx.Request.Context(), entry.AuditId, ctx.Writer.Status()); err != nil {
+		m.logger.Warning(fmt.Sprintf("Failed to record the outcome of audited request %s : %v", entry.AuditId, err))
+	}
+}
 
+// AuthorizeTokenOrAPIKey is AuthorizeToken for routes that other services may
+// also call with an API key, sent as a bearer token or in the X-API-Key header.
+func (m middleware) AuthorizeTokenOrAPIKey(ctx *gin.Context) {
+	apiKey := ctx.GetHeader(apiKeyHeader)
+	if token, err := parseAuthorization(ctx.GetHeader("Authorization")); err == nil && strings.HasPrefix(token, domain.APIKeyPrefix) {
+		apiKey = token
+	}
+	if apiKey == "" {
+		m.AuthorizeToken(ctx)
+		return
+	}
+
+	claims, err := m.apiKeyService.ValidateAPIKey(ctx.Request.Context(), apiKey)
 	if err != nil {
-		if err != nil {
-			m.logger.Error(fmt.Sprintf("Failed to verify token string : %v", err))
-			ctx.JSON(http.StatusUnauthorized, gin.H{
-				"responseCode":    http.StatusUnauthorized,
-				"responseMessage": "Failed to verify token string",
-			})
-			ctx.Abort()
+		m.logger.Error(fmt.Sprintf("Failed to verify api key : %v", err))
+		m.challenge(ctx, err)
+		return
+	}
+
+	ctx.Set(claimsContextKey, *claims)
+	ctx.Next()
+}
+
+// RequireRoles only lets the request through when the authenticated user holds every listed role.
+// Like permissions, roles are looked up on every request rather than read from the access token.
+// It must be registered after AuthorizeToken.
+func (m middleware) RequireRoles(roles ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		claims, ok := CurrentClaims(ctx)
+		if !ok {
+			m.abortUnauthorized(ctx)
 			return
 		}
+		m.authorize(ctx, claims, "", func() (bool, error) {
+			return m.policy.HasRoles(ctx.Request.Context(), claims, roles...)
+		})
+	}
+}
 
-		ctx.JSON(http.StatusUnauthorized, gin.H{
-			"responseCode":    http.StatusUnauthorized,
-			"responseMessage": "request not authorized",
+// RequireAnyRole only lets the request through when the authenticated user holds at least one
+// listed role. Like RequireRoles, it looks the roles up on every request. It must be registered
+// after AuthorizeToken.
+func (m middleware) RequireAnyRole(roles ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		claims, ok := CurrentClaims(ctx)
+		if !ok {
+			m.abortUnauthorized(ctx)
+			return
+		}
+		m.authorize(ctx, claims, "", func() (bool, error) {
+			return m.policy.HasAnyRole(ctx.Request.Context(), claims, roles...)
 		})
-		ctx.Abort()
-		return
 	}
+}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		if float64(time.Now().Unix()) > claims["exp"].(float64) {
-			ctx.JSON(http.StatusUnauthorized, gin.H{
-				"responseCode":    http.StatusUnauthorized,
-				"responseMessage": "Failed to verify token string",
-			})
-			ctx.Abort()
+// RequirePermission only lets the request through when one of the authenticated user's roles
+// grants the permission. Roles and permissions are resolved on every request so grants and
+// revocations take effect immediately. It must be registered after AuthorizeToken.
+func (m middleware) RequirePermission(permission string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		claims, ok := CurrentClaims(ctx)
+		if !ok {
+			m.abortUnauthorized(ctx)
 			return
 		}
-		ctx.Next()
-	} else {
-		m.logger.Error("request not authorized")
+		m.authorize(ctx, claims, permission, func() (bool, error) {
+			return m.policy.HasPermission(ctx.Request.Context(), claims, permission)
+		})
+	}
+}
 
-		ctx.JSON(http.StatusUnauthorized, gin.H{
-			"responseCode":    http.StatusUnauthorized,
-			"responseMessage": "Failed to verify token string",
+// RequireSelfOrPermission lets users act on their own account, identified by the
+// named path parameter, and otherwise requires the permission. It must be
+// registered after AuthorizeToken.
+func (m middleware) RequireSelfOrPermission(param, permission string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		claims, ok := CurrentClaims(ctx)
+		if !ok {
+			m.abortUnauthorized(ctx)
+			return
+		}
+		m.authorize(ctx, claims, permission, func() (bool, error) {
+			return m.policy.CanAccessUser(ctx.Request.Context(), claims, ctx.Param(param), permission)
+		})
+	}
+}
+
+// RequireSelfEmailOrPermission is RequireSelfOrPermission for routes that
+// identify the account by the email field of the JSON request body. The body
+// is kept for the handler, which must read it with ShouldBindBodyWith. It must
+// be registered after AuthorizeToken.
+func (m middleware) RequireSelfEmailOrPermission(permission string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		claims, ok := CurrentClaims(ctx)
+		if !ok {
+			m.abortUnauthorized(ctx)
+			return
+		}
+		var body struct {
+			Email string `json:"email"`
+		}
+		// A body that does not parse names nobody, and the handler reports it.
+		_ = ctx.ShouldBindBodyWith(&body, binding.JSON)
+		m.authorize(ctx, claims, permission, func() (bool, error) {
+			return m.policy.CanAccessEmail(ctx.Request.Context(), claims, body.Email, permission)
 		})
-		ctx.Abort()
+	}
+}
+
+// RequireMFA only lets the request through when the access token belongs to a
+// session started with a second factor. It must be registered after
+// AuthorizeToken.
+func (m middleware) RequireMFA(ctx *gin.Context) {
+	claims, ok := CurrentClaims(ctx)
+	if !ok {
+		m.abortUnauthorized(ctx)
+		return
+	}
+	if !claims.MFA {
+		m.logger.Warning(fmt.Sprintf("user %s needs two-factor authentication to access %s %s", claims.UserId, ctx.Request.Method, ctx.FullPath()))
+		respondWithError(ctx, domain.ErrMFARequired)
+		return
+	}
+	ctx.Next()
+}
+
+// RejectImpersonation refuses requests made with an impersonation token, for
+// what only users themselves may do, such as changing their credentials. It
+// must be registered after AuthorizeToken.
+func (m middleware) RejectImpersonation(ctx *gin.Context) {
+	claims, ok := CurrentClaims(ctx)
+	if !ok {
+		m.abortUnauthorized(ctx)
+		return
+	}
+	if claims.Impersonated() {
+		m.logger.Warning(fmt.Sprintf("%s acting as %s may not access %s %s", claims.Actor, claims.UserId, ctx.Request.Method, ctx.FullPath()))
+		respondWithError(ctx, domain.ErrImpersonationForbidden)
+		return
+	}
+	ctx.Next()
+}
+
+func (m middleware) authorize(ctx *gin.Context, claims domain.Claims, permission string, check func() (bool, error)) {
+	allowed, err := check()
+	if err != nil {
+		m.logger.Error(fmt.Sprintf("Failed to resolve permissions for user %s: %v", claims.UserId, err))
+		respondWithError(ctx, err)
+		return
+	}
+	if !allowed {
+		m.abortForbidden(ctx, claims, permission)
+		return
+	}
+	ctx.Next()
+}
+
+func (m middleware) abortUnauthorized(ctx *gin.Context) {
+	m.logger.Error("request not authorized")
+	m.challenge(ctx, domain.ErrUnauthenticated)
+}
+
+// abortForbidden rejects an authenticated caller with an insufficient_scope
+// challenge, naming the permission they lack when there is one.
+func (m middleware) abortForbidden(ctx *gin.Context, claims domain.Claims, permission string) {
+	m.logger.Warning(fmt.Sprintf("user %s is not permitted to access %s %s", claims.UserId, ctx.Request.Method, ctx.FullPath()))
+	params := []string{fmt.Sprintf("realm=%q", bearerRealm), `error="insufficient_scope"`}
+	if permission != "" {
+		params = append(params, fmt.Sprintf("scope=%q", permission))
+	}
+	ctx.Header("WWW-Authenticate", "Bearer "+strings.Join(params, ", "))
+	respondWithError(ctx, domain.ErrPermissionDenied)
+}
 
+// challenge rejects a request that failed authentication with the
+// WWW-Authenticate challenge of RFC 6750, section 3: no error code when it
+// carried no token, invalid_request when the token was malformed and
+// invalid_token when the token did not verify. Other errors are internal
+// failures and are reported without a challenge.
+func (m middleware) challenge(ctx *gin.Context, err error) {
+	params := []string{fmt.Sprintf("realm=%q", bearerRealm)}
+	switch {
+	case errors.Is(err, domain.ErrMalformedBearerToken):
+		params = append(params, `error="invalid_request"`)
+		ctx.Header("WWW-Authenticate", "Bearer "+strings.Join(params, ", "))
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"responseMessage": domain.ErrMalformedBearerToken.Message,
+			"responseCode":    http.StatusBadRequest,
+			"errorCode":       domain.ErrMalformedBearerToken.Code,
+		})
+		return
+	case errors.Is(err, domain.ErrUnauthenticated):
+	case errors.Is(err, domain.ErrInvalidCredentials):
+		params = append(params, `error="invalid_token"`)
+		var domainErr *domain.Error
+		if errors.As(err, &domainErr) {
+			params = append(params, fmt.Sprintf("error_description=%q", domainErr.Message))
+		}
+	default:
+		respondWithError(ctx, err)
 		return
 	}
+	ctx.Header("WWW-Authenticate", "Bearer "+strings.Join(params, ", "))
+	respondWithError(ctx, err)
+}
+
+// bearerToken returns the bearer token of the request. The Authorization
+// header takes precedence over the cookie, which is only read when configured.
+func (m middleware) bearerToken(ctx *gin.Context) (string, error) {
+	if header := ctx.GetHeader("Authorization"); header != "" {
+		return parseAuthorization(header)
+	}
+	if m.cookieName != "" {
+		if token, err := ctx.Cookie(m.cookieName); err == nil && token != "" {
+			if !bearerTokenPattern.MatchString(token) {
+				return "", domain.ErrMalformedBearerToken
+			}
+			return token, nil
+		}
+	}
+	return "", domain.ErrUnauthenticated
+}
+
+// parseAuthorization returns the token of an "Authorization: Bearer <token>"
+// header. Headers using another scheme carry no bearer token.
+func parseAuthorization(header string) (string, error) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", domain.ErrUnauthenticated
+	}
+	token = strings.TrimLeft(token, " ")
+	if !ok || !bearerTokenPattern.MatchString(token) {
+		return "", domain.ErrMalformedBearerToken
+	}
+	return token, nil
+}
+
+// CurrentClaims returns the verified claims of the caller, set by
+// AuthorizeToken or AuthorizeTokenOrAPIKey. It reports false on routes that
+// do not authenticate callers.
+func CurrentClaims(ctx *gin.Context) (domain.Claims, bool) {
+	value, ok := ctx.Get(claimsContextKey)
+	if !ok {
+		return domain.Claims{}, false
+	}
+	claims, ok := value.(domain.Claims)
+	return claims, ok
+}
+
+// CurrentUserId returns the ID of the authenticated user, or of the service
+// account for API keys, and "" when the caller is not authenticated.
+func CurrentUserId(ctx *gin.Context) string {
+	claims, _ := CurrentClaims(ctx)
+	return claims.UserId
+}
+
+// CurrentEmail returns the email address of the authenticated user, or "".
+func CurrentEmail(ctx *gin.Context) string {
+	claims, _ := CurrentClaims(ctx)
+	return claims.Email
+}
+
+// CurrentRoles returns the roles of the authenticated user when the access
+// token was issued.
+func CurrentRoles(ctx *gin.Context) []string {
+	claims, _ := CurrentClaims(ctx)
+	return claims.Roles
 }
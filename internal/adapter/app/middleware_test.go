@@ -0,0 +1,250 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/logger"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// stubTokenService accepts the access token "valid", "impersonated" as issued
+// to an admin acting as the same user, "oidc" as issued to an OAuth client of
+// an admin, "admin" for an admin and "demoted" for a user whose token still
+// names the Admin role they no longer hold, and nothing else. Use
+// stubAdminRoles for the roles they currently hold.
+type stubTokenService struct {
+	ports.TokenService
+}
+
+func (stubTokenService) ValidateAccessToken(ctx context.Context, accessToken string) (*domain.Claims, error) {
+	switch accessToken {
+	case "valid":
+		return &domain.Claims{UserId: "user", Email: "jane@example.com", Roles: []string{"Cleaner"}}, nil
+	case "impersonated":
+		return &domain.Claims{UserId: "user", Email: "jane@example.com", Roles: []string{"Cleaner"}, Actor: "admin", TokenId: "token"}, nil
+	case "admin":
+		return &domain.Claims{UserId: "admin", Email: "admin@example.com", Roles: []string{domain.RoleAdmin}}, nil
+	case "demoted":
+		return &domain.Claims{UserId: "demoted", Email: "demoted@example.com", Roles: []string{domain.RoleAdmin}}, nil
+	case "oidc":
+		return &domain.Claims{UserId: "admin", Email: "admin@example.com", Roles: []string{domain.RoleAdmin}, Scope: "openid email"}, nil
+	}
+	return nil, domain.ErrInvalidAccessToken
+}
+
+// stubAdminRoles makes "admin" the only admin.
+var stubAdminRoles = stubRoleStore{roles: map[string][]string{"admin": {domain.RoleAdmin}}}
+
+// stubImpersonationService keeps audit entries in memory, or fails to record
+// them when unavailable is set.
+type stubImpersonationService struct {
+	ports.ImpersonationService
+	entries     map[string]*domain.AuditEntry
+	unavailable bool
+}
+
+func (s *stubImpersonationService) RecordRequest(ctx context.Context, entry domain.AuditEntry) (*domain.AuditEntry, error) {
+	if s.unavailable {
+		return nil, errors.New("audit log unavailable")
+	}
+	entry.AuditId = fmt.Sprint(len(s.entries) + 1)
+	s.entries[entry.AuditId] = &entry
+	return &entry, nil
+}
+
+func (s *stubImpersonationService) CompleteRequest(ctx context.Context, auditId string, status int) error {
+	s.entries[auditId].Status = status
+	return nil
+}
+
+func TestAuthorizeToken(t *testing.T) {
+	logger, err := logger.NewDefaultLogger()
+	if err != nil {
+		panic(err)
+	}
+	gin.SetMode(gin.TestMode)
+	middleware := NewMiddleware(nil, stubTokenService{}, nil, nil, stubAdminRoles, stubAdminRoles, domain.EmailVerificationOptional, "session", logger)
+
+	router := gin.New()
+	router.GET("/me", middleware.AuthorizeToken, func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, CurrentUserId(ctx)+" "+CurrentEmail(ctx)+" "+strings.Join(CurrentRoles(ctx), ","))
+	})
+	router.GET("/admin", middleware.AuthorizeToken, middleware.RequireRoles(domain.RoleAdmin), func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+	router.GET("/staff", middleware.AuthorizeToken, middleware.RequireAnyRole("Support", domain.RoleAdmin), func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+	router.GET("/userinfo", middleware.AuthorizeClientToken, func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+
+	request := func(path string, prepare func(r *http.Request)) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		prepare(r)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		prepare   func(r *http.Request)
+		status    int
+		challenge string
+	}{
+		{"Test bearer token in the Authorization header", "/me", func(r *http.Request) { r.Header.Set("Authorization", "Bearer valid") }, http.StatusOK, ""},
+		{"Test the scheme is case-insensitive", "/me", func(r *http.Request) { r.Header.Set("Authorization", "bearer valid") }, http.StatusOK, ""},
+		{"Test bearer token in the cookie", "/me", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "session", Value: "valid"}) }, http.StatusOK, ""},
+		{"Test missing token", "/me", func(r *http.Request) {}, http.StatusUnauthorized, `Bearer realm="usafi-hub"`},
+		{"Test other schemes carry no bearer token", "/me", func(r *http.Request) { r.Header.Set("Authorization", "Basic dXNlcjpwYXNz") }, http.StatusUnauthorized, `Bearer realm="usafi-hub"`},
+		{"Test malformed token", "/me", func(r *http.Request) { r.Header.Set("Authorization", "Bearer not a token") }, http.StatusBadRequest, `error="invalid_request"`},
+		{"Test invalid token", "/me", func(r *http.Request) { r.Header.Set("Authorization", "Bearer expired") }, http.StatusUnauthorized, `error="invalid_token"`},
+		{"Test the header takes precedence over the cookie", "/me", func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer expired")
+			r.AddCookie(&http.Cookie{Name: "session", Value: "valid"})
+		}, http.StatusUnauthorized, `error="invalid_token"`},
+		{"Test missing role", "/admin", func(r *http.Request) { r.Header.Set("Authorization", "Bearer valid") }, http.StatusForbidden, `error="insufficient_scope"`},
+		{"Test holding the role", "/admin", func(r *http.Request) { r.Header.Set("Authorization", "Bearer admin") }, http.StatusOK, ""},
+		{"Test roles are looked up rather than read from the token", "/admin", func(r *http.Request) { r.Header.Set("Authorization", "Bearer demoted") }, http.StatusForbidden, `error="insufficient_scope"`},
+		{"Test holding one of the roles", "/staff", func(r *http.Request) { r.Header.Set("Authorization", "Bearer admin") }, http.StatusOK, ""},
+		{"Test holding none of the roles", "/staff", func(r *http.Request) { r.Header.Set("Authorization", "Bearer valid") }, http.StatusForbidden, `error="insufficient_scope"`},
+		{"Test any role is looked up rather than read from the token", "/staff", func(r *http.Request) { r.Header.Set("Authorization", "Bearer demoted") }, http.StatusForbidden, `error="insufficient_scope"`},
+		{"Test OAuth client tokens are refused", "/admin", func(r *http.Request) { r.Header.Set("Authorization", "Bearer oidc") }, http.StatusForbidden, `error="insufficient_scope"`},
+		{"Test OAuth client tokens on client routes", "/userinfo", func(r *http.Request) { r.Header.Set("Authorization", "Bearer oidc") }, http.StatusOK, ""},
+		{"Test user tokens on client routes", "/userinfo", func(r *http.Request) { r.Header.Set("Authorization", "Bearer valid") }, http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := request(test.path, test.prepare)
+			if w.Code != test.status {
+				t.Errorf("expected status %d, got %d: %s", test.status, w.Code, w.Body.String())
+			}
+			if challenge := w.Header().Get("WWW-Authenticate"); !strings.Contains(challenge, test.challenge) || (test.challenge == "") != (challenge == "") {
+				t.Errorf("expected a challenge containing %q, got %q", test.challenge, challenge)
+			}
+		})
+	}
+
+	t.Run("Test claims are available through the accessors", func(t *testing.T) {
+		w := request("/me", func(r *http.Request) { r.Header.Set("Authorization", "Bearer valid") })
+		if body := w.Body.String(); body != "user jane@example.com Cleaner" {
+			t.Errorf("expected the caller's claims, got %q", body)
+		}
+	})
+}
+
+func TestImpersonation(t *testing.T) {
+	logger, err := logger.NewDefaultLogger()
+	if err != nil {
+		panic(err)
+	}
+	gin.SetMode(gin.TestMode)
+	impersonation := &stubImpersonationService{entries: map[string]*domain.AuditEntry{}}
+	middleware := NewMiddleware(nil, stubTokenService{}, nil, impersonation, nil, nil, domain.EmailVerificationOptional, "", logger)
+
+	router := gin.New()
+	router.GET("/me", middleware.AuthorizeToken, func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+	router.PUT("/password", middleware.AuthorizeToken, middleware.RejectImpersonation, func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+
+	request := func(method, path, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("Testing impersonated requests are audited", func(t *testing.T) {
+		if w := request(http.MethodGet, "/me", "impersonated"); w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+		entry, ok := impersonation.entries["1"]
+		if !ok || entry.ActorId != "admin" || entry.UserId != "user" || entry.TokenId != "token" || entry.Path != "/me" || entry.Status != http.StatusOK {
+			t.Errorf("expected the request and its outcome to be recorded, got %+v", impersonation.entries)
+		}
+
+		if w := request(http.MethodGet, "/me", "valid"); w.Code != http.StatusOK || len(impersonation.entries) != 1 {
+			t.Errorf("expected requests by the user themselves not to be audited, got %d entries", len(impersonation.entries))
+		}
+	})
+
+	t.Run("Testing impersonation tokens cannot change credentials", func(t *testing.T) {
+		if w := request(http.MethodPut, "/password", "impersonated"); w.Code != http.StatusForbidden {
+			t.Errorf("expected 403, got %d", w.Code)
+		}
+		if entry := impersonation.entries["2"]; entry == nil || entry.Status != http.StatusForbidden {
+			t.Errorf("expected the refused request to be audited, got %+v", entry)
+		}
+		if w := request(http.MethodPut, "/password", "valid"); w.Code != http.StatusOK {
+			t.Errorf("expected 200 for the user themselves, got %d", w.Code)
+		}
+	})
+
+	t.Run("Testing requests that cannot be audited are refused", func(t *testing.T) {
+		impersonation.unavailable = true
+		defer func() { impersonation.unavailable = false }()
+		if w := request(http.MethodGet, "/me", "impersonated"); w.Code == http.StatusOK {
+			t.Error("expected the request to be refused")
+		}
+	})
+}
+
+func TestRequireSelfEmailOrPermission(t *testing.T) {
+	logger, err := logger.NewDefaultLogger()
+	if err != nil {
+		panic(err)
+	}
+	gin.SetMode(gin.TestMode)
+	middleware := NewMiddleware(nil, stubTokenService{}, nil, nil, stubAdminRoles, stubAdminRoles, domain.EmailVerificationOptional, "", logger)
+
+	router := gin.New()
+	router.POST("/users", middleware.AuthorizeToken, middleware.RequireSelfEmailOrPermission(domain.PermissionUsersRead), func(ctx *gin.Context) {
+		var body struct {
+			Email string `json:"email"`
+		}
+		if err := ctx.ShouldBindBodyWith(&body, binding.JSON); err != nil {
+			ctx.Status(http.StatusBadRequest)
+			return
+		}
+		ctx.String(http.StatusOK, body.Email)
+	})
+
+	tests := []struct {
+		name   string
+		token  string
+		body   string
+		status int
+	}{
+		{"Test users may look up their own email", "valid", `{"email": "JANE@example.com"}`, http.StatusOK},
+		{"Test users may not look up other emails", "valid", `{"email": "john@example.com"}`, http.StatusForbidden},
+		{"Test a body naming nobody needs the permission", "valid", `not json`, http.StatusForbidden},
+		{"Test holders of the permission may look up any email", "admin", `{"email": "john@example.com"}`, http.StatusOK},
+		{"Test the handler reports a body that does not parse", "admin", `not json`, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(test.body))
+			r.Header.Set("Authorization", "Bearer "+test.token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != test.status {
+				t.Errorf("expected status %d, got %d: %s", test.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
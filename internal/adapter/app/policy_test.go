@@ -0,0 +1,95 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
+)
+
+func TestServiceAccountPolicy(t *testing.T) {
+	policy := newAccessPolicy(nil, nil, domain.EmailVerificationLimitScopes)
+	ctx := context.Background()
+	claims := domain.Claims{
+		UserId:   "service-account",
+		Roles:    []string{domain.RoleAdmin},
+		Scope:    domain.PermissionUsersRead,
+		APIKeyId: "key",
+	}
+
+	t.Run("Test service accounts hold exactly their key's scopes", func(t *testing.T) {
+		if allowed, err := policy.HasPermission(ctx, claims, domain.PermissionUsersRead); err != nil || !allowed {
+			t.Errorf("expected users:read to be granted, got %v: %v", allowed, err)
+		}
+		if allowed, err := policy.HasPermission(ctx, claims, domain.PermissionUsersWrite); err != nil || allowed {
+			t.Errorf("expected users:write to be denied, got %v: %v", allowed, err)
+		}
+	})
+
+	t.Run("Test service accounts never act on their own account", func(t *testing.T) {
+		if allowed, err := policy.CanAccessUser(ctx, claims, claims.UserId, domain.PermissionUsersWrite); err != nil || allowed {
+			t.Errorf("expected access to be denied, got %v: %v", allowed, err)
+		}
+	})
+}
+
+// stubRoleStore holds the roles and permissions of users by ID.
+type stubRoleStore struct {
+	ports.RoleService
+	ports.UserRoleService
+	roles       map[string][]string
+	permissions map[string][]string
+}
+
+func (s stubRoleStore) GetUserRoles(ctx context.Context, userId string) ([]*domain.Role, error) {
+	roles := []*domain.Role{}
+	for _, name := range s.roles[userId] {
+		roles = append(roles, &domain.Role{Name: name})
+	}
+	return roles, nil
+}
+
+func (s stubRoleStore) GetUserPermissions(ctx context.Context, userId string) ([]string, error) {
+	return s.permissions[userId], nil
+}
+
+func TestRolePolicy(t *testing.T) {
+	store := stubRoleStore{
+		roles:       map[string][]string{"admin": {domain.RoleAdmin}, "support": {"Support"}},
+		permissions: map[string][]string{"support": {domain.PermissionUsersRead}},
+	}
+	policy := newAccessPolicy(store, store, domain.EmailVerificationOptional)
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		claims     domain.Claims
+		permission string
+		allowed    bool
+	}{
+		{"Test admins hold every permission", domain.Claims{UserId: "admin", Roles: []string{domain.RoleAdmin}}, domain.PermissionUsersWrite, true},
+		{"Test roles grant their permissions", domain.Claims{UserId: "support", Roles: []string{"Support"}}, domain.PermissionUsersRead, true},
+		{"Test roles grant no other permissions", domain.Claims{UserId: "support", Roles: []string{"Support"}}, domain.PermissionUsersWrite, false},
+		{"Test the Admin role is looked up rather than read from the token", domain.Claims{UserId: "support", Roles: []string{domain.RoleAdmin}}, domain.PermissionUsersWrite, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if allowed, err := policy.HasPermission(ctx, test.claims, test.permission); err != nil || allowed != test.allowed {
+				t.Errorf("expected %v, got %v: %v", test.allowed, allowed, err)
+			}
+		})
+	}
+
+	t.Run("Test HasRoles looks roles up rather than reading them from the token", func(t *testing.T) {
+		if held, err := policy.HasRoles(ctx, domain.Claims{UserId: "admin"}, domain.RoleAdmin); err != nil || !held {
+			t.Errorf("expected the admin to hold the Admin role, got %v: %v", held, err)
+		}
+		if held, err := policy.HasRoles(ctx, domain.Claims{UserId: "support", Roles: []string{domain.RoleAdmin}}, domain.RoleAdmin); err != nil || held {
+			t.Errorf("expected a stale Admin role in the token to be ignored, got %v: %v", held, err)
+		}
+		if held, err := policy.HasRoles(ctx, domain.Claims{UserId: "admin", APIKeyId: "key"}, domain.RoleAdmin); err != nil || held {
+			t.Errorf("expected service accounts to hold no roles, got %v: %v", held, err)
+		}
+	})
+}
@@ -0,0 +1,266 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// authRequirement is how a route authenticates its callers.
+type authRequirement int
+
+const (
+	authPublic authRequirement = iota
+	authToken
+	authTokenOrAPIKey
+	// authClientToken also accepts the scoped tokens issued to OAuth clients.
+	authClientToken
+)
+
+func (a authRequirement) String() string {
+	switch a {
+	case authToken:
+		return "token"
+	case authTokenOrAPIKey:
+		return "token_or_api_key"
+	case authClientToken:
+		return "client_token"
+	default:
+		return "public"
+	}
+}
+
+// route declares an endpoint and who may call it. The router is built from
+// these, so the table is the one place to look up how an endpoint is guarded.
+type route struct {
+	method  string
+	path    string
+	handler gin.HandlerFunc
+	auth    authRequirement
+	// role, when set, must be held by the caller.
+	role string
+	// permission, when set, must be granted to the caller, unless selfParam
+	// names a path parameter holding the caller's own user ID.
+	permission string
+	selfParam  string
+	// selfEmail, like selfParam, lets callers act on their own account when
+	// the email in the JSON request body is theirs.
+	selfEmail bool
+	// mfa marks role management routes, which require a second factor when
+	// MFA_REQUIRED_FOR_ROLE_MANAGEMENT is set.
+	mfa bool
+	// noImpersonation refuses callers using an impersonation token.
+	noImpersonation bool
+}
+
+// apiRoutes returns the routes served by handler. Other UsafiHub services call
+// the user, role and permission APIs with API keys.
+func apiRoutes(handler GinHandler) []route {
+	return []route{
+		{method: http.MethodGet, path: "/", handler: handler.Home},
+		{method: http.MethodGet, path: "/health-check", handler: handler.Healthcheck},
+
+		{method: http.MethodPost, path: "/users/v1/", handler: handler.CreateUser, auth: authTokenOrAPIKey, permission: domain.PermissionUsersWrite},
+		{method: http.MethodPost, path: "/users/v1/get", handler: handler.GetUserByEmail, auth: authTokenOrAPIKey, permission: domain.PermissionUsersRead, selfEmail: true},
+		{method: http.MethodGet, path: "/users/v1/:user_id", handler: handler.GetUserById, auth: authTokenOrAPIKey, permission: domain.PermissionUsersRead, selfParam: "user_id"},
+		{method: http.MethodGet, path: "/users/v1/", handler: handler.GetUsers, auth: authTokenOrAPIKey, permission: domain.PermissionUsersRead},
+		{method: http.MethodGet, path: "/users/v1/roles/:role_name", handler: handler.GetUsersWithRole, auth: authTokenOrAPIKey, permission: domain.PermissionUsersRead},
+		{method: http.MethodPut, path: "/users/v1/:user_id", handler: handler.UpdateUser, auth: authTokenOrAPIKey, permission: domain.PermissionUsersWrite, selfParam: "user_id"},
+		{method: http.MethodDelete, path: "/users/v1/:user_id", handler: handler.DeleteUser, auth: authTokenOrAPIKey, permission: domain.PermissionUsersDelete, selfParam: "user_id", noImpersonation: true},
+		{method: http.MethodPut, path: "/users/v1/:user_id/password", handler: handler.SetPassword, auth: authTokenOrAPIKey, permission: domain.PermissionUsersWrite, noImpersonation: true},
+		{method: http.MethodPost, path: "/users/v1/:user_id/unlock", handler: handler.UnlockUser, auth: authTokenOrAPIKey, permission: domain.PermissionUsersWrite},
+		{method: http.MethodGet, path: "/users/v1/:user_id/sessions", handler: handler.GetUserSessions, auth: authTokenOrAPIKey, permission: domain.PermissionUsersRead},
+		{method: http.MethodDelete, path: "/users/v1/:user_id/sessions/:session_id", handler: handler.RevokeUserSession, auth: authTokenOrAPIKey, permission: domain.PermissionUsersWrite},
+		{method: http.MethodPost, path: "/users/v1/:user_id/impersonate", handler: handler.Impersonate, auth: authToken, permission: domain.PermissionUsersImpersonate, noImpersonation: true},
+
+		{method: http.MethodGet, path: "/audit/v1/impersonations", handler: handler.GetImpersonationAuditLog, auth: authToken, permission: domain.PermissionUsersImpersonate, noImpersonation: true},
+
+		{method: http.MethodPost, path: "/roles/v1/", handler: handler.CreateRole, auth: authTokenOrAPIKey, permission: domain.PermissionRolesWrite, mfa: true},
+		{method: http.MethodGet, path: "/roles/v1/:role_id", handler: handler.GetRoleById, auth: authTokenOrAPIKey, permission: domain.PermissionRolesRead, mfa: true},
+		{method: http.MethodGet, path: "/roles/v1/", handler: handler.GetRoles, auth: authTokenOrAPIKey, permission: domain.PermissionRolesRead, mfa: true},
+		{method: http.MethodPut, path: "/roles/v1/:role_id", handler: handler.UpdateRole, auth: authTokenOrAPIKey, permission: domain.PermissionRolesWrite, mfa: true},
+		{method: http.MethodDelete, path: "/roles/v1/:role_id", handler: handler.DeleteRole, auth: authTokenOrAPIKey, permission: domain.PermissionRolesWrite, mfa: true},
+		{method: http.MethodGet, path: "/roles/v1/:role_id/permissions", handler: handler.GetRolePermissions, auth: authTokenOrAPIKey, permission: domain.PermissionRolesRead, mfa: true},
+		{method: http.MethodPost, path: "/roles/v1/:role_id/permissions", handler: handler.GrantRolePermission, auth: authTokenOrAPIKey, permission: domain.PermissionRolesWrite, mfa: true},
+		{method: http.MethodDelete, path: "/roles/v1/:role_id/permissions/:permission_id", handler: handler.RevokeRolePermission, auth: authTokenOrAPIKey, permission: domain.PermissionRolesWrite, mfa: true},
+
+		{method: http.MethodPost, path: "/permissions/v1/", handler: handler.CreatePermission, auth: authTokenOrAPIKey, permission: domain.PermissionRolesWrite, mfa: true},
+		{method: http.MethodGet, path: "/permissions/v1/", handler: handler.GetPermissions, auth: authTokenOrAPIKey, permission: domain.PermissionRolesRead, mfa: true},
+
+		{method: http.MethodPost, path: "/user_roles/v1/", handler: handler.AddUserRole, auth: authTokenOrAPIKey, permission: domain.PermissionRolesAssign, mfa: true},
+		{method: http.MethodDelete, path: "/user_roles/v1/:user_id/:role_id", handler: handler.RemoveUserRole, auth: authTokenOrAPIKey, permission: domain.PermissionRolesAssign, mfa: true},
+
+		{method: http.MethodPost, path: "/auth/v1/signup", handler: handler.SignupUser},
+		{method: http.MethodPost, path: "/auth/v1/login", handler: handler.LoginUser},
+		{method: http.MethodPost, path: "/auth/v1/token", handler: handler.GenerateToken},
+		{method: http.MethodPost, path: "/auth/v1/passwordless", handler: handler.RequestPasswordlessLogin},
+		{method: http.MethodPost, path: "/auth/v1/passwordless/verify", handler: handler.PasswordlessLogin},
+		{method: http.MethodPost, path: "/auth/v1/mfa/verify", handler: handler.VerifyMFA},
+		{method: http.MethodPost, path: "/auth/v1/mfa/totp", handler: handler.EnrollTOTP, auth: authToken, noImpersonation: true},
+		{method: http.MethodPost, path: "/auth/v1/mfa/totp/confirm", handler: handler.ConfirmTOTP, auth: authToken, noImpersonation: true},
+		{method: http.MethodDelete, path: "/auth/v1/mfa/totp", handler: handler.DisableTOTP, auth: authToken, noImpersonation: true},
+		{method: http.MethodPost, path: "/auth/v1/refresh", handler: handler.RefreshToken},
+		{method: http.MethodPost, path: "/auth/v1/logout", handler: handler.Logout, auth: authToken},
+		{method: http.MethodPost, path: "/auth/v1/logout-all", handler: handler.LogoutEverywhere, auth: authToken, noImpersonation: true},
+		{method: http.MethodGet, path: "/auth/v1/sessions", handler: handler.GetSessions, auth: authToken},
+		{method: http.MethodDelete, path: "/auth/v1/sessions/:session_id", handler: handler.RevokeSession, auth: authToken, noImpersonation: true},
+		{method: http.MethodPut, path: "/auth/v1/password", handler: handler.ChangePassword, auth: authToken, noImpersonation: true},
+		{method: http.MethodPost, path: "/auth/v1/forgot-password", handler: handler.ForgotPassword},
+		{method: http.MethodPost, path: "/auth/v1/reset-password", handler: handler.ResetPassword},
+		{method: http.MethodPost, path: "/auth/v1/verify-email", handler: handler.VerifyEmail},
+		{method: http.MethodPost, path: "/auth/v1/verify-email/resend", handler: handler.ResendVerificationEmail},
+		{method: http.MethodPost, path: "/auth/v1/verify-phone", handler: handler.VerifyPhone, auth: authToken},
+		{method: http.MethodPost, path: "/auth/v1/verify-phone/send", handler: handler.RequestPhoneVerification, auth: authToken},
+
+		{method: http.MethodGet, path: "/.well-known/jwks.json", handler: handler.JWKS},
+		{method: http.MethodGet, path: "/.well-known/openid-configuration", handler: handler.OpenIDConfiguration},
+
+		{method: http.MethodGet, path: "/oauth/v1/authorize", handler: handler.Authorize},
+		{method: http.MethodPost, path: "/oauth/v1/authorize", handler: handler.ApproveAuthorization, auth: authToken, noImpersonation: true},
+		{method: http.MethodPost, path: "/oauth/v1/token", handler: handler.Token},
+		{method: http.MethodGet, path: "/oauth/v1/userinfo", handler: handler.UserInfo, auth: authClientToken},
+		{method: http.MethodPost, path: "/oauth/v1/userinfo", handler: handler.UserInfo, auth: authClientToken},
+		{method: http.MethodPost, path: "/oauth/v1/clients", handler: handler.RegisterClient, auth: authToken, permission: domain.PermissionClientsWrite},
+		{method: http.MethodGet, path: "/oauth/v1/clients", handler: handler.GetClients, auth: authToken, permission: domain.PermissionClientsWrite},
+		{method: http.MethodDelete, path: "/oauth/v1/clients/:client_id", handler: handler.DeleteClient, auth: authToken, permission: domain.PermissionClientsWrite},
+
+		{method: http.MethodPost, path: "/service_accounts/v1/", handler: handler.CreateServiceAccount, auth: authToken, permission: domain.PermissionServiceAccountsWrite},
+		{method: http.MethodGet, path: "/service_accounts/v1/", handler: handler.GetServiceAccounts, auth: authToken, permission: domain.PermissionServiceAccountsWrite},
+		{method: http.MethodDelete, path: "/service_accounts/v1/:service_account_id", handler: handler.DeleteServiceAccount, auth: authToken, permission: domain.PermissionServiceAccountsWrite},
+		{method: http.MethodPost, path: "/service_accounts/v1/:service_account_id/keys", handler: handler.CreateAPIKey, auth: authToken, permission: domain.PermissionServiceAccountsWrite},
+		{method: http.MethodGet, path: "/service_accounts/v1/:service_account_id/keys", handler: handler.GetAPIKeys, auth: authToken, permission: domain.PermissionServiceAccountsWrite},
+		{method: http.MethodDelete, path: "/service_accounts/v1/:service_account_id/keys/:key_id", handler: handler.RevokeAPIKey, auth: authToken, permission: domain.PermissionServiceAccountsWrite},
+	}
+}
+
+// withRouteListing adds the admin listing of routes at GET /routes.
+func withRouteListing(routes []route) []route {
+	var all []route
+	listing := route{
+		method: http.MethodGet,
+		path:   "/routes",
+		handler: func(ctx *gin.Context) {
+			listRoutes(ctx, all)
+		},
+		auth: authToken,
+		role: domain.RoleAdmin,
+	}
+	all = append(append(all, routes...), listing)
+	return all
+}
+
+// registerRoutes mounts routes on router, guarding each with the middleware
+// its declaration asks for.
+func registerRoutes(router gin.IRouter, routes []route, m *middleware, requireMFA bool) error {
+	for _, r := range routes {
+		if r.auth == authPublic && (r.role != "" || r.permission != "" || r.selfEmail || r.mfa || r.noImpersonation) {
+			return fmt.Errorf("route %s %s restricts callers without authenticating them", r.method, r.path)
+		}
+		if r.selfParam != "" && !strings.Contains(r.path, ":"+r.selfParam) {
+			return fmt.Errorf("route %s %s has no path parameter %s", r.method, r.path, r.selfParam)
+		}
+		if r.selfEmail && r.selfParam != "" {
+			return fmt.Errorf("route %s %s identifies the caller's account twice", r.method, r.path)
+		}
+
+		handlers := []gin.HandlerFunc{}
+		switch r.auth {
+		case authToken:
+			handlers = append(handlers, m.AuthorizeToken)
+		case authTokenOrAPIKey:
+			handlers = append(handlers, m.AuthorizeTokenOrAPIKey)
+		case authClientToken:
+			handlers = append(handlers, m.AuthorizeClientToken)
+		}
+		if r.noImpersonation {
+			handlers = append(handlers, m.RejectImpersonation)
+		}
+		if r.role != "" {
+			handlers = append(handlers, m.RequireRoles(r.role))
+		}
+		switch {
+		case r.selfParam != "":
+			handlers = append(handlers, m.RequireSelfOrPermission(r.selfParam, r.permission))
+		case r.selfEmail:
+			handlers = append(handlers, m.RequireSelfEmailOrPermission(r.permission))
+		case r.permission != "":
+			handlers = append(handlers, m.RequirePermission(r.permission))
+		}
+		// Managing roles and permissions can grant any access, so deployments
+		// can insist that it is only done by users who logged in with a second
+		// factor.
+		if r.mfa && requireMFA {
+			handlers = append(handlers, m.RequireMFA)
+		}
+		router.Handle(r.method, r.path, append(handlers, r.handler)...)
+	}
+	return nil
+}
+
+// checkRoutes reports GinHandler methods that no route serves, which would
+// otherwise only be noticed when a client gets a 404.
+func checkRoutes(routes []route) error {
+	routed := map[string]bool{}
+	for _, r := range routes {
+		routed[handlerName(r.handler)] = true
+	}
+	var unrouted []string
+	handlerType := reflect.TypeOf((*GinHandler)(nil)).Elem()
+	for i := 0; i < handlerType.NumMethod(); i++ {
+		if name := handlerType.Method(i).Name; !routed[name] {
+			unrouted = append(unrouted, name)
+		}
+	}
+	if len(unrouted) > 0 {
+		return fmt.Errorf("handlers without a route: %s", strings.Join(unrouted, ", "))
+	}
+	return nil
+}
+
+// handlerName returns the method name of a handler method value.
+func handlerName(handler gin.HandlerFunc) string {
+	name := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+	name = strings.TrimSuffix(name, "-fm")
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+func listRoutes(ctx *gin.Context, routes []route) {
+	type routeInfo struct {
+		Method          string `json:"method"`
+		Path            string `json:"path"`
+		Handler         string `json:"handler"`
+		Auth            string `json:"auth"`
+		Role            string `json:"role,omitempty"`
+		Permission      string `json:"permission,omitempty"`
+		SelfParam       string `json:"self_param,omitempty"`
+		SelfEmail       bool   `json:"self_email,omitempty"`
+		MFA             bool   `json:"mfa,omitempty"`
+		NoImpersonation bool   `json:"no_impersonation,omitempty"`
+	}
+	listing := make([]routeInfo, 0, len(routes))
+	for _, r := range routes {
+		listing = append(listing, routeInfo{
+			Method:          r.method,
+			Path:            r.path,
+			Handler:         handlerName(r.handler),
+			Auth:            r.auth.String(),
+			Role:            r.role,
+			Permission:      r.permission,
+			SelfParam:       r.selfParam,
+			SelfEmail:       r.selfEmail,
+			MFA:             r.mfa,
+			NoImpersonation: r.noImpersonation,
+		})
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"responseMessage": "Routes retrieved successfully",
+		"responseCode":    http.StatusOK,
+		"data":            listing,
+	})
+}
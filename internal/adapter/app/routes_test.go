@@ -0,0 +1,128 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/logger"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRoutes(t *testing.T) {
+	logger, err := logger.NewDefaultLogger()
+	if err != nil {
+		panic(err)
+	}
+	gin.SetMode(gin.TestMode)
+	handler := NewGinHandler(nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, domain.EmailVerificationOptional)
+	middleware := NewMiddleware(nil, stubTokenService{}, nil, nil, stubAdminRoles, stubAdminRoles, domain.EmailVerificationOptional, "", logger)
+	routes := withRouteListing(apiRoutes(handler))
+
+	t.Run("Testing every handler is routed", func(t *testing.T) {
+		if err := checkRoutes(routes); err != nil {
+			t.Error(err)
+		}
+		if err := checkRoutes(routes[1:]); err == nil || !strings.Contains(err.Error(), "Home") {
+			t.Errorf("expected the unrouted Home handler to be reported, got %v", err)
+		}
+	})
+
+	t.Run("Testing routes restricting callers must authenticate them", func(t *testing.T) {
+		invalid := []route{{method: http.MethodGet, path: "/", handler: handler.Home, permission: domain.PermissionUsersRead}}
+		if err := registerRoutes(gin.New(), invalid, middleware, false); err == nil {
+			t.Error("expected a public route with a permission to be rejected")
+		}
+	})
+
+	router := gin.New()
+	if err := registerRoutes(router, routes, middleware, true); err != nil {
+		t.Fatalf("error registering routes: %v", err)
+	}
+	request := func(method, path, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(`{"email": "john@example.com"}`))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("Testing the health check is public", func(t *testing.T) {
+		if w := request(http.MethodGet, "/health-check", ""); w.Code != http.StatusOK {
+			t.Errorf("expected 200, got %d", w.Code)
+		}
+	})
+
+	t.Run("Testing the route listing is for admins", func(t *testing.T) {
+		if w := request(http.MethodGet, "/routes", ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401 without a token, got %d", w.Code)
+		}
+		if w := request(http.MethodGet, "/routes", "valid"); w.Code != http.StatusForbidden {
+			t.Errorf("expected 403 for a user who is not an admin, got %d", w.Code)
+		}
+		if w := request(http.MethodGet, "/routes", "demoted"); w.Code != http.StatusForbidden {
+			t.Errorf("expected 403 for a token naming a role the user no longer holds, got %d", w.Code)
+		}
+		if w := request(http.MethodGet, "/routes", "admin"); w.Code != http.StatusOK {
+			t.Errorf("expected 200 for an admin, got %d", w.Code)
+		}
+	})
+
+	t.Run("Testing looking up another user by email needs users:read", func(t *testing.T) {
+		if w := request(http.MethodPost, "/users/v1/get", "valid"); w.Code != http.StatusForbidden {
+			t.Errorf("expected 403 for a user without users:read, got %d", w.Code)
+		}
+	})
+
+	t.Run("Testing OAuth client tokens only reach userinfo", func(t *testing.T) {
+		if w := request(http.MethodGet, "/users/v1/", "oidc"); w.Code != http.StatusForbidden {
+			t.Errorf("expected 403 for a token issued to an OAuth client, got %d", w.Code)
+		}
+		if w := request(http.MethodGet, "/routes", "oidc"); w.Code != http.StatusForbidden {
+			t.Errorf("expected 403 for a token issued to an OAuth client, got %d", w.Code)
+		}
+	})
+
+	t.Run("Testing listRoutes", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		listRoutes(ctx, routes)
+
+		var response struct {
+			Data []struct {
+				Method     string `json:"method"`
+				Path       string `json:"path"`
+				Handler    string `json:"handler"`
+				Auth       string `json:"auth"`
+				Permission string `json:"permission"`
+				SelfEmail  bool   `json:"self_email"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("error decoding routes: %v", err)
+		}
+		if len(response.Data) != len(routes) {
+			t.Fatalf("expected %d routes, got %d", len(routes), len(response.Data))
+		}
+		found, foundByEmail := false, false
+		for _, r := range response.Data {
+			if r.Method == http.MethodDelete && r.Path == "/user_roles/v1/:user_id/:role_id" {
+				found = r.Handler == "RemoveUserRole" && r.Auth == "token_or_api_key" && r.Permission == domain.PermissionRolesAssign
+			}
+			if r.Path == "/users/v1/get" {
+				foundByEmail = r.Handler == "GetUserByEmail" && r.Permission == domain.PermissionUsersRead && r.SelfEmail
+			}
+		}
+		if !found {
+			t.Errorf("expected RemoveUserRole to be listed as a guarded DELETE route, got %+v", response.Data)
+		}
+		if !foundByEmail {
+			t.Errorf("expected GetUserByEmail to be listed as guarded by users:read or the caller's own email, got %+v", response.Data)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package breached
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// prefixLength is the length of the hash prefix used to index the list, the
+// same k-anonymity ranges served by the Pwned Passwords API.
+const prefixLength = 5
+
+// PasswordList checks passwords against a local copy of a breached password
+// list so that no password, or hash of one, ever leaves the service.
+//
+// The file holds one uppercase or lowercase SHA-1 hash per line, optionally
+// followed by ":<count>", which is the format produced by the Pwned Passwords
+// downloader. Blank lines and lines starting with # are ignored.
+type PasswordList struct {
+	ranges map[string]map[string]struct{}
+	size   int
+}
+
+func NewPasswordList(path string) (*PasswordList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %v", err)
+	}
+	defer file.Close()
+
+	list := &PasswordList{
+		ranges: map[string]map[string]struct{}{},
+	}
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		hash, _, _ := strings.Cut(entry, ":")
+		hash = strings.ToUpper(hash)
+		if len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("invalid breached password list entry on line %d", line)
+		}
+		if _, err := hex.DecodeString(hash); err != nil {
+			return nil, fmt.Errorf("invalid breached password list entry on line %d", line)
+		}
+		list.add(hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read breached password list: %v", err)
+	}
+	return list, nil
+}
+
+// Size reports how many hashes the list holds.
+func (l *PasswordList) Size() int {
+	return l.size
+}
+
+func (l *PasswordList) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	suffixes, ok := l.ranges[hash[:prefixLength]]
+	if !ok {
+		return false, nil
+	}
+	_, ok = suffixes[hash[prefixLength:]]
+	return ok, nil
+}
+
+func (l *PasswordList) add(hash string) {
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+	suffixes, ok := l.ranges[prefix]
+	if !ok {
+		suffixes = map[string]struct{}{}
+		l.ranges[prefix] = suffixes
+	}
+	if _, ok := suffixes[suffix]; !ok {
+		suffixes[suffix] = struct{}{}
+		l.size++
+	}
+}
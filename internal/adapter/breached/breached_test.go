@@ -0,0 +1,43 @@
+package breached
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPasswordList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	// SHA-1 of "password" and "Password1".
+	contents := "# breached passwords\n5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\n\n70ccd9007338d6d81dd3b6271621b9cf9a97ea00\n"
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("failed to write list: %v", err)
+	}
+
+	list, err := NewPasswordList(path)
+	if err != nil {
+		t.Fatalf("failed to load list: %v", err)
+	}
+	if list.Size() != 2 {
+		t.Errorf("expected 2 hashes, got %d", list.Size())
+	}
+
+	for password, expected := range map[string]bool{"password": true, "Password1": true, "correct horse battery staple": false} {
+		breached, err := list.IsBreached(password)
+		if err != nil {
+			t.Fatalf("failed to check %q: %v", password, err)
+		}
+		if breached != expected {
+			t.Errorf("expected breached(%q) to be %v", password, expected)
+		}
+	}
+
+	t.Run("Test invalid entries are rejected", func(t *testing.T) {
+		if err := os.WriteFile(path, []byte("not-a-hash\n"), 0o600); err != nil {
+			t.Fatalf("failed to write list: %v", err)
+		}
+		if _, err := NewPasswordList(path); err == nil {
+			t.Error("expected invalid list to be rejected")
+		}
+	})
+}
@@ -0,0 +1,355 @@
+package migrations
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/AntonyIS/usafi-hub-user-service/config"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
+)
+
+// Migration files are named <version>_<name>.<up|down>.sql. Table names are
+// written as template fields of config.Config, e.g. {{.USER_TABLE}}, so the
+// same migrations serve every environment.
+//
+//go:embed sql/*.sql
+var migrationFiles embed.FS
+
+var migrationFilename = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+type appliedMigration struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	config     config.Config
+	logger     ports.LoggerService
+	tablename  string
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB, config config.Config, logger ports.LoggerService) (*Migrator, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:         db,
+		config:     config,
+		logger:     logger,
+		tablename:  config.SCHEMA_MIGRATION_TABLE,
+		migrations: migrations,
+	}, nil
+}
+
+// LoadMigrations reads the embedded migrations ordered by version.
+func LoadMigrations() ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir("sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationFilename.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration filename: %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		contents, err := migrationFiles.ReadFile(path.Join("sql", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(contents)
+		} else {
+			migration.Down = string(contents)
+		}
+	}
+
+	migrations := []Migration{}
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s must have both up and down files", migration.Version, migration.Name)
+		}
+		sum := sha256.Sum256([]byte(migration.Up + "\n--\n" + migration.Down))
+		migration.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Up applies every pending migration and returns how many were applied.
+func (m *Migrator) Up() (int, error) {
+	count := 0
+	err := m.withLock(func(conn *sql.Conn) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := m.apply(conn, migration); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Down rolls back the most recently applied migrations, at most steps of them,
+// and returns how many were rolled back.
+func (m *Migrator) Down(steps int) (int, error) {
+	count := 0
+	err := m.withLock(func(conn *sql.Conn) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if err := m.rollback(conn, migration); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Status lists every known migration and when it was applied.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	statuses := []MigrationStatus{}
+	err := m.withLock(func(conn *sql.Conn) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+			if record, ok := applied[migration.Version]; ok {
+				appliedAt := record.appliedAt
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// withLock runs fn while holding a Postgres advisory lock so that concurrent
+// instances starting up at the same time do not apply migrations twice.
+// Advisory locks belong to a session, so everything runs on a single connection.
+func (m *Migrator) withLock(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	key := m.lockKey()
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, key); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %v", err)
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, key)
+
+	query := fmt.Sprintf(`
+        CREATE TABLE IF NOT EXISTS %s (
+            version INTEGER PRIMARY KEY,
+            name VARCHAR(255) NOT NULL,
+            checksum VARCHAR(64) NOT NULL,
+            applied_at TIMESTAMP NOT NULL
+        )
+    `, m.tablename)
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create migrations table: %v", err)
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) applied(conn *sql.Conn) (map[int]appliedMigration, error) {
+	query := fmt.Sprintf(`
+        SELECT version, name, checksum, applied_at
+        FROM %s
+    `, m.tablename)
+	rows, err := conn.QueryContext(context.Background(), query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]appliedMigration{}
+	for rows.Next() {
+		var version int
+		record := appliedMigration{}
+		if err := rows.Scan(&version, &record.name, &record.checksum, &record.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = record
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// verify refuses to run when an applied migration was edited afterwards or
+// when the database has migrations this binary does not know about.
+func (m *Migrator) verify(applied map[int]appliedMigration) error {
+	known := map[int]Migration{}
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+	for version, record := range applied {
+		migration, ok := known[version]
+		if !ok {
+			return fmt.Errorf("database has migration %04d_%s which is unknown to this build", version, record.name)
+		}
+		if migration.Checksum != record.checksum {
+			return fmt.Errorf("migration %04d_%s was modified after it was applied", version, migration.Name)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) apply(conn *sql.Conn, migration Migration) error {
+	statement, err := m.render(migration.Up)
+	if err != nil {
+		return fmt.Errorf("failed to render migration %04d_%s: %v", migration.Version, migration.Name, err)
+	}
+
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, statement); err != nil {
+		return fmt.Errorf("failed to apply migration %04d_%s: %v", migration.Version, migration.Name, err)
+	}
+	query := fmt.Sprintf(`
+        INSERT INTO %s (version, name, checksum, applied_at)
+        VALUES ($1, $2, $3, $4)
+    `, m.tablename)
+	if _, err := tx.ExecContext(ctx, query, migration.Version, migration.Name, migration.Checksum, time.Now()); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.logger.Info(fmt.Sprintf("Applied migration %04d_%s", migration.Version, migration.Name))
+	return nil
+}
+
+func (m *Migrator) rollback(conn *sql.Conn, migration Migration) error {
+	statement, err := m.render(migration.Down)
+	if err != nil {
+		return fmt.Errorf("failed to render migration %04d_%s: %v", migration.Version, migration.Name, err)
+	}
+
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, statement); err != nil {
+		return fmt.Errorf("failed to roll back migration %04d_%s: %v", migration.Version, migration.Name, err)
+	}
+	query := fmt.Sprintf(`
+        DELETE FROM %s
+        WHERE version=$1
+    `, m.tablename)
+	if _, err := tx.ExecContext(ctx, query, migration.Version); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.logger.Info(fmt.Sprintf("Rolled back migration %04d_%s", migration.Version, migration.Name))
+	return nil
+}
+
+func (m *Migrator) render(statement string) (string, error) {
+	tmpl, err := template.New("migration").Option("missingkey=error").Parse(statement)
+	if err != nil {
+		return "", err
+	}
+	var buffer bytes.Buffer
+	if err := tmpl.Execute(&buffer, m.config); err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+func (m *Migrator) lockKey() int64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(m.tablename))
+	return int64(hash.Sum64())
+}
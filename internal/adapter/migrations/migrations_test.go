@@ -0,0 +1,66 @@
+package migrations
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AntonyIS/usafi-hub-user-service/config"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatalf("error loading migrations: %v", err)
+	}
+
+	t.Run("Testing LoadMigrations ordering", func(t *testing.T) {
+		if len(migrations) == 0 {
+			t.Fatal("expected at least 1 migration, got 0")
+		}
+		for i, migration := range migrations {
+			if migration.Version != i+1 {
+				t.Errorf("expected migration version %d, got %d", i+1, migration.Version)
+			}
+			if migration.Checksum == "" {
+				t.Errorf("expected migration %d to have a checksum", migration.Version)
+			}
+		}
+	})
+
+	t.Run("Testing migrations render for every table", func(t *testing.T) {
+		migrator := Migrator{config: config.Config{
+			USER_TABLE:               "Test_Users",
+			ROLE_TABLE:               "Test_Roles",
+			USER_ROLE_TABLE:          "Test_UserRoles",
+			PASSWORD_RESET_TABLE:     "Test_PasswordResetTokens",
+			REFRESH_TOKEN_TABLE:      "Test_RefreshTokens",
+			REVOKED_TOKEN_TABLE:      "Test_RevokedTokens",
+			USER_REVOCATION_TABLE:    "Test_UserTokenRevocations",
+			PERMISSION_TABLE:         "Test_Permissions",
+			ROLE_PERMISSION_TABLE:    "Test_RolePermissions",
+			LOGIN_ATTEMPT_TABLE:      "Test_LoginAttempts",
+			ONE_TIME_CODE_TABLE:      "Test_OneTimeCodes",
+			TOTP_SECRET_TABLE:        "Test_TOTPSecrets",
+			RECOVERY_CODE_TABLE:      "Test_RecoveryCodes",
+			SIGNING_KEY_TABLE:        "Test_SigningKeys",
+			OAUTH_CLIENT_TABLE:       "Test_OAuthClients",
+			AUTHORIZATION_CODE_TABLE: "Test_AuthorizationCodes",
+			SERVICE_ACCOUNT_TABLE:    "Test_ServiceAccounts",
+			API_KEY_TABLE:            "Test_APIKeys",
+			SESSION_TABLE:            "Test_Sessions",
+			AUDIT_LOG_TABLE:          "Test_AuditLog",
+			SCHEMA_MIGRATION_TABLE:   "Test_SchemaMigrations",
+		}}
+		for _, migration := range migrations {
+			for _, statement := range []string{migration.Up, migration.Down} {
+				rendered, err := migrator.render(statement)
+				if err != nil {
+					t.Errorf("error rendering migration %d: %v", migration.Version, err)
+				}
+				if strings.Contains(rendered, "{{") {
+					t.Errorf("expected migration %d to be fully rendered", migration.Version)
+				}
+			}
+		}
+	})
+}
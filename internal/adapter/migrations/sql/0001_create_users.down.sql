@@ -0,0 +1 @@
+DROP TABLE IF EXISTS {{.USER_TABLE}};
@@ -0,0 +1,14 @@
+-- Tables created before migrations were introduced already exist in older
+-- databases, so the baseline migrations only create what is missing.
+CREATE TABLE IF NOT EXISTS {{.USER_TABLE}} (
+    user_id VARCHAR(255) PRIMARY KEY UNIQUE,
+    username VARCHAR(255) NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    email VARCHAR(255) UNIQUE NOT NULL,
+    fullname VARCHAR(255) NOT NULL,
+    phone_number VARCHAR(255),
+    avatar VARCHAR(255),
+    address VARCHAR(255),
+    created_at TIMESTAMP,
+    updated_at TIMESTAMP
+);
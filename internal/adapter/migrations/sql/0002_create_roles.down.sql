@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS {{.USER_ROLE_TABLE}};
+DROP TABLE IF EXISTS {{.ROLE_TABLE}};
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS {{.ROLE_TABLE}} (
+    role_id VARCHAR(255) PRIMARY KEY UNIQUE,
+    name VARCHAR(255) UNIQUE NOT NULL,
+    description VARCHAR(255)
+);
+
+CREATE TABLE IF NOT EXISTS {{.USER_ROLE_TABLE}} (
+    user_id VARCHAR(255),
+    role_id VARCHAR(255),
+    PRIMARY KEY (user_id, role_id),
+    CONSTRAINT fk_user_roles_user_id FOREIGN KEY (user_id) REFERENCES {{.USER_TABLE}}(user_id),
+    CONSTRAINT fk_user_roles_role_id FOREIGN KEY (role_id) REFERENCES {{.ROLE_TABLE}}(role_id)
+);
+
+-- The primary key already enforces uniqueness; older databases carry a
+-- redundant constraint that was recreated on every boot.
+ALTER TABLE {{.USER_ROLE_TABLE}} DROP CONSTRAINT IF EXISTS unique_{{.USER_ROLE_TABLE}};
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS {{.PASSWORD_RESET_TABLE}} (
+    token_hash VARCHAR(64) PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_{{.PASSWORD_RESET_TABLE}}_user_id FOREIGN KEY (user_id) REFERENCES {{.USER_TABLE}}(user_id) ON DELETE CASCADE
+);
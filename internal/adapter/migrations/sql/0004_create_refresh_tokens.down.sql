@@ -0,0 +1 @@
+DROP TABLE IF EXISTS {{.REFRESH_TOKEN_TABLE}};
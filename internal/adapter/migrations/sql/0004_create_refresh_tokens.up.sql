@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS {{.REFRESH_TOKEN_TABLE}} (
+    token_id VARCHAR(255) PRIMARY KEY,
+    family_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    replaced_by VARCHAR(255),
+    CONSTRAINT fk_{{.REFRESH_TOKEN_TABLE}}_user_id FOREIGN KEY (user_id) REFERENCES {{.USER_TABLE}}(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_{{.REFRESH_TOKEN_TABLE}}_family_id ON {{.REFRESH_TOKEN_TABLE}} (family_id);
+CREATE INDEX IF NOT EXISTS idx_{{.REFRESH_TOKEN_TABLE}}_user_id ON {{.REFRESH_TOKEN_TABLE}} (user_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS {{.USER_REVOCATION_TABLE}};
+DROP TABLE IF EXISTS {{.REVOKED_TOKEN_TABLE}};
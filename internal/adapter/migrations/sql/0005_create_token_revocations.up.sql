@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS {{.REVOKED_TOKEN_TABLE}} (
+    token_id VARCHAR(255) PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS {{.USER_REVOCATION_TABLE}} (
+    user_id VARCHAR(255) PRIMARY KEY,
+    revoked_at TIMESTAMP NOT NULL
+);
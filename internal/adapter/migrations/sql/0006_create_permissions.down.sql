@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS {{.ROLE_PERMISSION_TABLE}};
+DROP TABLE IF EXISTS {{.PERMISSION_TABLE}};
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS {{.PERMISSION_TABLE}} (
+    permission_id VARCHAR(255) PRIMARY KEY,
+    name VARCHAR(255) UNIQUE NOT NULL,
+    description VARCHAR(255)
+);
+
+CREATE TABLE IF NOT EXISTS {{.ROLE_PERMISSION_TABLE}} (
+    role_id VARCHAR(255),
+    permission_id VARCHAR(255),
+    PRIMARY KEY (role_id, permission_id),
+    CONSTRAINT fk_{{.ROLE_PERMISSION_TABLE}}_role_id FOREIGN KEY (role_id) REFERENCES {{.ROLE_TABLE}}(role_id) ON DELETE CASCADE,
+    CONSTRAINT fk_{{.ROLE_PERMISSION_TABLE}}_permission_id FOREIGN KEY (permission_id) REFERENCES {{.PERMISSION_TABLE}}(permission_id) ON DELETE CASCADE
+);
+
+INSERT INTO {{.PERMISSION_TABLE}} (permission_id, name, description) VALUES
+    (md5('users:read'), 'users:read', 'Read any user profile'),
+    (md5('users:write'), 'users:write', 'Create and update any user'),
+    (md5('users:delete'), 'users:delete', 'Delete any user'),
+    (md5('roles:read'), 'roles:read', 'Read roles and permissions'),
+    (md5('roles:write'), 'roles:write', 'Manage roles and permissions'),
+    (md5('roles:assign'), 'roles:assign', 'Assign roles to users')
+ON CONFLICT (name) DO NOTHING;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS {{.LOGIN_ATTEMPT_TABLE}};
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS {{.LOGIN_ATTEMPT_TABLE}} (
+    attempt_key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failed_at TIMESTAMP NOT NULL,
+    blocked_until TIMESTAMP
+);
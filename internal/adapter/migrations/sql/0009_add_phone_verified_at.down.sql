@@ -0,0 +1 @@
+ALTER TABLE {{.USER_TABLE}} DROP COLUMN IF EXISTS phone_verified_at;
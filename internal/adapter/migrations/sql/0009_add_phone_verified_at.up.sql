@@ -0,0 +1 @@
+ALTER TABLE {{.USER_TABLE}} ADD COLUMN IF NOT EXISTS phone_verified_at TIMESTAMP;
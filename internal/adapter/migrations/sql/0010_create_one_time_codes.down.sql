@@ -0,0 +1 @@
+DROP TABLE IF EXISTS {{.ONE_TIME_CODE_TABLE}};
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS {{.ONE_TIME_CODE_TABLE}} (
+    user_id VARCHAR(255) NOT NULL,
+    purpose VARCHAR(64) NOT NULL,
+    recipient VARCHAR(255) NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, purpose),
+    CONSTRAINT fk_{{.ONE_TIME_CODE_TABLE}}_user_id FOREIGN KEY (user_id) REFERENCES {{.USER_TABLE}}(user_id) ON DELETE CASCADE
+);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS {{.USER_TABLE}}_verified_phone_number_key;
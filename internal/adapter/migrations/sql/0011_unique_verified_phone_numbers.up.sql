@@ -0,0 +1,5 @@
+-- Verified phone numbers identify a user for passwordless login, so each may
+-- be verified by only one account.
+CREATE UNIQUE INDEX IF NOT EXISTS {{.USER_TABLE}}_verified_phone_number_key
+    ON {{.USER_TABLE}} (phone_number)
+    WHERE phone_verified_at IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS {{.RECOVERY_CODE_TABLE}};
+DROP TABLE IF EXISTS {{.TOTP_SECRET_TABLE}};
+ALTER TABLE {{.USER_TABLE}} DROP COLUMN IF EXISTS mfa_enabled_at;
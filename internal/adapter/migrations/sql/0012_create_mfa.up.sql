@@ -0,0 +1,19 @@
+ALTER TABLE {{.USER_TABLE}} ADD COLUMN IF NOT EXISTS mfa_enabled_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS {{.TOTP_SECRET_TABLE}} (
+    user_id VARCHAR(255) PRIMARY KEY,
+    encrypted_secret TEXT NOT NULL,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    confirmed_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_{{.TOTP_SECRET_TABLE}}_user_id FOREIGN KEY (user_id) REFERENCES {{.USER_TABLE}}(user_id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS {{.RECOVERY_CODE_TABLE}} (
+    user_id VARCHAR(255) NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, code_hash),
+    CONSTRAINT fk_{{.RECOVERY_CODE_TABLE}}_user_id FOREIGN KEY (user_id) REFERENCES {{.USER_TABLE}}(user_id) ON DELETE CASCADE
+);
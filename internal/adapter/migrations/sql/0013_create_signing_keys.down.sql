@@ -0,0 +1 @@
+DROP TABLE IF EXISTS {{.SIGNING_KEY_TABLE}};
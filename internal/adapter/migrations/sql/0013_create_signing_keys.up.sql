@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS {{.SIGNING_KEY_TABLE}} (
+    key_id VARCHAR(255) PRIMARY KEY,
+    algorithm VARCHAR(16) NOT NULL,
+    private_key TEXT NOT NULL,
+    public_key TEXT NOT NULL,
+    activates_at TIMESTAMP NOT NULL,
+    retires_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_{{.SIGNING_KEY_TABLE}}_expires_at ON {{.SIGNING_KEY_TABLE}} (expires_at);
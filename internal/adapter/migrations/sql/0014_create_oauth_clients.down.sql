@@ -0,0 +1,4 @@
+DELETE FROM {{.PERMISSION_TABLE}} WHERE name = 'clients:write';
+DROP TABLE IF EXISTS {{.AUTHORIZATION_CODE_TABLE}};
+DROP TABLE IF EXISTS {{.OAUTH_CLIENT_TABLE}};
+ALTER TABLE {{.REFRESH_TOKEN_TABLE}} DROP COLUMN IF EXISTS scope;
@@ -0,0 +1,29 @@
+ALTER TABLE {{.REFRESH_TOKEN_TABLE}} ADD COLUMN IF NOT EXISTS scope TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS {{.OAUTH_CLIENT_TABLE}} (
+    client_id VARCHAR(255) PRIMARY KEY,
+    client_secret_hash VARCHAR(64) NOT NULL DEFAULT '',
+    name VARCHAR(255) NOT NULL,
+    redirect_uris TEXT[] NOT NULL,
+    scopes TEXT[] NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS {{.AUTHORIZATION_CODE_TABLE}} (
+    code_hash VARCHAR(64) PRIMARY KEY,
+    client_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    redirect_uri TEXT NOT NULL,
+    scope TEXT NOT NULL,
+    nonce TEXT NOT NULL DEFAULT '',
+    code_challenge VARCHAR(128) NOT NULL,
+    auth_time TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_{{.AUTHORIZATION_CODE_TABLE}}_client_id FOREIGN KEY (client_id) REFERENCES {{.OAUTH_CLIENT_TABLE}}(client_id) ON DELETE CASCADE,
+    CONSTRAINT fk_{{.AUTHORIZATION_CODE_TABLE}}_user_id FOREIGN KEY (user_id) REFERENCES {{.USER_TABLE}}(user_id) ON DELETE CASCADE
+);
+
+INSERT INTO {{.PERMISSION_TABLE}} (permission_id, name, description) VALUES
+    (md5('clients:write'), 'clients:write', 'Register and remove OAuth clients')
+ON CONFLICT (name) DO NOTHING;
@@ -0,0 +1,3 @@
+DELETE FROM {{.PERMISSION_TABLE}} WHERE name = 'service_accounts:write';
+DROP TABLE IF EXISTS {{.API_KEY_TABLE}};
+DROP TABLE IF EXISTS {{.SERVICE_ACCOUNT_TABLE}};
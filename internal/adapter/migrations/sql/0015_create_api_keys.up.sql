@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS {{.SERVICE_ACCOUNT_TABLE}} (
+    service_account_id VARCHAR(255) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS {{.API_KEY_TABLE}} (
+    key_id VARCHAR(255) PRIMARY KEY,
+    service_account_id VARCHAR(255) NOT NULL,
+    prefix VARCHAR(32) NOT NULL UNIQUE,
+    secret_hash VARCHAR(64) NOT NULL,
+    scopes TEXT[] NOT NULL,
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_{{.API_KEY_TABLE}}_service_account_id FOREIGN KEY (service_account_id) REFERENCES {{.SERVICE_ACCOUNT_TABLE}}(service_account_id) ON DELETE CASCADE
+);
+
+INSERT INTO {{.PERMISSION_TABLE}} (permission_id, name, description) VALUES
+    (md5('service_accounts:write'), 'service_accounts:write', 'Manage service accounts and their API keys')
+ON CONFLICT (name) DO NOTHING;
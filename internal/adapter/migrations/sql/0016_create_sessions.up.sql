@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS {{.SESSION_TABLE}} (
+    session_id VARCHAR(255) PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_address VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    last_seen_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    CONSTRAINT fk_{{.SESSION_TABLE}}_user_id FOREIGN KEY (user_id) REFERENCES {{.USER_TABLE}}(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_{{.SESSION_TABLE}}_user_id ON {{.SESSION_TABLE}} (user_id);
+
+-- Every refresh token family is a session. Families started before sessions
+-- were recorded are listed without device details.
+INSERT INTO {{.SESSION_TABLE}} (session_id, user_id, created_at, last_seen_at, expires_at, revoked_at)
+SELECT family_id, user_id, MIN(created_at), MAX(created_at), MAX(expires_at),
+    CASE WHEN COUNT(*) FILTER (WHERE revoked_at IS NULL) = 0 THEN MAX(revoked_at) END
+FROM {{.REFRESH_TOKEN_TABLE}}
+GROUP BY family_id, user_id
+ON CONFLICT (session_id) DO NOTHING;
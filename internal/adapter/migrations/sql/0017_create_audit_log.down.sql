@@ -0,0 +1,2 @@
+DELETE FROM {{.PERMISSION_TABLE}} WHERE name = 'users:impersonate';
+DROP TABLE IF EXISTS {{.AUDIT_LOG_TABLE}};
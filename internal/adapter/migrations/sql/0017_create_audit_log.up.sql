@@ -0,0 +1,23 @@
+-- Entries outlive the users they mention, so user and actor IDs are not
+-- foreign keys.
+CREATE TABLE IF NOT EXISTS {{.AUDIT_LOG_TABLE}} (
+    audit_id VARCHAR(255) PRIMARY KEY,
+    action VARCHAR(64) NOT NULL,
+    actor_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    token_id VARCHAR(255) NOT NULL,
+    method VARCHAR(16) NOT NULL DEFAULT '',
+    path TEXT NOT NULL DEFAULT '',
+    status INTEGER NOT NULL DEFAULT 0,
+    reason TEXT NOT NULL DEFAULT '',
+    ip_address VARCHAR(64) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_{{.AUDIT_LOG_TABLE}}_user_id ON {{.AUDIT_LOG_TABLE}} (user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_{{.AUDIT_LOG_TABLE}}_actor_id ON {{.AUDIT_LOG_TABLE}} (actor_id, created_at);
+
+INSERT INTO {{.PERMISSION_TABLE}} (permission_id, name, description) VALUES
+    (md5('users:impersonate'), 'users:impersonate', 'Act as another user and read the impersonation audit log')
+ON CONFLICT (name) DO NOTHING;
@@ -0,0 +1 @@
+ALTER TABLE {{.SESSION_TABLE}} DROP COLUMN IF EXISTS mfa;
@@ -0,0 +1,3 @@
+-- Sessions started before this was recorded are treated as not having passed
+-- a second factor.
+ALTER TABLE {{.SESSION_TABLE}} ADD COLUMN IF NOT EXISTS mfa BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+ALTER TABLE {{.SESSION_TABLE}} DROP COLUMN IF EXISTS auth_time;
+ALTER TABLE {{.SESSION_TABLE}} DROP COLUMN IF EXISTS client_id;
@@ -0,0 +1,6 @@
+-- Sessions started before this was recorded were not granted to a client and
+-- are treated as authenticated when they started.
+ALTER TABLE {{.SESSION_TABLE}} ADD COLUMN IF NOT EXISTS client_id VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE {{.SESSION_TABLE}} ADD COLUMN IF NOT EXISTS auth_time TIMESTAMP;
+UPDATE {{.SESSION_TABLE}} SET auth_time = created_at WHERE auth_time IS NULL;
+ALTER TABLE {{.SESSION_TABLE}} ALTER COLUMN auth_time SET NOT NULL;
@@ -0,0 +1,25 @@
+package notifier
+
+import (
+	"fmt"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
+)
+
+// LogNotifier delivers notifications by writing them to the service logs.
+// It is intended for local development until a real email provider is wired in.
+type LogNotifier struct {
+	logger ports.LoggerService
+}
+
+func NewLogNotifier(logger ports.LoggerService) *LogNotifier {
+	return &LogNotifier{
+		logger: logger,
+	}
+}
+
+func (n *LogNotifier) Send(notification domain.Notification) error {
+	n.logger.Info(fmt.Sprintf("Notification to %s [%s]: %s", notification.Recipient, notification.Subject, notification.Message))
+	return nil
+}
@@ -0,0 +1,64 @@
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
+)
+
+// LogSMSSender delivers text messages by writing them to the service logs.
+// It is intended for local development until a real SMS gateway is wired in.
+type LogSMSSender struct {
+	logger ports.LoggerService
+}
+
+func NewLogSMSSender(logger ports.LoggerService) *LogSMSSender {
+	return &LogSMSSender{
+		logger: logger,
+	}
+}
+
+func (s *LogSMSSender) SendSMS(message domain.SMSMessage) error {
+	s.logger.Info(fmt.Sprintf("SMS to %s: %s", message.PhoneNumber, message.Message))
+	return nil
+}
+
+// FileSMSSender delivers text messages by appending them, one JSON object per
+// line, to a local outbox file that tests and developers can read back.
+type FileSMSSender struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileSMSSender(path string) *FileSMSSender {
+	return &FileSMSSender{
+		path: path,
+	}
+}
+
+func (s *FileSMSSender) SendSMS(message domain.SMSMessage) error {
+	line, err := json.Marshal(struct {
+		domain.SMSMessage
+		SentAt time.Time `json:"sent_at"`
+	}{message, time.Now()})
+	if err != nil {
+		return fmt.Errorf("send sms: failed to encode message: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("send sms: failed to open outbox %s: %w", s.path, err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("send sms: failed to write to outbox %s: %w", s.path, err)
+	}
+	return nil
+}
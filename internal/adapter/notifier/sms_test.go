@@ -0,0 +1,50 @@
+package notifier
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+)
+
+func TestFileSMSSender(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	sender := NewFileSMSSender(path)
+
+	messages := []domain.SMSMessage{
+		{PhoneNumber: "+254712345678", Message: "Your code is 123456"},
+		{PhoneNumber: "+254712345679", Message: "Your code is 654321"},
+	}
+	for _, message := range messages {
+		if err := sender.SendSMS(message); err != nil {
+			t.Fatalf("error sending sms: %v", err)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("error opening outbox: %v", err)
+	}
+	defer file.Close()
+
+	sent := []domain.SMSMessage{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var message domain.SMSMessage
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			t.Fatalf("error decoding outbox line %q: %v", scanner.Text(), err)
+		}
+		sent = append(sent, message)
+	}
+	if len(sent) != len(messages) {
+		t.Fatalf("expected %d messages in outbox, got %d", len(messages), len(sent))
+	}
+	for i := range messages {
+		if sent[i] != messages[i] {
+			t.Errorf("expected message %d to be %+v, got %+v", i, messages[i], sent[i])
+		}
+	}
+}
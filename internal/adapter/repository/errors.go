@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/lib/pq"
+)
+
+// Postgres error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pqUniqueViolation     = "23505"
+	pqForeignKeyViolation = "23503"
+)
+
+// translateError converts database errors into domain errors so that callers
+// never depend on database/sql or lib/pq. entity names the record involved,
+// e.g. "user" or "refresh_token", and prefixes the resulting error code.
+func translateError(err error, entity string) error {
+	if err == nil {
+		return nil
+	}
+	var domainErr *domain.Error
+	if errors.As(err, &domainErr) {
+		return err
+	}
+
+	name := strings.ReplaceAll(entity, "_", " ")
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound(entity).WithCause(err)
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case pqUniqueViolation:
+			return domain.NewError(domain.ErrAlreadyExists, entity+"_already_exists", name+" already exists").WithCause(err)
+		case pqForeignKeyViolation:
+			return domain.NewError(domain.ErrConflict, entity+"_conflict", name+" conflicts with related records").WithCause(err)
+		}
+	}
+	return fmt.Errorf("%s: %w", name, err)
+}
+
+func notFound(entity string) *domain.Error {
+	if entity == "user" {
+		return domain.ErrUserNotFound
+	}
+	return domain.NewError(domain.ErrNotFound, entity+"_not_found", strings.ReplaceAll(entity, "_", " ")+" not found")
+}
+
+// requireAffected reports a not found error when a statement changed no rows.
+func requireAffected(result sql.Result, entity string) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return translateError(err, entity)
+	}
+	if affected == 0 {
+		return notFound(entity)
+	}
+	return nil
+}
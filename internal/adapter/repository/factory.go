@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/AntonyIS/usafi-hub-user-service/config"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
+)
+
+// repositoryFactory hands out repositories that all share a single connection pool.
+type repositoryFactory struct {
+	client *postgresClient
+}
+
+func NewRepositoryFactory(db *sql.DB, config config.Config) *repositoryFactory {
+	return &repositoryFactory{
+		client: &postgresClient{
+			db:                       db,
+			usersTablename:           config.USER_TABLE,
+			rolesTablename:           config.ROLE_TABLE,
+			rolesUsersTablename:      config.USER_ROLE_TABLE,
+			passwordResetTablename:   config.PASSWORD_RESET_TABLE,
+			refreshTokensTablename:   config.REFRESH_TOKEN_TABLE,
+			revokedTokensTablename:   config.REVOKED_TOKEN_TABLE,
+			userRevocationTablename:  config.USER_REVOCATION_TABLE,
+			permissionsTablename:     config.PERMISSION_TABLE,
+			rolePermissionsTablename: config.ROLE_PERMISSION_TABLE,
+			loginAttemptsTablename:   config.LOGIN_ATTEMPT_TABLE,
+			oneTimeCodesTablename:    config.ONE_TIME_CODE_TABLE,
+			totpSecretsTablename:     config.TOTP_SECRET_TABLE,
+			recoveryCodesTablename:   config.RECOVERY_CODE_TABLE,
+			signingKeysTablename:     config.SIGNING_KEY_TABLE,
+			oauthClientsTablename:    config.OAUTH_CLIENT_TABLE,
+			authCodesTablename:       config.AUTHORIZATION_CODE_TABLE,
+			serviceAccountsTablename: config.SERVICE_ACCOUNT_TABLE,
+			apiKeysTablename:         config.API_KEY_TABLE,
+			sessionsTablename:        config.SESSION_TABLE,
+			auditLogTablename:        config.AUDIT_LOG_TABLE,
+			tablenames:               []string{config.SCHEMA_MIGRATION_TABLE, config.AUDIT_LOG_TABLE, config.SESSION_TABLE, config.API_KEY_TABLE, config.SERVICE_ACCOUNT_TABLE, config.AUTHORIZATION_CODE_TABLE, config.OAUTH_CLIENT_TABLE, config.SIGNING_KEY_TABLE, config.RECOVERY_CODE_TABLE, config.TOTP_SECRET_TABLE, config.ONE_TIME_CODE_TABLE, config.LOGIN_ATTEMPT_TABLE, config.ROLE_PERMISSION_TABLE, config.PERMISSION_TABLE, config.USER_REVOCATION_TABLE, config.REVOKED_TOKEN_TABLE, config.REFRESH_TOKEN_TABLE, config.PASSWORD_RESET_TABLE, config.USER_ROLE_TABLE, config.ROLE_TABLE, config.USER_TABLE, "roles"},
+		},
+	}
+}
+
+func (f *repositoryFactory) UserRepository() ports.UserRepository {
+	return f.client
+}
+
+func (f *repositoryFactory) RoleRepository() ports.RoleRepository {
+	return f.client
+}
+
+func (f *repositoryFactory) UserRoleRepository() ports.UserRoleRepository {
+	return f.client
+}
+
+func (f *repositoryFactory) PasswordResetRepository() ports.PasswordResetRepository {
+	return f.client
+}
+
+func (f *repositoryFactory) TokenRepository() ports.TokenRepository {
+	return f.client
+}
+
+func (f *repositoryFactory) RevocationRepository() ports.RevocationRepository {
+	return f.client
+}
+
+func (f *repositoryFactory) LoginAttemptRepository() ports.LoginAttemptRepository {
+	return f.client
+}
+
+func (f *repositoryFactory) OneTimeCodeRepository() ports.OneTimeCodeRepository {
+	return f.client
+}
+
+func (f *repositoryFactory) MFARepository() ports.MFARepository {
+	return f.client
+}
+
+func (f *repositoryFactory) SigningKeyRepository() ports.SigningKeyRepository {
+	return f.client
+}
+
+func (f *repositoryFactory) OAuthRepository() ports.OAuthRepository {
+	return f.client
+}
+
+func (f *repositoryFactory) APIKeyRepository() ports.APIKeyRepository {
+	return f.client
+}
+
+func (f *repositoryFactory) SessionRepository() ports.SessionRepository {
+	return f.client
+}
+
+func (f *repositoryFactory) AuditRepository() ports.AuditRepository {
+	return f.client
+}
+
+func (f *repositoryFactory) BaseRepository() ports.BaseRepository {
+	return f.client
+}
@@ -1,349 +1,1253 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/AntonyIS/usafi-hub-user-service/config"
 	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type postgresClient struct {
 	db *sql.DB
 	// logger              ports.LoggerService
-	usersTablename      string
-	rolesTablename      string
-	rolesUsersTablename string
-	tablenames          []string
+	usersTablename           string
+	rolesTablename           string
+	rolesUsersTablename      string
+	passwordResetTablename   string
+	refreshTokensTablename   string
+	revokedTokensTablename   string
+	userRevocationTablename  string
+	permissionsTablename     string
+	rolePermissionsTablename string
+	loginAttemptsTablename   string
+	oneTimeCodesTablename    string
+	totpSecretsTablename     string
+	recoveryCodesTablename   string
+	signingKeysTablename     string
+	oauthClientsTablename    string
+	authCodesTablename       string
+	serviceAccountsTablename string
+	apiKeysTablename         string
+	sessionsTablename        string
+	auditLogTablename        string
+	tablenames               []string
 }
 
-func NewBasePostgresClient(config config.Config) (*postgresClient, error) {
+// NewPostgresDB opens the connection pool shared by every repository. The
+// schema is managed by the migrations package and is expected to be up to date.
+func NewPostgresDB(config config.Config) (*sql.DB, error) {
 	dbname := config.POSTGRES_DB
-	tablenames := []string{config.USER_ROLE_TABLE, config.ROLE_TABLE, config.USER_TABLE, "roles"}
 	user := config.POSTGRES_USER
 	password := config.POSTGRES_PASSWORD
 	port := config.POSTGRES_PORT
 	host := config.POSTGRES_HOST
+	statementTimeout := config.DB_STATEMENT_TIMEOUT.Milliseconds()
 
-	dsn := fmt.Sprintf("host=%s port=%s user=%s dbname=%s password=%s sslmode=disable", host, port, user, dbname, password)
+	dsn := fmt.Sprintf("host=%s port=%s user=%s dbname=%s password=%s sslmode=disable statement_timeout=%d", host, port, user, dbname, password, statementTimeout)
 
 	db, err := sql.Open("postgres", dsn)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to open postgres connection pool: %v", err)
 	}
 
+	db.SetMaxOpenConns(config.DB_MAX_OPEN_CONNS)
+	db.SetMaxIdleConns(config.DB_MAX_IDLE_CONNS)
+	db.SetConnMaxLifetime(config.DB_CONN_MAX_LIFETIME)
+	db.SetConnMaxIdleTime(config.DB_CONN_MAX_IDLE_TIME)
+
 	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to reach postgres database %s at %s:%s: %v", dbname, host, port, err)
+	}
+	return db, nil
+}
+
+// userColumns lists the users table columns in the order scanUser reads them.
+const userColumns = "user_id, username, password_hash, email, fullname, phone_number, avatar, address, created_at, updated_at, email_verified_at, phone_verified_at, mfa_enabled_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row rowScanner) (*domain.User, error) {
+	user := &domain.User{}
+	var emailVerifiedAt, phoneVerifiedAt, mfaEnabledAt sql.NullTime
+	err := row.Scan(&user.UserId, &user.Username, &user.PasswordHash, &user.Email, &user.FullName, &user.PhoneNumber, &user.Avatar, &user.Address, &user.CreatedAt, &user.UpdatedAt, &emailVerifiedAt, &phoneVerifiedAt, &mfaEnabledAt)
 	if err != nil {
 		return nil, err
 	}
+	if emailVerifiedAt.Valid {
+		user.EmailVerifiedAt = &emailVerifiedAt.Time
+	}
+	if phoneVerifiedAt.Valid {
+		user.PhoneVerifiedAt = &phoneVerifiedAt.Time
+	}
+	if mfaEnabledAt.Valid {
+		user.MFAEnabledAt = &mfaEnabledAt.Time
+	}
+	return user, nil
+}
 
-	return &postgresClient{
-		db:                  db,
-		usersTablename:      config.USER_TABLE,
-		rolesTablename:      config.ROLE_TABLE,
-		rolesUsersTablename: config.USER_ROLE_TABLE,
-		tablenames:          tablenames,
-	}, nil
+// prefixColumns qualifies each of the comma-separated columns with alias.
+func prefixColumns(alias, columns string) string {
+	parts := strings.Split(columns, ", ")
+	for i, part := range parts {
+		parts[i] = alias + "." + part
+	}
+	return strings.Join(parts, ", ")
 }
 
-func NewUserPostgresClient(config config.Config) (*postgresClient, error) {
-	dbname := config.POSTGRES_DB
-	tablename := config.USER_TABLE
-	user := config.POSTGRES_USER
-	password := config.POSTGRES_PASSWORD
-	port := config.POSTGRES_PORT
-	host := config.POSTGRES_HOST
+func (svc postgresClient) CreateUser(ctx context.Context, user domain.User) (*domain.User, error) {
 
-	dsn := fmt.Sprintf("host=%s port=%s user=%s dbname=%s password=%s sslmode=disable", host, port, user, dbname, password)
+	query := fmt.Sprintf(`
+        INSERT INTO %s (user_id, username, password_hash, email, fullname, phone_number, avatar, address, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+    `, svc.usersTablename)
+	_, err := svc.db.ExecContext(ctx, query,
+		user.UserId,
+		user.Username,
+		user.PasswordHash,
+		user.Email,
+		user.FullName,
+		user.PhoneNumber,
+		user.Avatar,
+		user.Address,
+		user.CreatedAt,
+		user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, translateError(err, "user")
+	}
+	return svc.GetUserById(ctx, user.UserId)
+}
 
-	db, err := sql.Open("postgres", dsn)
+func (svc postgresClient) GetUserById(ctx context.Context, userId string) (*domain.User, error) {
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM %s
+        WHERE user_id = $1
+    `, userColumns, svc.usersTablename)
+	user, err := scanUser(svc.db.QueryRowContext(ctx, query, userId))
+	if err != nil {
+		return nil, translateError(err, "user")
+	}
+	return user, nil
+}
+
+func (svc postgresClient) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM %s
+        WHERE email = $1
+    `, userColumns, svc.usersTablename)
+	user, err := scanUser(svc.db.QueryRowContext(ctx, query, email))
+	if err != nil {
+		return nil, translateError(err, "user")
+	}
+
+	return user, nil
+}
+
+// GetUserByVerifiedPhoneNumber returns the user who verified phoneNumber. At
+// most one user can have verified a given number.
+func (svc postgresClient) GetUserByVerifiedPhoneNumber(ctx context.Context, phoneNumber string) (*domain.User, error) {
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM %s
+        WHERE phone_number = $1 AND phone_verified_at IS NOT NULL
+    `, userColumns, svc.usersTablename)
+	user, err := scanUser(svc.db.QueryRowContext(ctx, query, phoneNumber))
+	if err != nil {
+		return nil, translateError(err, "user")
+	}
+	return user, nil
+}
+
+func (svc postgresClient) GetUsers(ctx context.Context) ([]*domain.User, error) {
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM %s
+    `, userColumns, svc.usersTablename)
+	rows, err := svc.db.QueryContext(ctx, query)
 	if err != nil {
+		return nil, translateError(err, "user")
+	}
+	defer rows.Close()
+
+	users := []*domain.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, translateError(err, "user")
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err, "user")
+	}
+	return users, nil
+}
+
+func (svc postgresClient) GetUsersWithRole(ctx context.Context, roleName string) ([]*domain.User, error) {
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM %s u
+        JOIN %s ur ON u.user_id = ur.user_id
+        JOIN %s r ON ur.role_id = r.role_id
+        WHERE r.name = $1
+    `, prefixColumns("u", userColumns), svc.usersTablename, svc.rolesUsersTablename, svc.rolesTablename)
+	rows, err := svc.db.QueryContext(ctx, query, roleName)
+	if err != nil {
+		return nil, translateError(err, "user")
+	}
+	defer rows.Close()
+
+	users := []*domain.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, translateError(err, "user")
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err, "user")
+	}
+	return users, nil
+}
+
+// UpdateUser updates the user's profile. The password hash is left untouched;
+// use UpdatePassword to change it. Changing the email or phone number clears
+// its verification.
+func (svc postgresClient) UpdateUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	query := fmt.Sprintf(`
+        UPDATE %s
+        SET username=$2, email=$3, fullname=$4, phone_number=$5, avatar=$6, address=$7, updated_at=$8,
+            email_verified_at = CASE WHEN email = $3 THEN email_verified_at ELSE NULL END,
+            phone_verified_at = CASE WHEN phone_number = $5 THEN phone_verified_at ELSE NULL END
+        WHERE user_id=$1
+    `, svc.usersTablename)
+	result, err := svc.db.ExecContext(ctx, query, user.UserId, user.Username, user.Email, user.FullName, user.PhoneNumber, user.Avatar, user.Address, user.UpdatedAt)
+	if err != nil {
+		return nil, translateError(err, "user")
+	}
+	if err := requireAffected(result, "user"); err != nil {
 		return nil, err
 	}
+	return svc.GetUserById(ctx, user.UserId)
+}
 
-	err = db.Ping()
+func (svc postgresClient) UpdatePassword(ctx context.Context, userId, passwordHash string) error {
+	tx, err := svc.db.BeginTx(ctx, nil)
+	if err != nil {
+		return translateError(err, "user")
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`
+        UPDATE %s
+        SET password_hash=$2, updated_at=$3
+        WHERE user_id=$1
+    `, svc.usersTablename)
+	result, err := tx.ExecContext(ctx, query, userId, passwordHash, time.Now())
+	if err != nil {
+		return translateError(err, "user")
+	}
+	if err := requireAffected(result, "user"); err != nil {
+		return err
+	}
+
+	deleteQuery := fmt.Sprintf(`
+        DELETE FROM %s
+        WHERE user_id=$1
+    `, svc.passwordResetTablename)
+	_, err = tx.ExecContext(ctx, deleteQuery, userId)
+	if err != nil {
+		return translateError(err, "user")
+	}
+	return translateError(tx.Commit(), "user")
+}
+
+// MarkEmailVerified records that the user verified email. Nothing is updated,
+// and not found is returned, if the user's email has changed since.
+func (svc postgresClient) MarkEmailVerified(ctx context.Context, userId, email string, verifiedAt time.Time) error {
+	query := fmt.Sprintf(`
+        UPDATE %s
+        SET email_verified_at=$3
+        WHERE user_id=$1 AND email=$2
+    `, svc.usersTablename)
+	result, err := svc.db.ExecContext(ctx, query, userId, email, verifiedAt)
+	if err != nil {
+		return translateError(err, "user")
+	}
+	return requireAffected(result, "user")
+}
+
+// MarkPhoneVerified records that the user verified phoneNumber. Nothing is
+// updated, and not found is returned, if the user's number has changed since.
+func (svc postgresClient) MarkPhoneVerified(ctx context.Context, userId, phoneNumber string, verifiedAt time.Time) error {
+	query := fmt.Sprintf(`
+        UPDATE %s
+        SET phone_verified_at=$3
+        WHERE user_id=$1 AND phone_number=$2
+    `, svc.usersTablename)
+	result, err := svc.db.ExecContext(ctx, query, userId, phoneNumber, verifiedAt)
+	if err != nil {
+		return translateError(err, "user")
+	}
+	return requireAffected(result, "user")
+}
+
+func (svc postgresClient) DeleteUser(ctx context.Context, userId string) error {
+	query := fmt.Sprintf(`
+        DELETE FROM %s
+        WHERE user_id=$1
+    `, svc.usersTablename)
+	result, err := svc.db.ExecContext(ctx, query, userId)
+	if err != nil {
+		return translateError(err, "user")
+	}
+	return requireAffected(result, "user")
+}
+
+func (svc postgresClient) CreatePasswordResetToken(ctx context.Context, token domain.PasswordResetToken) error {
+	query := fmt.Sprintf(`
+        INSERT INTO %s (token_hash, user_id, expires_at, created_at)
+        VALUES ($1, $2, $3, $4)
+    `, svc.passwordResetTablename)
+	_, err := svc.db.ExecContext(ctx, query, token.TokenHash, token.UserId, token.ExpiresAt, token.CreatedAt)
+	if err != nil {
+		return translateError(err, "password_reset_token")
+	}
+	return nil
+}
+
+// GetPasswordResetToken looks a reset token up without using it up.
+func (svc postgresClient) GetPasswordResetToken(ctx context.Context, tokenHash string) (*domain.PasswordResetToken, error) {
+	query := fmt.Sprintf(`
+        SELECT token_hash, user_id, expires_at, created_at
+        FROM %s
+        WHERE token_hash=$1
+    `, svc.passwordResetTablename)
+	row := svc.db.QueryRowContext(ctx, query, tokenHash)
+	token := &domain.PasswordResetToken{}
+	err := row.Scan(&token.TokenHash, &token.UserId, &token.ExpiresAt, &token.CreatedAt)
+	if err != nil {
+		return nil, translateError(err, "password_reset_token")
+	}
+	return token, nil
+}
+
+func (svc postgresClient) ConsumePasswordResetToken(ctx context.Context, tokenHash string) (*domain.PasswordResetToken, error) {
+	query := fmt.Sprintf(`
+        DELETE FROM %s
+        WHERE token_hash=$1
+        RETURNING token_hash, user_id, expires_at, created_at
+    `, svc.passwordResetTablename)
+	row := svc.db.QueryRowContext(ctx, query, tokenHash)
+	token := &domain.PasswordResetToken{}
+	err := row.Scan(&token.TokenHash, &token.UserId, &token.ExpiresAt, &token.CreatedAt)
+	if err != nil {
+		return nil, translateError(err, "password_reset_token")
+	}
+	return token, nil
+}
+
+// SaveOneTimeCode stores code, replacing any code the user has for the same purpose.
+func (svc postgresClient) SaveOneTimeCode(ctx context.Context, code domain.OneTimeCode) error {
+	query := fmt.Sprintf(`
+        INSERT INTO %s (user_id, purpose, recipient, code_hash, attempts, expires_at, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        ON CONFLICT (user_id, purpose) DO UPDATE SET
+            recipient = EXCLUDED.recipient,
+            code_hash = EXCLUDED.code_hash,
+            attempts = EXCLUDED.attempts,
+            expires_at = EXCLUDED.expires_at,
+            created_at = EXCLUDED.created_at
+    `, svc.oneTimeCodesTablename)
+	_, err := svc.db.ExecContext(ctx, query, code.UserId, code.Purpose, code.Recipient, code.CodeHash, code.Attempts, code.ExpiresAt, code.CreatedAt)
+	if err != nil {
+		return translateError(err, "one_time_code")
+	}
+	return nil
+}
+
+func (svc postgresClient) GetOneTimeCode(ctx context.Context, userId, purpose string) (*domain.OneTimeCode, error) {
+	query := fmt.Sprintf(`
+        SELECT user_id, purpose, recipient, code_hash, attempts, expires_at, created_at
+        FROM %s
+        WHERE user_id = $1 AND purpose = $2
+    `, svc.oneTimeCodesTablename)
+	row := svc.db.QueryRowContext(ctx, query, userId, purpose)
+	code := &domain.OneTimeCode{}
+	err := row.Scan(&code.UserId, &code.Purpose, &code.Recipient, &code.CodeHash, &code.Attempts, &code.ExpiresAt, &code.CreatedAt)
+	if err != nil {
+		return nil, translateError(err, "one_time_code")
+	}
+	return code, nil
+}
+
+// IncrementOneTimeCodeAttempts counts an attempt at the user's code for
+// purpose. It returns not found if there is none or it already had
+// maxAttempts, in the same statement, so that concurrent guesses cannot
+// exceed the limit.
+func (svc postgresClient) IncrementOneTimeCodeAttempts(ctx context.Context, userId, purpose string, maxAttempts int) error {
+	query := fmt.Sprintf(`
+        UPDATE %s
+        SET attempts = attempts + 1
+        WHERE user_id = $1 AND purpose = $2 AND attempts < $3
+    `, svc.oneTimeCodesTablename)
+	result, err := svc.db.ExecContext(ctx, query, userId, purpose, maxAttempts)
+	if err != nil {
+		return translateError(err, "one_time_code")
+	}
+	return requireAffected(result, "one_time_code")
+}
+
+// DeleteOneTimeCode removes the user's code for purpose. It returns not found
+// if there is none, so that concurrent requests cannot both use the same code.
+func (svc postgresClient) DeleteOneTimeCode(ctx context.Context, userId, purpose string) error {
+	query := fmt.Sprintf(`
+        DELETE FROM %s
+        WHERE user_id = $1 AND purpose = $2
+    `, svc.oneTimeCodesTablename)
+	result, err := svc.db.ExecContext(ctx, query, userId, purpose)
+	if err != nil {
+		return translateError(err, "one_time_code")
+	}
+	return requireAffected(result, "one_time_code")
+}
+
+// SaveTOTPSecret stores a new, unconfirmed TOTP secret for the user,
+// replacing any secret the user started to enrol earlier.
+func (svc postgresClient) SaveTOTPSecret(ctx context.Context, secret domain.TOTPSecret) error {
+	query := fmt.Sprintf(`
+        INSERT INTO %s (user_id, encrypted_secret, last_used_step, confirmed_at, created_at)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (user_id) DO UPDATE SET
+            encrypted_secret = EXCLUDED.encrypted_secret,
+            last_used_step = EXCLUDED.last_used_step,
+            confirmed_at = EXCLUDED.confirmed_at,
+            created_at = EXCLUDED.created_at
+    `, svc.totpSecretsTablename)
+	_, err := svc.db.ExecContext(ctx, query, secret.UserId, secret.EncryptedSecret, secret.LastUsedStep, secret.ConfirmedAt, secret.CreatedAt)
+	if err != nil {
+		return translateError(err, "totp_secret")
+	}
+	return nil
+}
+
+func (svc postgresClient) GetTOTPSecret(ctx context.Context, userId string) (*domain.TOTPSecret, error) {
+	query := fmt.Sprintf(`
+        SELECT user_id, encrypted_secret, last_used_step, confirmed_at, created_at
+        FROM %s
+        WHERE user_id = $1
+    `, svc.totpSecretsTablename)
+	row := svc.db.QueryRowContext(ctx, query, userId)
+	secret := &domain.TOTPSecret{}
+	var confirmedAt sql.NullTime
+	err := row.Scan(&secret.UserId, &secret.EncryptedSecret, &secret.LastUsedStep, &confirmedAt, &secret.CreatedAt)
+	if err != nil {
+		return nil, translateError(err, "totp_secret")
+	}
+	if confirmedAt.Valid {
+		secret.ConfirmedAt = &confirmedAt.Time
+	}
+	return secret, nil
+}
+
+// UseTOTPStep records that the code for step was used. It reports false if
+// that step or a later one was used already, so that a code cannot be replayed.
+func (svc postgresClient) UseTOTPStep(ctx context.Context, userId string, step int64) (bool, error) {
+	query := fmt.Sprintf(`
+        UPDATE %s
+        SET last_used_step = $2
+        WHERE user_id = $1 AND last_used_step < $2
+    `, svc.totpSecretsTablename)
+	result, err := svc.db.ExecContext(ctx, query, userId, step)
+	if err != nil {
+		return false, translateError(err, "totp_secret")
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, translateError(err, "totp_secret")
+	}
+	return affected == 1, nil
+}
+
+// EnableMFA confirms the user's TOTP secret, replaces their recovery codes and
+// marks two-factor authentication as enabled, all in one transaction.
+func (svc postgresClient) EnableMFA(ctx context.Context, userId string, recoveryCodeHashes []string, enabledAt time.Time) error {
+	tx, err := svc.db.BeginTx(ctx, nil)
+	if err != nil {
+		return translateError(err, "totp_secret")
+	}
+	defer tx.Rollback()
+
+	confirmQuery := fmt.Sprintf(`
+        UPDATE %s
+        SET confirmed_at=$2
+        WHERE user_id=$1
+    `, svc.totpSecretsTablename)
+	result, err := tx.ExecContext(ctx, confirmQuery, userId, enabledAt)
+	if err != nil {
+		return translateError(err, "totp_secret")
+	}
+	if err := requireAffected(result, "totp_secret"); err != nil {
+		return err
+	}
+
+	deleteQuery := fmt.Sprintf(`
+        DELETE FROM %s
+        WHERE user_id=$1
+    `, svc.recoveryCodesTablename)
+	if _, err := tx.ExecContext(ctx, deleteQuery, userId); err != nil {
+		return translateError(err, "recovery_code")
+	}
+	insertQuery := fmt.Sprintf(`
+        INSERT INTO %s (user_id, code_hash, created_at)
+        VALUES ($1, $2, $3)
+    `, svc.recoveryCodesTablename)
+	for _, codeHash := range recoveryCodeHashes {
+		if _, err := tx.ExecContext(ctx, insertQuery, userId, codeHash, enabledAt); err != nil {
+			return translateError(err, "recovery_code")
+		}
+	}
+
+	userQuery := fmt.Sprintf(`
+        UPDATE %s
+        SET mfa_enabled_at=$2
+        WHERE user_id=$1
+    `, svc.usersTablename)
+	result, err = tx.ExecContext(ctx, userQuery, userId, enabledAt)
+	if err != nil {
+		return translateError(err, "user")
+	}
+	if err := requireAffected(result, "user"); err != nil {
+		return err
+	}
+	return translateError(tx.Commit(), "user")
+}
+
+// DisableMFA removes the user's TOTP secret and recovery codes and marks
+// two-factor authentication as disabled.
+func (svc postgresClient) DisableMFA(ctx context.Context, userId string) error {
+	tx, err := svc.db.BeginTx(ctx, nil)
+	if err != nil {
+		return translateError(err, "user")
+	}
+	defer tx.Rollback()
+
+	userQuery := fmt.Sprintf(`
+        UPDATE %s
+        SET mfa_enabled_at=NULL
+        WHERE user_id=$1
+    `, svc.usersTablename)
+	result, err := tx.ExecContext(ctx, userQuery, userId)
+	if err != nil {
+		return translateError(err, "user")
+	}
+	if err := requireAffected(result, "user"); err != nil {
+		return err
+	}
+
+	for _, tablename := range []string{svc.recoveryCodesTablename, svc.totpSecretsTablename} {
+		query := fmt.Sprintf(`
+        DELETE FROM %s
+        WHERE user_id=$1
+    `, tablename)
+		if _, err := tx.ExecContext(ctx, query, userId); err != nil {
+			return translateError(err, "user")
+		}
+	}
+	return translateError(tx.Commit(), "user")
+}
+
+// UseRecoveryCode marks one of the user's unused recovery codes as used. It
+// reports false if the code does not exist or was used already.
+func (svc postgresClient) UseRecoveryCode(ctx context.Context, userId, codeHash string, usedAt time.Time) (bool, error) {
+	query := fmt.Sprintf(`
+        UPDATE %s
+        SET used_at=$3
+        WHERE user_id=$1 AND code_hash=$2 AND used_at IS NULL
+    `, svc.recoveryCodesTablename)
+	result, err := svc.db.ExecContext(ctx, query, userId, codeHash, usedAt)
+	if err != nil {
+		return false, translateError(err, "recovery_code")
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, translateError(err, "recovery_code")
+	}
+	return affected == 1, nil
+}
+
+func (svc postgresClient) CreateSigningKey(ctx context.Context, key domain.SigningKey) error {
+	query := fmt.Sprintf(`
+        INSERT INTO %s (key_id, algorithm, private_key, public_key, activates_at, retires_at, expires_at, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+    `, svc.signingKeysTablename)
+	_, err := svc.db.ExecContext(ctx, query, key.KeyId, key.Algorithm, key.EncryptedPrivateKey, key.PublicKey, key.ActivatesAt, key.RetiresAt, key.ExpiresAt, key.CreatedAt)
+	if err != nil {
+		return translateError(err, "signing_key")
+	}
+	return nil
+}
+
+// GetSigningKeys returns the keys that have not expired at the given time,
+// oldest activation first.
+func (svc postgresClient) GetSigningKeys(ctx context.Context, at time.Time) ([]domain.SigningKey, error) {
+	query := fmt.Sprintf(`
+        SELECT key_id, algorithm, private_key, public_key, activates_at, retires_at, expires_at, created_at
+        FROM %s
+        WHERE expires_at > $1
+        ORDER BY activates_at, created_at
+    `, svc.signingKeysTablename)
+	rows, err := svc.db.QueryContext(ctx, query, at)
+	if err != nil {
+		return nil, translateError(err, "signing_key")
+	}
+	defer rows.Close()
+
+	keys := []domain.SigningKey{}
+	for rows.Next() {
+		var key domain.SigningKey
+		err := rows.Scan(&key.KeyId, &key.Algorithm, &key.EncryptedPrivateKey, &key.PublicKey, &key.ActivatesAt, &key.RetiresAt, &key.ExpiresAt, &key.CreatedAt)
+		if err != nil {
+			return nil, translateError(err, "signing_key")
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err, "signing_key")
+	}
+	return keys, nil
+}
+
+func (svc postgresClient) DeleteExpiredSigningKeys(ctx context.Context, at time.Time) error {
+	query := fmt.Sprintf(`
+        DELETE FROM %s
+        WHERE expires_at <= $1
+    `, svc.signingKeysTablename)
+	_, err := svc.db.ExecContext(ctx, query, at)
+	if err != nil {
+		return translateError(err, "signing_key")
+	}
+	return nil
+}
+
+func (svc postgresClient) CreateClient(ctx context.Context, client domain.OAuthClient) error {
+	query := fmt.Sprintf(`
+        INSERT INTO %s (client_id, client_secret_hash, name, redirect_uris, scopes, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
+    `, svc.oauthClientsTablename)
+	_, err := svc.db.ExecContext(ctx, query, client.ClientId, client.ClientSecretHash, client.Name, pq.Array(client.RedirectURIs), pq.Array(client.Scopes), client.CreatedAt)
+	if err != nil {
+		return translateError(err, "oauth_client")
+	}
+	return nil
+}
+
+const oauthClientColumns = "client_id, client_secret_hash, name, redirect_uris, scopes, created_at"
+
+func scanOAuthClient(row rowScanner) (*domain.OAuthClient, error) {
+	client := &domain.OAuthClient{}
+	err := row.Scan(&client.ClientId, &client.ClientSecretHash, &client.Name, pq.Array(&client.RedirectURIs), pq.Array(&client.Scopes), &client.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func (svc postgresClient) GetClient(ctx context.Context, clientId string) (*domain.OAuthClient, error) {
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM %s
+        WHERE client_id = $1
+    `, oauthClientColumns, svc.oauthClientsTablename)
+	client, err := scanOAuthClient(svc.db.QueryRowContext(ctx, query, clientId))
+	if err != nil {
+		return nil, translateError(err, "oauth_client")
+	}
+	return client, nil
+}
+
+func (svc postgresClient) GetClients(ctx context.Context) ([]*domain.OAuthClient, error) {
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM %s
+        ORDER BY created_at
+    `, oauthClientColumns, svc.oauthClientsTablename)
+	rows, err := svc.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, translateError(err, "oauth_client")
+	}
+	defer rows.Close()
+
+	clients := []*domain.OAuthClient{}
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, translateError(err, "oauth_client")
+		}
+		clients = append(clients, client)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err, "oauth_client")
+	}
+	return clients, nil
+}
+
+func (svc postgresClient) DeleteClient(ctx context.Context, clientId string) error {
+	query := fmt.Sprintf(`
+        DELETE FROM %s
+        WHERE client_id = $1
+    `, svc.oauthClientsTablename)
+	result, err := svc.db.ExecContext(ctx, query, clientId)
+	if err != nil {
+		return translateError(err, "oauth_client")
+	}
+	return requireAffected(result, "oauth_client")
+}
+
+func (svc postgresClient) CreateAuthorizationCode(ctx context.Context, code domain.AuthorizationCode) error {
+	query := fmt.Sprintf(`
+        INSERT INTO %s (code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, auth_time, expires_at, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+    `, svc.authCodesTablename)
+	_, err := svc.db.ExecContext(ctx, query, code.CodeHash, code.ClientId, code.UserId, code.RedirectURI, code.Scope, code.Nonce, code.CodeChallenge, code.AuthTime, code.ExpiresAt, code.CreatedAt)
+	if err != nil {
+		return translateError(err, "authorization_code")
+	}
+	return nil
+}
+
+// ConsumeAuthorizationCode deletes and returns the code with the given hash,
+// so that a code can be exchanged only once even by concurrent requests.
+func (svc postgresClient) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*domain.AuthorizationCode, error) {
+	query := fmt.Sprintf(`
+        DELETE FROM %s
+        WHERE code_hash=$1
+        RETURNING code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, auth_time, expires_at, created_at
+    `, svc.authCodesTablename)
+	row := svc.db.QueryRowContext(ctx, query, codeHash)
+	code := &domain.AuthorizationCode{}
+	err := row.Scan(&code.CodeHash, &code.ClientId, &code.UserId, &code.RedirectURI, &code.Scope, &code.Nonce, &code.CodeChallenge, &code.AuthTime, &code.ExpiresAt, &code.CreatedAt)
+	if err != nil {
+		return nil, translateError(err, "authorization_code")
+	}
+	return code, nil
+}
+
+func (svc postgresClient) CreateServiceAccount(ctx context.Context, account domain.ServiceAccount) error {
+	query := fmt.Sprintf(`
+        INSERT INTO %s (service_account_id, name, description, created_at)
+        VALUES ($1, $2, $3, $4)
+    `, svc.serviceAccountsTablename)
+	_, err := svc.db.ExecContext(ctx, query, account.ServiceAccountId, account.Name, account.Description, account.CreatedAt)
+	if err != nil {
+		return translateError(err, "service_account")
+	}
+	return nil
+}
+
+func (svc postgresClient) GetServiceAccount(ctx context.Context, serviceAccountId string) (*domain.ServiceAccount, error) {
+	query := fmt.Sprintf(`
+        SELECT service_account_id, name, description, created_at
+        FROM %s
+        WHERE service_account_id = $1
+    `, svc.serviceAccountsTablename)
+	account := &domain.ServiceAccount{}
+	err := svc.db.QueryRowContext(ctx, query, serviceAccountId).Scan(&account.ServiceAccountId, &account.Name, &account.Description, &account.CreatedAt)
+	if err != nil {
+		return nil, translateError(err, "service_account")
+	}
+	return account, nil
+}
+
+func (svc postgresClient) GetServiceAccounts(ctx context.Context) ([]*domain.ServiceAccount, error) {
+	query := fmt.Sprintf(`
+        SELECT service_account_id, name, description, created_at
+        FROM %s
+        ORDER BY name
+    `, svc.serviceAccountsTablename)
+	rows, err := svc.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, translateError(err, "service_account")
+	}
+	defer rows.Close()
+
+	accounts := []*domain.ServiceAccount{}
+	for rows.Next() {
+		account := &domain.ServiceAccount{}
+		if err := rows.Scan(&account.ServiceAccountId, &account.Name, &account.Description, &account.CreatedAt); err != nil {
+			return nil, translateError(err, "service_account")
+		}
+		accounts = append(accounts, account)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err, "service_account")
+	}
+	return accounts, nil
+}
+
+// DeleteServiceAccount deletes the account together with its API keys.
+func (svc postgresClient) DeleteServiceAccount(ctx context.Context, serviceAccountId string) error {
+	query := fmt.Sprintf(`
+        DELETE FROM %s
+        WHERE service_account_id = $1
+    `, svc.serviceAccountsTablename)
+	result, err := svc.db.ExecContext(ctx, query, serviceAccountId)
+	if err != nil {
+		return translateError(err, "service_account")
+	}
+	return requireAffected(result, "service_account")
+}
+
+func (svc postgresClient) CreateAPIKey(ctx context.Context, key domain.APIKey) error {
+	query := fmt.Sprintf(`
+        INSERT INTO %s (key_id, service_account_id, prefix, secret_hash, scopes, expires_at, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+    `, svc.apiKeysTablename)
+	_, err := svc.db.ExecContext(ctx, query, key.KeyId, key.ServiceAccountId, key.Prefix, key.SecretHash, pq.Array(key.Scopes), key.ExpiresAt, key.CreatedAt)
+	if err != nil {
+		return translateError(err, "api_key")
+	}
+	return nil
+}
+
+const apiKeyColumns = "key_id, service_account_id, prefix, secret_hash, scopes, expires_at, last_used_at, revoked_at, created_at"
+
+func scanAPIKey(row rowScanner) (*domain.APIKey, error) {
+	key := &domain.APIKey{}
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&key.KeyId, &key.ServiceAccountId, &key.Prefix, &key.SecretHash, pq.Array(&key.Scopes), &expiresAt, &lastUsedAt, &revokedAt, &key.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return key, nil
+}
+
+func (svc postgresClient) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*domain.APIKey, error) {
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM %s
+        WHERE prefix = $1
+    `, apiKeyColumns, svc.apiKeysTablename)
+	key, err := scanAPIKey(svc.db.QueryRowContext(ctx, query, prefix))
+	if err != nil {
+		return nil, translateError(err, "api_key")
+	}
+	return key, nil
+}
+
+func (svc postgresClient) GetAPIKeys(ctx context.Context, serviceAccountId string) ([]*domain.APIKey, error) {
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM %s
+        WHERE service_account_id = $1
+        ORDER BY created_at
+    `, apiKeyColumns, svc.apiKeysTablename)
+	rows, err := svc.db.QueryContext(ctx, query, serviceAccountId)
+	if err != nil {
+		return nil, translateError(err, "api_key")
+	}
+	defer rows.Close()
+
+	keys := []*domain.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, translateError(err, "api_key")
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err, "api_key")
+	}
+	return keys, nil
+}
+
+func (svc postgresClient) RevokeAPIKey(ctx context.Context, serviceAccountId, keyId string, at time.Time) error {
+	query := fmt.Sprintf(`
+        UPDATE %s
+        SET revoked_at = $3
+        WHERE service_account_id = $1 AND key_id = $2 AND revoked_at IS NULL
+    `, svc.apiKeysTablename)
+	result, err := svc.db.ExecContext(ctx, query, serviceAccountId, keyId, at)
+	if err != nil {
+		return translateError(err, "api_key")
+	}
+	return requireAffected(result, "api_key")
+}
+
+func (svc postgresClient) TouchAPIKey(ctx context.Context, keyId string, at time.Time) error {
+	query := fmt.Sprintf(`
+        UPDATE %s
+        SET last_used_at = $2
+        WHERE key_id = $1
+    `, svc.apiKeysTablename)
+	_, err := svc.db.ExecContext(ctx, query, keyId, at)
+	if err != nil {
+		return translateError(err, "api_key")
+	}
+	return nil
+}
+
+func (svc postgresClient) CreateRefreshToken(ctx context.Context, token domain.RefreshToken) error {
+	query := fmt.Sprintf(`
+        INSERT INTO %s (token_id, family_id, user_id, token_hash, expires_at, created_at, scope)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+    `, svc.refreshTokensTablename)
+	_, err := svc.db.ExecContext(ctx, query, token.TokenId, token.FamilyId, token.UserId, token.TokenHash, token.ExpiresAt, token.CreatedAt, token.Scope)
+	if err != nil {
+		return translateError(err, "refresh_token")
+	}
+	return nil
+}
+
+func (svc postgresClient) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*domain.RefreshToken, error) {
+	query := fmt.Sprintf(`
+        SELECT token_id, family_id, user_id, token_hash, expires_at, created_at, revoked_at, COALESCE(replaced_by, ''), scope
+        FROM %s
+        WHERE token_hash = $1
+    `, svc.refreshTokensTablename)
+	row := svc.db.QueryRowContext(ctx, query, tokenHash)
+	token := &domain.RefreshToken{}
+	var revokedAt sql.NullTime
+	err := row.Scan(&token.TokenId, &token.FamilyId, &token.UserId, &token.TokenHash, &token.ExpiresAt, &token.CreatedAt, &revokedAt, &token.ReplacedBy, &token.Scope)
+	if err != nil {
+		return nil, translateError(err, "refresh_token")
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return token, nil
+}
+
+// RotateRefreshToken revokes the token with the given id and stores its replacement.
+// It reports false without storing anything if the token was already revoked,
+// which happens when two requests race to rotate the same token.
+func (svc postgresClient) RotateRefreshToken(ctx context.Context, tokenId string, replacement domain.RefreshToken) (bool, error) {
+	tx, err := svc.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, translateError(err, "refresh_token")
+	}
+	defer tx.Rollback()
+
+	revokeQuery := fmt.Sprintf(`
+        UPDATE %s
+        SET revoked_at=$2, replaced_by=$3
+        WHERE token_id=$1 AND revoked_at IS NULL
+    `, svc.refreshTokensTablename)
+	result, err := tx.ExecContext(ctx, revokeQuery, tokenId, replacement.CreatedAt, replacement.TokenId)
+	if err != nil {
+		return false, translateError(err, "refresh_token")
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, translateError(err, "refresh_token")
+	}
+	if affected == 0 {
+		return false, nil
+	}
 
-	queryString := fmt.Sprintf(`
-        CREATE TABLE IF NOT EXISTS %s (
-            user_id VARCHAR(255) PRIMARY KEY UNIQUE,
-            username VARCHAR(255) NOT NULL,
-            password_hash VARCHAR(255) NOT NULL,
-            email VARCHAR(255) UNIQUE NOT NULL,
-            fullname VARCHAR(255) NOT NULL,
-            phone_number VARCHAR(255),
-            avatar VARCHAR(255),
-            address VARCHAR(255),
-            created_at TIMESTAMP,
-            updated_at TIMESTAMP
-        )
-    `, tablename)
-
-	_, err = db.Exec(queryString)
+	insertQuery := fmt.Sprintf(`
+        INSERT INTO %s (token_id, family_id, user_id, token_hash, expires_at, created_at, scope)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+    `, svc.refreshTokensTablename)
+	_, err = tx.ExecContext(ctx, insertQuery, replacement.TokenId, replacement.FamilyId, replacement.UserId, replacement.TokenHash, replacement.ExpiresAt, replacement.CreatedAt, replacement.Scope)
 	if err != nil {
-		// logger.Error(fmt.Sprintf("Failed to create user table: %v", err))
-		return nil, err
+		return false, translateError(err, "refresh_token")
 	}
-	// logger.Info("Connected to the database successfully")
-	return &postgresClient{
-		db:                  db,
-		usersTablename:      config.USER_TABLE,
-		rolesTablename:      config.ROLE_TABLE,
-		rolesUsersTablename: config.USER_ROLE_TABLE,
-		tablenames:          []string{},
-		// logger:              logger,
-	}, nil
+	return true, translateError(tx.Commit(), "refresh_token")
 }
 
-func NewRolePostgresClient(config config.Config) (*postgresClient, error) {
-	dbname := config.POSTGRES_DB
-	tablename := config.ROLE_TABLE
-	user := config.POSTGRES_USER
-	password := config.POSTGRES_PASSWORD
-	port := config.POSTGRES_PORT
-	host := config.POSTGRES_HOST
-
-	dsn := fmt.Sprintf("host=%s port=%s user=%s dbname=%s password=%s sslmode=disable", host, port, user, dbname, password)
-
-	db, err := sql.Open("postgres", dsn)
+func (svc postgresClient) RevokeRefreshTokenFamily(ctx context.Context, familyId string) error {
+	query := fmt.Sprintf(`
+        UPDATE %s
+        SET revoked_at=$2
+        WHERE family_id=$1 AND revoked_at IS NULL
+    `, svc.refreshTokensTablename)
+	_, err := svc.db.ExecContext(ctx, query, familyId, time.Now())
 	if err != nil {
-		return nil, err
+		return translateError(err, "refresh_token")
 	}
+	return nil
+}
 
-	err = db.Ping()
+func (svc postgresClient) RevokeUserRefreshTokens(ctx context.Context, userId string) error {
+	query := fmt.Sprintf(`
+        UPDATE %s
+        SET revoked_at=$2
+        WHERE user_id=$1 AND revoked_at IS NULL
+    `, svc.refreshTokensTablename)
+	_, err := svc.db.ExecContext(ctx, query, userId, time.Now())
 	if err != nil {
-		return nil, err
+		return translateError(err, "refresh_token")
 	}
+	return nil
+}
 
-	roleQueryString := fmt.Sprintf(`
-        CREATE TABLE IF NOT EXISTS %s (
-            role_id VARCHAR(255) PRIMARY KEY UNIQUE,
-            name VARCHAR(255) UNIQUE NOT NULL,
-            description VARCHAR(255)
-        )
-    `, tablename)
-
-	_, err = db.Exec(roleQueryString)
+func (svc postgresClient) CreateSession(ctx context.Context, session domain.Session) error {
+	query := fmt.Sprintf(`
+        INSERT INTO %s (session_id, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at, mfa, client_id, auth_time)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+    `, svc.sessionsTablename)
+	_, err := svc.db.ExecContext(ctx, query, session.SessionId, session.UserId, session.UserAgent, session.IPAddress, session.CreatedAt, session.LastSeenAt, session.ExpiresAt, session.MFA, session.ClientId, session.AuthTime)
 	if err != nil {
-		// logger.Error(fmt.Sprintf("Failed to create role table: %v", err))
-		return nil, err
+		return translateError(err, "session")
 	}
-	// logger.Info("Connected to the database successfully")
-	return &postgresClient{
-		db:                  db,
-		usersTablename:      config.USER_TABLE,
-		rolesTablename:      config.ROLE_TABLE,
-		rolesUsersTablename: config.USER_ROLE_TABLE,
-		tablenames:          []string{},
-		// logger:              logger,
-	}, nil
+	return nil
 }
 
-func NewUserRolePostgresClient(config config.Config) (*postgresClient, error) {
-	dbname := config.POSTGRES_DB
-	tablename := config.USER_ROLE_TABLE
-	user := config.POSTGRES_USER
-	password := config.POSTGRES_PASSWORD
-	port := config.POSTGRES_PORT
-	host := config.POSTGRES_HOST
-
-	dsn := fmt.Sprintf("host=%s port=%s user=%s dbname=%s password=%s sslmode=disable", host, port, user, dbname, password)
+const sessionColumns = "session_id, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at, revoked_at, mfa, client_id, auth_time"
 
-	db, err := sql.Open("postgres", dsn)
+func scanSession(row rowScanner) (*domain.Session, error) {
+	session := &domain.Session{}
+	var revokedAt sql.NullTime
+	err := row.Scan(&session.SessionId, &session.UserId, &session.UserAgent, &session.IPAddress, &session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &revokedAt, &session.MFA, &session.ClientId, &session.AuthTime)
 	if err != nil {
 		return nil, err
 	}
-
-	err = db.Ping()
-	if err != nil {
-		return nil, err
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
 	}
+	return session, nil
+}
 
-	userRoleQueryString := fmt.Sprintf(`
-        CREATE TABLE IF NOT EXISTS %s (
-            user_id VARCHAR(255),
-            role_id VARCHAR(255),
-            PRIMARY KEY (user_id, role_id),
-            CONSTRAINT fk_user_roles_user_id FOREIGN KEY (user_id) REFERENCES %s(user_id),
-            CONSTRAINT fk_user_roles_role_id FOREIGN KEY (role_id) REFERENCES %s(role_id)
-        )
-    `, config.USER_ROLE_TABLE, config.USER_TABLE, config.ROLE_TABLE)
-
-	_, err = db.Exec(userRoleQueryString)
+func (svc postgresClient) GetSession(ctx context.Context, sessionId string) (*domain.Session, error) {
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM %s
+        WHERE session_id = $1
+    `, sessionColumns, svc.sessionsTablename)
+	session, err := scanSession(svc.db.QueryRowContext(ctx, query, sessionId))
 	if err != nil {
-		return nil, err
+		return nil, translateError(err, "session")
 	}
+	return session, nil
+}
 
-	unique_user_role_name := fmt.Sprintf(`unique_%s`, config.USER_ROLE_TABLE)
-	dropQueryString := fmt.Sprintf(`
-    	ALTER TABLE %s
-    	DROP CONSTRAINT IF EXISTS %s;
-	`, tablename, unique_user_role_name)
-	_, err = db.Exec(dropQueryString)
+// GetSessions returns the user's sessions that are neither revoked nor
+// expired at the given time, most recently seen first.
+func (svc postgresClient) GetSessions(ctx context.Context, userId string, at time.Time) ([]*domain.Session, error) {
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM %s
+        WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+        ORDER BY last_seen_at DESC
+    `, sessionColumns, svc.sessionsTablename)
+	rows, err := svc.db.QueryContext(ctx, query, userId, at)
 	if err != nil {
-		return nil, err
+		return nil, translateError(err, "session")
 	}
+	defer rows.Close()
 
-	alterQueryString := fmt.Sprintf(`
-        ALTER TABLE %s
-        ADD CONSTRAINT %s UNIQUE (user_id, role_id);
-    `, tablename, unique_user_role_name)
-
-	_, err = db.Exec(alterQueryString)
-	if err != nil {
-		return nil, err
+	sessions := []*domain.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, translateError(err, "session")
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err, "session")
 	}
-	return &postgresClient{
-		db:                  db,
-		usersTablename:      config.USER_TABLE,
-		rolesTablename:      config.ROLE_TABLE,
-		rolesUsersTablename: config.USER_ROLE_TABLE,
-		tablenames:          []string{},
-	}, nil
+	return sessions, nil
 }
 
-func (svc postgresClient) CreateUser(user domain.User) (*domain.User, error) {
-
+func (svc postgresClient) TouchSession(ctx context.Context, sessionId string, lastSeenAt, expiresAt time.Time) error {
 	query := fmt.Sprintf(`
-        INSERT INTO %s (user_id, username, password_hash, email, fullname, phone_number, avatar, address, created_at, updated_at)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-    `, svc.usersTablename)
-	_, err := svc.db.Exec(query,
-		user.UserId,
-		user.Username,
-		user.PasswordHash,
-		user.Email,
-		user.FullName,
-		user.PhoneNumber,
-		user.Avatar,
-		user.Address,
-		user.CreatedAt,
-		user.UpdatedAt,
-	)
+        UPDATE %s
+        SET last_seen_at = $2, expires_at = $3
+        WHERE session_id = $1
+    `, svc.sessionsTablename)
+	result, err := svc.db.ExecContext(ctx, query, sessionId, lastSeenAt, expiresAt)
 	if err != nil {
-		return nil, err
+		return translateError(err, "session")
 	}
-	return svc.GetUserById(user.UserId)
+	return requireAffected(result, "session")
 }
 
-func (svc postgresClient) GetUserById(userId string) (*domain.User, error) {
+func (svc postgresClient) CreateAuditEntry(ctx context.Context, entry domain.AuditEntry) error {
 	query := fmt.Sprintf(`
-        SELECT user_id, username, password_hash, email, fullname, phone_number, avatar, address, created_at, updated_at
-        FROM %s
-        WHERE user_id = $1
-    `, svc.usersTablename)
-	row := svc.db.QueryRow(query, userId)
-	user := &domain.User{}
-	err := row.Scan(&user.UserId, &user.Username, &user.PasswordHash, &user.Email, &user.FullName, &user.PhoneNumber, &user.Avatar, &user.Address, &user.CreatedAt, &user.UpdatedAt)
+        INSERT INTO %s (audit_id, action, actor_id, user_id, token_id, method, path, status, reason, ip_address, user_agent, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+    `, svc.auditLogTablename)
+	_, err := svc.db.ExecContext(ctx, query, entry.AuditId, entry.Action, entry.ActorId, entry.UserId, entry.TokenId, entry.Method, entry.Path, entry.Status, entry.Reason, entry.IPAddress, entry.UserAgent, entry.CreatedAt)
 	if err != nil {
-		return nil, err
+		return translateError(err, "audit_entry")
 	}
-	return user, nil
+	return nil
 }
 
-func (svc postgresClient) GetUserByEmail(email string) (*domain.User, error) {
+func (svc postgresClient) SetAuditEntryStatus(ctx context.Context, auditId string, status int) error {
 	query := fmt.Sprintf(`
-        SELECT user_id, username, password_hash, email, fullname, phone_number, avatar, address, created_at, updated_at
-        FROM %s
-        WHERE email = $1
-    `, svc.usersTablename)
-	row := svc.db.QueryRow(query, email)
-	user := &domain.User{}
-	err := row.Scan(&user.UserId, &user.Username, &user.PasswordHash, &user.Email, &user.FullName, &user.PhoneNumber, &user.Avatar, &user.Address, &user.CreatedAt, &user.UpdatedAt)
+        UPDATE %s
+        SET status = $2
+        WHERE audit_id = $1
+    `, svc.auditLogTablename)
+	result, err := svc.db.ExecContext(ctx, query, auditId, status)
 	if err != nil {
-		return nil, err
+		return translateError(err, "audit_entry")
 	}
-
-	return user, nil
+	return requireAffected(result, "audit_entry")
 }
 
-func (svc postgresClient) GetUsers() ([]*domain.User, error) {
+// GetAuditEntries returns the newest entries matching the filter.
+func (svc postgresClient) GetAuditEntries(ctx context.Context, filter domain.AuditFilter) ([]*domain.AuditEntry, error) {
 	query := fmt.Sprintf(`
-        SELECT user_id, username, password_hash, email, fullname, phone_number, avatar, address, created_at, updated_at
+        SELECT audit_id, action, actor_id, user_id, token_id, method, path, status, reason, ip_address, user_agent, created_at
         FROM %s
-    `, svc.usersTablename)
-	rows, err := svc.db.Query(query)
+        WHERE ($1 = '' OR actor_id = $1) AND ($2 = '' OR user_id = $2)
+        ORDER BY created_at DESC
+        LIMIT $3
+    `, svc.auditLogTablename)
+	rows, err := svc.db.QueryContext(ctx, query, filter.ActorId, filter.UserId, filter.Limit)
 	if err != nil {
-		return nil, err
+		return nil, translateError(err, "audit_entry")
 	}
 	defer rows.Close()
 
-	users := []*domain.User{}
+	entries := []*domain.AuditEntry{}
 	for rows.Next() {
-		user := &domain.User{}
-		err := rows.Scan(&user.UserId, &user.Username, &user.PasswordHash, &user.Email, &user.FullName, &user.PhoneNumber, &user.Avatar, &user.Address, &user.CreatedAt, &user.UpdatedAt)
+		entry := &domain.AuditEntry{}
+		err := rows.Scan(&entry.AuditId, &entry.Action, &entry.ActorId, &entry.UserId, &entry.TokenId, &entry.Method, &entry.Path, &entry.Status, &entry.Reason, &entry.IPAddress, &entry.UserAgent, &entry.CreatedAt)
 		if err != nil {
-			return nil, err
+			return nil, translateError(err, "audit_entry")
 		}
-		users = append(users, user)
+		entries = append(entries, entry)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, translateError(err, "audit_entry")
 	}
-	return users, nil
+	return entries, nil
 }
 
-func (svc postgresClient) GetUsersWithRole(roleName string) ([]*domain.User, error) {
+func (svc postgresClient) RevokeToken(ctx context.Context, token domain.RevokedToken) error {
 	query := fmt.Sprintf(`
-        SELECT u.user_id, u.username, u.password_hash, u.email, u.fullname, u.phone_number, u.avatar, u.address, u.created_at, u.updated_at
-        FROM %s u
-        JOIN %s ur ON u.user_id = ur.user_id
-        JOIN %s r ON ur.role_id = r.role_id
-        WHERE r.name = $1
-    `, svc.usersTablename, svc.rolesUsersTablename, svc.rolesTablename)
-	rows, err := svc.db.Query(query, roleName)
+        INSERT INTO %s (token_id, user_id, expires_at, revoked_at)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (token_id) DO NOTHING
+    `, svc.revokedTokensTablename)
+	_, err := svc.db.ExecContext(ctx, query, token.TokenId, token.UserId, token.ExpiresAt, token.RevokedAt)
 	if err != nil {
-		return nil, err
+		return translateError(err, "token_revocation")
 	}
-	defer rows.Close()
 
-	users := []*domain.User{}
-	for rows.Next() {
-		user := &domain.User{}
-		err := rows.Scan(&user.UserId, &user.Username, &user.PasswordHash, &user.Email, &user.FullName, &user.PhoneNumber, &user.Avatar, &user.Address, &user.CreatedAt, &user.UpdatedAt)
-		if err != nil {
-			return nil, err
-		}
-		users = append(users, user)
+	// Revoked tokens only need to be remembered until they would have expired anyway.
+	purgeQuery := fmt.Sprintf(`
+        DELETE FROM %s
+        WHERE expires_at < $1
+    `, svc.revokedTokensTablename)
+	_, err = svc.db.ExecContext(ctx, purgeQuery, time.Now())
+	if err != nil {
+		return translateError(err, "token_revocation")
 	}
-	if err := rows.Err(); err != nil {
-		return nil, err
+	return nil
+}
+
+func (svc postgresClient) IsTokenRevoked(ctx context.Context, tokenId string) (bool, error) {
+	query := fmt.Sprintf(`
+        SELECT EXISTS (SELECT 1 FROM %s WHERE token_id = $1)
+    `, svc.revokedTokensTablename)
+	var revoked bool
+	err := svc.db.QueryRowContext(ctx, query, tokenId).Scan(&revoked)
+	if err != nil {
+		return false, translateError(err, "token_revocation")
 	}
-	return users, nil
+	return revoked, nil
 }
 
-func (svc postgresClient) UpdateUser(user domain.User) (*domain.User, error) {
+func (svc postgresClient) RevokeUserTokens(ctx context.Context, userId string, revokedAt time.Time) error {
 	query := fmt.Sprintf(`
+        INSERT INTO %s (user_id, revoked_at)
+        VALUES ($1, $2)
+        ON CONFLICT (user_id) DO UPDATE SET revoked_at = EXCLUDED.revoked_at
+    `, svc.userRevocationTablename)
+	_, err := svc.db.ExecContext(ctx, query, userId, revokedAt)
+	if err != nil {
+		return translateError(err, "token_revocation")
+	}
+
+	// Every session the user had is over too.
+	sessionQuery := fmt.Sprintf(`
         UPDATE %s
-        SET username=$2, password_hash=$3, email=$4, fullname=$5, phone_number=$6, avatar=$7, address=$8, updated_at=$9
-        WHERE user_id=$1
-    `, svc.usersTablename)
-	_, err := svc.db.Exec(query, user.UserId, user.Username, user.PasswordHash, user.Email, user.FullName, user.PhoneNumber, user.Avatar, user.Address, user.UpdatedAt)
+        SET revoked_at = $2
+        WHERE user_id = $1 AND revoked_at IS NULL
+    `, svc.sessionsTablename)
+	_, err = svc.db.ExecContext(ctx, sessionQuery, userId, revokedAt)
 	if err != nil {
-		return nil, err
+		return translateError(err, "session")
 	}
-	return svc.GetUserById(user.UserId)
+	return nil
 }
 
-func (svc postgresClient) DeleteUser(userId string) error {
+func (svc postgresClient) GetUserTokensRevokedAt(ctx context.Context, userId string) (*time.Time, error) {
 	query := fmt.Sprintf(`
-        DELETE FROM %s
-        WHERE user_id=$1
-    `, svc.usersTablename)
-	_, err := svc.db.Exec(query, userId)
+        SELECT revoked_at
+        FROM %s
+        WHERE user_id = $1
+    `, svc.userRevocationTablename)
+	var revokedAt time.Time
+	err := svc.db.QueryRowContext(ctx, query, userId).Scan(&revokedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 	if err != nil {
-		return err
+		return nil, translateError(err, "token_revocation")
+	}
+	return &revokedAt, nil
+}
+
+func (svc postgresClient) RevokeSession(ctx context.Context, sessionId string, revokedAt time.Time) error {
+	query := fmt.Sprintf(`
+        UPDATE %s
+        SET revoked_at = $2
+        WHERE session_id = $1 AND revoked_at IS NULL
+    `, svc.sessionsTablename)
+	_, err := svc.db.ExecContext(ctx, query, sessionId, revokedAt)
+	if err != nil {
+		return translateError(err, "session")
 	}
 	return nil
 }
 
-func (svc postgresClient) CreateRole(role domain.Role) (*domain.Role, error) {
-	roles, err := svc.GetRoles()
+// IsSessionRevoked treats sessions that do not exist as revoked, so that a
+// token naming a deleted session is refused.
+func (svc postgresClient) IsSessionRevoked(ctx context.Context, sessionId string) (bool, error) {
+	query := fmt.Sprintf(`
+        SELECT NOT EXISTS (SELECT 1 FROM %s WHERE session_id = $1 AND revoked_at IS NULL)
+    `, svc.sessionsTablename)
+	var revoked bool
+	err := svc.db.QueryRowContext(ctx, query, sessionId).Scan(&revoked)
 	if err != nil {
-		return nil, err
+		return false, translateError(err, "session")
+	}
+	return revoked, nil
+}
+
+func (svc postgresClient) CreateRole(ctx context.Context, role domain.Role) (*domain.Role, error) {
+	roles, err := svc.GetRoles(ctx)
+	if err != nil {
+		return nil, translateError(err, "role")
 	}
 	for _, roleItem := range roles {
 		if roleItem.Name == role.Name && roleItem.Description == role.Description {
@@ -355,36 +1259,36 @@ func (svc postgresClient) CreateRole(role domain.Role) (*domain.Role, error) {
         VALUES ($1, $2, $3)
 	`, svc.rolesTablename)
 
-	_, err = svc.db.Exec(query, role.RoleId, role.Name, role.Description)
+	_, err = svc.db.ExecContext(ctx, query, role.RoleId, role.Name, role.Description)
 	if err != nil {
-		return nil, err
+		return nil, translateError(err, "role")
 	}
-	return svc.GetRoleById(role.RoleId)
+	return svc.GetRoleById(ctx, role.RoleId)
 }
 
-func (svc postgresClient) GetRoleById(roleId string) (*domain.Role, error) {
+func (svc postgresClient) GetRoleById(ctx context.Context, roleId string) (*domain.Role, error) {
 	query := fmt.Sprintf(`
         SELECT role_id, name, description
         FROM %s
         WHERE role_id = $1
 	`, svc.rolesTablename)
-	row := svc.db.QueryRow(query, roleId)
+	row := svc.db.QueryRowContext(ctx, query, roleId)
 	role := &domain.Role{}
 	err := row.Scan(&role.RoleId, &role.Name, &role.Description)
 	if err != nil {
-		return nil, err
+		return nil, translateError(err, "role")
 	}
 	return role, nil
 }
 
-func (svc postgresClient) GetRoles() ([]*domain.Role, error) {
+func (svc postgresClient) GetRoles(ctx context.Context) ([]*domain.Role, error) {
 	query := fmt.Sprintf(`
         SELECT role_id, name, description
         FROM %s
     `, svc.rolesTablename)
-	rows, err := svc.db.Query(query)
+	rows, err := svc.db.QueryContext(ctx, query)
 	if err != nil {
-		return nil, err
+		return nil, translateError(err, "role")
 	}
 	defer rows.Close()
 
@@ -393,70 +1297,293 @@ func (svc postgresClient) GetRoles() ([]*domain.Role, error) {
 		role := &domain.Role{}
 		err := rows.Scan(&role.RoleId, &role.Name, &role.Description)
 		if err != nil {
-			return nil, err
+			return nil, translateError(err, "role")
 		}
 		roles = append(roles, role)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, translateError(err, "role")
 	}
 	return roles, nil
 }
 
-func (svc postgresClient) UpdateRole(role domain.Role) error {
+func (svc postgresClient) UpdateRole(ctx context.Context, role domain.Role) error {
 	query := fmt.Sprintf(`
         UPDATE %s
         SET name=$2, description=$3
         WHERE role_id=$1
 	`, svc.rolesTablename)
-	_, err := svc.db.Exec(query, role.RoleId, role.Name, role.Description)
+	result, err := svc.db.ExecContext(ctx, query, role.RoleId, role.Name, role.Description)
 	if err != nil {
-		return err
+		return translateError(err, "role")
 	}
-	return nil
+	return requireAffected(result, "role")
 }
 
-func (svc postgresClient) DeleteRole(roleId string) error {
+func (svc postgresClient) DeleteRole(ctx context.Context, roleId string) error {
 	query := fmt.Sprintf(`
         DELETE FROM %s
         WHERE role_id=$1
 	`, svc.rolesTablename)
-	_, err := svc.db.Exec(query, roleId)
+	result, err := svc.db.ExecContext(ctx, query, roleId)
 	if err != nil {
-		return err
+		return translateError(err, "role")
+	}
+	return requireAffected(result, "role")
+}
+
+func (svc postgresClient) CreatePermission(ctx context.Context, permission domain.Permission) (*domain.Permission, error) {
+	query := fmt.Sprintf(`
+        INSERT INTO %s (permission_id, name, description)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (name) DO NOTHING
+    `, svc.permissionsTablename)
+	_, err := svc.db.ExecContext(ctx, query, permission.PermissionId, permission.Name, permission.Description)
+	if err != nil {
+		return nil, translateError(err, "permission")
+	}
+
+	selectQuery := fmt.Sprintf(`
+        SELECT permission_id, name, COALESCE(description, '')
+        FROM %s
+        WHERE name = $1
+    `, svc.permissionsTablename)
+	row := svc.db.QueryRowContext(ctx, selectQuery, permission.Name)
+	dbPermission := &domain.Permission{}
+	err = row.Scan(&dbPermission.PermissionId, &dbPermission.Name, &dbPermission.Description)
+	if err != nil {
+		return nil, translateError(err, "permission")
+	}
+	return dbPermission, nil
+}
+
+func (svc postgresClient) GetPermissions(ctx context.Context) ([]*domain.Permission, error) {
+	query := fmt.Sprintf(`
+        SELECT permission_id, name, COALESCE(description, '')
+        FROM %s
+        ORDER BY name
+    `, svc.permissionsTablename)
+	return svc.queryPermissions(ctx, query)
+}
+
+func (svc postgresClient) GetRolePermissions(ctx context.Context, roleId string) ([]*domain.Permission, error) {
+	query := fmt.Sprintf(`
+        SELECT p.permission_id, p.name, COALESCE(p.description, '')
+        FROM %s p
+        JOIN %s rp ON rp.permission_id = p.permission_id
+        WHERE rp.role_id = $1
+        ORDER BY p.name
+    `, svc.permissionsTablename, svc.rolePermissionsTablename)
+	return svc.queryPermissions(ctx, query, roleId)
+}
+
+func (svc postgresClient) GrantPermission(ctx context.Context, rolePermission domain.RolePermission) error {
+	query := fmt.Sprintf(`
+        INSERT INTO %s (role_id, permission_id)
+        VALUES ($1, $2)
+        ON CONFLICT DO NOTHING
+    `, svc.rolePermissionsTablename)
+	_, err := svc.db.ExecContext(ctx, query, rolePermission.RoleId, rolePermission.PermissionId)
+	if err != nil {
+		return translateError(err, "role_permission")
+	}
+	return nil
+}
+
+func (svc postgresClient) RevokePermission(ctx context.Context, rolePermission domain.RolePermission) error {
+	query := fmt.Sprintf(`
+        DELETE FROM %s
+        WHERE role_id=$1 AND permission_id=$2
+    `, svc.rolePermissionsTablename)
+	_, err := svc.db.ExecContext(ctx, query, rolePermission.RoleId, rolePermission.PermissionId)
+	if err != nil {
+		return translateError(err, "role_permission")
 	}
 	return nil
 }
 
-func (svc postgresClient) AddUserRole(userRole domain.UserRole) error {
+func (svc postgresClient) GetUserPermissions(ctx context.Context, userId string) ([]string, error) {
+	query := fmt.Sprintf(`
+        SELECT DISTINCT p.name
+        FROM %s p
+        JOIN %s rp ON rp.permission_id = p.permission_id
+        JOIN %s ur ON ur.role_id = rp.role_id
+        WHERE ur.user_id = $1
+        ORDER BY p.name
+    `, svc.permissionsTablename, svc.rolePermissionsTablename, svc.rolesUsersTablename)
+	rows, err := svc.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, translateError(err, "permission")
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, translateError(err, "permission")
+		}
+		permissions = append(permissions, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err, "permission")
+	}
+	return permissions, nil
+}
+
+func (svc postgresClient) queryPermissions(ctx context.Context, query string, args ...interface{}) ([]*domain.Permission, error) {
+	rows, err := svc.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, translateError(err, "permission")
+	}
+	defer rows.Close()
+
+	permissions := []*domain.Permission{}
+	for rows.Next() {
+		permission := &domain.Permission{}
+		err := rows.Scan(&permission.PermissionId, &permission.Name, &permission.Description)
+		if err != nil {
+			return nil, translateError(err, "permission")
+		}
+		permissions = append(permissions, permission)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err, "permission")
+	}
+	return permissions, nil
+}
+
+func (svc postgresClient) AddUserRole(ctx context.Context, userRole domain.UserRole) error {
 	query := fmt.Sprintf(`
         INSERT INTO %s (user_id, role_id)
         VALUES ($1, $2)
    	`, svc.rolesUsersTablename)
 
-	_, err := svc.db.Exec(query, userRole.UserId, userRole.RoleId)
+	_, err := svc.db.ExecContext(ctx, query, userRole.UserId, userRole.RoleId)
 	if err != nil {
-		return err
+		return translateError(err, "user_role")
 	}
 
 	return nil
 }
 
-func (svc postgresClient) RemoveUserRole(userRole domain.UserRole) error {
+func (svc postgresClient) RemoveUserRole(ctx context.Context, userRole domain.UserRole) error {
 	query := fmt.Sprintf(`
         DELETE FROM %s
         WHERE user_id=$1 AND role_id=$2
    	`, svc.rolesUsersTablename)
-	_, err := svc.db.Exec(query, userRole.UserId, userRole.RoleId)
+	result, err := svc.db.ExecContext(ctx, query, userRole.UserId, userRole.RoleId)
 	if err != nil {
-		return err
+		return translateError(err, "user_role")
+	}
+	return requireAffected(result, "user_role")
+}
+
+func (svc postgresClient) GetUserRoles(ctx context.Context, userId string) ([]*domain.Role, error) {
+	query := fmt.Sprintf(`
+        SELECT r.role_id, r.name, r.description
+        FROM %s r
+        JOIN %s ur ON ur.role_id = r.role_id
+        WHERE ur.user_id = $1
+    `, svc.rolesTablename, svc.rolesUsersTablename)
+	rows, err := svc.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, translateError(err, "role")
+	}
+	defer rows.Close()
+
+	roles := []*domain.Role{}
+	for rows.Next() {
+		role := &domain.Role{}
+		err := rows.Scan(&role.RoleId, &role.Name, &role.Description)
+		if err != nil {
+			return nil, translateError(err, "role")
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err, "role")
+	}
+	return roles, nil
+}
+
+func (svc postgresClient) GetLoginAttempts(ctx context.Context, keys []string) ([]*domain.LoginAttempt, error) {
+	query := fmt.Sprintf(`
+        SELECT attempt_key, failures, last_failed_at, blocked_until
+        FROM %s
+        WHERE attempt_key = ANY($1)
+    `, svc.loginAttemptsTablename)
+	rows, err := svc.db.QueryContext(ctx, query, pq.Array(keys))
+	if err != nil {
+		return nil, translateError(err, "login_attempt")
+	}
+	defer rows.Close()
+
+	attempts := []*domain.LoginAttempt{}
+	for rows.Next() {
+		attempt, err := scanLoginAttempt(rows)
+		if err != nil {
+			return nil, translateError(err, "login_attempt")
+		}
+		attempts = append(attempts, attempt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err, "login_attempt")
+	}
+	return attempts, nil
+}
+
+// RecordLoginFailure adds a failure to key and returns the updated count.
+// Failures older than windowStart no longer count and restart the count at one.
+func (svc postgresClient) RecordLoginFailure(ctx context.Context, key string, failedAt, windowStart time.Time) (*domain.LoginAttempt, error) {
+	query := fmt.Sprintf(`
+        INSERT INTO %[1]s (attempt_key, failures, last_failed_at)
+        VALUES ($1, 1, $2)
+        ON CONFLICT (attempt_key) DO UPDATE SET
+            failures = CASE WHEN %[1]s.last_failed_at < $3 THEN 1 ELSE %[1]s.failures + 1 END,
+            last_failed_at = EXCLUDED.last_failed_at
+        RETURNING attempt_key, failures, last_failed_at, blocked_until
+    `, svc.loginAttemptsTablename)
+	attempt, err := scanLoginAttempt(svc.db.QueryRowContext(ctx, query, key, failedAt, windowStart))
+	if err != nil {
+		return nil, translateError(err, "login_attempt")
+	}
+	return attempt, nil
+}
+
+func (svc postgresClient) BlockLogin(ctx context.Context, key string, until time.Time) error {
+	query := fmt.Sprintf(`UPDATE %s SET blocked_until = $2 WHERE attempt_key = $1`, svc.loginAttemptsTablename)
+	result, err := svc.db.ExecContext(ctx, query, key, until)
+	if err != nil {
+		return translateError(err, "login_attempt")
+	}
+	return requireAffected(result, "login_attempt")
+}
+
+func (svc postgresClient) ClearLoginAttempts(ctx context.Context, key string) error {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE attempt_key = $1`, svc.loginAttemptsTablename)
+	_, err := svc.db.ExecContext(ctx, query, key)
+	if err != nil {
+		return translateError(err, "login_attempt")
 	}
 	return nil
 }
 
-func (svc postgresClient) DropTables() error {
+func scanLoginAttempt(row rowScanner) (*domain.LoginAttempt, error) {
+	attempt := &domain.LoginAttempt{}
+	var blockedUntil sql.NullTime
+	if err := row.Scan(&attempt.Key, &attempt.Failures, &attempt.LastFailedAt, &blockedUntil); err != nil {
+		return nil, err
+	}
+	if blockedUntil.Valid {
+		attempt.BlockedUntil = &blockedUntil.Time
+	}
+	return attempt, nil
+}
+
+func (svc postgresClient) DropTables(ctx context.Context) error {
 	for _, tablename := range svc.tablenames {
-		_, err := svc.db.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s;`, tablename))
+		_, err := svc.db.ExecContext(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s;`, tablename))
 		if err != nil {
 			return err
 		}
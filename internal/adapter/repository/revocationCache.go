@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
+)
+
+type cachedRevocation struct {
+	revoked   bool
+	revokedAt *time.Time
+	expiresAt time.Time
+}
+
+// revocationCache keeps recent revocation lookups in memory so that
+// AuthorizeToken does not hit Postgres on every request. Revocations made
+// through this instance are visible immediately; revocations made by other
+// instances are picked up once the cached entry expires.
+type revocationCache struct {
+	repo     ports.RevocationRepository
+	ttl      time.Duration
+	mu       sync.RWMutex
+	tokens   map[string]cachedRevocation
+	users    map[string]cachedRevocation
+	sessions map[string]cachedRevocation
+	pruned   time.Time
+}
+
+func NewRevocationCache(repo ports.RevocationRepository, ttl time.Duration) *revocationCache {
+	return &revocationCache{
+		repo:     repo,
+		ttl:      ttl,
+		tokens:   map[string]cachedRevocation{},
+		users:    map[string]cachedRevocation{},
+		sessions: map[string]cachedRevocation{},
+	}
+}
+
+func (c *revocationCache) RevokeToken(ctx context.Context, token domain.RevokedToken) error {
+	if err := c.repo.RevokeToken(ctx, token); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pruneLocked()
+	c.tokens[token.TokenId] = cachedRevocation{revoked: true, expiresAt: token.ExpiresAt}
+	return nil
+}
+
+func (c *revocationCache) IsTokenRevoked(ctx context.Context, tokenId string) (bool, error) {
+	c.mu.RLock()
+	entry, ok := c.tokens[tokenId]
+	c.mu.RUnlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.revoked, nil
+	}
+
+	revoked, err := c.repo.IsTokenRevoked(ctx, tokenId)
+	if err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pruneLocked()
+	c.tokens[tokenId] = cachedRevocation{revoked: revoked, expiresAt: time.Now().Add(c.ttl)}
+	return revoked, nil
+}
+
+func (c *revocationCache) RevokeUserTokens(ctx context.Context, userId string, revokedAt time.Time) error {
+	if err := c.repo.RevokeUserTokens(ctx, userId, revokedAt); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.users[userId] = cachedRevocation{revoked: true, revokedAt: &revokedAt, expiresAt: time.Now().Add(c.ttl)}
+	return nil
+}
+
+func (c *revocationCache) GetUserTokensRevokedAt(ctx context.Context, userId string) (*time.Time, error) {
+	c.mu.RLock()
+	entry, ok := c.users[userId]
+	c.mu.RUnlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.revokedAt, nil
+	}
+
+	revokedAt, err := c.repo.GetUserTokensRevokedAt(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pruneLocked()
+	c.users[userId] = cachedRevocation{revoked: revokedAt != nil, revokedAt: revokedAt, expiresAt: time.Now().Add(c.ttl)}
+	return revokedAt, nil
+}
+
+func (c *revocationCache) RevokeSession(ctx context.Context, sessionId string, revokedAt time.Time) error {
+	if err := c.repo.RevokeSession(ctx, sessionId, revokedAt); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pruneLocked()
+	c.sessions[sessionId] = cachedRevocation{revoked: true, revokedAt: &revokedAt, expiresAt: time.Now().Add(c.ttl)}
+	return nil
+}
+
+func (c *revocationCache) IsSessionRevoked(ctx context.Context, sessionId string) (bool, error) {
+	c.mu.RLock()
+	entry, ok := c.sessions[sessionId]
+	c.mu.RUnlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.revoked, nil
+	}
+
+	revoked, err := c.repo.IsSessionRevoked(ctx, sessionId)
+	if err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pruneLocked()
+	c.sessions[sessionId] = cachedRevocation{revoked: revoked, expiresAt: time.Now().Add(c.ttl)}
+	return revoked, nil
+}
+
+func (c *revocationCache) pruneLocked() {
+	now := time.Now()
+	if now.Sub(c.pruned) < c.ttl {
+		return
+	}
+	c.pruned = now
+	for key, entry := range c.tokens {
+		if now.After(entry.expiresAt) {
+			delete(c.tokens, key)
+		}
+	}
+	for key, entry := range c.users {
+		if now.After(entry.expiresAt) {
+			delete(c.users, key)
+		}
+	}
+	for key, entry := range c.sessions {
+		if now.After(entry.expiresAt) {
+			delete(c.sessions, key)
+		}
+	}
+}
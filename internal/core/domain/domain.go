@@ -1,20 +1,36 @@
 package domain
 
 import (
+	"strings"
 	"time"
 )
 
 type User struct {
-	UserId       string    `json:"user_id"`
-	Username     string    `json:"username"`
-	PasswordHash string    `json:"password_hash"`
-	Email        string    `json:"email"`
-	FullName     string    `json:"fullname"`
-	PhoneNumber  string    `json:"phone_number"`
-	Avatar       string    `json:"avatar"`
-	Address      string    `json:"address"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	UserId          string     `json:"user_id"`
+	Username        string     `json:"username"`
+	PasswordHash    string     `json:"-"`
+	Email           string     `json:"email"`
+	FullName        string     `json:"fullname"`
+	PhoneNumber     string     `json:"phone_number"`
+	Avatar          string     `json:"avatar"`
+	Address         string     `json:"address"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	PhoneVerifiedAt *time.Time `json:"phone_verified_at"`
+	MFAEnabledAt    *time.Time `json:"mfa_enabled_at"`
+}
+
+func (u User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+func (u User) PhoneVerified() bool {
+	return u.PhoneVerifiedAt != nil
+}
+
+func (u User) MFAEnabled() bool {
+	return u.MFAEnabledAt != nil
 }
 
 type Role struct {
@@ -27,3 +43,501 @@ type UserRole struct {
 	UserId string `json:"user_id"`
 	RoleId string `json:"role_id"`
 }
+
+type Permission struct {
+	PermissionId string `json:"permission_id"`
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+}
+
+type RolePermission struct {
+	RoleId       string `json:"role_id"`
+	PermissionId string `json:"permission_id"`
+}
+
+// RoleAdmin is the name of the role granted full administrative access.
+// Holders of this role implicitly have every permission.
+const RoleAdmin = "Admin"
+
+// Permissions checked by this service. Other services may define their own.
+const (
+	PermissionUsersRead            = "users:read"
+	PermissionUsersWrite           = "users:write"
+	PermissionUsersDelete          = "users:delete"
+	PermissionRolesRead            = "roles:read"
+	PermissionRolesWrite           = "roles:write"
+	PermissionRolesAssign          = "roles:assign"
+	PermissionClientsWrite         = "clients:write"
+	PermissionServiceAccountsWrite = "service_accounts:write"
+	PermissionUsersImpersonate     = "users:impersonate"
+)
+
+// PasswordRules configures which passwords are accepted. Passwords are always
+// limited to 72 bytes, the most bcrypt will hash.
+type PasswordRules struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+}
+
+// LoginRequest is a login attempt together with where it came from.
+type LoginRequest struct {
+	Email     string
+	Password  string
+	IPAddress string
+	UserAgent string
+}
+
+// LoginAttempt tracks recent failed logins for one account or client IP address.
+type LoginAttempt struct {
+	Key          string     `json:"key"`
+	Failures     int        `json:"failures"`
+	LastFailedAt time.Time  `json:"last_failed_at"`
+	BlockedUntil *time.Time `json:"blocked_until"`
+}
+
+// LoginThrottleRules configures brute-force protection for logins. Each failure
+// within FailureWindow blocks further attempts for an exponentially growing
+// delay starting at BackoffBase and capped at BackoffMax. Reaching the maximum
+// number of failures locks the account or IP address for LockoutDuration.
+type LoginThrottleRules struct {
+	MaxAccountFailures int
+	MaxIPFailures      int
+	FailureWindow      time.Duration
+	BackoffBase        time.Duration
+	BackoffMax         time.Duration
+	LockoutDuration    time.Duration
+}
+
+// EmailVerificationPolicy decides what users may do before verifying their email.
+type EmailVerificationPolicy string
+
+const (
+	// EmailVerificationOptional lets unverified users do everything verified users can.
+	EmailVerificationOptional EmailVerificationPolicy = "optional"
+	// EmailVerificationLimitScopes lets unverified users log in and manage their
+	// own account, but withholds every permission granted by their roles.
+	EmailVerificationLimitScopes EmailVerificationPolicy = "limit_scopes"
+	// EmailVerificationRequired rejects logins until the email is verified.
+	EmailVerificationRequired EmailVerificationPolicy = "required"
+)
+
+func (p EmailVerificationPolicy) Valid() bool {
+	switch p {
+	case EmailVerificationOptional, EmailVerificationLimitScopes, EmailVerificationRequired:
+		return true
+	}
+	return false
+}
+
+// Purposes a one-time code can be issued for. A user has at most one active
+// code per purpose; issuing a new one replaces it.
+const (
+	OneTimeCodePhoneVerification = "phone_verification"
+	OneTimeCodePasswordlessLogin = "passwordless_login"
+)
+
+// Ways of delivering a passwordless login.
+const (
+	// PasswordlessCode sends a short code to type into the app.
+	PasswordlessCode = "code"
+	// PasswordlessLink sends a link that logs in when opened.
+	PasswordlessLink = "link"
+)
+
+// PasswordlessRequest asks for a passwordless login to be sent to a verified
+// email address or phone number. Exactly one of Email and PhoneNumber is set.
+type PasswordlessRequest struct {
+	Email       string
+	PhoneNumber string
+	Method      string
+}
+
+// PasswordlessLogin exchanges the code, or the token from a login link, sent
+// to Email or PhoneNumber for a token pair.
+type PasswordlessLogin struct {
+	Email       string
+	PhoneNumber string
+	Code        string
+	IPAddress   string
+	UserAgent   string
+}
+
+// OneTimeCode is a short numeric code sent to a user, stored as a keyed hash.
+// Recipient is the phone number or email the code was sent to; the code is
+// only accepted while the user still has that recipient.
+type OneTimeCode struct {
+	UserId    string    `json:"user_id"`
+	Purpose   string    `json:"purpose"`
+	Recipient string    `json:"recipient"`
+	CodeHash  string    `json:"-"`
+	Attempts  int       `json:"attempts"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OneTimeCodeRules configures one-time codes. A code expires after TTL or
+// after MaxAttempts wrong guesses, and a new code for the same purpose can only
+// be requested once ResendInterval has passed.
+type OneTimeCodeRules struct {
+	Length         int
+	TTL            time.Duration
+	MaxAttempts    int
+	ResendInterval time.Duration
+}
+
+type PasswordResetToken struct {
+	TokenHash string    `json:"-"`
+	UserId    string    `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Notification struct {
+	Recipient string `json:"recipient"`
+	Subject   string `json:"subject"`
+	Message   string `json:"message"`
+}
+
+type SMSMessage struct {
+	PhoneNumber string `json:"phone_number"`
+	Message     string `json:"message"`
+}
+
+type RefreshToken struct {
+	TokenId    string     `json:"token_id"`
+	FamilyId   string     `json:"family_id"`
+	UserId     string     `json:"user_id"`
+	TokenHash  string     `json:"-"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	ReplacedBy string     `json:"replaced_by"`
+	Scope      string     `json:"scope"`
+}
+
+// Device describes the client a user logged in from.
+type Device struct {
+	IPAddress string
+	UserAgent string
+}
+
+// Authentication describes how a user logged in to start a session.
+type Authentication struct {
+	Device
+	// MFA is set when the user passed a second factor.
+	MFA bool
+	// ClientId names the OAuth client the session is granted to, if any.
+	ClientId string
+	// AuthTime is when the user proved who they are. It defaults to now, and
+	// is earlier when a client is given a session for an earlier login.
+	AuthTime time.Time
+}
+
+// Session is a login on one device. It lasts as long as the refresh token
+// family it started, whose ID it shares, and ends for good when revoked.
+type Session struct {
+	SessionId  string     `json:"session_id"`
+	UserId     string     `json:"user_id"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	MFA        bool       `json:"mfa"`
+	ClientId   string     `json:"client_id,omitempty"`
+	AuthTime   time.Time  `json:"auth_time"`
+	Current    bool       `json:"current"`
+}
+
+// Audit log actions.
+const (
+	AuditImpersonationStarted = "impersonation.started"
+	AuditImpersonatedRequest  = "impersonation.request"
+)
+
+// AuditEntry records something an admin did as another user. TokenId is the
+// impersonation token, which ties each request to the impersonation that
+// allowed it.
+type AuditEntry struct {
+	AuditId   string    `json:"audit_id"`
+	Action    string    `json:"action"`
+	ActorId   string    `json:"actor_id"`
+	UserId    string    `json:"user_id"`
+	TokenId   string    `json:"token_id"`
+	Method    string    `json:"method,omitempty"`
+	Path      string    `json:"path,omitempty"`
+	Status    int       `json:"status,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuditFilter selects audit log entries. Empty fields match every entry.
+type AuditFilter struct {
+	ActorId string
+	UserId  string
+	Limit   int
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// LoginResult is the outcome of checking a user's first factor. Users without
+// two-factor authentication get their tokens straight away; the others get an
+// MFA challenge token to exchange, together with a code, for their tokens.
+type LoginResult struct {
+	*TokenPair
+	MFARequired bool   `json:"mfa_required,omitempty"`
+	MFAToken    string `json:"mfa_token,omitempty"`
+}
+
+// TOTPSecret is a user's RFC 6238 secret, encrypted at rest. It is confirmed
+// once the user has proved they can generate codes from it.
+type TOTPSecret struct {
+	UserId          string     `json:"user_id"`
+	EncryptedSecret string     `json:"-"`
+	LastUsedStep    int64      `json:"-"`
+	ConfirmedAt     *time.Time `json:"confirmed_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// TOTPEnrollment is what a user needs to add a new TOTP secret to their
+// authenticator app: the secret in base32 and an otpauth:// URI for a QR code.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// Algorithms access tokens can be signed with. HS256 uses SECRET_KEY and can
+// only be verified by this service; the others use a key ring whose public
+// keys are published so that other services can verify tokens themselves.
+const (
+	SigningAlgorithmHS256 = "HS256"
+	SigningAlgorithmRS256 = "RS256"
+	SigningAlgorithmEdDSA = "EdDSA"
+)
+
+func ValidSigningAlgorithm(algorithm string) bool {
+	switch algorithm {
+	case SigningAlgorithmHS256, SigningAlgorithmRS256, SigningAlgorithmEdDSA:
+		return true
+	}
+	return false
+}
+
+// SigningKey is one key of the token signing key ring. It signs tokens from
+// ActivatesAt until RetiresAt, and tokens it signed are accepted until
+// ExpiresAt. The private key is stored encrypted.
+type SigningKey struct {
+	KeyId               string    `json:"kid"`
+	Algorithm           string    `json:"alg"`
+	EncryptedPrivateKey string    `json:"-"`
+	PublicKey           string    `json:"public_key"`
+	ActivatesAt         time.Time `json:"activates_at"`
+	RetiresAt           time.Time `json:"retires_at"`
+	ExpiresAt           time.Time `json:"expires_at"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// JSONWebKey is the RFC 7517 form of a public signing key.
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	KeyId     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// OpenID Connect scopes this service supports. Each scope other than openid
+// releases a group of standard claims about the user.
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+	ScopePhone   = "phone"
+	ScopeAddress = "address"
+)
+
+var SupportedScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopePhone, ScopeAddress}
+
+// OAuthClient is an application registered to log users in through this
+// service. Public clients, such as the mobile app, have no secret and rely on
+// PKCE alone.
+type OAuthClient struct {
+	ClientId         string    `json:"client_id"`
+	ClientSecretHash string    `json:"-"`
+	Name             string    `json:"name"`
+	RedirectURIs     []string  `json:"redirect_uris"`
+	Scopes           []string  `json:"scopes"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+func (c OAuthClient) Confidential() bool {
+	return c.ClientSecretHash != ""
+}
+
+// AuthorizationRequest holds the parameters of an OAuth 2.0 authorization
+// request. Only the code response type with an S256 PKCE challenge is supported.
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientId            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// AuthorizationCode is a single-use code issued to a client for a user. Only
+// a hash of the code is stored.
+type AuthorizationCode struct {
+	CodeHash      string
+	ClientId      string
+	UserId        string
+	RedirectURI   string
+	Scope         string
+	Nonce         string
+	CodeChallenge string
+	AuthTime      time.Time
+	ExpiresAt     time.Time
+	CreatedAt     time.Time
+}
+
+// TokenRequest holds the parameters of a request to the OAuth 2.0 token endpoint.
+type TokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	ClientId     string
+	ClientSecret string
+	CodeVerifier string
+	RefreshToken string
+	IPAddress    string
+	UserAgent    string
+}
+
+// OIDCTokenResponse is a token pair together with an ID token for the client.
+type OIDCTokenResponse struct {
+	*TokenPair
+	IDToken string `json:"id_token,omitempty"`
+	Scope   string `json:"scope,omitempty"`
+}
+
+// OpenIDConfiguration is the OpenID Connect discovery document.
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// ServiceAccount is a non-human caller, such as another UsafiHub service,
+// that authenticates with API keys instead of logging in.
+type ServiceAccount struct {
+	ServiceAccountId string    `json:"service_account_id"`
+	Name             string    `json:"name"`
+	Description      string    `json:"description"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// APIKey is a credential of a service account. Keys are shown to callers once
+// as "<prefix>.<secret>", where the prefix starts with APIKeyPrefix and
+// identifies the key; only a hash of the secret is stored. Scopes are the
+// permissions the key grants.
+type APIKey struct {
+	KeyId            string     `json:"key_id"`
+	ServiceAccountId string     `json:"service_account_id"`
+	Prefix           string     `json:"prefix"`
+	SecretHash       string     `json:"-"`
+	Scopes           []string   `json:"scopes"`
+	ExpiresAt        *time.Time `json:"expires_at"`
+	LastUsedAt       *time.Time `json:"last_used_at"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// APIKeyPrefix starts every API key, which tells them apart from JWTs.
+const APIKeyPrefix = "usk_"
+
+// Active reports whether the key may be used at the given time.
+func (k APIKey) Active(at time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || at.Before(*k.ExpiresAt))
+}
+
+type RevokedToken struct {
+	TokenId   string    `json:"token_id"`
+	UserId    string    `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
+type Claims struct {
+	TokenId       string    `json:"jti"`
+	UserId        string    `json:"user_id"`
+	Email         string    `json:"email"`
+	Roles         []string  `json:"roles"`
+	EmailVerified bool      `json:"email_verified"`
+	MFA           bool      `json:"mfa"`
+	Scope         string    `json:"scope"`
+	APIKeyId      string    `json:"api_key_id"`
+	SessionId     string    `json:"sid"`
+	Actor         string    `json:"act"`
+	IssuedAt      time.Time `json:"iat"`
+	ExpiresAt     time.Time `json:"exp"`
+}
+
+// ServiceAccount reports whether the caller authenticated with an API key, in
+// which case UserId holds the service account ID and Scope the key's scopes.
+func (c Claims) ServiceAccount() bool {
+	return c.APIKeyId != ""
+}
+
+// Impersonated reports whether the token was issued to Actor, an admin,
+// acting as the user.
+func (c Claims) Impersonated() bool {
+	return c.Actor != ""
+}
+
+func (c Claims) HasScope(scope string) bool {
+	for _, claimScope := range strings.Fields(c.Scope) {
+		if claimScope == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Claims) HasRole(role string) bool {
+	for _, claimRole := range c.Roles {
+		if claimRole == role {
+			return true
+		}
+	}
+	return false
+}
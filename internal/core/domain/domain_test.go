@@ -58,3 +58,21 @@ func TestUserRoleDomain(t *testing.T) {
 		}
 	})
 }
+
+func TestClaimsDomain(t *testing.T) {
+	// Test role lookup on claims
+	t.Run("Test claims HasRole", func(t *testing.T) {
+		claims := Claims{
+			UserId: "1",
+			Roles:  []string{RoleAdmin, "Cleaner"},
+		}
+
+		if !claims.HasRole(RoleAdmin) {
+			t.Errorf("expected claims to have role %s", RoleAdmin)
+		}
+
+		if claims.HasRole("Customer") {
+			t.Error("expected claims not to have role 'Customer'")
+		}
+	})
+}
@@ -0,0 +1,154 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Error kinds. Every domain error belongs to exactly one kind, so callers can
+// decide how to react with errors.Is without knowing the specific error.
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrAlreadyExists      = errors.New("already exists")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrValidation         = errors.New("validation failed")
+	ErrConflict           = errors.New("conflict")
+	ErrForbidden          = errors.New("forbidden")
+	ErrTooManyRequests    = errors.New("too many requests")
+)
+
+// Error is an error of a known kind carrying a stable, machine-readable code
+// such as "user_not_found" and a message that is safe to show to clients.
+// Err optionally holds the underlying cause, which is never shown to clients.
+type Error struct {
+	Kind       error
+	Code       string
+	Message    string
+	Violations []Violation
+	RetryAfter time.Duration
+	Err        error
+}
+
+// Violation describes one reason a value failed validation.
+type Violation struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func NewError(kind error, code, message string) *Error {
+	return &Error{
+		Kind:    kind,
+		Code:    code,
+		Message: message,
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the error's kind as well as any error with the same code, so
+// errors.Is(err, ErrUserNotFound) holds for copies made with WithCause.
+func (e *Error) Is(target error) bool {
+	if target == e.Kind {
+		return true
+	}
+	var other *Error
+	if errors.As(target, &other) {
+		return other.Code == e.Code
+	}
+	return false
+}
+
+// WithCause returns a copy of the error that wraps err.
+func (e *Error) WithCause(err error) *Error {
+	wrapped := *e
+	wrapped.Err = err
+	return &wrapped
+}
+
+// WithViolations returns a copy of the error listing the given violations.
+func (e *Error) WithViolations(violations []Violation) *Error {
+	wrapped := *e
+	wrapped.Violations = violations
+	return &wrapped
+}
+
+// WithRetryAfter returns a copy of the error telling clients when to try again.
+func (e *Error) WithRetryAfter(retryAfter time.Duration) *Error {
+	wrapped := *e
+	wrapped.RetryAfter = retryAfter
+	return &wrapped
+}
+
+var (
+	ErrUserNotFound              = NewError(ErrNotFound, "user_not_found", "user not found")
+	ErrUserAlreadyExists         = NewError(ErrAlreadyExists, "user_already_exists", "user with email exists")
+	ErrInvalidLogin              = NewError(ErrInvalidCredentials, "invalid_login", "invalid email or password")
+	ErrLoginThrottled            = NewError(ErrTooManyRequests, "too_many_login_attempts", "too many failed login attempts, try again later")
+	ErrIncorrectPassword         = NewError(ErrInvalidCredentials, "incorrect_password", "current password is incorrect")
+	ErrInvalidPasswordResetToken = NewError(ErrValidation, "invalid_password_reset_token", "invalid or expired password reset token")
+	ErrWeakPassword              = NewError(ErrValidation, "password_policy_violation", "password does not meet the password policy")
+	ErrInvalidEmailVerification  = NewError(ErrValidation, "invalid_email_verification_token", "invalid or expired email verification token")
+	ErrEmailNotVerified          = NewError(ErrForbidden, "email_not_verified", "email address has not been verified")
+	ErrInvalidPhoneNumber        = NewError(ErrValidation, "invalid_phone_number", "phone number is not valid")
+	ErrPhoneNumberRequired       = NewError(ErrValidation, "phone_number_required", "a phone number is required")
+	ErrInvalidOneTimeCode        = NewError(ErrValidation, "invalid_one_time_code", "invalid or expired code")
+	ErrOneTimeCodeRecentlySent   = NewError(ErrTooManyRequests, "one_time_code_recently_sent", "a code was sent recently, try again later")
+	ErrPhoneNumberInUse          = NewError(ErrConflict, "phone_number_in_use", "phone number is already verified by another account")
+	ErrEmailOrPhoneRequired      = NewError(ErrValidation, "email_or_phone_required", "provide either an email address or a phone number")
+	ErrInvalidPasswordlessMethod = NewError(ErrValidation, "invalid_passwordless_method", "method must be code or link")
+	ErrMFAAlreadyEnabled         = NewError(ErrConflict, "mfa_already_enabled", "two-factor authentication is already enabled")
+	ErrMFANotEnrolled            = NewError(ErrValidation, "mfa_not_enrolled", "start two-factor enrolment before confirming it")
+	ErrMFANotEnabled             = NewError(ErrValidation, "mfa_not_enabled", "two-factor authentication is not enabled")
+	ErrInvalidMFACode            = NewError(ErrInvalidCredentials, "invalid_mfa_code", "invalid two-factor authentication code")
+	ErrInvalidMFAChallenge       = NewError(ErrInvalidCredentials, "invalid_mfa_challenge", "invalid or expired two-factor authentication challenge")
+	ErrMFARequired               = NewError(ErrForbidden, "mfa_required", "two-factor authentication must be enabled for this action")
+	ErrInvalidRefreshToken       = NewError(ErrInvalidCredentials, "invalid_refresh_token", "invalid or expired refresh token")
+	ErrRefreshTokenReused        = NewError(ErrInvalidCredentials, "refresh_token_reused", "refresh token reuse detected")
+	ErrInvalidAccessToken        = NewError(ErrInvalidCredentials, "invalid_access_token", "invalid or expired access token")
+	ErrTokenRevoked              = NewError(ErrInvalidCredentials, "token_revoked", "access token has been revoked")
+	ErrSessionNotFound           = NewError(ErrNotFound, "session_not_found", "session not found")
+	ErrUnauthenticated           = NewError(ErrInvalidCredentials, "unauthenticated", "request not authorized")
+	ErrMalformedBearerToken      = NewError(ErrValidation, "malformed_bearer_token", "authorization header must be of the form \"Bearer <token>\"")
+	ErrPermissionDenied          = NewError(ErrForbidden, "permission_denied", "you do not have permission to perform this action")
+)
+
+// Errors for admin impersonation.
+var (
+	ErrImpersonationForbidden      = NewError(ErrForbidden, "impersonation_forbidden", "this action is not available while impersonating a user")
+	ErrCannotImpersonate           = NewError(ErrForbidden, "cannot_impersonate", "admins and your own account cannot be impersonated")
+	ErrImpersonationReasonRequired = NewError(ErrValidation, "impersonation_reason_required", "a reason for impersonating the user is required")
+)
+
+// OAuth 2.0 errors use the error codes from RFC 6749, so the token endpoint
+// can return them as they are.
+var (
+	ErrOAuthClientNotFound          = NewError(ErrNotFound, "oauth_client_not_found", "oauth client not found")
+	ErrInvalidRedirectURI           = NewError(ErrValidation, "invalid_redirect_uri", "redirect_uri is not registered for this client")
+	ErrOAuthInvalidRequest          = NewError(ErrValidation, "invalid_request", "the request is missing a parameter or is otherwise malformed")
+	ErrOAuthInvalidClient           = NewError(ErrInvalidCredentials, "invalid_client", "client authentication failed")
+	ErrOAuthInvalidGrant            = NewError(ErrInvalidCredentials, "invalid_grant", "the authorization code or refresh token is invalid or expired")
+	ErrOAuthInvalidScope            = NewError(ErrValidation, "invalid_scope", "the requested scope is invalid or not allowed for this client")
+	ErrOAuthUnsupportedGrantType    = NewError(ErrValidation, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+	ErrOAuthUnsupportedResponseType = NewError(ErrValidation, "unsupported_response_type", "response_type must be code")
+)
+
+// Errors for service accounts and their API keys.
+var (
+	ErrServiceAccountNotFound     = NewError(ErrNotFound, "service_account_not_found", "service account not found")
+	ErrAPIKeyNotFound             = NewError(ErrNotFound, "api_key_not_found", "api key not found")
+	ErrInvalidAPIKey              = NewError(ErrInvalidCredentials, "invalid_api_key", "invalid, expired or revoked api key")
+	ErrInvalidAPIKeyScope         = NewError(ErrValidation, "invalid_api_key_scope", "api key scopes must be existing permissions")
+	ErrInvalidAPIKeyExpiry        = NewError(ErrValidation, "invalid_api_key_expiry", "api key expiry must be in the future")
+	ErrServiceAccountNameRequired = NewError(ErrValidation, "service_account_name_required", "service account name is required")
+)
@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	t.Run("Test errors match their kind", func(t *testing.T) {
+		err := fmt.Errorf("get user: %w", ErrUserNotFound)
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected %v to be a not found error", err)
+		}
+		if errors.Is(err, ErrAlreadyExists) {
+			t.Errorf("expected %v not to be an already exists error", err)
+		}
+	})
+
+	t.Run("Test errors with a cause match by code", func(t *testing.T) {
+		err := ErrUserNotFound.WithCause(sql.ErrNoRows)
+		if !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("expected %v to match %v", err, ErrUserNotFound)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected %v to wrap %v", err, sql.ErrNoRows)
+		}
+		if errors.Is(err, ErrInvalidLogin) {
+			t.Errorf("expected %v not to match %v", err, ErrInvalidLogin)
+		}
+	})
+}
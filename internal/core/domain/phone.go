@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"strings"
+)
+
+// DefaultCountryCode is the calling code assumed for phone numbers written
+// without one. Most of our cleaners and clients are in Kenya.
+const DefaultCountryCode = "254"
+
+// nationalNumberLengths holds the length of national numbers for the calling
+// codes we know. Numbers for other codes are only checked against E.164 limits.
+var nationalNumberLengths = map[string]int{
+	"254": 9,
+}
+
+// NormalizePhoneNumber returns number in E.164 form, such as +254712345678.
+// Spaces, dashes, dots and brackets are ignored. Numbers starting with + or 00
+// are international; other numbers are national numbers in DefaultCountryCode,
+// with or without the leading 0. An empty number is returned unchanged.
+func NormalizePhoneNumber(number string) (string, error) {
+	number = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, number)
+	if number == "" {
+		return "", nil
+	}
+
+	var digits string
+	switch {
+	case strings.HasPrefix(number, "+"):
+		digits = number[1:]
+	case strings.HasPrefix(number, "00"):
+		digits = number[2:]
+	case strings.HasPrefix(number, DefaultCountryCode) && len(number) == len(DefaultCountryCode)+nationalNumberLengths[DefaultCountryCode]:
+		digits = number
+	default:
+		digits = DefaultCountryCode + strings.TrimPrefix(number, "0")
+	}
+
+	if !isDigits(digits) || len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+		return "", ErrInvalidPhoneNumber
+	}
+	for code, length := range nationalNumberLengths {
+		if strings.HasPrefix(digits, code) && len(digits) != len(code)+length {
+			return "", ErrInvalidPhoneNumber
+		}
+	}
+	return "+" + digits, nil
+}
+
+func isDigits(value string) bool {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return value != ""
+}
@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizePhoneNumber(t *testing.T) {
+	valid := map[string]string{
+		"":                   "",
+		"0712345678":         "+254712345678",
+		"0712 345 678":       "+254712345678",
+		"712345678":          "+254712345678",
+		"254712345678":       "+254712345678",
+		"+254 (712) 345-678": "+254712345678",
+		"00254712345678":     "+254712345678",
+		"0110123456":         "+254110123456",
+		"+14155552671":       "+14155552671",
+		"+44 20 7946 0958":   "+442079460958",
+	}
+	for number, expected := range valid {
+		normalized, err := NormalizePhoneNumber(number)
+		if err != nil {
+			t.Errorf("NormalizePhoneNumber(%q) returned %v", number, err)
+		}
+		if normalized != expected {
+			t.Errorf("NormalizePhoneNumber(%q) = %q, want %q", number, normalized, expected)
+		}
+	}
+
+	invalid := []string{"07123456", "07123456789", "+2547123456789", "+0712345678", "07l2345678", "+1234", "+1234567890123456", "call me"}
+	for _, number := range invalid {
+		if _, err := NormalizePhoneNumber(number); !errors.Is(err, ErrInvalidPhoneNumber) {
+			t.Errorf("NormalizePhoneNumber(%q) expected ErrInvalidPhoneNumber, got %v", number, err)
+		}
+	}
+}
@@ -1,54 +1,260 @@
 package ports
 
 import (
+	"context"
+	"time"
+
 	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
 )
 
 type UserService interface {
-	CreateUser(user domain.User) (*domain.User, error)
-	GetUsersWithRole(roleName string) ([]*domain.User, error)
-	GetUserById(userId string) (*domain.User, error)
-	GetUsers() ([]*domain.User, error)
-	GetUserByEmail(email string) (*domain.User, error)
-	UpdateUser(user domain.User) (*domain.User, error)
-	DeleteUser(userId string) error
-	LoginUser(email, password string) (string, error)
+	CreateUser(ctx context.Context, user domain.User) (*domain.User, error)
+	GetUsersWithRole(ctx context.Context, roleName string) ([]*domain.User, error)
+	GetUserById(ctx context.Context, userId string) (*domain.User, error)
+	GetUsers(ctx context.Context) ([]*domain.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*domain.User, error)
+	UpdateUser(ctx context.Context, user domain.User) (*domain.User, error)
+	DeleteUser(ctx context.Context, userId string) error
+	LoginUser(ctx context.Context, request domain.LoginRequest) (*domain.LoginResult, error)
+	ChangePassword(ctx context.Context, userId, currentPassword, newPassword string) error
+	SetPassword(ctx context.Context, actor domain.Claims, userId, newPassword string) error
+	AuthorizeCredentialChange(ctx context.Context, actor domain.Claims, userId string) error
+	UnlockUser(ctx context.Context, userId string) error
+}
+
+type LoginThrottleService interface {
+	CheckLogin(ctx context.Context, email, ipAddress string) error
+	RecordLoginFailure(ctx context.Context, email, ipAddress string) error
+	RecordLoginSuccess(ctx context.Context, email, ipAddress string) error
+	Unlock(ctx context.Context, email string) error
+}
+
+type TokenService interface {
+	IssueTokens(ctx context.Context, user domain.User, auth domain.Authentication) (*domain.TokenPair, error)
+	IssueScopedTokens(ctx context.Context, user domain.User, scope string, auth domain.Authentication) (*domain.TokenPair, error)
+	IssueImpersonationToken(ctx context.Context, user domain.User, actor domain.Claims, ttl time.Duration) (*domain.TokenPair, error)
+	RefreshTokens(ctx context.Context, refreshToken, clientId string) (*domain.TokenPair, error)
+	ValidateAccessToken(ctx context.Context, accessToken string) (*domain.Claims, error)
+	Logout(ctx context.Context, claims domain.Claims, refreshToken string) error
+	LogoutEverywhere(ctx context.Context, userId string) error
+	GetSessions(ctx context.Context, userId string) ([]*domain.Session, error)
+	RevokeSession(ctx context.Context, userId, sessionId string) error
+}
+
+type ImpersonationService interface {
+	Impersonate(ctx context.Context, actor domain.Claims, userId, reason string, device domain.Device) (*domain.TokenPair, error)
+	RecordRequest(ctx context.Context, entry domain.AuditEntry) (*domain.AuditEntry, error)
+	CompleteRequest(ctx context.Context, auditId string, status int) error
+	GetAuditLog(ctx context.Context, filter domain.AuditFilter) ([]*domain.AuditEntry, error)
+}
+
+type OIDCService interface {
+	Discovery() domain.OpenIDConfiguration
+	ValidateAuthorizationRequest(ctx context.Context, request domain.AuthorizationRequest) (*domain.OAuthClient, error)
+	LoginRedirect(request domain.AuthorizationRequest) string
+	Authorize(ctx context.Context, claims domain.Claims, request domain.AuthorizationRequest) (string, error)
+	ExchangeToken(ctx context.Context, request domain.TokenRequest) (*domain.OIDCTokenResponse, error)
+	UserInfo(ctx context.Context, claims domain.Claims) (map[string]interface{}, error)
+	RegisterClient(ctx context.Context, client domain.OAuthClient, confidential bool) (*domain.OAuthClient, string, error)
+	GetClients(ctx context.Context) ([]*domain.OAuthClient, error)
+	DeleteClient(ctx context.Context, clientId string) error
+}
+
+// APIKeyService manages service accounts and authenticates the API keys they
+// call this service with.
+type APIKeyService interface {
+	CreateServiceAccount(ctx context.Context, account domain.ServiceAccount) (*domain.ServiceAccount, error)
+	GetServiceAccounts(ctx context.Context) ([]*domain.ServiceAccount, error)
+	DeleteServiceAccount(ctx context.Context, serviceAccountId string) error
+	CreateAPIKey(ctx context.Context, serviceAccountId string, scopes []string, expiresAt *time.Time) (*domain.APIKey, string, error)
+	GetAPIKeys(ctx context.Context, serviceAccountId string) ([]*domain.APIKey, error)
+	RevokeAPIKey(ctx context.Context, serviceAccountId, keyId string) error
+	ValidateAPIKey(ctx context.Context, key string) (*domain.Claims, error)
+}
+
+// KeyRingService signs and verifies JWTs with the current signing keys.
+type KeyRingService interface {
+	SignToken(ctx context.Context, claims map[string]interface{}) (string, error)
+	ParseToken(ctx context.Context, token string) (map[string]interface{}, error)
+	RotateKeys(ctx context.Context) error
+	JWKS(ctx context.Context) (*domain.JSONWebKeySet, error)
+}
+
+type EmailVerificationService interface {
+	SendVerificationEmail(ctx context.Context, user domain.User) error
+	ResendVerificationEmail(ctx context.Context, email string) error
+	VerifyEmail(ctx context.Context, token string) (*domain.User, error)
+}
+
+type PhoneVerificationService interface {
+	RequestPhoneVerification(ctx context.Context, userId string) error
+	VerifyPhone(ctx context.Context, userId, code string) (*domain.User, error)
+}
+
+type PasswordlessService interface {
+	RequestPasswordlessLogin(ctx context.Context, request domain.PasswordlessRequest) error
+	LoginWithCode(ctx context.Context, login domain.PasswordlessLogin) (*domain.LoginResult, error)
+}
+
+type MFAService interface {
+	EnrollTOTP(ctx context.Context, userId string) (*domain.TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, userId, code string, device domain.Device) ([]string, error)
+	DisableTOTP(ctx context.Context, userId, code string, device domain.Device) error
+	BeginLogin(ctx context.Context, user domain.User, device domain.Device) (*domain.LoginResult, error)
+	CompleteLogin(ctx context.Context, mfaToken, code string, device domain.Device) (*domain.TokenPair, error)
+}
+
+type PasswordResetService interface {
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
 }
 
 type RoleService interface {
-	CreateRole(role domain.Role) (*domain.Role, error)
-	GetRoleById(roleId string) (*domain.Role, error)
-	GetRoles() ([]*domain.Role, error)
-	UpdateRole(role domain.Role) error
-	DeleteRole(roleId string) error
+	CreateRole(ctx context.Context, role domain.Role) (*domain.Role, error)
+	GetRoleById(ctx context.Context, roleId string) (*domain.Role, error)
+	GetRoles(ctx context.Context) ([]*domain.Role, error)
+	UpdateRole(ctx context.Context, role domain.Role) error
+	DeleteRole(ctx context.Context, roleId string) error
+	CreatePermission(ctx context.Context, permission domain.Permission) (*domain.Permission, error)
+	GetPermissions(ctx context.Context) ([]*domain.Permission, error)
+	GetRolePermissions(ctx context.Context, roleId string) ([]*domain.Permission, error)
+	GrantPermission(ctx context.Context, rolePermission domain.RolePermission) error
+	RevokePermission(ctx context.Context, rolePermission domain.RolePermission) error
+	GetUserPermissions(ctx context.Context, userId string) ([]string, error)
 }
 
 type UserRoleService interface {
-	AddUserRole(userRole domain.UserRole) error
-	RemoveUserRole(userRole domain.UserRole) error
+	AddUserRole(ctx context.Context, userRole domain.UserRole) error
+	RemoveUserRole(ctx context.Context, userRole domain.UserRole) error
+	GetUserRoles(ctx context.Context, userId string) ([]*domain.Role, error)
 }
 
 type UserRepository interface {
-	CreateUser(user domain.User) (*domain.User, error)
-	GetUsersWithRole(roleName string) ([]*domain.User, error)
-	GetUserById(userId string) (*domain.User, error)
-	GetUsers() ([]*domain.User, error)
-	GetUserByEmail(email string) (*domain.User, error)
-	UpdateUser(user domain.User) (*domain.User, error)
-	DeleteUser(userId string) error
+	CreateUser(ctx context.Context, user domain.User) (*domain.User, error)
+	GetUsersWithRole(ctx context.Context, roleName string) ([]*domain.User, error)
+	GetUserById(ctx context.Context, userId string) (*domain.User, error)
+	GetUsers(ctx context.Context) ([]*domain.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*domain.User, error)
+	GetUserByVerifiedPhoneNumber(ctx context.Context, phoneNumber string) (*domain.User, error)
+	UpdateUser(ctx context.Context, user domain.User) (*domain.User, error)
+	UpdatePassword(ctx context.Context, userId, passwordHash string) error
+	MarkEmailVerified(ctx context.Context, userId, email string, verifiedAt time.Time) error
+	MarkPhoneVerified(ctx context.Context, userId, phoneNumber string, verifiedAt time.Time) error
+	DeleteUser(ctx context.Context, userId string) error
+}
+
+type OneTimeCodeRepository interface {
+	SaveOneTimeCode(ctx context.Context, code domain.OneTimeCode) error
+	GetOneTimeCode(ctx context.Context, userId, purpose string) (*domain.OneTimeCode, error)
+	IncrementOneTimeCodeAttempts(ctx context.Context, userId, purpose string, maxAttempts int) error
+	DeleteOneTimeCode(ctx context.Context, userId, purpose string) error
+}
+
+type MFARepository interface {
+	SaveTOTPSecret(ctx context.Context, secret domain.TOTPSecret) error
+	GetTOTPSecret(ctx context.Context, userId string) (*domain.TOTPSecret, error)
+	UseTOTPStep(ctx context.Context, userId string, step int64) (bool, error)
+	EnableMFA(ctx context.Context, userId string, recoveryCodeHashes []string, enabledAt time.Time) error
+	DisableMFA(ctx context.Context, userId string) error
+	UseRecoveryCode(ctx context.Context, userId, codeHash string, usedAt time.Time) (bool, error)
+}
+
+type PasswordResetRepository interface {
+	CreatePasswordResetToken(ctx context.Context, token domain.PasswordResetToken) error
+	GetPasswordResetToken(ctx context.Context, tokenHash string) (*domain.PasswordResetToken, error)
+	ConsumePasswordResetToken(ctx context.Context, tokenHash string) (*domain.PasswordResetToken, error)
+}
+
+type LoginAttemptRepository interface {
+	GetLoginAttempts(ctx context.Context, keys []string) ([]*domain.LoginAttempt, error)
+	RecordLoginFailure(ctx context.Context, key string, failedAt, windowStart time.Time) (*domain.LoginAttempt, error)
+	BlockLogin(ctx context.Context, key string, until time.Time) error
+	ClearLoginAttempts(ctx context.Context, key string) error
+}
+
+type TokenRepository interface {
+	CreateRefreshToken(ctx context.Context, token domain.RefreshToken) error
+	GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*domain.RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, tokenId string, replacement domain.RefreshToken) (bool, error)
+	RevokeRefreshTokenFamily(ctx context.Context, familyId string) error
+	RevokeUserRefreshTokens(ctx context.Context, userId string) error
+}
+
+type AuditRepository interface {
+	CreateAuditEntry(ctx context.Context, entry domain.AuditEntry) error
+	SetAuditEntryStatus(ctx context.Context, auditId string, status int) error
+	GetAuditEntries(ctx context.Context, filter domain.AuditFilter) ([]*domain.AuditEntry, error)
+}
+
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session domain.Session) error
+	GetSession(ctx context.Context, sessionId string) (*domain.Session, error)
+	GetSessions(ctx context.Context, userId string, at time.Time) ([]*domain.Session, error)
+	TouchSession(ctx context.Context, sessionId string, lastSeenAt, expiresAt time.Time) error
+}
+
+type OAuthRepository interface {
+	CreateClient(ctx context.Context, client domain.OAuthClient) error
+	GetClient(ctx context.Context, clientId string) (*domain.OAuthClient, error)
+	GetClients(ctx context.Context) ([]*domain.OAuthClient, error)
+	DeleteClient(ctx context.Context, clientId string) error
+	CreateAuthorizationCode(ctx context.Context, code domain.AuthorizationCode) error
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*domain.AuthorizationCode, error)
+}
+
+type APIKeyRepository interface {
+	CreateServiceAccount(ctx context.Context, account domain.ServiceAccount) error
+	GetServiceAccount(ctx context.Context, serviceAccountId string) (*domain.ServiceAccount, error)
+	GetServiceAccounts(ctx context.Context) ([]*domain.ServiceAccount, error)
+	DeleteServiceAccount(ctx context.Context, serviceAccountId string) error
+	CreateAPIKey(ctx context.Context, key domain.APIKey) error
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*domain.APIKey, error)
+	GetAPIKeys(ctx context.Context, serviceAccountId string) ([]*domain.APIKey, error)
+	RevokeAPIKey(ctx context.Context, serviceAccountId, keyId string, at time.Time) error
+	TouchAPIKey(ctx context.Context, keyId string, at time.Time) error
+}
+
+type SigningKeyRepository interface {
+	CreateSigningKey(ctx context.Context, key domain.SigningKey) error
+	GetSigningKeys(ctx context.Context, at time.Time) ([]domain.SigningKey, error)
+	DeleteExpiredSigningKeys(ctx context.Context, at time.Time) error
+}
+
+type RevocationRepository interface {
+	RevokeToken(ctx context.Context, token domain.RevokedToken) error
+	IsTokenRevoked(ctx context.Context, tokenId string) (bool, error)
+	RevokeUserTokens(ctx context.Context, userId string, revokedAt time.Time) error
+	GetUserTokensRevokedAt(ctx context.Context, userId string) (*time.Time, error)
+	RevokeSession(ctx context.Context, sessionId string, revokedAt time.Time) error
+	IsSessionRevoked(ctx context.Context, sessionId string) (bool, error)
 }
 
 type RoleRepository interface {
-	CreateRole(role domain.Role) (*domain.Role, error)
-	GetRoleById(roleId string) (*domain.Role, error)
-	GetRoles() ([]*domain.Role, error)
-	UpdateRole(role domain.Role) error
-	DeleteRole(roleId string) error
+	CreateRole(ctx context.Context, role domain.Role) (*domain.Role, error)
+	GetRoleById(ctx context.Context, roleId string) (*domain.Role, error)
+	GetRoles(ctx context.Context) ([]*domain.Role, error)
+	UpdateRole(ctx context.Context, role domain.Role) error
+	DeleteRole(ctx context.Context, roleId string) error
+	CreatePermission(ctx context.Context, permission domain.Permission) (*domain.Permission, error)
+	GetPermissions(ctx context.Context) ([]*domain.Permission, error)
+	GetRolePermissions(ctx context.Context, roleId string) ([]*domain.Permission, error)
+	GrantPermission(ctx context.Context, rolePermission domain.RolePermission) error
+	RevokePermission(ctx context.Context, rolePermission domain.RolePermission) error
+	GetUserPermissions(ctx context.Context, userId string) ([]string, error)
 }
 
 type UserRoleRepository interface {
-	AddUserRole(userRole domain.UserRole) error
-	RemoveUserRole(userRole domain.UserRole) error
+	AddUserRole(ctx context.Context, userRole domain.UserRole) error
+	RemoveUserRole(ctx context.Context, userRole domain.UserRole) error
+	GetUserRoles(ctx context.Context, userId string) ([]*domain.Role, error)
+}
+
+type PasswordPolicy interface {
+	Validate(password string, user domain.User) error
+}
+
+type BreachedPasswordChecker interface {
+	IsBreached(password string) (bool, error)
 }
 
 type LoggerService interface {
@@ -57,10 +263,18 @@ type LoggerService interface {
 	Error(message string)
 }
 
+type NotificationService interface {
+	Send(notification domain.Notification) error
+}
+
+type SMSSender interface {
+	SendSMS(message domain.SMSMessage) error
+}
+
 type BaseRepository interface {
-	DropTables() error
+	DropTables(ctx context.Context) error
 }
 
 type BaseService interface {
-	DropTables() error
+	DropTables(ctx context.Context) error
 }
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
+	"github.com/google/uuid"
+)
+
+// apiKeyLastUsedResolution bounds how often last_used_at is written for a key
+// that is in constant use.
+const apiKeyLastUsedResolution = time.Minute
+
+type apiKeyService struct {
+	repo     ports.APIKeyRepository
+	roleRepo ports.RoleRepository
+	logger   ports.LoggerService
+}
+
+func NewAPIKeyService(repo ports.APIKeyRepository, roleRepo ports.RoleRepository, logger ports.LoggerService) *apiKeyService {
+	service := apiKeyService{
+		repo:     repo,
+		roleRepo: roleRepo,
+		logger:   logger,
+	}
+	return &service
+}
+
+func (svc apiKeyService) CreateServiceAccount(ctx context.Context, account domain.ServiceAccount) (*domain.ServiceAccount, error) {
+	account.Name = strings.TrimSpace(account.Name)
+	if account.Name == "" {
+		return nil, domain.ErrServiceAccountNameRequired
+	}
+	account.ServiceAccountId = uuid.New().String()
+	account.CreatedAt = time.Now()
+
+	if err := svc.repo.CreateServiceAccount(ctx, account); err != nil {
+		svc.logger.Error(fmt.Sprintf("create service account: %v", err))
+		return nil, fmt.Errorf("create service account: %w", err)
+	}
+	return &account, nil
+}
+
+func (svc apiKeyService) GetServiceAccounts(ctx context.Context) ([]*domain.ServiceAccount, error) {
+	accounts, err := svc.repo.GetServiceAccounts(ctx)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("get service accounts: %v", err))
+		return nil, fmt.Errorf("get service accounts: %w", err)
+	}
+	return accounts, nil
+}
+
+// DeleteServiceAccount deletes the account and every API key it holds.
+func (svc apiKeyService) DeleteServiceAccount(ctx context.Context, serviceAccountId string) error {
+	if err := svc.repo.DeleteServiceAccount(ctx, serviceAccountId); err != nil {
+		svc.logger.Error(fmt.Sprintf("delete service account: %v", err))
+		return fmt.Errorf("delete service account: %w", err)
+	}
+	return nil
+}
+
+// CreateAPIKey issues a key for the service account granting the given
+// permissions, which must exist. The key is returned once and only a hash of
+// its secret is stored. A nil expiresAt creates a key that does not expire.
+func (svc apiKeyService) CreateAPIKey(ctx context.Context, serviceAccountId string, scopes []string, expiresAt *time.Time) (*domain.APIKey, string, error) {
+	if _, err := svc.repo.GetServiceAccount(ctx, serviceAccountId); err != nil {
+		svc.logger.Error(fmt.Sprintf("create api key: failed to get service account: %v", err))
+		return nil, "", fmt.Errorf("create api key: failed to get service account: %w", err)
+	}
+	if err := svc.validateScopes(ctx, scopes); err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	if expiresAt != nil && !expiresAt.After(now) {
+		return nil, "", domain.ErrInvalidAPIKeyExpiry
+	}
+
+	prefix, err := generateAPIKeyPrefix()
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("create api key: failed to generate prefix: %v", err))
+		return nil, "", fmt.Errorf("create api key: failed to generate prefix: %w", err)
+	}
+	secret, err := generateOpaqueToken()
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("create api key: failed to generate secret: %v", err))
+		return nil, "", fmt.Errorf("create api key: failed to generate secret: %w", err)
+	}
+
+	key := domain.APIKey{
+		KeyId:            uuid.New().String(),
+		ServiceAccountId: serviceAccountId,
+		Prefix:           prefix,
+		SecretHash:       hashOpaqueToken(secret),
+		Scopes:           scopes,
+		ExpiresAt:        expiresAt,
+		CreatedAt:        now,
+	}
+	if err := svc.repo.CreateAPIKey(ctx, key); err != nil {
+		svc.logger.Error(fmt.Sprintf("create api key: %v", err))
+		return nil, "", fmt.Errorf("create api key: %w", err)
+	}
+	return &key, prefix + "." + secret, nil
+}
+
+func (svc apiKeyService) GetAPIKeys(ctx context.Context, serviceAccountId string) ([]*domain.APIKey, error) {
+	if _, err := svc.repo.GetServiceAccount(ctx, serviceAccountId); err != nil {
+		svc.logger.Error(fmt.Sprintf("get api keys: failed to get service account: %v", err))
+		return nil, fmt.Errorf("get api keys: failed to get service account: %w", err)
+	}
+	keys, err := svc.repo.GetAPIKeys(ctx, serviceAccountId)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("get api keys: %v", err))
+		return nil, fmt.Errorf("get api keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey stops the key from authenticating. Revoked keys stay listed so
+// that their last use can still be seen.
+func (svc apiKeyService) RevokeAPIKey(ctx context.Context, serviceAccountId, keyId string) error {
+	if err := svc.repo.RevokeAPIKey(ctx, serviceAccountId, keyId, time.Now()); err != nil {
+		svc.logger.Error(fmt.Sprintf("revoke api key: %v", err))
+		return fmt.Errorf("revoke api key: %w", err)
+	}
+	return nil
+}
+
+// ValidateAPIKey authenticates an API key and returns claims for its service
+// account carrying the key's scopes. The key's last use is recorded.
+func (svc apiKeyService) ValidateAPIKey(ctx context.Context, apiKey string) (*domain.Claims, error) {
+	prefix, secret, ok := strings.Cut(apiKey, ".")
+	if !ok || !strings.HasPrefix(prefix, domain.APIKeyPrefix) {
+		return nil, domain.ErrInvalidAPIKey
+	}
+
+	key, err := svc.repo.GetAPIKeyByPrefix(ctx, prefix)
+	if errors.Is(err, domain.ErrNotFound) {
+		svc.logger.Warning(fmt.Sprintf("validate api key: unknown api key %s", prefix))
+		return nil, domain.ErrInvalidAPIKey
+	}
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("validate api key: failed to get api key: %v", err))
+		return nil, fmt.Errorf("validate api key: failed to get api key: %w", err)
+	}
+
+	now := time.Now()
+	if !hmac.Equal([]byte(hashOpaqueToken(secret)), []byte(key.SecretHash)) || !key.Active(now) {
+		svc.logger.Warning(fmt.Sprintf("validate api key: rejected api key %s", prefix))
+		return nil, domain.ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyLastUsedResolution {
+		// The key is valid either way, so a failed write only costs accuracy.
+		if err := svc.repo.TouchAPIKey(ctx, key.KeyId, now); err != nil {
+			svc.logger.Warning(fmt.Sprintf("validate api key: failed to record use of %s: %v", prefix, err))
+		}
+	}
+
+	claims := &domain.Claims{
+		UserId:   key.ServiceAccountId,
+		Roles:    []string{},
+		Scope:    strings.Join(key.Scopes, " "),
+		APIKeyId: key.KeyId,
+		IssuedAt: key.CreatedAt,
+	}
+	if key.ExpiresAt != nil {
+		claims.ExpiresAt = *key.ExpiresAt
+	}
+	return claims, nil
+}
+
+// validateScopes checks that scopes names at least one permission and only
+// permissions that exist.
+func (svc apiKeyService) validateScopes(ctx context.Context, scopes []string) error {
+	if len(scopes) == 0 {
+		return domain.ErrInvalidAPIKeyScope
+	}
+	permissions, err := svc.roleRepo.GetPermissions(ctx)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("create api key: failed to get permissions: %v", err))
+		return fmt.Errorf("create api key: failed to get permissions: %w", err)
+	}
+	for _, scope := range scopes {
+		found := false
+		for _, permission := range permissions {
+			if permission.Name == scope {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return domain.ErrInvalidAPIKeyScope
+		}
+	}
+	return nil
+}
+
+// generateAPIKeyPrefix returns the public identifier of a new API key.
+func generateAPIKeyPrefix() (string, error) {
+	bytes := make([]byte, 6)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return domain.APIKeyPrefix + hex.EncodeToString(bytes), nil
+}
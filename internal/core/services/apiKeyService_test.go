@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AntonyIS/usafi-hub-user-service/config"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/logger"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/repository"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+)
+
+func TestAPIKeyService(t *testing.T) {
+	requireDatabase(t)
+	logger, err := logger.NewDefaultLogger()
+	if err != nil {
+		panic(err)
+	}
+
+	config, err := config.NewConfig(logger)
+	if err != nil {
+		panic(err)
+	}
+
+	db, _ := repository.NewPostgresDB(*config)
+	factory := repository.NewRepositoryFactory(db, *config)
+	ctx := context.Background()
+	apiKeyService := NewAPIKeyService(factory.APIKeyRepository(), factory.RoleRepository(), logger)
+
+	account, err := apiKeyService.CreateServiceAccount(ctx, domain.ServiceAccount{
+		Name:        "booking-service",
+		Description: "Books cleaners for customers",
+	})
+	if err != nil {
+		t.Fatalf("error creating service account: %v", err)
+	}
+	defer apiKeyService.DeleteServiceAccount(ctx, account.ServiceAccountId)
+
+	t.Run("Testing CreateAPIKey and ValidateAPIKey", func(t *testing.T) {
+		if _, _, err := apiKeyService.CreateAPIKey(ctx, account.ServiceAccountId, []string{"bookings:everything"}, nil); !errors.Is(err, domain.ErrInvalidAPIKeyScope) {
+			t.Errorf("expected ErrInvalidAPIKeyScope, got %v", err)
+		}
+
+		key, apiKey, err := apiKeyService.CreateAPIKey(ctx, account.ServiceAccountId, []string{domain.PermissionUsersRead}, nil)
+		if err != nil {
+			t.Fatalf("error creating api key: %v", err)
+		}
+		if !strings.HasPrefix(apiKey, key.Prefix+".") || !strings.HasPrefix(key.Prefix, domain.APIKeyPrefix) {
+			t.Errorf("expected the api key to start with its prefix, got %s", apiKey)
+		}
+
+		claims, err := apiKeyService.ValidateAPIKey(ctx, apiKey)
+		if err != nil {
+			t.Fatalf("error validating api key: %v", err)
+		}
+		if !claims.ServiceAccount() || claims.UserId != account.ServiceAccountId || !claims.HasScope(domain.PermissionUsersRead) || claims.HasScope(domain.PermissionUsersWrite) {
+			t.Errorf("expected service account claims scoped to users:read, got %+v", claims)
+		}
+
+		if _, err := apiKeyService.ValidateAPIKey(ctx, key.Prefix+".wrong"); !errors.Is(err, domain.ErrInvalidAPIKey) {
+			t.Errorf("expected ErrInvalidAPIKey for a wrong secret, got %v", err)
+		}
+
+		keys, err := apiKeyService.GetAPIKeys(ctx, account.ServiceAccountId)
+		if err != nil || len(keys) != 1 || keys[0].LastUsedAt == nil {
+			t.Errorf("expected one key with its last use recorded, got %v: %v", keys, err)
+		}
+
+		if err := apiKeyService.RevokeAPIKey(ctx, account.ServiceAccountId, key.KeyId); err != nil {
+			t.Fatalf("error revoking api key: %v", err)
+		}
+		if _, err := apiKeyService.ValidateAPIKey(ctx, apiKey); !errors.Is(err, domain.ErrInvalidAPIKey) {
+			t.Errorf("expected ErrInvalidAPIKey for a revoked key, got %v", err)
+		}
+	})
+
+	t.Run("Testing CreateAPIKey rejects past expiry", func(t *testing.T) {
+		expiresAt := time.Now().Add(-time.Minute)
+		if _, _, err := apiKeyService.CreateAPIKey(ctx, account.ServiceAccountId, []string{domain.PermissionUsersRead}, &expiresAt); !errors.Is(err, domain.ErrInvalidAPIKeyExpiry) {
+			t.Errorf("expected ErrInvalidAPIKeyExpiry, got %v", err)
+		}
+	})
+}
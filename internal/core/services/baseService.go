@@ -1,6 +1,10 @@
 package services
 
-import "github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
+import (
+	"context"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
+)
 
 type baseService struct {
 	repo ports.BaseRepository
@@ -13,6 +17,6 @@ func NewBaseService(repo ports.BaseRepository) *baseService {
 	return &service
 }
 
-func (svc baseService) DropTables() error {
-	return svc.repo.DropTables()
+func (svc baseService) DropTables(ctx context.Context) error {
+	return svc.repo.DropTables(ctx)
 }
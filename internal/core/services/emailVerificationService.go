@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
+	"github.com/golang-jwt/jwt"
+)
+
+const emailVerificationPurpose = "email_verification"
+
+type emailVerificationService struct {
+	userRepo   ports.UserRepository
+	notifier   ports.NotificationService
+	logger     ports.LoggerService
+	signingKey []byte
+	verifyURL  string
+	tokenTTL   time.Duration
+}
+
+// NewEmailVerificationService creates a service issuing verification tokens
+// signed with a key derived from secret. Tokens are not stored: they carry the
+// user and the email they verify, and stop working once the email changes.
+func NewEmailVerificationService(userRepo ports.UserRepository, notifier ports.NotificationService, logger ports.LoggerService, secret []byte, verifyURL string, tokenTTL time.Duration) *emailVerificationService {
+	service := emailVerificationService{
+		userRepo:   userRepo,
+		notifier:   notifier,
+		logger:     logger,
+		signingKey: deriveKey(secret, emailVerificationPurpose),
+		verifyURL:  verifyURL,
+		tokenTTL:   tokenTTL,
+	}
+	return &service
+}
+
+// SendVerificationEmail sends the user a link to verify their current email.
+// Users whose email is already verified are not sent anything.
+func (svc emailVerificationService) SendVerificationEmail(ctx context.Context, user domain.User) error {
+	if user.EmailVerified() {
+		return nil
+	}
+
+	now := time.Now()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"purpose": emailVerificationPurpose,
+		"sub":     user.UserId,
+		"email":   user.Email,
+		"iat":     now.Unix(),
+		"exp":     now.Add(svc.tokenTTL).Unix(),
+	}).SignedString(svc.signingKey)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("send verification email: failed to sign token: %v", err))
+		return fmt.Errorf("send verification email: failed to sign token: %w", err)
+	}
+
+	err = svc.notifier.Send(domain.Notification{
+		Recipient: user.Email,
+		Subject:   "Verify your UsafiHub email address",
+		Message:   fmt.Sprintf("Use the link below to verify your email address. It expires in %s.\n%s?token=%s", svc.tokenTTL, svc.verifyURL, token),
+	})
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("send verification email: failed to send notification: %v", err))
+		return fmt.Errorf("send verification email: failed to send notification: %w", err)
+	}
+	return nil
+}
+
+// ResendVerificationEmail sends a new verification link to the account with the
+// given email. Unknown emails are not reported back so accounts cannot be enumerated.
+func (svc emailVerificationService) ResendVerificationEmail(ctx context.Context, email string) error {
+	user, err := svc.userRepo.GetUserByEmail(ctx, email)
+	if err != nil {
+		svc.logger.Warning(fmt.Sprintf("resend verification email: no user for email %s: %v", email, err))
+		return nil
+	}
+	return svc.SendVerificationEmail(ctx, *user)
+}
+
+// VerifyEmail checks a verification token and marks the email it was issued
+// for as verified. Verifying an already verified email succeeds.
+func (svc emailVerificationService) VerifyEmail(ctx context.Context, token string) (*domain.User, error) {
+	userId, email, err := svc.parseToken(token)
+	if err != nil {
+		svc.logger.Warning(fmt.Sprintf("verify email: %v", err))
+		return nil, domain.ErrInvalidEmailVerification
+	}
+
+	user, err := svc.userRepo.GetUserById(ctx, userId)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, domain.ErrInvalidEmailVerification
+	}
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("verify email: failed to get user: %v", err))
+		return nil, fmt.Errorf("verify email: failed to get user: %w", err)
+	}
+	if user.Email != email {
+		return nil, domain.ErrInvalidEmailVerification
+	}
+	if user.EmailVerified() {
+		return user, nil
+	}
+
+	verifiedAt := time.Now()
+	err = svc.userRepo.MarkEmailVerified(ctx, user.UserId, email, verifiedAt)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, domain.ErrInvalidEmailVerification
+	}
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("verify email: failed to mark email verified: %v", err))
+		return nil, fmt.Errorf("verify email: failed to mark email verified: %w", err)
+	}
+	user.EmailVerifiedAt = &verifiedAt
+	return user, nil
+}
+
+func (svc emailVerificationService) parseToken(token string) (string, string, error) {
+	parsed, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return svc.signingKey, nil
+	})
+	if err != nil || !parsed.Valid {
+		return "", "", fmt.Errorf("invalid token: %v", err)
+	}
+
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", "", errors.New("invalid token claims")
+	}
+	purpose, _ := claims["purpose"].(string)
+	userId, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+	if purpose != emailVerificationPurpose || userId == "" || email == "" {
+		return "", "", errors.New("token is missing required claims")
+	}
+	if _, ok := claims["exp"]; !ok {
+		return "", "", errors.New("token has no expiry")
+	}
+	return userId, email, nil
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/AntonyIS/usafi-hub-user-service/config"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/logger"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/repository"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+)
+
+func TestEmailVerificationService(t *testing.T) {
+	requireDatabase(t)
+	logger, err := logger.NewDefaultLogger()
+	if err != nil {
+		panic(err)
+	}
+
+	config, err := config.NewConfig(logger)
+	if err != nil {
+		panic(err)
+	}
+
+	db, _ := repository.NewPostgresDB(*config)
+	factory := repository.NewRepositoryFactory(db, *config)
+	ctx := context.Background()
+	userRepo := factory.UserRepository()
+	tokenRepo := factory.TokenRepository()
+	revocationRepo := factory.RevocationRepository()
+	userRoleRepo := factory.UserRoleRepository()
+	notifier := &recordingNotifier{}
+
+	tokenService := NewTokenService(tokenRepo, revocationRepo, factory.SessionRepository(), userRepo, userRoleRepo, logger, newTestKeyRing(factory.SigningKeyRepository(), *config, logger), config.ACCESS_TOKEN_TTL, config.REFRESH_TOKEN_TTL)
+	loginThrottle := newTestLoginThrottle(factory.LoginAttemptRepository(), *config, logger)
+	mfaService := newTestMFAService(userRepo, factory.MFARepository(), tokenService, loginThrottle, *config, logger)
+	userService := NewUserService(userRepo, factory.UserRoleRepository(), tokenService, mfaService, newTestPasswordPolicy(*config, logger), loginThrottle, domain.EmailVerificationRequired, logger)
+	verificationService := NewEmailVerificationService(userRepo, notifier, logger, []byte(config.SECRET_KEY), config.EMAIL_VERIFICATION_URL, config.EMAIL_VERIFICATION_TTL)
+
+	user, err := userService.CreateUser(ctx, domain.User{
+		Username:     "verify_doe",
+		PasswordHash: "Verify_Password1",
+		Email:        "verify.doe@example.com",
+		FullName:     "Verify Doe",
+	})
+	if err != nil {
+		t.Fatalf("error adding user: %v", err)
+	}
+	defer userService.DeleteUser(ctx, user.UserId)
+
+	t.Run("Testing LoginUser requires a verified email", func(t *testing.T) {
+		_, err := userService.LoginUser(ctx, domain.LoginRequest{Email: user.Email, Password: "Verify_Password1"})
+		if !errors.Is(err, domain.ErrEmailNotVerified) {
+			t.Errorf("expected ErrEmailNotVerified, got %v", err)
+		}
+	})
+
+	t.Run("Testing VerifyEmail rejects invalid tokens", func(t *testing.T) {
+		_, err := verificationService.VerifyEmail(ctx, "not-a-token")
+		if !errors.Is(err, domain.ErrInvalidEmailVerification) {
+			t.Errorf("expected ErrInvalidEmailVerification, got %v", err)
+		}
+
+		otherService := NewEmailVerificationService(userRepo, notifier, logger, []byte("another secret"), config.EMAIL_VERIFICATION_URL, config.EMAIL_VERIFICATION_TTL)
+		if err := otherService.SendVerificationEmail(ctx, *user); err != nil {
+			t.Fatalf("error sending verification email: %v", err)
+		}
+		_, err = verificationService.VerifyEmail(ctx, notifier.lastToken())
+		if !errors.Is(err, domain.ErrInvalidEmailVerification) {
+			t.Errorf("expected token signed with another key to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("Testing VerifyEmail", func(t *testing.T) {
+		if err := verificationService.ResendVerificationEmail(ctx, user.Email); err != nil {
+			t.Fatalf("error resending verification email: %v", err)
+		}
+		token := notifier.lastToken()
+		if token == "" {
+			t.Fatal("expected verification token in notification")
+		}
+
+		verified, err := verificationService.VerifyEmail(ctx, token)
+		if err != nil {
+			t.Fatalf("error verifying email: %v", err)
+		}
+		if !verified.EmailVerified() {
+			t.Errorf("expected email to be verified")
+		}
+
+		if _, err := userService.LoginUser(ctx, domain.LoginRequest{Email: user.Email, Password: "Verify_Password1"}); err != nil {
+			t.Errorf("expected verified user to log in, got %v", err)
+		}
+	})
+
+	t.Run("Testing changing the email clears its verification", func(t *testing.T) {
+		notifier.notifications = nil
+		if err := verificationService.ResendVerificationEmail(ctx, user.Email); err != nil {
+			t.Fatalf("error resending verification email: %v", err)
+		}
+		if len(notifier.notifications) != 0 {
+			t.Errorf("expected no notification for a verified email, got %d", len(notifier.notifications))
+		}
+
+		dbUser, err := userService.GetUserById(ctx, user.UserId)
+		if err != nil {
+			t.Fatalf("error getting user: %v", err)
+		}
+		if err := verificationService.SendVerificationEmail(ctx, domain.User{UserId: dbUser.UserId, Email: dbUser.Email}); err != nil {
+			t.Fatalf("error sending verification email: %v", err)
+		}
+		oldToken := notifier.lastToken()
+
+		dbUser.Email = "verify.doe2@example.com"
+		dbUser, err = userService.UpdateUser(ctx, *dbUser)
+		if err != nil {
+			t.Fatalf("error updating user: %v", err)
+		}
+		if dbUser.EmailVerified() {
+			t.Errorf("expected new email to be unverified")
+		}
+		if _, err := verificationService.VerifyEmail(ctx, oldToken); !errors.Is(err, domain.ErrInvalidEmailVerification) {
+			t.Errorf("expected token for the old email to be rejected, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
+	"github.com/google/uuid"
+)
+
+// auditLogLimit caps how many audit log entries are returned at once.
+const auditLogLimit = 500
+
+type impersonationService struct {
+	userRepo     ports.UserRepository
+	userRoleRepo ports.UserRoleRepository
+	auditRepo    ports.AuditRepository
+	tokenService ports.TokenService
+	logger       ports.LoggerService
+	tokenTTL     time.Duration
+}
+
+func NewImpersonationService(userRepo ports.UserRepository, userRoleRepo ports.UserRoleRepository, auditRepo ports.AuditRepository, tokenService ports.TokenService, logger ports.LoggerService, tokenTTL time.Duration) *impersonationService {
+	service := impersonationService{
+		userRepo:     userRepo,
+		userRoleRepo: userRoleRepo,
+		auditRepo:    auditRepo,
+		tokenService: tokenService,
+		logger:       logger,
+		tokenTTL:     tokenTTL,
+	}
+	return &service
+}
+
+// Impersonate issues the actor a short-lived access token for the user and
+// records why in the audit log. Admins cannot be impersonated, so that the
+// permission never grants more than the actor could be given directly, and
+// an impersonation cannot be started from another one.
+func (svc impersonationService) Impersonate(ctx context.Context, actor domain.Claims, userId, reason string, device domain.Device) (*domain.TokenPair, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, domain.ErrImpersonationReasonRequired
+	}
+	if actor.Impersonated() || actor.ServiceAccount() {
+		return nil, domain.ErrImpersonationForbidden
+	}
+	if actor.UserId == userId {
+		return nil, domain.ErrCannotImpersonate
+	}
+
+	user, err := svc.userRepo.GetUserById(ctx, userId)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("impersonate: failed to get user: %v", err))
+		return nil, fmt.Errorf("impersonate: failed to get user: %w", err)
+	}
+	admin, err := hasAdminRole(ctx, svc.userRoleRepo, userId)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("impersonate: failed to get user roles: %v", err))
+		return nil, fmt.Errorf("impersonate: failed to get user roles: %w", err)
+	}
+	if admin {
+		return nil, domain.ErrCannotImpersonate
+	}
+
+	tokens, err := svc.tokenService.IssueImpersonationToken(ctx, *user, actor, svc.tokenTTL)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("impersonate: failed to issue token: %v", err))
+		return nil, fmt.Errorf("impersonate: failed to issue token: %w", err)
+	}
+	claims, err := svc.tokenService.ValidateAccessToken(ctx, tokens.AccessToken)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("impersonate: failed to read issued token: %v", err))
+		return nil, fmt.Errorf("impersonate: failed to read issued token: %w", err)
+	}
+
+	// The token is only handed out once its impersonation is on record.
+	entry := domain.AuditEntry{
+		AuditId:   uuid.New().String(),
+		Action:    domain.AuditImpersonationStarted,
+		ActorId:   actor.UserId,
+		UserId:    user.UserId,
+		TokenId:   claims.TokenId,
+		Reason:    reason,
+		IPAddress: device.IPAddress,
+		UserAgent: device.UserAgent,
+		CreatedAt: time.Now(),
+	}
+	if err := svc.auditRepo.CreateAuditEntry(ctx, entry); err != nil {
+		svc.logger.Error(fmt.Sprintf("impersonate: failed to record audit entry: %v", err))
+		return nil, fmt.Errorf("impersonate: failed to record audit entry: %w", err)
+	}
+	svc.logger.Warning(fmt.Sprintf("impersonate: %s is acting as %s: %s", actor.UserId, user.UserId, reason))
+	return tokens, nil
+}
+
+// RecordRequest adds a request made with an impersonation token to the audit
+// log. Requests that cannot be recorded must not be served.
+func (svc impersonationService) RecordRequest(ctx context.Context, entry domain.AuditEntry) (*domain.AuditEntry, error) {
+	entry.AuditId = uuid.New().String()
+	entry.Action = domain.AuditImpersonatedRequest
+	entry.CreatedAt = time.Now()
+	if err := svc.auditRepo.CreateAuditEntry(ctx, entry); err != nil {
+		svc.logger.Error(fmt.Sprintf("record impersonated request: %v", err))
+		return nil, fmt.Errorf("record impersonated request: %w", err)
+	}
+	return &entry, nil
+}
+
+// CompleteRequest records the response status of an impersonated request.
+func (svc impersonationService) CompleteRequest(ctx context.Context, auditId string, status int) error {
+	if err := svc.auditRepo.SetAuditEntryStatus(ctx, auditId, status); err != nil {
+		svc.logger.Error(fmt.Sprintf("complete impersonated request: %v", err))
+		return fmt.Errorf("complete impersonated request: %w", err)
+	}
+	return nil
+}
+
+// GetAuditLog returns matching audit log entries, newest first.
+func (svc impersonationService) GetAuditLog(ctx context.Context, filter domain.AuditFilter) ([]*domain.AuditEntry, error) {
+	if filter.Limit <= 0 || filter.Limit > auditLogLimit {
+		filter.Limit = auditLogLimit
+	}
+	entries, err := svc.auditRepo.GetAuditEntries(ctx, filter)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("get audit log: %v", err))
+		return nil, fmt.Errorf("get audit log: %w", err)
+	}
+	return entries, nil
+}
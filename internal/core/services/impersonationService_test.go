@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/AntonyIS/usafi-hub-user-service/config"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/logger"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/repository"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+)
+
+func TestImpersonationService(t *testing.T) {
+	requireDatabase(t)
+	logger, err := logger.NewDefaultLogger()
+	if err != nil {
+		panic(err)
+	}
+
+	config, err := config.NewConfig(logger)
+	if err != nil {
+		panic(err)
+	}
+
+	db, _ := repository.NewPostgresDB(*config)
+	factory := repository.NewRepositoryFactory(db, *config)
+	ctx := context.Background()
+	userRepo := factory.UserRepository()
+	userRoleRepo := factory.UserRoleRepository()
+
+	tokenService := NewTokenService(factory.TokenRepository(), factory.RevocationRepository(), factory.SessionRepository(), userRepo, userRoleRepo, logger, newTestKeyRing(factory.SigningKeyRepository(), *config, logger), config.ACCESS_TOKEN_TTL, config.REFRESH_TOKEN_TTL)
+	impersonationService := NewImpersonationService(userRepo, userRoleRepo, factory.AuditRepository(), tokenService, logger, config.IMPERSONATION_TOKEN_TTL)
+	loginThrottle := newTestLoginThrottle(factory.LoginAttemptRepository(), *config, logger)
+	mfaService := newTestMFAService(userRepo, factory.MFARepository(), tokenService, loginThrottle, *config, logger)
+	userService := NewUserService(userRepo, factory.UserRoleRepository(), tokenService, mfaService, newTestPasswordPolicy(*config, logger), loginThrottle, domain.EmailVerificationOptional, logger)
+
+	user, err := userService.CreateUser(ctx, domain.User{
+		Username:     "impersonated_doe",
+		PasswordHash: "Impersonated_Password1",
+		Email:        "impersonated.doe@example.com",
+		FullName:     "Impersonated Doe",
+	})
+	if err != nil {
+		t.Fatalf("error adding user: %v", err)
+	}
+	defer userService.DeleteUser(ctx, user.UserId)
+
+	actor := domain.Claims{UserId: "support-agent", Roles: []string{domain.RoleAdmin}, MFA: true}
+
+	t.Run("Testing Impersonate issues an audited act-claim token", func(t *testing.T) {
+		if _, err := impersonationService.Impersonate(ctx, actor, user.UserId, " ", domain.Device{}); !errors.Is(err, domain.ErrImpersonationReasonRequired) {
+			t.Errorf("expected ErrImpersonationReasonRequired, got %v", err)
+		}
+		if _, err := impersonationService.Impersonate(ctx, actor, actor.UserId, "Testing", domain.Device{}); !errors.Is(err, domain.ErrCannotImpersonate) {
+			t.Errorf("expected ErrCannotImpersonate for the actor themselves, got %v", err)
+		}
+
+		tokens, err := impersonationService.Impersonate(ctx, actor, user.UserId, "Reproducing a booking issue", domain.Device{IPAddress: "192.0.2.1"})
+		if err != nil {
+			t.Fatalf("error impersonating user: %v", err)
+		}
+		if tokens.RefreshToken != "" {
+			t.Error("expected impersonation tokens not to be refreshable")
+		}
+
+		claims, err := tokenService.ValidateAccessToken(ctx, tokens.AccessToken)
+		if err != nil {
+			t.Fatalf("error validating impersonation token: %v", err)
+		}
+		if !claims.Impersonated() || claims.Actor != actor.UserId || claims.UserId != user.UserId {
+			t.Errorf("expected a token for the user naming the actor, got %+v", claims)
+		}
+
+		if _, err := impersonationService.Impersonate(ctx, *claims, "another-user", "Testing", domain.Device{}); !errors.Is(err, domain.ErrImpersonationForbidden) {
+			t.Errorf("expected ErrImpersonationForbidden from an impersonated session, got %v", err)
+		}
+
+		entries, err := impersonationService.GetAuditLog(ctx, domain.AuditFilter{UserId: user.UserId})
+		if err != nil {
+			t.Fatalf("error getting audit log: %v", err)
+		}
+		if len(entries) != 1 || entries[0].Action != domain.AuditImpersonationStarted || entries[0].Reason != "Reproducing a booking issue" || entries[0].TokenId != claims.TokenId {
+			t.Errorf("expected the impersonation to be recorded, got %+v", entries)
+		}
+	})
+
+	t.Run("Testing RecordRequest and CompleteRequest", func(t *testing.T) {
+		entry, err := impersonationService.RecordRequest(ctx, domain.AuditEntry{
+			ActorId: actor.UserId,
+			UserId:  user.UserId,
+			TokenId: "token",
+			Method:  http.MethodGet,
+			Path:    "/users/v1/" + user.UserId,
+		})
+		if err != nil {
+			t.Fatalf("error recording request: %v", err)
+		}
+		if err := impersonationService.CompleteRequest(ctx, entry.AuditId, http.StatusOK); err != nil {
+			t.Fatalf("error completing request: %v", err)
+		}
+
+		entries, err := impersonationService.GetAuditLog(ctx, domain.AuditFilter{ActorId: actor.UserId, UserId: user.UserId, Limit: 1})
+		if err != nil {
+			t.Fatalf("error getting audit log: %v", err)
+		}
+		if len(entries) != 1 || entries[0].AuditId != entry.AuditId || entries[0].Status != http.StatusOK {
+			t.Errorf("expected the newest entry to be the completed request, got %+v", entries)
+		}
+	})
+}
@@ -0,0 +1,406 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+)
+
+const (
+	rsaKeySize = 2048
+	// keyRingRefreshInterval is how often keys created by other instances are
+	// picked up. Tokens with an unknown kid trigger an earlier reload, but no
+	// more often than keyRingMinReload.
+	keyRingRefreshInterval = time.Minute
+	keyRingMinReload       = 5 * time.Second
+)
+
+// ringKey is a signing key with its keys parsed.
+type ringKey struct {
+	domain.SigningKey
+	method  jwt.SigningMethod
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+// keyRingService signs tokens with the newest active key of the configured
+// algorithm and verifies them with any key that has not expired. Keys are
+// rotated on a schedule: the next key is published in the JWKS an overlap
+// period before it starts signing, and a retired key stays published for the
+// same overlap so tokens it signed remain valid until they expire.
+//
+// Tokens without a kid are HS256 tokens signed with the shared secret. They
+// are issued when the configured algorithm is HS256, and otherwise only
+// accepted when acceptHS256 is set, since anyone holding the secret could
+// forge them. Refresh tokens do not depend on the algorithm, so after a
+// switch clients only need to refresh their access tokens.
+type keyRingService struct {
+	repo          ports.SigningKeyRepository
+	logger        ports.LoggerService
+	algorithm     string
+	acceptHS256   bool
+	secret        []byte
+	encryptionKey []byte
+	interval      time.Duration
+	overlap       time.Duration
+
+	mu       sync.RWMutex
+	keys     []ringKey
+	loadedAt time.Time
+}
+
+func NewKeyRingService(repo ports.SigningKeyRepository, logger ports.LoggerService, algorithm string, acceptHS256 bool, secret []byte, interval, overlap time.Duration) *keyRingService {
+	service := keyRingService{
+		repo:          repo,
+		logger:        logger,
+		algorithm:     algorithm,
+		acceptHS256:   acceptHS256 || algorithm == domain.SigningAlgorithmHS256,
+		secret:        secret,
+		encryptionKey: deriveKey(secret, "signing_key"),
+		interval:      interval,
+		overlap:       overlap,
+	}
+	return &service
+}
+
+// SignToken signs claims with the current key, naming it in the kid header.
+func (svc *keyRingService) SignToken(ctx context.Context, claims map[string]interface{}) (string, error) {
+	if svc.algorithm == domain.SigningAlgorithmHS256 {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims(claims)).SignedString(svc.secret)
+	}
+
+	key, err := svc.signingKey(ctx)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("sign token: %v", err))
+		return "", fmt.Errorf("sign token: %w", err)
+	}
+	token := jwt.NewWithClaims(key.method, jwt.MapClaims(claims))
+	token.Header["kid"] = key.KeyId
+	return token.SignedString(key.private)
+}
+
+// ParseToken verifies a token's signature and expiry and returns its claims.
+// The algorithm in the token header must be the one its key was created for.
+func (svc *keyRingService) ParseToken(ctx context.Context, tokenString string) (map[string]interface{}, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		keyId, _ := token.Header["kid"].(string)
+		if keyId == "" {
+			if !svc.acceptHS256 {
+				return nil, errors.New("token has no kid")
+			}
+			if token.Method != jwt.SigningMethodHS256 {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return svc.secret, nil
+		}
+
+		key, err := svc.verificationKey(ctx, keyId)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method != key.method {
+			return nil, fmt.Errorf("unexpected signing method %v for key %s", token.Header["alg"], keyId)
+		}
+		return key.public, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("invalid token: %v", err)
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims")
+	}
+	return claims, nil
+}
+
+// RotateKeys makes sure a key of the configured algorithm is active and, once
+// the active key is within the overlap period of retiring, publishes its
+// successor. Expired keys are deleted. It is safe to call at any time.
+func (svc *keyRingService) RotateKeys(ctx context.Context) error {
+	if svc.algorithm == domain.SigningAlgorithmHS256 {
+		return nil
+	}
+
+	now := time.Now()
+	keys, err := svc.repo.GetSigningKeys(ctx, now)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("rotate keys: failed to get signing keys: %v", err))
+		return fmt.Errorf("rotate keys: failed to get signing keys: %w", err)
+	}
+
+	var latest *domain.SigningKey
+	for i := range keys {
+		if keys[i].Algorithm == svc.algorithm && (latest == nil || !keys[i].ActivatesAt.Before(latest.ActivatesAt)) {
+			latest = &keys[i]
+		}
+	}
+	if latest == nil || latest.RetiresAt.Sub(now) < svc.overlap {
+		activatesAt := now
+		if latest != nil && latest.RetiresAt.After(now) {
+			activatesAt = latest.RetiresAt
+		}
+		key, err := svc.newSigningKey(activatesAt)
+		if err != nil {
+			svc.logger.Error(fmt.Sprintf("rotate keys: failed to generate key: %v", err))
+			return fmt.Errorf("rotate keys: failed to generate key: %w", err)
+		}
+		if err := svc.repo.CreateSigningKey(ctx, *key); err != nil {
+			svc.logger.Error(fmt.Sprintf("rotate keys: failed to store key: %v", err))
+			return fmt.Errorf("rotate keys: failed to store key: %w", err)
+		}
+		svc.logger.Info(fmt.Sprintf("rotate keys: created %s key %s, signing from %s", key.Algorithm, key.KeyId, key.ActivatesAt.Format(time.RFC3339)))
+	}
+
+	if err := svc.repo.DeleteExpiredSigningKeys(ctx, now); err != nil {
+		svc.logger.Error(fmt.Sprintf("rotate keys: failed to delete expired keys: %v", err))
+		return fmt.Errorf("rotate keys: failed to delete expired keys: %w", err)
+	}
+	return svc.reload(ctx)
+}
+
+// JWKS returns the public keys that tokens may currently be signed with,
+// including keys that have not started signing yet.
+func (svc *keyRingService) JWKS(ctx context.Context) (*domain.JSONWebKeySet, error) {
+	keys, err := svc.currentKeys(ctx)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("jwks: %v", err))
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+
+	set := &domain.JSONWebKeySet{Keys: []domain.JSONWebKey{}}
+	now := time.Now()
+	for _, key := range keys {
+		if !now.Before(key.ExpiresAt) {
+			continue
+		}
+		jwk := domain.JSONWebKey{
+			Use:       "sig",
+			KeyId:     key.KeyId,
+			Algorithm: key.Algorithm,
+		}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
+
+// signingKey returns the newest key of the configured algorithm that is
+// active now. If there is none, because rotation has not run in time, it
+// rotates first.
+func (svc *keyRingService) signingKey(ctx context.Context) (*ringKey, error) {
+	keys, err := svc.currentKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if key := svc.activeKey(keys, time.Now()); key != nil {
+		return key, nil
+	}
+
+	if err := svc.RotateKeys(ctx); err != nil {
+		return nil, err
+	}
+	svc.mu.RLock()
+	keys = svc.keys
+	svc.mu.RUnlock()
+	if key := svc.activeKey(keys, time.Now()); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("no active %s signing key", svc.algorithm)
+}
+
+func (svc *keyRingService) activeKey(keys []ringKey, now time.Time) *ringKey {
+	var active *ringKey
+	for i := range keys {
+		key := &keys[i]
+		if key.Algorithm != svc.algorithm || now.Before(key.ActivatesAt) || !now.Before(key.RetiresAt) {
+			continue
+		}
+		if active == nil || !key.ActivatesAt.Before(active.ActivatesAt) {
+			active = key
+		}
+	}
+	return active
+}
+
+func (svc *keyRingService) verificationKey(ctx context.Context, keyId string) (*ringKey, error) {
+	keys, err := svc.currentKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if key := findKey(keys, keyId); key != nil {
+		return key, nil
+	}
+
+	// The key may have just been created by another instance.
+	svc.mu.RLock()
+	stale := time.Since(svc.loadedAt) > keyRingMinReload
+	svc.mu.RUnlock()
+	if stale {
+		if err := svc.reload(ctx); err != nil {
+			return nil, err
+		}
+		svc.mu.RLock()
+		keys = svc.keys
+		svc.mu.RUnlock()
+		if key := findKey(keys, keyId); key != nil {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %s", keyId)
+}
+
+func findKey(keys []ringKey, keyId string) *ringKey {
+	now := time.Now()
+	for i := range keys {
+		if keys[i].KeyId == keyId && now.Before(keys[i].ExpiresAt) {
+			return &keys[i]
+		}
+	}
+	return nil
+}
+
+// currentKeys returns the cached keys, reloading them when they are stale.
+func (svc *keyRingService) currentKeys(ctx context.Context) ([]ringKey, error) {
+	svc.mu.RLock()
+	keys, loadedAt := svc.keys, svc.loadedAt
+	svc.mu.RUnlock()
+	if time.Since(loadedAt) < keyRingRefreshInterval {
+		return keys, nil
+	}
+
+	if err := svc.reload(ctx); err != nil {
+		return nil, err
+	}
+	svc.mu.RLock()
+	defer svc.mu.RUnlock()
+	return svc.keys, nil
+}
+
+func (svc *keyRingService) reload(ctx context.Context) error {
+	stored, err := svc.repo.GetSigningKeys(ctx, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to get signing keys: %w", err)
+	}
+
+	keys := make([]ringKey, 0, len(stored))
+	for _, key := range stored {
+		parsed, err := svc.parseKey(key)
+		if err != nil {
+			svc.logger.Error(fmt.Sprintf("skipping signing key %s: %v", key.KeyId, err))
+			continue
+		}
+		keys = append(keys, *parsed)
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.keys = keys
+	svc.loadedAt = time.Now()
+	return nil
+}
+
+func (svc *keyRingService) newSigningKey(activatesAt time.Time) (*domain.SigningKey, error) {
+	var private crypto.PrivateKey
+	var public crypto.PublicKey
+	switch svc.algorithm {
+	case domain.SigningAlgorithmRS256:
+		key, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
+		if err != nil {
+			return nil, err
+		}
+		private, public = key, &key.PublicKey
+	case domain.SigningAlgorithmEdDSA:
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		private, public = privateKey, publicKey
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", svc.algorithm)
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := sealSecret(svc.encryptionKey, string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})))
+	if err != nil {
+		return nil, err
+	}
+
+	retiresAt := activatesAt.Add(svc.interval)
+	return &domain.SigningKey{
+		KeyId:               uuid.New().String(),
+		Algorithm:           svc.algorithm,
+		EncryptedPrivateKey: encrypted,
+		PublicKey:           string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+		ActivatesAt:         activatesAt,
+		RetiresAt:           retiresAt,
+		ExpiresAt:           retiresAt.Add(svc.overlap),
+		CreatedAt:           time.Now(),
+	}, nil
+}
+
+func (svc *keyRingService) parseKey(key domain.SigningKey) (*ringKey, error) {
+	var method jwt.SigningMethod
+	switch key.Algorithm {
+	case domain.SigningAlgorithmRS256:
+		method = jwt.SigningMethodRS256
+	case domain.SigningAlgorithmEdDSA:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", key.Algorithm)
+	}
+
+	privatePEM, err := openSecret(svc.encryptionKey, key.EncryptedPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+	}
+	private, err := parsePEM(privatePEM, x509.ParsePKCS8PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	public, err := parsePEM(key.PublicKey, x509.ParsePKIXPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	return &ringKey{SigningKey: key, method: method, private: private, public: public}, nil
+}
+
+func parsePEM(data string, parse func(der []byte) (interface{}, error)) (interface{}, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	return parse(block.Bytes)
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/logger"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/golang-jwt/jwt"
+)
+
+type memorySigningKeys map[string]*domain.SigningKey
+
+func (m memorySigningKeys) CreateSigningKey(ctx context.Context, key domain.SigningKey) error {
+	m[key.KeyId] = &key
+	return nil
+}
+
+func (m memorySigningKeys) GetSigningKeys(ctx context.Context, at time.Time) ([]domain.SigningKey, error) {
+	keys := []domain.SigningKey{}
+	for _, key := range m {
+		if key.ExpiresAt.After(at) {
+			keys = append(keys, *key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ActivatesAt.Before(keys[j].ActivatesAt)
+	})
+	return keys, nil
+}
+
+func (m memorySigningKeys) DeleteExpiredSigningKeys(ctx context.Context, at time.Time) error {
+	for id, key := range m {
+		if !key.ExpiresAt.After(at) {
+			delete(m, id)
+		}
+	}
+	return nil
+}
+
+func TestKeyRingService(t *testing.T) {
+	logger, err := logger.NewDefaultLogger()
+	if err != nil {
+		panic(err)
+	}
+	ctx := context.Background()
+	secret := []byte("testsecret")
+	claims := func() map[string]interface{} {
+		return map[string]interface{}{"sub": "user", "exp": time.Now().Add(time.Minute).Unix()}
+	}
+
+	for _, algorithm := range []string{domain.SigningAlgorithmRS256, domain.SigningAlgorithmEdDSA} {
+		t.Run("Testing SignToken and ParseToken with "+algorithm, func(t *testing.T) {
+			keyRing := NewKeyRingService(memorySigningKeys{}, logger, algorithm, false, secret, 2*time.Hour, time.Hour)
+			if err := keyRing.RotateKeys(ctx); err != nil {
+				t.Fatalf("error rotating keys: %v", err)
+			}
+
+			token, err := keyRing.SignToken(ctx, claims())
+			if err != nil {
+				t.Fatalf("error signing token: %v", err)
+			}
+			parsed, err := keyRing.ParseToken(ctx, token)
+			if err != nil || parsed["sub"] != "user" {
+				t.Errorf("expected token for user, got %v: %v", parsed, err)
+			}
+
+			jwks, err := keyRing.JWKS(ctx)
+			if err != nil {
+				t.Fatalf("error getting jwks: %v", err)
+			}
+			if len(jwks.Keys) != 1 || jwks.Keys[0].Algorithm != algorithm || jwks.Keys[0].Use != "sig" {
+				t.Errorf("expected one %s signing key, got %+v", algorithm, jwks.Keys)
+			}
+		})
+	}
+
+	t.Run("Testing RotateKeys publishes the next key before it signs", func(t *testing.T) {
+		repo := memorySigningKeys{}
+		keyRing := NewKeyRingService(repo, logger, domain.SigningAlgorithmEdDSA, false, secret, 2*time.Hour, time.Hour)
+		if err := keyRing.RotateKeys(ctx); err != nil {
+			t.Fatalf("error rotating keys: %v", err)
+		}
+		if err := keyRing.RotateKeys(ctx); err != nil || len(repo) != 1 {
+			t.Fatalf("expected no new key before the overlap, got %d keys: %v", len(repo), err)
+		}
+		var first *domain.SigningKey
+		for _, key := range repo {
+			first = key
+		}
+		oldToken, _ := keyRing.SignToken(ctx, claims())
+
+		first.RetiresAt = time.Now().Add(30 * time.Minute)
+		first.ExpiresAt = first.RetiresAt.Add(time.Hour)
+		if err := keyRing.RotateKeys(ctx); err != nil || len(repo) != 2 {
+			t.Fatalf("expected the next key to be created, got %d keys: %v", len(repo), err)
+		}
+		if jwks, _ := keyRing.JWKS(ctx); len(jwks.Keys) != 2 {
+			t.Errorf("expected both keys to be published, got %d", len(jwks.Keys))
+		}
+		token, _ := keyRing.SignToken(ctx, claims())
+		if kid := tokenKeyId(token); kid != first.KeyId {
+			t.Errorf("expected the current key to keep signing, got %s", kid)
+		}
+
+		// Move the handover into the past.
+		first.RetiresAt = time.Now().Add(-time.Minute)
+		for _, key := range repo {
+			if key.KeyId != first.KeyId {
+				key.ActivatesAt = first.RetiresAt
+			}
+		}
+		if err := keyRing.reload(ctx); err != nil {
+			t.Fatalf("error reloading keys: %v", err)
+		}
+		token, _ = keyRing.SignToken(ctx, claims())
+		if kid := tokenKeyId(token); kid == first.KeyId {
+			t.Errorf("expected the next key to sign after the handover")
+		}
+		if _, err := keyRing.ParseToken(ctx, oldToken); err != nil {
+			t.Errorf("expected tokens from the retired key to stay valid, got %v", err)
+		}
+	})
+
+	t.Run("Testing ParseToken rejects forged tokens", func(t *testing.T) {
+		keyRing := NewKeyRingService(memorySigningKeys{}, logger, domain.SigningAlgorithmRS256, false, secret, 2*time.Hour, time.Hour)
+		if err := keyRing.RotateKeys(ctx); err != nil {
+			t.Fatalf("error rotating keys: %v", err)
+		}
+		token, _ := keyRing.SignToken(ctx, claims())
+		jwks, _ := keyRing.JWKS(ctx)
+
+		legacy, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims(claims())).SignedString(secret)
+		if _, err := keyRing.ParseToken(ctx, legacy); err == nil {
+			t.Error("expected HS256 tokens without a kid to be rejected once the algorithm is switched")
+		}
+
+		confused := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims(claims()))
+		confused.Header["kid"] = jwks.Keys[0].KeyId
+		forged, _ := confused.SignedString([]byte(jwks.Keys[0].N))
+		if _, err := keyRing.ParseToken(ctx, forged); err == nil {
+			t.Error("expected an HS256 token naming an RS256 key to be rejected")
+		}
+
+		other := NewKeyRingService(memorySigningKeys{}, logger, domain.SigningAlgorithmRS256, false, secret, 2*time.Hour, time.Hour)
+		other.RotateKeys(ctx)
+		foreign, _ := other.SignToken(ctx, claims())
+		if _, err := keyRing.ParseToken(ctx, foreign); err == nil {
+			t.Error("expected a token signed with an unknown key to be rejected")
+		}
+		if _, err := keyRing.ParseToken(ctx, token); err != nil {
+			t.Errorf("expected own token to be accepted, got %v", err)
+		}
+	})
+
+	t.Run("Testing HS256 tokens without a kid during a switch", func(t *testing.T) {
+		legacy, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims(claims())).SignedString(secret)
+
+		hs256 := NewKeyRingService(memorySigningKeys{}, logger, domain.SigningAlgorithmHS256, false, secret, 2*time.Hour, time.Hour)
+		if _, err := hs256.ParseToken(ctx, legacy); err != nil {
+			t.Errorf("expected HS256 tokens to be accepted while the algorithm is HS256, got %v", err)
+		}
+
+		switching := NewKeyRingService(memorySigningKeys{}, logger, domain.SigningAlgorithmRS256, true, secret, 2*time.Hour, time.Hour)
+		if err := switching.RotateKeys(ctx); err != nil {
+			t.Fatalf("error rotating keys: %v", err)
+		}
+		if _, err := switching.ParseToken(ctx, legacy); err != nil {
+			t.Errorf("expected HS256 tokens to be accepted while the switch is allowed, got %v", err)
+		}
+		unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims(claims())).SignedString(jwt.UnsafeAllowNoneSignatureType)
+		if _, err := switching.ParseToken(ctx, unsigned); err == nil {
+			t.Error("expected unsigned tokens without a kid to be rejected")
+		}
+	})
+}
+
+func tokenKeyId(token string) string {
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		return ""
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
+)
+
+type loginThrottleService struct {
+	repo   ports.LoginAttemptRepository
+	rules  domain.LoginThrottleRules
+	logger ports.LoggerService
+}
+
+func NewLoginThrottleService(repo ports.LoginAttemptRepository, rules domain.LoginThrottleRules, logger ports.LoggerService) *loginThrottleService {
+	service := loginThrottleService{
+		repo:   repo,
+		rules:  rules,
+		logger: logger,
+	}
+	return &service
+}
+
+// CheckLogin rejects the attempt while the account or the client IP address is
+// backing off or locked out. Accounts are keyed by the submitted email whether
+// or not it exists, so the response does not reveal which emails are registered.
+func (svc loginThrottleService) CheckLogin(ctx context.Context, email, ipAddress string) error {
+	attempts, err := svc.repo.GetLoginAttempts(ctx, loginAttemptKeys(email, ipAddress))
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("check login: failed to get login attempts: %v", err))
+		return fmt.Errorf("check login: failed to get login attempts: %w", err)
+	}
+
+	now := time.Now()
+	var retryAfter time.Duration
+	for _, attempt := range attempts {
+		if attempt.BlockedUntil != nil && attempt.BlockedUntil.After(now) {
+			if wait := attempt.BlockedUntil.Sub(now); wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+	if retryAfter > 0 {
+		return domain.ErrLoginThrottled.WithRetryAfter(retryAfter)
+	}
+	return nil
+}
+
+// RecordLoginFailure counts a failed attempt against both the account and the
+// client IP address and blocks each of them for their next backoff period.
+func (svc loginThrottleService) RecordLoginFailure(ctx context.Context, email, ipAddress string) error {
+	now := time.Now()
+	limits := map[string]int{accountAttemptKey(email): svc.rules.MaxAccountFailures}
+	if ipAddress != "" {
+		limits[ipAttemptKey(ipAddress)] = svc.rules.MaxIPFailures
+	}
+
+	for key, maxFailures := range limits {
+		attempt, err := svc.repo.RecordLoginFailure(ctx, key, now, now.Add(-svc.rules.FailureWindow))
+		if err != nil {
+			svc.logger.Error(fmt.Sprintf("record login failure: failed to record failure for %s: %v", key, err))
+			return fmt.Errorf("record login failure: failed to record failure: %w", err)
+		}
+
+		blockFor := svc.backoff(attempt.Failures)
+		if attempt.Failures >= maxFailures {
+			blockFor = svc.rules.LockoutDuration
+			svc.logger.Warning(fmt.Sprintf("record login failure: %s locked out after %d failed attempts", key, attempt.Failures))
+		}
+		if err := svc.repo.BlockLogin(ctx, key, now.Add(blockFor)); err != nil {
+			svc.logger.Error(fmt.Sprintf("record login failure: failed to block %s: %v", key, err))
+			return fmt.Errorf("record login failure: failed to block login: %w", err)
+		}
+	}
+	return nil
+}
+
+// RecordLoginSuccess clears the account's failed attempts. The IP address keeps
+// its count so that one valid account cannot be used to reset it.
+func (svc loginThrottleService) RecordLoginSuccess(ctx context.Context, email, ipAddress string) error {
+	return svc.Unlock(ctx, email)
+}
+
+// Unlock clears the failed attempts and any lockout of the account.
+func (svc loginThrottleService) Unlock(ctx context.Context, email string) error {
+	if err := svc.repo.ClearLoginAttempts(ctx, accountAttemptKey(email)); err != nil {
+		svc.logger.Error(fmt.Sprintf("unlock: failed to clear login attempts: %v", err))
+		return fmt.Errorf("unlock: failed to clear login attempts: %w", err)
+	}
+	return nil
+}
+
+// backoff doubles the delay with every failure, starting at BackoffBase.
+func (svc loginThrottleService) backoff(failures int) time.Duration {
+	delay := svc.rules.BackoffBase
+	for i := 1; i < failures && delay < svc.rules.BackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > svc.rules.BackoffMax {
+		delay = svc.rules.BackoffMax
+	}
+	return delay
+}
+
+func loginAttemptKeys(email, ipAddress string) []string {
+	keys := []string{accountAttemptKey(email)}
+	if ipAddress != "" {
+		keys = append(keys, ipAttemptKey(ipAddress))
+	}
+	return keys
+}
+
+func accountAttemptKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipAttemptKey(ipAddress string) string {
+	return "ip:" + ipAddress
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/logger"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+)
+
+type memoryLoginAttempts map[string]*domain.LoginAttempt
+
+func (m memoryLoginAttempts) GetLoginAttempts(ctx context.Context, keys []string) ([]*domain.LoginAttempt, error) {
+	attempts := []*domain.LoginAttempt{}
+	for _, key := range keys {
+		if attempt, ok := m[key]; ok {
+			attempts = append(attempts, attempt)
+		}
+	}
+	return attempts, nil
+}
+
+func (m memoryLoginAttempts) RecordLoginFailure(ctx context.Context, key string, failedAt, windowStart time.Time) (*domain.LoginAttempt, error) {
+	attempt, ok := m[key]
+	if !ok {
+		attempt = &domain.LoginAttempt{Key: key}
+		m[key] = attempt
+	}
+	if attempt.LastFailedAt.Before(windowStart) {
+		attempt.Failures = 0
+	}
+	attempt.Failures++
+	attempt.LastFailedAt = failedAt
+	return attempt, nil
+}
+
+func (m memoryLoginAttempts) BlockLogin(ctx context.Context, key string, until time.Time) error {
+	attempt, ok := m[key]
+	if !ok {
+		return domain.NewError(domain.ErrNotFound, "login_attempt_not_found", "login attempt not found")
+	}
+	attempt.BlockedUntil = &until
+	return nil
+}
+
+func (m memoryLoginAttempts) ClearLoginAttempts(ctx context.Context, key string) error {
+	delete(m, key)
+	return nil
+}
+
+func TestLoginThrottleService(t *testing.T) {
+	logger, err := logger.NewDefaultLogger()
+	if err != nil {
+		panic(err)
+	}
+	ctx := context.Background()
+	rules := domain.LoginThrottleRules{
+		MaxAccountFailures: 3,
+		MaxIPFailures:      5,
+		FailureWindow:      15 * time.Minute,
+		BackoffBase:        time.Second,
+		BackoffMax:         4 * time.Second,
+		LockoutDuration:    15 * time.Minute,
+	}
+
+	t.Run("Testing backoff doubles up to the maximum", func(t *testing.T) {
+		throttle := NewLoginThrottleService(memoryLoginAttempts{}, rules, logger)
+		expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second}
+		for i, want := range expected {
+			if got := throttle.backoff(i + 1); got != want {
+				t.Errorf("backoff(%d) = %v, want %v", i+1, got, want)
+			}
+		}
+	})
+
+	t.Run("Testing a failed login blocks the next attempt", func(t *testing.T) {
+		throttle := NewLoginThrottleService(memoryLoginAttempts{}, rules, logger)
+		if err := throttle.CheckLogin(ctx, "john.doe@example.com", "10.0.0.1"); err != nil {
+			t.Fatalf("expected first attempt to be allowed, got %v", err)
+		}
+		if err := throttle.RecordLoginFailure(ctx, "john.doe@example.com", "10.0.0.1"); err != nil {
+			t.Fatalf("error recording failure: %v", err)
+		}
+
+		err := throttle.CheckLogin(ctx, "John.Doe@example.com ", "10.0.0.2")
+		var domainErr *domain.Error
+		if !errors.Is(err, domain.ErrLoginThrottled) || !errors.As(err, &domainErr) {
+			t.Fatalf("expected ErrLoginThrottled, got %v", err)
+		}
+		if domainErr.RetryAfter <= 0 || domainErr.RetryAfter > time.Second {
+			t.Errorf("expected retry after at most a second, got %v", domainErr.RetryAfter)
+		}
+	})
+
+	t.Run("Testing the account is locked out after too many failures", func(t *testing.T) {
+		throttle := NewLoginThrottleService(memoryLoginAttempts{}, rules, logger)
+		for i := 0; i < rules.MaxAccountFailures; i++ {
+			if err := throttle.RecordLoginFailure(ctx, "john.doe@example.com", ""); err != nil {
+				t.Fatalf("error recording failure: %v", err)
+			}
+		}
+
+		var domainErr *domain.Error
+		err := throttle.CheckLogin(ctx, "john.doe@example.com", "")
+		if !errors.As(err, &domainErr) || domainErr.RetryAfter <= rules.BackoffMax {
+			t.Fatalf("expected lockout, got %v", err)
+		}
+
+		if err := throttle.Unlock(ctx, "john.doe@example.com"); err != nil {
+			t.Fatalf("error unlocking: %v", err)
+		}
+		if err := throttle.CheckLogin(ctx, "john.doe@example.com", ""); err != nil {
+			t.Errorf("expected unlocked account to be allowed, got %v", err)
+		}
+	})
+
+	t.Run("Testing a successful login keeps the IP address count", func(t *testing.T) {
+		attempts := memoryLoginAttempts{}
+		throttle := NewLoginThrottleService(attempts, rules, logger)
+		if err := throttle.RecordLoginFailure(ctx, "john.doe@example.com", "10.0.0.1"); err != nil {
+			t.Fatalf("error recording failure: %v", err)
+		}
+		if err := throttle.RecordLoginSuccess(ctx, "john.doe@example.com", "10.0.0.1"); err != nil {
+			t.Fatalf("error recording success: %v", err)
+		}
+
+		if _, ok := attempts[accountAttemptKey("john.doe@example.com")]; ok {
+			t.Errorf("expected account attempts to be cleared")
+		}
+		if attempt, ok := attempts[ipAttemptKey("10.0.0.1")]; !ok || attempt.Failures != 1 {
+			t.Errorf("expected IP address attempts to be kept, got %+v", attempt)
+		}
+	})
+
+	t.Run("Testing failures outside the window are forgotten", func(t *testing.T) {
+		attempts := memoryLoginAttempts{}
+		throttle := NewLoginThrottleService(attempts, rules, logger)
+		attempts[accountAttemptKey("john.doe@example.com")] = &domain.LoginAttempt{
+			Failures:     rules.MaxAccountFailures - 1,
+			LastFailedAt: time.Now().Add(-time.Hour),
+		}
+		if err := throttle.RecordLoginFailure(ctx, "john.doe@example.com", ""); err != nil {
+			t.Fatalf("error recording failure: %v", err)
+		}
+		if got := attempts[accountAttemptKey("john.doe@example.com")].Failures; got != 1 {
+			t.Errorf("expected failures to restart at 1, got %d", got)
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/AntonyIS/usafi-hub-user-service/config"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/logger"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/migrations"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/repository"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
+)
+
+// errDatabaseUnavailable is why the test database could not be reached, if it
+// could not. Tests that need it are skipped rather than run against no database.
+var errDatabaseUnavailable error
+
+// TestMain brings the test database schema up to date before the service tests run.
+func TestMain(m *testing.M) {
+	logger, err := logger.NewDefaultLogger()
+	if err != nil {
+		panic(err)
+	}
+
+	config, err := config.NewConfig(logger)
+	if err != nil {
+		panic(err)
+	}
+
+	db, err := repository.NewPostgresDB(*config)
+	if err != nil {
+		fmt.Printf("skipping database tests, database unavailable: %v\n", err)
+		errDatabaseUnavailable = err
+		os.Exit(m.Run())
+	}
+
+	migrator, err := migrations.NewMigrator(db, *config, logger)
+	if err != nil {
+		panic(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		panic(err)
+	}
+	db.Close()
+
+	os.Exit(m.Run())
+}
+
+// requireDatabase skips the test when the test database is unavailable.
+func requireDatabase(t *testing.T) {
+	t.Helper()
+	if errDatabaseUnavailable != nil {
+		t.Skipf("database unavailable: %v", errDatabaseUnavailable)
+	}
+}
+
+func newTestPasswordPolicy(config config.Config, logger ports.LoggerService) *passwordPolicy {
+	return NewPasswordPolicy(domain.PasswordRules{
+		MinLength:     config.PASSWORD_MIN_LENGTH,
+		RequireUpper:  config.PASSWORD_REQUIRE_UPPER,
+		RequireLower:  config.PASSWORD_REQUIRE_LOWER,
+		RequireDigit:  config.PASSWORD_REQUIRE_DIGIT,
+		RequireSymbol: config.PASSWORD_REQUIRE_SYMBOL,
+	}, nil, logger)
+}
+
+// newTestLoginThrottle applies the configured limits without backing off, so
+// tests may log in right after a failed attempt.
+func newTestLoginThrottle(repo ports.LoginAttemptRepository, config config.Config, logger ports.LoggerService) *loginThrottleService {
+	return NewLoginThrottleService(repo, domain.LoginThrottleRules{
+		MaxAccountFailures: config.LOGIN_MAX_FAILURES,
+		MaxIPFailures:      config.LOGIN_IP_MAX_FAILURES,
+		FailureWindow:      config.LOGIN_FAILURE_WINDOW,
+		LockoutDuration:    config.LOGIN_LOCKOUT_DURATION,
+	}, logger)
+}
+
+func newTestMFAService(userRepo ports.UserRepository, mfaRepo ports.MFARepository, tokenService ports.TokenService, loginThrottle ports.LoginThrottleService, config config.Config, logger ports.LoggerService) *mfaService {
+	return NewMFAService(userRepo, mfaRepo, tokenService, loginThrottle, logger, []byte(config.SECRET_KEY), config.MFA_ISSUER, config.MFA_CHALLENGE_TTL)
+}
+
+func newTestKeyRing(repo ports.SigningKeyRepository, config config.Config, logger ports.LoggerService) *keyRingService {
+	return NewKeyRingService(repo, logger, config.JWT_SIGNING_ALGORITHM, config.JWT_ACCEPT_LEGACY_HS256, []byte(config.SECRET_KEY), config.KEY_ROTATION_INTERVAL, config.KEY_ROTATION_OVERLAP)
+}
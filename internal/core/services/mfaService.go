@@ -0,0 +1,334 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	mfaChallengePurpose = "mfa_challenge"
+	recoveryCodeCount   = 10
+	recoveryCodeLength  = 10
+)
+
+type mfaService struct {
+	userRepo      ports.UserRepository
+	mfaRepo       ports.MFARepository
+	tokenService  ports.TokenService
+	loginThrottle ports.LoginThrottleService
+	logger        ports.LoggerService
+	issuer        string
+	challengeTTL  time.Duration
+	challengeKey  []byte
+	encryptionKey []byte
+	recoveryKey   []byte
+}
+
+// NewMFAService creates a service for TOTP two-factor authentication. TOTP
+// secrets are encrypted, recovery codes hashed and login challenges signed
+// with keys derived from secret.
+func NewMFAService(userRepo ports.UserRepository, mfaRepo ports.MFARepository, tokenService ports.TokenService, loginThrottle ports.LoginThrottleService, logger ports.LoggerService, secret []byte, issuer string, challengeTTL time.Duration) *mfaService {
+	service := mfaService{
+		userRepo:      userRepo,
+		mfaRepo:       mfaRepo,
+		tokenService:  tokenService,
+		loginThrottle: loginThrottle,
+		logger:        logger,
+		issuer:        issuer,
+		challengeTTL:  challengeTTL,
+		challengeKey:  deriveKey(secret, mfaChallengePurpose),
+		encryptionKey: deriveKey(secret, "totp_secret"),
+		recoveryKey:   deriveKey(secret, "recovery_code"),
+	}
+	return &service
+}
+
+// EnrollTOTP generates a new TOTP secret for the user. The secret is not used
+// for logins until the user confirms it with a code from their app.
+func (svc mfaService) EnrollTOTP(ctx context.Context, userId string) (*domain.TOTPEnrollment, error) {
+	user, err := svc.userRepo.GetUserById(ctx, userId)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("enroll totp: failed to get user: %v", err))
+		return nil, fmt.Errorf("enroll totp: failed to get user: %w", err)
+	}
+	if user.MFAEnabled() {
+		return nil, domain.ErrMFAAlreadyEnabled
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("enroll totp: failed to generate secret: %v", err))
+		return nil, fmt.Errorf("enroll totp: failed to generate secret: %w", err)
+	}
+	encrypted, err := sealSecret(svc.encryptionKey, secret)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("enroll totp: failed to encrypt secret: %v", err))
+		return nil, fmt.Errorf("enroll totp: failed to encrypt secret: %w", err)
+	}
+	err = svc.mfaRepo.SaveTOTPSecret(ctx, domain.TOTPSecret{
+		UserId:          user.UserId,
+		EncryptedSecret: encrypted,
+		CreatedAt:       time.Now(),
+	})
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("enroll totp: failed to store secret: %v", err))
+		return nil, fmt.Errorf("enroll totp: failed to store secret: %w", err)
+	}
+
+	return &domain.TOTPEnrollment{
+		Secret: secret,
+		URI:    totpURI(svc.issuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables two-factor authentication once the user proves their app
+// generates the right codes. It returns the user's recovery codes, which are
+// only ever shown this once. Wrong codes count towards the login throttle.
+func (svc mfaService) ConfirmTOTP(ctx context.Context, userId, code string, device domain.Device) ([]string, error) {
+	user, err := svc.userRepo.GetUserById(ctx, userId)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("confirm totp: failed to get user: %v", err))
+		return nil, fmt.Errorf("confirm totp: failed to get user: %w", err)
+	}
+	if user.MFAEnabled() {
+		return nil, domain.ErrMFAAlreadyEnabled
+	}
+
+	if err := svc.loginThrottle.CheckLogin(ctx, user.Email, device.IPAddress); err != nil {
+		svc.logger.Warning(fmt.Sprintf("confirm totp: throttled attempt for %s from %s", user.Email, device.IPAddress))
+		return nil, err
+	}
+	ok, err := svc.checkTOTP(ctx, user.UserId, code)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, domain.ErrMFANotEnrolled
+	}
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("confirm totp: %v", err))
+		return nil, fmt.Errorf("confirm totp: %w", err)
+	}
+	if !ok {
+		svc.logger.Warning(fmt.Sprintf("confirm totp: wrong code for %s from %s", user.Email, device.IPAddress))
+		if err := svc.loginThrottle.RecordLoginFailure(ctx, user.Email, device.IPAddress); err != nil {
+			return nil, err
+		}
+		return nil, domain.ErrInvalidMFACode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		codes[i], err = generateRecoveryCode()
+		if err != nil {
+			svc.logger.Error(fmt.Sprintf("confirm totp: failed to generate recovery code: %v", err))
+			return nil, fmt.Errorf("confirm totp: failed to generate recovery code: %w", err)
+		}
+		hashes[i] = svc.hashRecoveryCode(user.UserId, codes[i])
+	}
+	if err := svc.mfaRepo.EnableMFA(ctx, user.UserId, hashes, time.Now()); err != nil {
+		svc.logger.Error(fmt.Sprintf("confirm totp: failed to enable mfa: %v", err))
+		return nil, fmt.Errorf("confirm totp: failed to enable mfa: %w", err)
+	}
+	return codes, nil
+}
+
+// DisableTOTP turns two-factor authentication off. It takes a current code or
+// an unused recovery code, so that a stolen access token alone cannot do it,
+// and wrong codes count towards the login throttle so that they cannot be
+// guessed either.
+func (svc mfaService) DisableTOTP(ctx context.Context, userId, code string, device domain.Device) error {
+	user, err := svc.userRepo.GetUserById(ctx, userId)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("disable totp: failed to get user: %v", err))
+		return fmt.Errorf("disable totp: failed to get user: %w", err)
+	}
+	if !user.MFAEnabled() {
+		return domain.ErrMFANotEnabled
+	}
+
+	if err := svc.loginThrottle.CheckLogin(ctx, user.Email, device.IPAddress); err != nil {
+		svc.logger.Warning(fmt.Sprintf("disable totp: throttled attempt for %s from %s", user.Email, device.IPAddress))
+		return err
+	}
+	ok, err := svc.checkSecondFactor(ctx, user.UserId, code)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("disable totp: %v", err))
+		return fmt.Errorf("disable totp: %w", err)
+	}
+	if !ok {
+		svc.logger.Warning(fmt.Sprintf("disable totp: wrong code for %s from %s", user.Email, device.IPAddress))
+		if err := svc.loginThrottle.RecordLoginFailure(ctx, user.Email, device.IPAddress); err != nil {
+			return err
+		}
+		return domain.ErrInvalidMFACode
+	}
+	if err := svc.mfaRepo.DisableMFA(ctx, user.UserId); err != nil {
+		svc.logger.Error(fmt.Sprintf("disable totp: failed to disable mfa: %v", err))
+		return fmt.Errorf("disable totp: failed to disable mfa: %w", err)
+	}
+	return nil
+}
+
+// BeginLogin is called once a user has passed their first factor. Users
+// without two-factor authentication get their tokens; the others get a
+// short-lived challenge token for CompleteLogin. The account's failed login
+// attempts are only cleared once tokens are issued, so that logging in again
+// does not reset the count of wrong second-factor codes.
+func (svc mfaService) BeginLogin(ctx context.Context, user domain.User, device domain.Device) (*domain.LoginResult, error) {
+	if !user.MFAEnabled() {
+		if err := svc.loginThrottle.RecordLoginSuccess(ctx, user.Email, device.IPAddress); err != nil {
+			return nil, err
+		}
+		tokens, err := svc.tokenService.IssueTokens(ctx, user, domain.Authentication{Device: device})
+		if err != nil {
+			return nil, err
+		}
+		return &domain.LoginResult{TokenPair: tokens}, nil
+	}
+
+	now := time.Now()
+	challenge, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"purpose": mfaChallengePurpose,
+		"sub":     user.UserId,
+		"iat":     now.Unix(),
+		"exp":     now.Add(svc.challengeTTL).Unix(),
+	}).SignedString(svc.challengeKey)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("begin login: failed to sign mfa challenge: %v", err))
+		return nil, fmt.Errorf("begin login: failed to sign mfa challenge: %w", err)
+	}
+	return &domain.LoginResult{MFARequired: true, MFAToken: challenge}, nil
+}
+
+// CompleteLogin exchanges a challenge token from BeginLogin and a TOTP or
+// recovery code for a token pair. Wrong codes count towards the login
+// throttle of the user's email and of the device's IP address.
+func (svc mfaService) CompleteLogin(ctx context.Context, mfaToken, code string, device domain.Device) (*domain.TokenPair, error) {
+	userId, err := svc.parseChallenge(mfaToken)
+	if err != nil {
+		svc.logger.Warning(fmt.Sprintf("complete login: %v", err))
+		return nil, domain.ErrInvalidMFAChallenge
+	}
+	user, err := svc.userRepo.GetUserById(ctx, userId)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, domain.ErrInvalidMFAChallenge
+	}
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("complete login: failed to get user: %v", err))
+		return nil, fmt.Errorf("complete login: failed to get user: %w", err)
+	}
+	if !user.MFAEnabled() {
+		return nil, domain.ErrInvalidMFAChallenge
+	}
+
+	if err := svc.loginThrottle.CheckLogin(ctx, user.Email, device.IPAddress); err != nil {
+		svc.logger.Warning(fmt.Sprintf("complete login: throttled login for %s from %s", user.Email, device.IPAddress))
+		return nil, err
+	}
+	ok, err := svc.checkSecondFactor(ctx, user.UserId, code)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("complete login: %v", err))
+		return nil, fmt.Errorf("complete login: %w", err)
+	}
+	if !ok {
+		svc.logger.Warning(fmt.Sprintf("complete login: wrong mfa code for %s from %s", user.Email, device.IPAddress))
+		if err := svc.loginThrottle.RecordLoginFailure(ctx, user.Email, device.IPAddress); err != nil {
+			return nil, err
+		}
+		return nil, domain.ErrInvalidMFACode
+	}
+	if err := svc.loginThrottle.RecordLoginSuccess(ctx, user.Email, device.IPAddress); err != nil {
+		return nil, err
+	}
+	return svc.tokenService.IssueTokens(ctx, *user, domain.Authentication{Device: device, MFA: true})
+}
+
+// checkSecondFactor accepts either a TOTP code or an unused recovery code,
+// consuming whichever it was.
+func (svc mfaService) checkSecondFactor(ctx context.Context, userId, code string) (bool, error) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) == totpDigits {
+		return svc.checkTOTP(ctx, userId, code)
+	}
+	return svc.mfaRepo.UseRecoveryCode(ctx, userId, svc.hashRecoveryCode(userId, code), time.Now())
+}
+
+// checkTOTP matches code against the user's TOTP secret. A code is accepted
+// only once, and never after a code from a later time step.
+func (svc mfaService) checkTOTP(ctx context.Context, userId, code string) (bool, error) {
+	stored, err := svc.mfaRepo.GetTOTPSecret(ctx, userId)
+	if err != nil {
+		return false, err
+	}
+	secret, err := openSecret(svc.encryptionKey, stored.EncryptedSecret)
+	if err != nil {
+		return false, fmt.Errorf("failed to decrypt totp secret: %w", err)
+	}
+	step, ok, err := matchTOTP(secret, code, time.Now())
+	if err != nil || !ok {
+		return false, err
+	}
+	return svc.mfaRepo.UseTOTPStep(ctx, userId, step)
+}
+
+func (svc mfaService) hashRecoveryCode(userId, code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	mac := hmac.New(sha256.New, svc.recoveryKey)
+	mac.Write([]byte(userId + "\x00" + normalized))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (svc mfaService) parseChallenge(token string) (string, error) {
+	parsed, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return svc.challengeKey, nil
+	})
+	if err != nil || !parsed.Valid {
+		return "", fmt.Errorf("invalid mfa challenge: %v", err)
+	}
+
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", errors.New("invalid mfa challenge claims")
+	}
+	purpose, _ := claims["purpose"].(string)
+	userId, _ := claims["sub"].(string)
+	if purpose != mfaChallengePurpose || userId == "" {
+		return "", errors.New("mfa challenge is missing required claims")
+	}
+	if _, ok := claims["exp"]; !ok {
+		return "", errors.New("mfa challenge has no expiry")
+	}
+	return userId, nil
+}
+
+// generateRecoveryCode returns a random code such as "k3f9x-q7m2p", avoiding
+// characters that are easily confused when written down.
+func generateRecoveryCode() (string, error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	code := make([]byte, 0, recoveryCodeLength+1)
+	for i := 0; i < recoveryCodeLength; i++ {
+		if i == recoveryCodeLength/2 {
+			code = append(code, '-')
+		}
+		index, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", err
+		}
+		code = append(code, alphabet[index.Int64()])
+	}
+	return string(code), nil
+}
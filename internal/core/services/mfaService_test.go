@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AntonyIS/usafi-hub-user-service/config"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/logger"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/repository"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+)
+
+func TestMFAService(t *testing.T) {
+	requireDatabase(t)
+	logger, err := logger.NewDefaultLogger()
+	if err != nil {
+		panic(err)
+	}
+
+	config, err := config.NewConfig(logger)
+	if err != nil {
+		panic(err)
+	}
+
+	db, _ := repository.NewPostgresDB(*config)
+	factory := repository.NewRepositoryFactory(db, *config)
+	ctx := context.Background()
+	userRepo := factory.UserRepository()
+	tokenRepo := factory.TokenRepository()
+	revocationRepo := factory.RevocationRepository()
+	userRoleRepo := factory.UserRoleRepository()
+
+	tokenService := NewTokenService(tokenRepo, revocationRepo, factory.SessionRepository(), userRepo, userRoleRepo, logger, newTestKeyRing(factory.SigningKeyRepository(), *config, logger), config.ACCESS_TOKEN_TTL, config.REFRESH_TOKEN_TTL)
+	loginThrottle := newTestLoginThrottle(factory.LoginAttemptRepository(), *config, logger)
+	mfaService := newTestMFAService(userRepo, factory.MFARepository(), tokenService, loginThrottle, *config, logger)
+	userService := NewUserService(userRepo, factory.UserRoleRepository(), tokenService, mfaService, newTestPasswordPolicy(*config, logger), loginThrottle, domain.EmailVerificationOptional, logger)
+
+	user, err := userService.CreateUser(ctx, domain.User{
+		Username:     "mfa_doe",
+		PasswordHash: "Mfa_Password1",
+		Email:        "mfa.doe@example.com",
+		FullName:     "Mfa Doe",
+	})
+	if err != nil {
+		t.Fatalf("error adding user: %v", err)
+	}
+	defer userService.DeleteUser(ctx, user.UserId)
+
+	login := domain.LoginRequest{Email: user.Email, Password: "Mfa_Password1"}
+	accountFailures := func() int {
+		attempts, err := factory.LoginAttemptRepository().GetLoginAttempts(ctx, []string{accountAttemptKey(user.Email)})
+		if err != nil || len(attempts) == 0 {
+			return 0
+		}
+		return attempts[0].Failures
+	}
+	var secret string
+	var recoveryCodes []string
+
+	t.Run("Testing EnrollTOTP and ConfirmTOTP", func(t *testing.T) {
+		if _, err := mfaService.ConfirmTOTP(ctx, user.UserId, "123456", domain.Device{}); !errors.Is(err, domain.ErrMFANotEnrolled) {
+			t.Errorf("expected ErrMFANotEnrolled, got %v", err)
+		}
+
+		enrollment, err := mfaService.EnrollTOTP(ctx, user.UserId)
+		if err != nil {
+			t.Fatalf("error enrolling totp: %v", err)
+		}
+		uri, err := url.Parse(enrollment.URI)
+		if err != nil || uri.Scheme != "otpauth" || uri.Query().Get("secret") != enrollment.Secret {
+			t.Errorf("expected an otpauth uri for the secret, got %s: %v", enrollment.URI, err)
+		}
+		secret = enrollment.Secret
+
+		result, err := userService.LoginUser(ctx, login)
+		if err != nil || result.MFARequired || result.TokenPair == nil {
+			t.Fatalf("expected tokens until enrolment is confirmed, got %+v: %v", result, err)
+		}
+
+		code, _ := totpCode(secret, totpStep(time.Now()))
+		recoveryCodes, err = mfaService.ConfirmTOTP(ctx, user.UserId, code, domain.Device{})
+		if err != nil {
+			t.Fatalf("error confirming totp: %v", err)
+		}
+		if len(recoveryCodes) != recoveryCodeCount {
+			t.Errorf("expected %d recovery codes, got %d", recoveryCodeCount, len(recoveryCodes))
+		}
+		if _, err := mfaService.EnrollTOTP(ctx, user.UserId); !errors.Is(err, domain.ErrMFAAlreadyEnabled) {
+			t.Errorf("expected ErrMFAAlreadyEnabled, got %v", err)
+		}
+
+		// The session was started without a second factor, whatever the user has enabled since.
+		refreshed, err := tokenService.RefreshTokens(ctx, result.TokenPair.RefreshToken, "")
+		if err != nil {
+			t.Fatalf("error refreshing tokens: %v", err)
+		}
+		claims, err := tokenService.ValidateAccessToken(ctx, refreshed.AccessToken)
+		if err != nil || claims.MFA {
+			t.Errorf("expected a refreshed token without the mfa claim, got %+v: %v", claims, err)
+		}
+	})
+
+	t.Run("Testing LoginUser returns an MFA challenge", func(t *testing.T) {
+		result, err := userService.LoginUser(ctx, login)
+		if err != nil {
+			t.Fatalf("error logging in: %v", err)
+		}
+		if !result.MFARequired || result.MFAToken == "" || result.TokenPair != nil {
+			t.Fatalf("expected an mfa challenge and no tokens, got %+v", result)
+		}
+
+		if _, err := mfaService.CompleteLogin(ctx, "not-a-challenge", "123456", domain.Device{}); !errors.Is(err, domain.ErrInvalidMFAChallenge) {
+			t.Errorf("expected ErrInvalidMFAChallenge, got %v", err)
+		}
+
+		// The current step's code was used to confirm enrolment and cannot be replayed.
+		used, _ := totpCode(secret, totpStep(time.Now()))
+		if _, err := mfaService.CompleteLogin(ctx, result.MFAToken, used, domain.Device{}); !errors.Is(err, domain.ErrInvalidMFACode) {
+			t.Errorf("expected a used code to be rejected, got %v", err)
+		}
+
+		// Passing the first factor again does not reset the count of wrong codes.
+		if _, err := userService.LoginUser(ctx, login); err != nil {
+			t.Fatalf("error logging in: %v", err)
+		}
+		if failures := accountFailures(); failures != 1 {
+			t.Errorf("expected the wrong code to still count, got %d failures", failures)
+		}
+
+		next, _ := totpCode(secret, totpStep(time.Now())+1)
+		tokens, err := mfaService.CompleteLogin(ctx, result.MFAToken, next, domain.Device{})
+		if err != nil {
+			t.Fatalf("error completing login: %v", err)
+		}
+		claims, err := tokenService.ValidateAccessToken(ctx, tokens.AccessToken)
+		if err != nil || !claims.MFA {
+			t.Errorf("expected an access token with the mfa claim, got %+v: %v", claims, err)
+		}
+
+		refreshed, err := tokenService.RefreshTokens(ctx, tokens.RefreshToken, "")
+		if err != nil {
+			t.Fatalf("error refreshing tokens: %v", err)
+		}
+		if claims, err := tokenService.ValidateAccessToken(ctx, refreshed.AccessToken); err != nil || !claims.MFA {
+			t.Errorf("expected the mfa claim to be kept across refreshes, got %+v: %v", claims, err)
+		}
+	})
+
+	t.Run("Testing recovery codes are single use", func(t *testing.T) {
+		result, err := userService.LoginUser(ctx, login)
+		if err != nil {
+			t.Fatalf("error logging in: %v", err)
+		}
+		if _, err := mfaService.CompleteLogin(ctx, result.MFAToken, recoveryCodes[0], domain.Device{}); err != nil {
+			t.Fatalf("error completing login with recovery code: %v", err)
+		}
+		if _, err := mfaService.CompleteLogin(ctx, result.MFAToken, recoveryCodes[0], domain.Device{}); !errors.Is(err, domain.ErrInvalidMFACode) {
+			t.Errorf("expected a used recovery code to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("Testing DisableTOTP", func(t *testing.T) {
+		before := accountFailures()
+		if err := mfaService.DisableTOTP(ctx, user.UserId, "000000", domain.Device{}); !errors.Is(err, domain.ErrInvalidMFACode) {
+			t.Errorf("expected ErrInvalidMFACode, got %v", err)
+		}
+		if failures := accountFailures(); failures != before+1 {
+			t.Errorf("expected the wrong code to count towards the login throttle, got %d failures", failures)
+		}
+		if err := mfaService.DisableTOTP(ctx, user.UserId, recoveryCodes[1], domain.Device{}); err != nil {
+			t.Fatalf("error disabling totp: %v", err)
+		}
+		result, err := userService.LoginUser(ctx, login)
+		if err != nil || result.MFARequired {
+			t.Errorf("expected tokens once mfa is disabled, got %+v: %v", result, err)
+		}
+	})
+}
@@ -0,0 +1,452 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
+	"github.com/google/uuid"
+)
+
+const (
+	grantTypeAuthorizationCode = "authorization_code"
+	grantTypeRefreshToken      = "refresh_token"
+	codeChallengeMethodS256    = "S256"
+)
+
+type oidcService struct {
+	userRepo         ports.UserRepository
+	oauthRepo        ports.OAuthRepository
+	sessionRepo      ports.SessionRepository
+	tokenService     ports.TokenService
+	keyRing          ports.KeyRingService
+	logger           ports.LoggerService
+	issuer           string
+	loginURL         string
+	signingAlgorithm string
+	codeTTL          time.Duration
+	idTokenTTL       time.Duration
+}
+
+func NewOIDCService(userRepo ports.UserRepository, oauthRepo ports.OAuthRepository, sessionRepo ports.SessionRepository, tokenService ports.TokenService, keyRing ports.KeyRingService, logger ports.LoggerService, issuer, loginURL, signingAlgorithm string, codeTTL, idTokenTTL time.Duration) *oidcService {
+	service := oidcService{
+		userRepo:         userRepo,
+		oauthRepo:        oauthRepo,
+		sessionRepo:      sessionRepo,
+		tokenService:     tokenService,
+		keyRing:          keyRing,
+		logger:           logger,
+		issuer:           strings.TrimSuffix(issuer, "/"),
+		loginURL:         loginURL,
+		signingAlgorithm: signingAlgorithm,
+		codeTTL:          codeTTL,
+		idTokenTTL:       idTokenTTL,
+	}
+	return &service
+}
+
+// Discovery returns the OpenID Connect discovery document for this issuer.
+func (svc oidcService) Discovery() domain.OpenIDConfiguration {
+	return domain.OpenIDConfiguration{
+		Issuer:                            svc.issuer,
+		AuthorizationEndpoint:             svc.issuer + "/oauth/v1/authorize",
+		TokenEndpoint:                     svc.issuer + "/oauth/v1/token",
+		UserInfoEndpoint:                  svc.issuer + "/oauth/v1/userinfo",
+		JWKSURI:                           svc.issuer + "/.well-known/jwks.json",
+		ScopesSupported:                   domain.SupportedScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{grantTypeAuthorizationCode, grantTypeRefreshToken},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{svc.signingAlgorithm},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{codeChallengeMethodS256},
+		ClaimsSupported: []string{
+			"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "at_hash",
+			"name", "preferred_username", "picture", "updated_at",
+			"email", "email_verified", "phone_number", "phone_number_verified", "address",
+		},
+	}
+}
+
+// ValidateAuthorizationRequest checks an authorization request before the
+// user is asked to log in. ErrOAuthClientNotFound and ErrInvalidRedirectURI
+// mean the request cannot be trusted to redirect back to the client; any other
+// domain error should be returned to the client at its redirect_uri.
+func (svc oidcService) ValidateAuthorizationRequest(ctx context.Context, request domain.AuthorizationRequest) (*domain.OAuthClient, error) {
+	client, err := svc.oauthRepo.GetClient(ctx, request.ClientId)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, domain.ErrOAuthClientNotFound
+	}
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("validate authorization request: failed to get client: %v", err))
+		return nil, fmt.Errorf("validate authorization request: failed to get client: %w", err)
+	}
+	if !containsString(client.RedirectURIs, request.RedirectURI) {
+		return nil, domain.ErrInvalidRedirectURI
+	}
+
+	if request.ResponseType != "code" {
+		return nil, domain.ErrOAuthUnsupportedResponseType
+	}
+	scopes := strings.Fields(request.Scope)
+	if !containsString(scopes, domain.ScopeOpenID) {
+		return nil, domain.ErrOAuthInvalidScope
+	}
+	for _, scope := range scopes {
+		if !containsString(client.Scopes, scope) {
+			return nil, domain.ErrOAuthInvalidScope
+		}
+	}
+	if request.CodeChallengeMethod != codeChallengeMethodS256 || len(request.CodeChallenge) != 43 {
+		return nil, domain.ErrOAuthInvalidRequest
+	}
+	return client, nil
+}
+
+// LoginRedirect returns the login page URL the user agent is sent to for a
+// valid authorization request. The page logs the user in and posts the same
+// parameters back to Authorize.
+func (svc oidcService) LoginRedirect(request domain.AuthorizationRequest) string {
+	query := url.Values{}
+	query.Set("response_type", request.ResponseType)
+	query.Set("client_id", request.ClientId)
+	query.Set("redirect_uri", request.RedirectURI)
+	query.Set("scope", request.Scope)
+	query.Set("code_challenge", request.CodeChallenge)
+	query.Set("code_challenge_method", request.CodeChallengeMethod)
+	if request.State != "" {
+		query.Set("state", request.State)
+	}
+	if request.Nonce != "" {
+		query.Set("nonce", request.Nonce)
+	}
+	return redirectWithQuery(svc.loginURL, query)
+}
+
+// Authorize issues an authorization code to the client for the logged-in user
+// and returns the redirect_uri the user agent should be sent back to. The
+// user's session decides the auth_time of the ID token.
+func (svc oidcService) Authorize(ctx context.Context, claims domain.Claims, request domain.AuthorizationRequest) (string, error) {
+	if _, err := svc.ValidateAuthorizationRequest(ctx, request); err != nil {
+		return "", err
+	}
+	session, err := svc.sessionRepo.GetSession(ctx, claims.SessionId)
+	if errors.Is(err, domain.ErrNotFound) || (err == nil && session.UserId != claims.UserId) {
+		return "", domain.ErrInvalidAccessToken
+	}
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("authorize: failed to get session: %v", err))
+		return "", fmt.Errorf("authorize: failed to get session: %w", err)
+	}
+
+	code, err := generateOpaqueToken()
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("authorize: failed to generate code: %v", err))
+		return "", fmt.Errorf("authorize: failed to generate code: %w", err)
+	}
+	now := time.Now()
+	err = svc.oauthRepo.CreateAuthorizationCode(ctx, domain.AuthorizationCode{
+		CodeHash:      hashOpaqueToken(code),
+		ClientId:      request.ClientId,
+		UserId:        claims.UserId,
+		RedirectURI:   request.RedirectURI,
+		Scope:         strings.Join(strings.Fields(request.Scope), " "),
+		Nonce:         request.Nonce,
+		CodeChallenge: request.CodeChallenge,
+		AuthTime:      session.AuthTime,
+		ExpiresAt:     now.Add(svc.codeTTL),
+		CreatedAt:     now,
+	})
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("authorize: failed to store code: %v", err))
+		return "", fmt.Errorf("authorize: failed to store code: %w", err)
+	}
+
+	query := url.Values{}
+	query.Set("code", code)
+	if request.State != "" {
+		query.Set("state", request.State)
+	}
+	return redirectWithQuery(request.RedirectURI, query), nil
+}
+
+// ExchangeToken implements the token endpoint for the authorization_code and
+// refresh_token grants. Confidential clients must authenticate with their
+// secret; public clients are identified by client_id and bound by PKCE.
+func (svc oidcService) ExchangeToken(ctx context.Context, request domain.TokenRequest) (*domain.OIDCTokenResponse, error) {
+	switch request.GrantType {
+	case grantTypeAuthorizationCode:
+		return svc.exchangeCode(ctx, request)
+	case grantTypeRefreshToken:
+		client, err := svc.authenticateClient(ctx, request.ClientId, request.ClientSecret)
+		if err != nil {
+			return nil, err
+		}
+		tokens, err := svc.tokenService.RefreshTokens(ctx, request.RefreshToken, client.ClientId)
+		var domainErr *domain.Error
+		if errors.As(err, &domainErr) {
+			return nil, domain.ErrOAuthInvalidGrant
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &domain.OIDCTokenResponse{TokenPair: tokens}, nil
+	default:
+		return nil, domain.ErrOAuthUnsupportedGrantType
+	}
+}
+
+func (svc oidcService) exchangeCode(ctx context.Context, request domain.TokenRequest) (*domain.OIDCTokenResponse, error) {
+	client, err := svc.authenticateClient(ctx, request.ClientId, request.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if request.Code == "" || request.CodeVerifier == "" {
+		return nil, domain.ErrOAuthInvalidRequest
+	}
+
+	code, err := svc.oauthRepo.ConsumeAuthorizationCode(ctx, hashOpaqueToken(request.Code))
+	if errors.Is(err, domain.ErrNotFound) {
+		svc.logger.Warning(fmt.Sprintf("exchange token: unknown authorization code for client %s", client.ClientId))
+		return nil, domain.ErrOAuthInvalidGrant
+	}
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("exchange token: failed to consume code: %v", err))
+		return nil, fmt.Errorf("exchange token: failed to consume code: %w", err)
+	}
+	if code.ClientId != client.ClientId || code.RedirectURI != request.RedirectURI || time.Now().After(code.ExpiresAt) {
+		return nil, domain.ErrOAuthInvalidGrant
+	}
+	if !verifyCodeChallenge(code.CodeChallenge, request.CodeVerifier) {
+		svc.logger.Warning(fmt.Sprintf("exchange token: code verifier mismatch for client %s", client.ClientId))
+		return nil, domain.ErrOAuthInvalidGrant
+	}
+
+	user, err := svc.userRepo.GetUserById(ctx, code.UserId)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("exchange token: failed to get user: %v", err))
+		return nil, domain.ErrOAuthInvalidGrant
+	}
+	tokens, err := svc.tokenService.IssueScopedTokens(ctx, *user, code.Scope, domain.Authentication{
+		Device:   domain.Device{IPAddress: request.IPAddress, UserAgent: request.UserAgent},
+		ClientId: client.ClientId,
+		AuthTime: code.AuthTime,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	idClaims := standardClaims(*user, strings.Fields(code.Scope))
+	idClaims["iss"] = svc.issuer
+	idClaims["aud"] = client.ClientId
+	idClaims["iat"] = now.Unix()
+	idClaims["exp"] = now.Add(svc.idTokenTTL).Unix()
+	idClaims["auth_time"] = code.AuthTime.Unix()
+	idClaims["at_hash"] = svc.accessTokenHash(tokens.AccessToken)
+	if code.Nonce != "" {
+		idClaims["nonce"] = code.Nonce
+	}
+	idToken, err := svc.keyRing.SignToken(ctx, idClaims)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("exchange token: failed to sign id token: %v", err))
+		return nil, fmt.Errorf("exchange token: failed to sign id token: %w", err)
+	}
+
+	return &domain.OIDCTokenResponse{
+		TokenPair: tokens,
+		IDToken:   idToken,
+		Scope:     code.Scope,
+	}, nil
+}
+
+// UserInfo returns the claims about the user that the access token's scope
+// releases. First-party tokens carry no scope and release every claim.
+func (svc oidcService) UserInfo(ctx context.Context, claims domain.Claims) (map[string]interface{}, error) {
+	scopes := domain.SupportedScopes
+	if claims.Scope != "" {
+		scopes = strings.Fields(claims.Scope)
+		if !containsString(scopes, domain.ScopeOpenID) {
+			return nil, domain.ErrOAuthInvalidScope
+		}
+	}
+	user, err := svc.userRepo.GetUserById(ctx, claims.UserId)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("userinfo: failed to get user: %v", err))
+		return nil, fmt.Errorf("userinfo: failed to get user: %w", err)
+	}
+	return standardClaims(*user, scopes), nil
+}
+
+// RegisterClient stores a new client. Confidential clients are given a secret,
+// which is returned once and stored only as a hash. Redirect URIs must be
+// absolute; custom schemes are allowed for mobile apps. Clients registered
+// without scopes may request every supported scope.
+func (svc oidcService) RegisterClient(ctx context.Context, client domain.OAuthClient, confidential bool) (*domain.OAuthClient, string, error) {
+	if client.Name == "" {
+		return nil, "", domain.ErrOAuthInvalidRequest
+	}
+	if len(client.RedirectURIs) == 0 {
+		return nil, "", domain.ErrInvalidRedirectURI
+	}
+	for _, redirectURI := range client.RedirectURIs {
+		parsed, err := url.Parse(redirectURI)
+		web := parsed != nil && (parsed.Scheme == "http" || parsed.Scheme == "https")
+		if err != nil || !parsed.IsAbs() || parsed.Fragment != "" || web && parsed.Host == "" {
+			return nil, "", domain.ErrInvalidRedirectURI
+		}
+	}
+	if len(client.Scopes) == 0 {
+		client.Scopes = domain.SupportedScopes
+	}
+	for _, scope := range client.Scopes {
+		if !containsString(domain.SupportedScopes, scope) {
+			return nil, "", domain.ErrOAuthInvalidScope
+		}
+	}
+
+	secret := ""
+	if confidential {
+		var err error
+		secret, err = generateOpaqueToken()
+		if err != nil {
+			svc.logger.Error(fmt.Sprintf("register client: failed to generate secret: %v", err))
+			return nil, "", fmt.Errorf("register client: failed to generate secret: %w", err)
+		}
+		client.ClientSecretHash = hashOpaqueToken(secret)
+	}
+	client.ClientId = uuid.New().String()
+	client.CreatedAt = time.Now()
+
+	if err := svc.oauthRepo.CreateClient(ctx, client); err != nil {
+		svc.logger.Error(fmt.Sprintf("register client: %v", err))
+		return nil, "", fmt.Errorf("register client: %w", err)
+	}
+	return &client, secret, nil
+}
+
+func (svc oidcService) GetClients(ctx context.Context) ([]*domain.OAuthClient, error) {
+	clients, err := svc.oauthRepo.GetClients(ctx)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("get clients: %v", err))
+		return nil, fmt.Errorf("get clients: %w", err)
+	}
+	return clients, nil
+}
+
+func (svc oidcService) DeleteClient(ctx context.Context, clientId string) error {
+	if err := svc.oauthRepo.DeleteClient(ctx, clientId); err != nil {
+		svc.logger.Error(fmt.Sprintf("delete client: %v", err))
+		return fmt.Errorf("delete client: %w", err)
+	}
+	return nil
+}
+
+// authenticateClient returns the client identified by clientId. Confidential
+// clients must present their secret and public clients must not.
+func (svc oidcService) authenticateClient(ctx context.Context, clientId, secret string) (*domain.OAuthClient, error) {
+	if clientId == "" {
+		return nil, domain.ErrOAuthInvalidClient
+	}
+	client, err := svc.oauthRepo.GetClient(ctx, clientId)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, domain.ErrOAuthInvalidClient
+	}
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("authenticate client: %v", err))
+		return nil, fmt.Errorf("authenticate client: %w", err)
+	}
+	if client.Confidential() != (secret != "") {
+		return nil, domain.ErrOAuthInvalidClient
+	}
+	if client.Confidential() && !hmac.Equal([]byte(hashOpaqueToken(secret)), []byte(client.ClientSecretHash)) {
+		svc.logger.Warning(fmt.Sprintf("authenticate client: wrong secret for client %s", clientId))
+		return nil, domain.ErrOAuthInvalidClient
+	}
+	return client, nil
+}
+
+// accessTokenHash computes the at_hash claim: the left half of the hash of
+// the access token, using the hash that goes with the ID token's algorithm.
+func (svc oidcService) accessTokenHash(accessToken string) string {
+	var digest hash.Hash = sha256.New()
+	if svc.signingAlgorithm == domain.SigningAlgorithmEdDSA {
+		digest = sha512.New()
+	}
+	digest.Write([]byte(accessToken))
+	sum := digest.Sum(nil)
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
+
+// verifyCodeChallenge checks a PKCE code verifier against an S256 challenge.
+func verifyCodeChallenge(challenge, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return hmac.Equal([]byte(expected), []byte(challenge))
+}
+
+// standardClaims returns the OpenID Connect standard claims about the user
+// that the given scopes release. Claims without a value are left out.
+func standardClaims(user domain.User, scopes []string) map[string]interface{} {
+	claims := map[string]interface{}{"sub": user.UserId}
+	if containsString(scopes, domain.ScopeProfile) {
+		setClaim(claims, "name", user.FullName)
+		setClaim(claims, "preferred_username", user.Username)
+		setClaim(claims, "picture", user.Avatar)
+		claims["updated_at"] = user.UpdatedAt.Unix()
+	}
+	if containsString(scopes, domain.ScopeEmail) {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.EmailVerified()
+	}
+	if containsString(scopes, domain.ScopePhone) && user.PhoneNumber != "" {
+		claims["phone_number"] = user.PhoneNumber
+		claims["phone_number_verified"] = user.PhoneVerified()
+	}
+	if containsString(scopes, domain.ScopeAddress) && user.Address != "" {
+		claims["address"] = map[string]interface{}{"formatted": user.Address}
+	}
+	return claims
+}
+
+func setClaim(claims map[string]interface{}, name, value string) {
+	if value != "" {
+		claims[name] = value
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectWithQuery adds query to uri, keeping any query it already has.
+func redirectWithQuery(uri string, query url.Values) string {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	values := parsed.Query()
+	for key := range query {
+		values.Set(key, query.Get(key))
+	}
+	parsed.RawQuery = values.Encode()
+	return parsed.String()
+}
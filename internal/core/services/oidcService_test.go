@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AntonyIS/usafi-hub-user-service/config"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/logger"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/repository"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+)
+
+// PKCE example from RFC 7636, Appendix B.
+const (
+	testCodeVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testCodeChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestOIDCClaims(t *testing.T) {
+	t.Run("Testing verifyCodeChallenge", func(t *testing.T) {
+		if !verifyCodeChallenge(testCodeChallenge, testCodeVerifier) {
+			t.Error("expected the RFC 7636 verifier to match its challenge")
+		}
+		if verifyCodeChallenge(testCodeChallenge, testCodeVerifier[1:]+"A") {
+			t.Error("expected a different verifier to be rejected")
+		}
+		if verifyCodeChallenge("short", "short") {
+			t.Error("expected a verifier shorter than 43 characters to be rejected")
+		}
+	})
+
+	t.Run("Testing standardClaims releases claims by scope", func(t *testing.T) {
+		verifiedAt := time.Now()
+		user := domain.User{
+			UserId:          "user",
+			Username:        "jane",
+			FullName:        "Jane Doe",
+			Email:           "jane@example.com",
+			PhoneNumber:     "+254712345678",
+			EmailVerifiedAt: &verifiedAt,
+		}
+
+		claims := standardClaims(user, []string{domain.ScopeOpenID})
+		if len(claims) != 1 || claims["sub"] != "user" {
+			t.Errorf("expected only sub for the openid scope, got %v", claims)
+		}
+
+		claims = standardClaims(user, []string{domain.ScopeOpenID, domain.ScopeProfile, domain.ScopeEmail, domain.ScopePhone, domain.ScopeAddress})
+		if claims["name"] != "Jane Doe" || claims["preferred_username"] != "jane" || claims["email_verified"] != true || claims["phone_number_verified"] != false {
+			t.Errorf("expected profile, email and phone claims, got %v", claims)
+		}
+		if _, ok := claims["picture"]; ok {
+			t.Error("expected empty claims to be left out")
+		}
+		if _, ok := claims["address"]; ok {
+			t.Error("expected no address claim for a user without an address")
+		}
+	})
+}
+
+func TestOIDCService(t *testing.T) {
+	requireDatabase(t)
+	logger, err := logger.NewDefaultLogger()
+	if err != nil {
+		panic(err)
+	}
+
+	config, err := config.NewConfig(logger)
+	if err != nil {
+		panic(err)
+	}
+
+	db, _ := repository.NewPostgresDB(*config)
+	factory := repository.NewRepositoryFactory(db, *config)
+	ctx := context.Background()
+	userRepo := factory.UserRepository()
+
+	keyRing := newTestKeyRing(factory.SigningKeyRepository(), *config, logger)
+	tokenService := NewTokenService(factory.TokenRepository(), factory.RevocationRepository(), factory.SessionRepository(), userRepo, factory.UserRoleRepository(), logger, keyRing, config.ACCESS_TOKEN_TTL, config.REFRESH_TOKEN_TTL)
+	oidcService := NewOIDCService(userRepo, factory.OAuthRepository(), factory.SessionRepository(), tokenService, keyRing, logger, config.OIDC_ISSUER, config.OIDC_LOGIN_URL, config.JWT_SIGNING_ALGORITHM, config.AUTHORIZATION_CODE_TTL, config.ID_TOKEN_TTL)
+	loginThrottle := newTestLoginThrottle(factory.LoginAttemptRepository(), *config, logger)
+	mfaService := newTestMFAService(userRepo, factory.MFARepository(), tokenService, loginThrottle, *config, logger)
+	userService := NewUserService(userRepo, factory.UserRoleRepository(), tokenService, mfaService, newTestPasswordPolicy(*config, logger), loginThrottle, domain.EmailVerificationOptional, logger)
+
+	user, err := userService.CreateUser(ctx, domain.User{
+		Username:     "oidc_doe",
+		PasswordHash: "Oidc_Password1",
+		Email:        "oidc.doe@example.com",
+		FullName:     "Oidc Doe",
+	})
+	if err != nil {
+		t.Fatalf("error adding user: %v", err)
+	}
+	defer userService.DeleteUser(ctx, user.UserId)
+
+	client, secret, err := oidcService.RegisterClient(ctx, domain.OAuthClient{
+		Name:         "UsafiHub Web",
+		RedirectURIs: []string{"https://app.example.com/callback"},
+	}, true)
+	if err != nil {
+		t.Fatalf("error registering client: %v", err)
+	}
+	defer oidcService.DeleteClient(ctx, client.ClientId)
+	if secret == "" || !client.Confidential() {
+		t.Fatalf("expected a confidential client with a secret")
+	}
+
+	request := domain.AuthorizationRequest{
+		ResponseType:        "code",
+		ClientId:            client.ClientId,
+		RedirectURI:         "https://app.example.com/callback",
+		Scope:               "openid email",
+		State:               "state",
+		Nonce:               "nonce",
+		CodeChallenge:       testCodeChallenge,
+		CodeChallengeMethod: codeChallengeMethodS256,
+	}
+	login, err := tokenService.IssueTokens(ctx, *user, domain.Authentication{})
+	if err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	claims, err := tokenService.ValidateAccessToken(ctx, login.AccessToken)
+	if err != nil {
+		t.Fatalf("error validating access token: %v", err)
+	}
+	sessions, err := tokenService.GetSessions(ctx, user.UserId)
+	if err != nil || len(sessions) != 1 {
+		t.Fatalf("expected the login session, got %v: %v", sessions, err)
+	}
+	// The user approves the client a while after logging in.
+	time.Sleep(time.Second)
+
+	authorize := func(t *testing.T) string {
+		redirectURI, err := oidcService.Authorize(ctx, *claims, request)
+		if err != nil {
+			t.Fatalf("error authorizing: %v", err)
+		}
+		parsed, _ := url.Parse(redirectURI)
+		if parsed.Query().Get("state") != "state" {
+			t.Errorf("expected state to be returned, got %s", redirectURI)
+		}
+		return parsed.Query().Get("code")
+	}
+
+	t.Run("Testing ValidateAuthorizationRequest", func(t *testing.T) {
+		if _, err := oidcService.ValidateAuthorizationRequest(ctx, request); err != nil {
+			t.Errorf("expected a valid request, got %v", err)
+		}
+
+		invalid := request
+		invalid.RedirectURI = "https://evil.example.com/callback"
+		if _, err := oidcService.ValidateAuthorizationRequest(ctx, invalid); !errors.Is(err, domain.ErrInvalidRedirectURI) {
+			t.Errorf("expected ErrInvalidRedirectURI, got %v", err)
+		}
+
+		invalid = request
+		invalid.CodeChallengeMethod = "plain"
+		if _, err := oidcService.ValidateAuthorizationRequest(ctx, invalid); !errors.Is(err, domain.ErrOAuthInvalidRequest) {
+			t.Errorf("expected ErrOAuthInvalidRequest, got %v", err)
+		}
+
+		invalid = request
+		invalid.Scope = "email"
+		if _, err := oidcService.ValidateAuthorizationRequest(ctx, invalid); !errors.Is(err, domain.ErrOAuthInvalidScope) {
+			t.Errorf("expected ErrOAuthInvalidScope, got %v", err)
+		}
+	})
+
+	t.Run("Testing ExchangeToken with an authorization code", func(t *testing.T) {
+		code := authorize(t)
+		exchange := domain.TokenRequest{
+			GrantType:    grantTypeAuthorizationCode,
+			Code:         code,
+			RedirectURI:  request.RedirectURI,
+			ClientId:     client.ClientId,
+			ClientSecret: secret,
+			CodeVerifier: testCodeVerifier,
+		}
+
+		wrongSecret := exchange
+		wrongSecret.ClientSecret = "wrong"
+		if _, err := oidcService.ExchangeToken(ctx, wrongSecret); !errors.Is(err, domain.ErrOAuthInvalidClient) {
+			t.Errorf("expected ErrOAuthInvalidClient, got %v", err)
+		}
+
+		tokens, err := oidcService.ExchangeToken(ctx, exchange)
+		if err != nil {
+			t.Fatalf("error exchanging code: %v", err)
+		}
+		idClaims, err := keyRing.ParseToken(ctx, tokens.IDToken)
+		if err != nil {
+			t.Fatalf("error parsing id token: %v", err)
+		}
+		if idClaims["sub"] != user.UserId || idClaims["aud"] != client.ClientId || idClaims["nonce"] != "nonce" || idClaims["email"] != user.Email {
+			t.Errorf("expected id token claims for the user and client, got %v", idClaims)
+		}
+		if _, ok := idClaims["name"]; ok {
+			t.Error("expected no profile claims without the profile scope")
+		}
+		if authTime, _ := idClaims["auth_time"].(float64); int64(authTime) != sessions[0].AuthTime.Unix() {
+			t.Errorf("expected auth_time to be when the user logged in, %d, got %v", sessions[0].AuthTime.Unix(), idClaims["auth_time"])
+		}
+
+		if _, err := oidcService.ExchangeToken(ctx, exchange); !errors.Is(err, domain.ErrOAuthInvalidGrant) {
+			t.Errorf("expected a used code to be rejected, got %v", err)
+		}
+
+		accessClaims, err := tokenService.ValidateAccessToken(ctx, tokens.AccessToken)
+		if err != nil || accessClaims.Scope != "openid email" {
+			t.Fatalf("expected a scoped access token, got %+v: %v", accessClaims, err)
+		}
+		userInfo, err := oidcService.UserInfo(ctx, *accessClaims)
+		if err != nil || userInfo["email"] != user.Email {
+			t.Errorf("expected userinfo with the email claim, got %v: %v", userInfo, err)
+		}
+
+		other, _, err := oidcService.RegisterClient(ctx, domain.OAuthClient{
+			Name:         "UsafiHub Mobile",
+			RedirectURIs: []string{"usafihub://callback"},
+		}, false)
+		if err != nil {
+			t.Fatalf("error registering client: %v", err)
+		}
+		defer oidcService.DeleteClient(ctx, other.ClientId)
+		if _, err := oidcService.ExchangeToken(ctx, domain.TokenRequest{
+			GrantType:    grantTypeRefreshToken,
+			RefreshToken: tokens.RefreshToken,
+			ClientId:     other.ClientId,
+		}); !errors.Is(err, domain.ErrOAuthInvalidGrant) {
+			t.Errorf("expected a refresh token issued to another client to be rejected, got %v", err)
+		}
+		if _, err := tokenService.RefreshTokens(ctx, tokens.RefreshToken, ""); !errors.Is(err, domain.ErrInvalidRefreshToken) {
+			t.Errorf("expected a client's refresh token to be rejected by the first-party refresh, got %v", err)
+		}
+
+		refreshed, err := oidcService.ExchangeToken(ctx, domain.TokenRequest{
+			GrantType:    grantTypeRefreshToken,
+			RefreshToken: tokens.RefreshToken,
+			ClientId:     client.ClientId,
+			ClientSecret: secret,
+		})
+		if err != nil {
+			t.Fatalf("error refreshing tokens: %v", err)
+		}
+		if refreshedClaims, err := tokenService.ValidateAccessToken(ctx, refreshed.AccessToken); err != nil || refreshedClaims.Scope != accessClaims.Scope {
+			t.Errorf("expected the scope to survive a refresh, got %+v: %v", refreshedClaims, err)
+		}
+	})
+
+	t.Run("Testing ExchangeToken rejects a wrong code verifier", func(t *testing.T) {
+		code := authorize(t)
+		_, err := oidcService.ExchangeToken(ctx, domain.TokenRequest{
+			GrantType:    grantTypeAuthorizationCode,
+			Code:         code,
+			RedirectURI:  request.RedirectURI,
+			ClientId:     client.ClientId,
+			ClientSecret: secret,
+			CodeVerifier: testCodeVerifier[1:] + "A",
+		})
+		if !errors.Is(err, domain.ErrOAuthInvalidGrant) {
+			t.Errorf("expected ErrOAuthInvalidGrant, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
+)
+
+// oneTimeCodes issues and checks short numeric codes for any purpose. Codes are
+// stored as an HMAC keyed with a secret, since a plain hash of a six digit
+// code could be reversed by trying every code.
+type oneTimeCodes struct {
+	repo  ports.OneTimeCodeRepository
+	rules domain.OneTimeCodeRules
+	key   []byte
+}
+
+func newOneTimeCodes(repo ports.OneTimeCodeRepository, rules domain.OneTimeCodeRules, secret []byte) oneTimeCodes {
+	return oneTimeCodes{
+		repo:  repo,
+		rules: rules,
+		key:   deriveKey(secret, "one_time_code"),
+	}
+}
+
+// issue creates a numeric code for the user and purpose, replacing any earlier
+// one. It refuses to replace a code sent less than ResendInterval ago.
+func (c oneTimeCodes) issue(ctx context.Context, userId, purpose, recipient string) (string, error) {
+	return c.issueWith(ctx, userId, purpose, recipient, func() (string, error) {
+		return generateNumericCode(c.rules.Length)
+	})
+}
+
+// issueToken works like issue but creates a long random token, for use in
+// links where the code does not have to be typed.
+func (c oneTimeCodes) issueToken(ctx context.Context, userId, purpose, recipient string) (string, error) {
+	return c.issueWith(ctx, userId, purpose, recipient, generateOpaqueToken)
+}
+
+func (c oneTimeCodes) issueWith(ctx context.Context, userId, purpose, recipient string, generate func() (string, error)) (string, error) {
+	existing, err := c.repo.GetOneTimeCode(ctx, userId, purpose)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return "", fmt.Errorf("failed to get one-time code: %w", err)
+	}
+	now := time.Now()
+	if existing != nil {
+		if wait := existing.CreatedAt.Add(c.rules.ResendInterval).Sub(now); wait > 0 {
+			return "", domain.ErrOneTimeCodeRecentlySent.WithRetryAfter(wait)
+		}
+	}
+
+	code, err := generate()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate one-time code: %w", err)
+	}
+	err = c.repo.SaveOneTimeCode(ctx, domain.OneTimeCode{
+		UserId:    userId,
+		Purpose:   purpose,
+		Recipient: recipient,
+		CodeHash:  c.hash(userId, purpose, code),
+		ExpiresAt: now.Add(c.rules.TTL),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to store one-time code: %w", err)
+	}
+	return code, nil
+}
+
+// verify checks code against the user's code for purpose and consumes it on a
+// match. Every attempt counts towards MaxAttempts, and is counted before the
+// code is compared so that concurrent guesses cannot exceed it. Expired codes,
+// exhausted codes and codes sent to anything but recipient are rejected as
+// invalid.
+func (c oneTimeCodes) verify(ctx context.Context, userId, purpose, recipient, code string) error {
+	stored, err := c.repo.GetOneTimeCode(ctx, userId, purpose)
+	if errors.Is(err, domain.ErrNotFound) {
+		return domain.ErrInvalidOneTimeCode
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get one-time code: %w", err)
+	}
+
+	if time.Now().After(stored.ExpiresAt) || stored.Recipient != recipient {
+		return domain.ErrInvalidOneTimeCode
+	}
+	err = c.repo.IncrementOneTimeCodeAttempts(ctx, userId, purpose, c.rules.MaxAttempts)
+	if errors.Is(err, domain.ErrNotFound) {
+		return domain.ErrInvalidOneTimeCode
+	}
+	if err != nil {
+		return fmt.Errorf("failed to count one-time code attempt: %w", err)
+	}
+	if !hmac.Equal([]byte(stored.CodeHash), []byte(c.hash(userId, purpose, code))) {
+		return domain.ErrInvalidOneTimeCode
+	}
+
+	// Only the request that deletes the code may use it.
+	err = c.repo.DeleteOneTimeCode(ctx, userId, purpose)
+	if errors.Is(err, domain.ErrNotFound) {
+		return domain.ErrInvalidOneTimeCode
+	}
+	if err != nil {
+		return fmt.Errorf("failed to consume one-time code: %w", err)
+	}
+	return nil
+}
+
+func (c oneTimeCodes) hash(userId, purpose, code string) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(userId + "\x00" + purpose + "\x00" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// generateNumericCode returns a random code of length decimal digits.
+func generateNumericCode(length int) (string, error) {
+	code := make([]byte, length)
+	for i := range code {
+		digit, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		code[i] = byte('0' + digit.Int64())
+	}
+	return string(code), nil
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+)
+
+type memoryOneTimeCodes map[string]*domain.OneTimeCode
+
+func (m memoryOneTimeCodes) SaveOneTimeCode(ctx context.Context, code domain.OneTimeCode) error {
+	m[code.UserId+"/"+code.Purpose] = &code
+	return nil
+}
+
+func (m memoryOneTimeCodes) GetOneTimeCode(ctx context.Context, userId, purpose string) (*domain.OneTimeCode, error) {
+	code, ok := m[userId+"/"+purpose]
+	if !ok {
+		return nil, domain.NewError(domain.ErrNotFound, "one_time_code_not_found", "one time code not found")
+	}
+	copied := *code
+	return &copied, nil
+}
+
+func (m memoryOneTimeCodes) IncrementOneTimeCodeAttempts(ctx context.Context, userId, purpose string, maxAttempts int) error {
+	code, ok := m[userId+"/"+purpose]
+	if !ok || code.Attempts >= maxAttempts {
+		return domain.NewError(domain.ErrNotFound, "one_time_code_not_found", "one time code not found")
+	}
+	code.Attempts++
+	return nil
+}
+
+// staleOneTimeCodes reads codes as they were before any attempt, like
+// concurrent requests that all read the code before any of them counts a guess.
+type staleOneTimeCodes struct {
+	memoryOneTimeCodes
+}
+
+func (s staleOneTimeCodes) GetOneTimeCode(ctx context.Context, userId, purpose string) (*domain.OneTimeCode, error) {
+	code, err := s.memoryOneTimeCodes.GetOneTimeCode(ctx, userId, purpose)
+	if err == nil {
+		code.Attempts = 0
+	}
+	return code, err
+}
+
+func (m memoryOneTimeCodes) DeleteOneTimeCode(ctx context.Context, userId, purpose string) error {
+	if _, ok := m[userId+"/"+purpose]; !ok {
+		return domain.NewError(domain.ErrNotFound, "one_time_code_not_found", "one time code not found")
+	}
+	delete(m, userId+"/"+purpose)
+	return nil
+}
+
+func TestOneTimeCodes(t *testing.T) {
+	ctx := context.Background()
+	rules := domain.OneTimeCodeRules{
+		Length:         6,
+		TTL:            10 * time.Minute,
+		MaxAttempts:    3,
+		ResendInterval: time.Minute,
+	}
+	const purpose = domain.OneTimeCodePhoneVerification
+	const recipient = "+254712345678"
+
+	t.Run("Testing a code can be used once", func(t *testing.T) {
+		repo := memoryOneTimeCodes{}
+		codes := newOneTimeCodes(repo, rules, []byte("secret"))
+		code, err := codes.issue(ctx, "user-1", purpose, recipient)
+		if err != nil {
+			t.Fatalf("error issuing code: %v", err)
+		}
+		if len(code) != rules.Length {
+			t.Errorf("expected a %d digit code, got %q", rules.Length, code)
+		}
+		if repo["user-1/"+purpose].CodeHash == code {
+			t.Errorf("expected the code to be stored hashed")
+		}
+
+		if err := codes.verify(ctx, "user-1", purpose, recipient, code); err != nil {
+			t.Fatalf("error verifying code: %v", err)
+		}
+		if err := codes.verify(ctx, "user-1", purpose, recipient, code); !errors.Is(err, domain.ErrInvalidOneTimeCode) {
+			t.Errorf("expected a used code to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("Testing a code stops working after too many wrong guesses", func(t *testing.T) {
+		codes := newOneTimeCodes(memoryOneTimeCodes{}, rules, []byte("secret"))
+		code, err := codes.issue(ctx, "user-1", purpose, recipient)
+		if err != nil {
+			t.Fatalf("error issuing code: %v", err)
+		}
+		wrong := "000000"
+		if code == wrong {
+			wrong = "111111"
+		}
+		for i := 0; i < rules.MaxAttempts; i++ {
+			if err := codes.verify(ctx, "user-1", purpose, recipient, wrong); !errors.Is(err, domain.ErrInvalidOneTimeCode) {
+				t.Fatalf("expected a wrong code to be rejected, got %v", err)
+			}
+		}
+		if err := codes.verify(ctx, "user-1", purpose, recipient, code); !errors.Is(err, domain.ErrInvalidOneTimeCode) {
+			t.Errorf("expected an exhausted code to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("Testing concurrent guesses cannot exceed the attempt limit", func(t *testing.T) {
+		codes := newOneTimeCodes(staleOneTimeCodes{memoryOneTimeCodes{}}, rules, []byte("secret"))
+		code, err := codes.issue(ctx, "user-1", purpose, recipient)
+		if err != nil {
+			t.Fatalf("error issuing code: %v", err)
+		}
+		wrong := "000000"
+		if code == wrong {
+			wrong = "111111"
+		}
+		for i := 0; i < rules.MaxAttempts; i++ {
+			if err := codes.verify(ctx, "user-1", purpose, recipient, wrong); !errors.Is(err, domain.ErrInvalidOneTimeCode) {
+				t.Fatalf("expected a wrong code to be rejected, got %v", err)
+			}
+		}
+		if err := codes.verify(ctx, "user-1", purpose, recipient, code); !errors.Is(err, domain.ErrInvalidOneTimeCode) {
+			t.Errorf("expected the guess over the limit to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("Testing codes are bound to the recipient, purpose and expiry", func(t *testing.T) {
+		repo := memoryOneTimeCodes{}
+		codes := newOneTimeCodes(repo, rules, []byte("secret"))
+		code, err := codes.issue(ctx, "user-1", purpose, recipient)
+		if err != nil {
+			t.Fatalf("error issuing code: %v", err)
+		}
+		if err := codes.verify(ctx, "user-1", purpose, "+254712345679", code); !errors.Is(err, domain.ErrInvalidOneTimeCode) {
+			t.Errorf("expected a code for another recipient to be rejected, got %v", err)
+		}
+		if err := codes.verify(ctx, "user-1", "another_purpose", recipient, code); !errors.Is(err, domain.ErrInvalidOneTimeCode) {
+			t.Errorf("expected a code for another purpose to be rejected, got %v", err)
+		}
+
+		repo["user-1/"+purpose].ExpiresAt = time.Now().Add(-time.Second)
+		if err := codes.verify(ctx, "user-1", purpose, recipient, code); !errors.Is(err, domain.ErrInvalidOneTimeCode) {
+			t.Errorf("expected an expired code to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("Testing codes cannot be resent too often", func(t *testing.T) {
+		repo := memoryOneTimeCodes{}
+		codes := newOneTimeCodes(repo, rules, []byte("secret"))
+		if _, err := codes.issue(ctx, "user-1", purpose, recipient); err != nil {
+			t.Fatalf("error issuing code: %v", err)
+		}
+
+		_, err := codes.issue(ctx, "user-1", purpose, recipient)
+		var domainErr *domain.Error
+		if !errors.Is(err, domain.ErrOneTimeCodeRecentlySent) || !errors.As(err, &domainErr) || domainErr.RetryAfter <= 0 {
+			t.Fatalf("expected ErrOneTimeCodeRecentlySent with a retry delay, got %v", err)
+		}
+
+		repo["user-1/"+purpose].CreatedAt = time.Now().Add(-rules.ResendInterval)
+		if _, err := codes.issue(ctx, "user-1", purpose, recipient); err != nil {
+			t.Errorf("expected a new code after the resend interval, got %v", err)
+		}
+	})
+}
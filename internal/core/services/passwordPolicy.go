@@ -0,0 +1,114 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
+)
+
+// bcryptMaxBytes is the longest password bcrypt can hash. Longer passwords
+// are rejected rather than silently truncated.
+const bcryptMaxBytes = 72
+
+// minPersonalInfoLength is the shortest username or email part that passwords
+// may not contain. Shorter parts would reject too many unrelated passwords.
+const minPersonalInfoLength = 3
+
+type passwordPolicy struct {
+	rules    domain.PasswordRules
+	breached ports.BreachedPasswordChecker
+	logger   ports.LoggerService
+}
+
+// NewPasswordPolicy creates a policy enforcing rules. breached may be nil, in
+// which case passwords are not checked against known breaches.
+func NewPasswordPolicy(rules domain.PasswordRules, breached ports.BreachedPasswordChecker, logger ports.LoggerService) *passwordPolicy {
+	policy := passwordPolicy{
+		rules:    rules,
+		breached: breached,
+		logger:   logger,
+	}
+	return &policy
+}
+
+// Validate reports every rule the password breaks as a domain.ErrWeakPassword.
+// user is used to reject passwords containing the username or email address
+// and may be empty when the account is not known yet.
+func (p passwordPolicy) Validate(password string, user domain.User) error {
+	violations := []domain.Violation{}
+	violate := func(code, message string) {
+		violations = append(violations, domain.Violation{Field: "password", Code: code, Message: message})
+	}
+
+	if utf8.RuneCountInString(password) < p.rules.MinLength {
+		violate("too_short", fmt.Sprintf("password must be at least %d characters long", p.rules.MinLength))
+	}
+	if len(password) > bcryptMaxBytes {
+		violate("too_long", fmt.Sprintf("password must be at most %d bytes long", bcryptMaxBytes))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if p.rules.RequireUpper && !hasUpper {
+		violate("missing_upper", "password must contain an uppercase letter")
+	}
+	if p.rules.RequireLower && !hasLower {
+		violate("missing_lower", "password must contain a lowercase letter")
+	}
+	if p.rules.RequireDigit && !hasDigit {
+		violate("missing_digit", "password must contain a digit")
+	}
+	if p.rules.RequireSymbol && !hasSymbol {
+		violate("missing_symbol", "password must contain a symbol")
+	}
+
+	if containsPersonalInfo(password, user) {
+		violate("contains_personal_info", "password must not contain your username or email address")
+	}
+
+	if p.breached != nil && password != "" {
+		breached, err := p.breached.IsBreached(password)
+		if err != nil {
+			p.logger.Error(fmt.Sprintf("password policy: failed to check breached passwords: %v", err))
+			return fmt.Errorf("password policy: failed to check breached passwords: %w", err)
+		}
+		if breached {
+			violate("breached", "password has appeared in a data breach, please choose another")
+		}
+	}
+
+	if len(violations) > 0 {
+		return domain.ErrWeakPassword.WithViolations(violations)
+	}
+	return nil
+}
+
+func containsPersonalInfo(password string, user domain.User) bool {
+	password = strings.ToLower(password)
+	parts := []string{user.Username, user.Email}
+	if at := strings.LastIndex(user.Email, "@"); at > 0 {
+		parts = append(parts, user.Email[:at])
+	}
+	for _, part := range parts {
+		part = strings.ToLower(part)
+		if len(part) >= minPersonalInfoLength && strings.Contains(password, part) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+)
+
+type stubBreachedPasswords map[string]bool
+
+func (s stubBreachedPasswords) IsBreached(password string) (bool, error) {
+	return s[password], nil
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	rules := domain.PasswordRules{
+		MinLength:    8,
+		RequireUpper: true,
+		RequireLower: true,
+		RequireDigit: true,
+	}
+	policy := NewPasswordPolicy(rules, stubBreachedPasswords{"Password1": true}, nil)
+	user := domain.User{Username: "john_doe", Email: "john.doe@example.com"}
+
+	violationCodes := func(err error) map[string]bool {
+		var domainErr *domain.Error
+		if !errors.As(err, &domainErr) {
+			t.Fatalf("expected a domain error, got %v", err)
+		}
+		codes := map[string]bool{}
+		for _, violation := range domainErr.Violations {
+			codes[violation.Code] = true
+		}
+		return codes
+	}
+
+	t.Run("Testing a strong password is accepted", func(t *testing.T) {
+		if err := policy.Validate("Correct-Horse-9", user); err != nil {
+			t.Errorf("expected password to be accepted, got %v", err)
+		}
+	})
+
+	t.Run("Testing an empty password is rejected", func(t *testing.T) {
+		err := policy.Validate("", user)
+		if !errors.Is(err, domain.ErrWeakPassword) {
+			t.Fatalf("expected ErrWeakPassword, got %v", err)
+		}
+		codes := violationCodes(err)
+		for _, code := range []string{"too_short", "missing_upper", "missing_lower", "missing_digit"} {
+			if !codes[code] {
+				t.Errorf("expected violation %s, got %v", code, codes)
+			}
+		}
+	})
+
+	t.Run("Testing passwords longer than bcrypt accepts are rejected", func(t *testing.T) {
+		password := "Aa1"
+		for len(password) <= bcryptMaxBytes {
+			password += "x"
+		}
+		if codes := violationCodes(policy.Validate(password, user)); !codes["too_long"] {
+			t.Errorf("expected violation too_long, got %v", codes)
+		}
+	})
+
+	t.Run("Testing passwords containing the username or email are rejected", func(t *testing.T) {
+		for _, password := range []string{"John_Doe2024", "X-JOHN.DOE-9x"} {
+			if codes := violationCodes(policy.Validate(password, user)); !codes["contains_personal_info"] {
+				t.Errorf("expected %q to be rejected for personal info, got %v", password, codes)
+			}
+		}
+	})
+
+	t.Run("Testing breached passwords are rejected", func(t *testing.T) {
+		if codes := violationCodes(policy.Validate("Password1", user)); !codes["breached"] {
+			t.Errorf("expected violation breached, got %v", codes)
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type passwordResetService struct {
+	userRepo     ports.UserRepository
+	resetRepo    ports.PasswordResetRepository
+	tokenService ports.TokenService
+	notifier     ports.NotificationService
+	policy       ports.PasswordPolicy
+	logger       ports.LoggerService
+	resetURL     string
+	tokenTTL     time.Duration
+}
+
+func NewPasswordResetService(userRepo ports.UserRepository, resetRepo ports.PasswordResetRepository, tokenService ports.TokenService, notifier ports.NotificationService, policy ports.PasswordPolicy, logger ports.LoggerService, resetURL string, tokenTTL time.Duration) *passwordResetService {
+	service := passwordResetService{
+		userRepo:     userRepo,
+		resetRepo:    resetRepo,
+		tokenService: tokenService,
+		notifier:     notifier,
+		policy:       policy,
+		logger:       logger,
+		resetURL:     resetURL,
+		tokenTTL:     tokenTTL,
+	}
+	return &service
+}
+
+// RequestPasswordReset issues a reset token for the account with the given email.
+// Unknown emails are not reported back to the caller so accounts cannot be enumerated.
+func (svc passwordResetService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := svc.userRepo.GetUserByEmail(ctx, email)
+	if err != nil {
+		svc.logger.Warning(fmt.Sprintf("request password reset: no user for email %s: %v", email, err))
+		return nil
+	}
+
+	token, err := generateOpaqueToken()
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("request password reset: failed to generate token: %v", err))
+		return fmt.Errorf("request password reset: failed to generate token: %w", err)
+	}
+
+	now := time.Now()
+	err = svc.resetRepo.CreatePasswordResetToken(ctx, domain.PasswordResetToken{
+		TokenHash: hashOpaqueToken(token),
+		UserId:    user.UserId,
+		ExpiresAt: now.Add(svc.tokenTTL),
+		CreatedAt: now,
+	})
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("request password reset: failed to store token: %v", err))
+		return fmt.Errorf("request password reset: failed to store token: %w", err)
+	}
+
+	err = svc.notifier.Send(domain.Notification{
+		Recipient: user.Email,
+		Subject:   "Reset your UsafiHub password",
+		Message:   fmt.Sprintf("Use the link below to reset your password. It expires in %s.\n%s?token=%s", svc.tokenTTL, svc.resetURL, token),
+	})
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("request password reset: failed to send notification: %v", err))
+		return fmt.Errorf("request password reset: failed to send notification: %w", err)
+	}
+	return nil
+}
+
+// ResetPassword consumes a reset token and replaces the user's password,
+// logging the user out everywhere in case the account was compromised.
+// Tokens are single-use: the token is removed whether or not it has expired.
+func (svc passwordResetService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	tokenHash := hashOpaqueToken(token)
+	resetToken, err := svc.resetRepo.GetPasswordResetToken(ctx, tokenHash)
+	if err != nil {
+		svc.logger.Warning(fmt.Sprintf("reset password: failed to get token: %v", err))
+		return domain.ErrInvalidPasswordResetToken
+	}
+
+	if time.Now().After(resetToken.ExpiresAt) {
+		if _, err := svc.resetRepo.ConsumePasswordResetToken(ctx, tokenHash); err != nil {
+			svc.logger.Warning(fmt.Sprintf("reset password: failed to remove expired token: %v", err))
+		}
+		return domain.ErrInvalidPasswordResetToken
+	}
+
+	user, err := svc.userRepo.GetUserById(ctx, resetToken.UserId)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("reset password: failed to get user: %v", err))
+		return fmt.Errorf("reset password: failed to get user: %w", err)
+	}
+	// The token is only used up once the password is accepted, so that a
+	// rejected password does not cost the user their link.
+	if err := svc.policy.Validate(newPassword, *user); err != nil {
+		return err
+	}
+
+	// Consuming the token fails when a concurrent reset used it first.
+	if _, err := svc.resetRepo.ConsumePasswordResetToken(ctx, tokenHash); err != nil {
+		svc.logger.Warning(fmt.Sprintf("reset password: failed to consume token: %v", err))
+		return domain.ErrInvalidPasswordResetToken
+	}
+
+	bytes, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("reset password: failed to hash password: %v", err))
+		return fmt.Errorf("reset password: failed to hash password: %w", err)
+	}
+
+	err = svc.userRepo.UpdatePassword(ctx, resetToken.UserId, string(bytes))
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("reset password: failed to update password: %v", err))
+		return fmt.Errorf("reset password: failed to update password: %w", err)
+	}
+
+	err = svc.tokenService.LogoutEverywhere(ctx, resetToken.UserId)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("reset password: failed to revoke sessions: %v", err))
+		return fmt.Errorf("reset password: failed to revoke sessions: %w", err)
+	}
+	return nil
+}
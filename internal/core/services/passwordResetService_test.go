@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/AntonyIS/usafi-hub-user-service/config"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/logger"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/repository"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+)
+
+type recordingNotifier struct {
+	notifications []domain.Notification
+}
+
+func (n *recordingNotifier) Send(notification domain.Notification) error {
+	n.notifications = append(n.notifications, notification)
+	return nil
+}
+
+func (n *recordingNotifier) lastToken() string {
+	if len(n.notifications) == 0 {
+		return ""
+	}
+	message := n.notifications[len(n.notifications)-1].Message
+	index := strings.LastIndex(message, "token=")
+	if index == -1 {
+		return ""
+	}
+	return message[index+len("token="):]
+}
+
+func TestPasswordResetService(t *testing.T) {
+	requireDatabase(t)
+	logger, err := logger.NewDefaultLogger()
+	if err != nil {
+		panic(err)
+	}
+
+	config, err := config.NewConfig(logger)
+	if err != nil {
+		panic(err)
+	}
+
+	db, _ := repository.NewPostgresDB(*config)
+	factory := repository.NewRepositoryFactory(db, *config)
+	ctx := context.Background()
+	userRepo := factory.UserRepository()
+	tokenRepo := factory.TokenRepository()
+	revocationRepo := factory.RevocationRepository()
+	userRoleRepo := factory.UserRoleRepository()
+	resetRepo := factory.PasswordResetRepository()
+	notifier := &recordingNotifier{}
+
+	tokenService := NewTokenService(tokenRepo, revocationRepo, factory.SessionRepository(), userRepo, userRoleRepo, logger, newTestKeyRing(factory.SigningKeyRepository(), *config, logger), config.ACCESS_TOKEN_TTL, config.REFRESH_TOKEN_TTL)
+	loginThrottle := newTestLoginThrottle(factory.LoginAttemptRepository(), *config, logger)
+	mfaService := newTestMFAService(userRepo, factory.MFARepository(), tokenService, loginThrottle, *config, logger)
+	userService := NewUserService(userRepo, factory.UserRoleRepository(), tokenService, mfaService, newTestPasswordPolicy(*config, logger), loginThrottle, domain.EmailVerificationOptional, logger)
+	resetService := NewPasswordResetService(userRepo, resetRepo, tokenService, notifier, newTestPasswordPolicy(*config, logger), logger, config.PASSWORD_RESET_URL, config.PASSWORD_RESET_TTL)
+
+	user, err := userService.CreateUser(ctx, domain.User{
+		Username:     "reset_doe",
+		PasswordHash: "Old_Password1",
+		Email:        "reset.doe@example.com",
+		FullName:     "Reset Doe",
+	})
+	if err != nil {
+		t.Fatalf("error adding user: %v", err)
+	}
+	defer userService.DeleteUser(ctx, user.UserId)
+
+	t.Run("Testing RequestPasswordReset for unknown email", func(t *testing.T) {
+		err := resetService.RequestPasswordReset(ctx, "nobody@example.com")
+		if err != nil {
+			t.Errorf("expected no error for unknown email, got %v", err)
+		}
+		if len(notifier.notifications) != 0 {
+			t.Errorf("expected no notification, got %d", len(notifier.notifications))
+		}
+	})
+
+	t.Run("Testing ResetPassword", func(t *testing.T) {
+		err := resetService.RequestPasswordReset(ctx, user.Email)
+		if err != nil {
+			t.Fatalf("error requesting password reset: %v", err)
+		}
+
+		token := notifier.lastToken()
+		if token == "" {
+			t.Fatal("expected reset token in notification")
+		}
+
+		tokens, err := userService.LoginUser(ctx, domain.LoginRequest{Email: user.Email, Password: "Old_Password1"})
+		if err != nil {
+			t.Fatalf("error logging in: %v", err)
+		}
+
+		err = resetService.ResetPassword(ctx, token, "New_Password1")
+		if err != nil {
+			t.Fatalf("error resetting password: %v", err)
+		}
+
+		if _, err := tokenService.ValidateAccessToken(ctx, tokens.AccessToken); !errors.Is(err, domain.ErrTokenRevoked) {
+			t.Errorf("expected access tokens issued before the reset to be revoked, got %v", err)
+		}
+		if _, err := tokenService.RefreshTokens(ctx, tokens.RefreshToken, ""); err == nil {
+			t.Error("expected refresh tokens issued before the reset to be revoked")
+		}
+
+		if _, err := userService.LoginUser(ctx, domain.LoginRequest{Email: user.Email, Password: "New_Password1"}); err != nil {
+			t.Errorf("expected login with new password to succeed: %v", err)
+		}
+
+		err = resetService.ResetPassword(ctx, token, "Another_Password1")
+		if !errors.Is(err, domain.ErrInvalidPasswordResetToken) {
+			t.Errorf("expected reused token to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("Testing ResetPassword keeps the token when the password is rejected", func(t *testing.T) {
+		if err := resetService.RequestPasswordReset(ctx, user.Email); err != nil {
+			t.Fatalf("error requesting password reset: %v", err)
+		}
+		token := notifier.lastToken()
+
+		if err := resetService.ResetPassword(ctx, token, "Reset_Doe_Password1"); !errors.Is(err, domain.ErrWeakPassword) {
+			t.Fatalf("expected a password containing the username to be rejected, got %v", err)
+		}
+		if err := resetService.ResetPassword(ctx, token, "Third_Password1"); err != nil {
+			t.Errorf("expected the token to still be usable, got %v", err)
+		}
+	})
+}
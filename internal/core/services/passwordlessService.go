@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
+)
+
+type passwordlessService struct {
+	userRepo      ports.UserRepository
+	codes         oneTimeCodes
+	mfaService    ports.MFAService
+	loginThrottle ports.LoginThrottleService
+	notifier      ports.NotificationService
+	sms           ports.SMSSender
+	emailPolicy   domain.EmailVerificationPolicy
+	logger        ports.LoggerService
+	linkURL       string
+}
+
+func NewPasswordlessService(userRepo ports.UserRepository, codeRepo ports.OneTimeCodeRepository, mfaService ports.MFAService, loginThrottle ports.LoginThrottleService, notifier ports.NotificationService, sms ports.SMSSender, emailPolicy domain.EmailVerificationPolicy, logger ports.LoggerService, rules domain.OneTimeCodeRules, secret []byte, linkURL string) *passwordlessService {
+	service := passwordlessService{
+		userRepo:      userRepo,
+		codes:         newOneTimeCodes(codeRepo, rules, secret),
+		mfaService:    mfaService,
+		loginThrottle: loginThrottle,
+		notifier:      notifier,
+		sms:           sms,
+		emailPolicy:   emailPolicy,
+		logger:        logger,
+		linkURL:       linkURL,
+	}
+	return &service
+}
+
+// RequestPasswordlessLogin sends a login code or link to a verified email
+// address or phone number. Requests for unknown or unverified addresses, and
+// repeated requests within the resend interval, are dropped without telling
+// the caller so that accounts cannot be enumerated.
+func (svc passwordlessService) RequestPasswordlessLogin(ctx context.Context, request domain.PasswordlessRequest) error {
+	if request.Method != domain.PasswordlessCode && request.Method != domain.PasswordlessLink {
+		return domain.ErrInvalidPasswordlessMethod
+	}
+	recipient, err := passwordlessRecipient(request.Email, request.PhoneNumber)
+	if err != nil {
+		return err
+	}
+
+	user, err := svc.findUser(ctx, request.Email, recipient)
+	if errors.Is(err, domain.ErrNotFound) {
+		svc.logger.Warning(fmt.Sprintf("request passwordless login: no verified user for %s", recipient))
+		return nil
+	}
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("request passwordless login: failed to get user: %v", err))
+		return fmt.Errorf("request passwordless login: failed to get user: %w", err)
+	}
+
+	issue := svc.codes.issue
+	if request.Method == domain.PasswordlessLink {
+		issue = svc.codes.issueToken
+	}
+	code, err := issue(ctx, user.UserId, domain.OneTimeCodePasswordlessLogin, recipient)
+	if errors.Is(err, domain.ErrOneTimeCodeRecentlySent) {
+		svc.logger.Warning(fmt.Sprintf("request passwordless login: %v", err))
+		return nil
+	}
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("request passwordless login: %v", err))
+		return fmt.Errorf("request passwordless login: %w", err)
+	}
+
+	message := fmt.Sprintf("Your UsafiHub login code is %s. It expires in %s.", code, svc.codes.rules.TTL)
+	if request.Method == domain.PasswordlessLink {
+		message = fmt.Sprintf("Use the link below to log in to UsafiHub. It expires in %s.\n%s", svc.codes.rules.TTL, svc.loginLink(request, code))
+	}
+
+	if request.Email != "" {
+		err = svc.notifier.Send(domain.Notification{
+			Recipient: user.Email,
+			Subject:   "Log in to UsafiHub",
+			Message:   message,
+		})
+	} else {
+		err = svc.sms.SendSMS(domain.SMSMessage{
+			PhoneNumber: user.PhoneNumber,
+			Message:     message,
+		})
+	}
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("request passwordless login: failed to send code: %v", err))
+		return fmt.Errorf("request passwordless login: failed to send code: %w", err)
+	}
+	return nil
+}
+
+// LoginWithCode exchanges a code or link token for a token pair, or an MFA
+// challenge, exactly as a password login would. Wrong codes count towards the login throttle of the
+// email or phone number and of the client IP address.
+func (svc passwordlessService) LoginWithCode(ctx context.Context, login domain.PasswordlessLogin) (*domain.LoginResult, error) {
+	recipient, err := passwordlessRecipient(login.Email, login.PhoneNumber)
+	if err != nil {
+		return nil, err
+	}
+	if err := svc.loginThrottle.CheckLogin(ctx, recipient, login.IPAddress); err != nil {
+		svc.logger.Warning(fmt.Sprintf("passwordless login: throttled login for %s from %s", recipient, login.IPAddress))
+		return nil, err
+	}
+
+	user, err := svc.findUser(ctx, login.Email, recipient)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		svc.logger.Error(fmt.Sprintf("passwordless login: failed to get user: %v", err))
+		return nil, fmt.Errorf("passwordless login: failed to get user: %w", err)
+	}
+	if user != nil {
+		err = svc.codes.verify(ctx, user.UserId, domain.OneTimeCodePasswordlessLogin, recipient, login.Code)
+	}
+	if user == nil || errors.Is(err, domain.ErrInvalidOneTimeCode) {
+		svc.logger.Warning(fmt.Sprintf("passwordless login: failed login for %s from %s", recipient, login.IPAddress))
+		if err := svc.loginThrottle.RecordLoginFailure(ctx, recipient, login.IPAddress); err != nil {
+			return nil, err
+		}
+		return nil, domain.ErrInvalidOneTimeCode
+	}
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("passwordless login: %v", err))
+		return nil, fmt.Errorf("passwordless login: %w", err)
+	}
+
+	// Codes sent to a phone number are throttled by the number, which a second
+	// factor does not share. The account's attempts are cleared by BeginLogin.
+	if login.Email == "" {
+		if err := svc.loginThrottle.RecordLoginSuccess(ctx, recipient, login.IPAddress); err != nil {
+			return nil, err
+		}
+	}
+	if svc.emailPolicy == domain.EmailVerificationRequired && !user.EmailVerified() {
+		return nil, domain.ErrEmailNotVerified
+	}
+	return svc.mfaService.BeginLogin(ctx, *user, domain.Device{IPAddress: login.IPAddress, UserAgent: login.UserAgent})
+}
+
+// findUser returns the user who verified the email address or phone number.
+// Users who have not verified it are reported as not found.
+func (svc passwordlessService) findUser(ctx context.Context, email, recipient string) (*domain.User, error) {
+	if email == "" {
+		return svc.userRepo.GetUserByVerifiedPhoneNumber(ctx, recipient)
+	}
+	user, err := svc.userRepo.GetUserByEmail(ctx, recipient)
+	if err != nil {
+		return nil, err
+	}
+	if !user.EmailVerified() {
+		return nil, domain.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (svc passwordlessService) loginLink(request domain.PasswordlessRequest, token string) string {
+	query := url.Values{}
+	if request.Email != "" {
+		query.Set("email", request.Email)
+	} else {
+		query.Set("phone_number", request.PhoneNumber)
+	}
+	query.Set("code", token)
+	return svc.linkURL + "?" + query.Encode()
+}
+
+// passwordlessRecipient returns the email address, or the phone number in
+// E.164 form, that a passwordless login is for.
+func passwordlessRecipient(email, phoneNumber string) (string, error) {
+	if (email == "") == (phoneNumber == "") {
+		return "", domain.ErrEmailOrPhoneRequired
+	}
+	if email != "" {
+		return email, nil
+	}
+	return domain.NormalizePhoneNumber(phoneNumber)
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AntonyIS/usafi-hub-user-service/config"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/logger"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/repository"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+)
+
+func TestPasswordlessService(t *testing.T) {
+	requireDatabase(t)
+	logger, err := logger.NewDefaultLogger()
+	if err != nil {
+		panic(err)
+	}
+
+	config, err := config.NewConfig(logger)
+	if err != nil {
+		panic(err)
+	}
+
+	db, _ := repository.NewPostgresDB(*config)
+	factory := repository.NewRepositoryFactory(db, *config)
+	ctx := context.Background()
+	userRepo := factory.UserRepository()
+	tokenRepo := factory.TokenRepository()
+	revocationRepo := factory.RevocationRepository()
+	userRoleRepo := factory.UserRoleRepository()
+	notifier := &recordingNotifier{}
+	sms := &recordingSMSSender{}
+
+	tokenService := NewTokenService(tokenRepo, revocationRepo, factory.SessionRepository(), userRepo, userRoleRepo, logger, newTestKeyRing(factory.SigningKeyRepository(), *config, logger), config.ACCESS_TOKEN_TTL, config.REFRESH_TOKEN_TTL)
+	loginThrottle := newTestLoginThrottle(factory.LoginAttemptRepository(), *config, logger)
+	mfaService := newTestMFAService(userRepo, factory.MFARepository(), tokenService, loginThrottle, *config, logger)
+	userService := NewUserService(userRepo, factory.UserRoleRepository(), tokenService, mfaService, newTestPasswordPolicy(*config, logger), loginThrottle, domain.EmailVerificationOptional, logger)
+	passwordlessService := NewPasswordlessService(userRepo, factory.OneTimeCodeRepository(), mfaService, loginThrottle, notifier, sms, domain.EmailVerificationOptional, logger, domain.OneTimeCodeRules{
+		Length:      config.OTP_LENGTH,
+		TTL:         config.PASSWORDLESS_TTL,
+		MaxAttempts: config.OTP_MAX_ATTEMPTS,
+	}, []byte(config.SECRET_KEY), config.PASSWORDLESS_LINK_URL)
+
+	user, err := userService.CreateUser(ctx, domain.User{
+		Username:     "passwordless_doe",
+		PasswordHash: "Passwordless_Password1",
+		Email:        "passwordless.doe@example.com",
+		FullName:     "Passwordless Doe",
+		PhoneNumber:  "0733 000 111",
+	})
+	if err != nil {
+		t.Fatalf("error adding user: %v", err)
+	}
+	defer userService.DeleteUser(ctx, user.UserId)
+
+	t.Run("Testing nothing is sent to unverified addresses", func(t *testing.T) {
+		err := passwordlessService.RequestPasswordlessLogin(ctx, domain.PasswordlessRequest{Email: user.Email, Method: domain.PasswordlessCode})
+		if err != nil {
+			t.Fatalf("expected no error for an unverified email, got %v", err)
+		}
+		err = passwordlessService.RequestPasswordlessLogin(ctx, domain.PasswordlessRequest{PhoneNumber: user.PhoneNumber, Method: domain.PasswordlessCode})
+		if err != nil {
+			t.Fatalf("expected no error for an unverified phone number, got %v", err)
+		}
+		if len(notifier.notifications) != 0 || len(sms.messages) != 0 {
+			t.Errorf("expected nothing to be sent, got %d emails and %d texts", len(notifier.notifications), len(sms.messages))
+		}
+	})
+
+	if err := userRepo.MarkEmailVerified(ctx, user.UserId, user.Email, time.Now()); err != nil {
+		t.Fatalf("error verifying email: %v", err)
+	}
+	if err := userRepo.MarkPhoneVerified(ctx, user.UserId, user.PhoneNumber, time.Now()); err != nil {
+		t.Fatalf("error verifying phone number: %v", err)
+	}
+
+	t.Run("Testing login with a code texted to the phone", func(t *testing.T) {
+		err := passwordlessService.RequestPasswordlessLogin(ctx, domain.PasswordlessRequest{PhoneNumber: "0733000111", Method: domain.PasswordlessCode})
+		if err != nil {
+			t.Fatalf("error requesting passwordless login: %v", err)
+		}
+		code := sms.lastCode()
+		if code == "" {
+			t.Fatal("expected a login code in the text message")
+		}
+
+		tokens, err := passwordlessService.LoginWithCode(ctx, domain.PasswordlessLogin{PhoneNumber: "+254733000111", Code: code})
+		if err != nil {
+			t.Fatalf("error logging in with code: %v", err)
+		}
+		claims, err := tokenService.ValidateAccessToken(ctx, tokens.AccessToken)
+		if err != nil || claims.UserId != user.UserId {
+			t.Errorf("expected an access token for %s, got %+v: %v", user.UserId, claims, err)
+		}
+
+		_, err = passwordlessService.LoginWithCode(ctx, domain.PasswordlessLogin{PhoneNumber: "+254733000111", Code: code})
+		if !errors.Is(err, domain.ErrInvalidOneTimeCode) {
+			t.Errorf("expected a used code to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("Testing login with an emailed link", func(t *testing.T) {
+		err := passwordlessService.RequestPasswordlessLogin(ctx, domain.PasswordlessRequest{Email: user.Email, Method: domain.PasswordlessLink})
+		if err != nil {
+			t.Fatalf("error requesting passwordless login: %v", err)
+		}
+		if len(notifier.notifications) != 1 {
+			t.Fatalf("expected one email, got %d", len(notifier.notifications))
+		}
+		message := notifier.notifications[0].Message
+		link, err := url.Parse(message[strings.Index(message, config.PASSWORDLESS_LINK_URL):])
+		if err != nil {
+			t.Fatalf("error parsing login link: %v", err)
+		}
+		if link.Query().Get("email") != user.Email {
+			t.Errorf("expected link for %s, got %s", user.Email, link)
+		}
+
+		_, err = passwordlessService.LoginWithCode(ctx, domain.PasswordlessLogin{PhoneNumber: user.PhoneNumber, Code: link.Query().Get("code")})
+		if !errors.Is(err, domain.ErrInvalidOneTimeCode) {
+			t.Errorf("expected an emailed link not to work for the phone number, got %v", err)
+		}
+		if _, err := passwordlessService.LoginWithCode(ctx, domain.PasswordlessLogin{Email: user.Email, Code: link.Query().Get("code")}); err != nil {
+			t.Errorf("error logging in with link: %v", err)
+		}
+	})
+
+	t.Run("Testing requests need exactly one address", func(t *testing.T) {
+		err := passwordlessService.RequestPasswordlessLogin(ctx, domain.PasswordlessRequest{Email: user.Email, PhoneNumber: user.PhoneNumber, Method: domain.PasswordlessCode})
+		if !errors.Is(err, domain.ErrEmailOrPhoneRequired) {
+			t.Errorf("expected ErrEmailOrPhoneRequired, got %v", err)
+		}
+		_, err = passwordlessService.LoginWithCode(ctx, domain.PasswordlessLogin{Code: "123456"})
+		if !errors.Is(err, domain.ErrEmailOrPhoneRequired) {
+			t.Errorf("expected ErrEmailOrPhoneRequired, got %v", err)
+		}
+	})
+}
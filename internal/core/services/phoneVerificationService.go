@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
+)
+
+type phoneVerificationService struct {
+	userRepo ports.UserRepository
+	codes    oneTimeCodes
+	sms      ports.SMSSender
+	logger   ports.LoggerService
+}
+
+func NewPhoneVerificationService(userRepo ports.UserRepository, codeRepo ports.OneTimeCodeRepository, sms ports.SMSSender, logger ports.LoggerService, rules domain.OneTimeCodeRules, secret []byte) *phoneVerificationService {
+	service := phoneVerificationService{
+		userRepo: userRepo,
+		codes:    newOneTimeCodes(codeRepo, rules, secret),
+		sms:      sms,
+		logger:   logger,
+	}
+	return &service
+}
+
+// RequestPhoneVerification texts the user a code for their current phone number.
+func (svc phoneVerificationService) RequestPhoneVerification(ctx context.Context, userId string) error {
+	user, err := svc.userRepo.GetUserById(ctx, userId)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("request phone verification: failed to get user: %v", err))
+		return fmt.Errorf("request phone verification: failed to get user: %w", err)
+	}
+	if user.PhoneNumber == "" {
+		return domain.ErrPhoneNumberRequired
+	}
+
+	code, err := svc.codes.issue(ctx, user.UserId, domain.OneTimeCodePhoneVerification, user.PhoneNumber)
+	if err != nil {
+		svc.logger.Warning(fmt.Sprintf("request phone verification: %v", err))
+		return err
+	}
+
+	err = svc.sms.SendSMS(domain.SMSMessage{
+		PhoneNumber: user.PhoneNumber,
+		Message:     fmt.Sprintf("Your UsafiHub verification code is %s. It expires in %s.", code, svc.codes.rules.TTL),
+	})
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("request phone verification: failed to send sms: %v", err))
+		return fmt.Errorf("request phone verification: failed to send sms: %w", err)
+	}
+	return nil
+}
+
+// VerifyPhone checks the code texted to the user and marks their phone number
+// as verified. Codes sent to a number the user has since changed are rejected.
+func (svc phoneVerificationService) VerifyPhone(ctx context.Context, userId, code string) (*domain.User, error) {
+	user, err := svc.userRepo.GetUserById(ctx, userId)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("verify phone: failed to get user: %v", err))
+		return nil, fmt.Errorf("verify phone: failed to get user: %w", err)
+	}
+
+	err = svc.codes.verify(ctx, user.UserId, domain.OneTimeCodePhoneVerification, user.PhoneNumber, code)
+	if err != nil {
+		svc.logger.Warning(fmt.Sprintf("verify phone: %v", err))
+		return nil, err
+	}
+
+	verifiedAt := time.Now()
+	err = svc.userRepo.MarkPhoneVerified(ctx, user.UserId, user.PhoneNumber, verifiedAt)
+	if errors.Is(err, domain.ErrAlreadyExists) {
+		return nil, domain.ErrPhoneNumberInUse
+	}
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("verify phone: failed to mark phone verified: %v", err))
+		return nil, fmt.Errorf("verify phone: failed to mark phone verified: %w", err)
+	}
+	user.PhoneVerifiedAt = &verifiedAt
+	return user, nil
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AntonyIS/usafi-hub-user-service/config"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/logger"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/repository"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+)
+
+type recordingSMSSender struct {
+	messages []domain.SMSMessage
+}
+
+func (s *recordingSMSSender) SendSMS(message domain.SMSMessage) error {
+	s.messages = append(s.messages, message)
+	return nil
+}
+
+// lastCode returns the first run of digits in the last message sent.
+func (s *recordingSMSSender) lastCode() string {
+	if len(s.messages) == 0 {
+		return ""
+	}
+	fields := strings.FieldsFunc(s.messages[len(s.messages)-1].Message, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+func TestPhoneVerificationService(t *testing.T) {
+	requireDatabase(t)
+	logger, err := logger.NewDefaultLogger()
+	if err != nil {
+		panic(err)
+	}
+
+	config, err := config.NewConfig(logger)
+	if err != nil {
+		panic(err)
+	}
+
+	db, _ := repository.NewPostgresDB(*config)
+	factory := repository.NewRepositoryFactory(db, *config)
+	ctx := context.Background()
+	userRepo := factory.UserRepository()
+	tokenRepo := factory.TokenRepository()
+	revocationRepo := factory.RevocationRepository()
+	userRoleRepo := factory.UserRoleRepository()
+	sms := &recordingSMSSender{}
+
+	tokenService := NewTokenService(tokenRepo, revocationRepo, factory.SessionRepository(), userRepo, userRoleRepo, logger, newTestKeyRing(factory.SigningKeyRepository(), *config, logger), config.ACCESS_TOKEN_TTL, config.REFRESH_TOKEN_TTL)
+	loginThrottle := newTestLoginThrottle(factory.LoginAttemptRepository(), *config, logger)
+	mfaService := newTestMFAService(userRepo, factory.MFARepository(), tokenService, loginThrottle, *config, logger)
+	userService := NewUserService(userRepo, factory.UserRoleRepository(), tokenService, mfaService, newTestPasswordPolicy(*config, logger), loginThrottle, domain.EmailVerificationOptional, logger)
+	verificationService := NewPhoneVerificationService(userRepo, factory.OneTimeCodeRepository(), sms, logger, domain.OneTimeCodeRules{
+		Length:      config.OTP_LENGTH,
+		TTL:         config.OTP_TTL,
+		MaxAttempts: config.OTP_MAX_ATTEMPTS,
+	}, []byte(config.SECRET_KEY))
+
+	user, err := userService.CreateUser(ctx, domain.User{
+		Username:     "phone_doe",
+		PasswordHash: "Phone_Password1",
+		Email:        "phone.doe@example.com",
+		FullName:     "Phone Doe",
+		PhoneNumber:  "0722 000 111",
+	})
+	if err != nil {
+		t.Fatalf("error adding user: %v", err)
+	}
+	defer userService.DeleteUser(ctx, user.UserId)
+
+	t.Run("Testing VerifyPhone", func(t *testing.T) {
+		if err := verificationService.RequestPhoneVerification(ctx, user.UserId); err != nil {
+			t.Fatalf("error requesting phone verification: %v", err)
+		}
+		if len(sms.messages) != 1 || sms.messages[0].PhoneNumber != "+254722000111" {
+			t.Fatalf("expected a code texted to +254722000111, got %+v", sms.messages)
+		}
+
+		if _, err := verificationService.VerifyPhone(ctx, user.UserId, "not-the-code"); !errors.Is(err, domain.ErrInvalidOneTimeCode) {
+			t.Errorf("expected ErrInvalidOneTimeCode, got %v", err)
+		}
+
+		verified, err := verificationService.VerifyPhone(ctx, user.UserId, sms.lastCode())
+		if err != nil {
+			t.Fatalf("error verifying phone: %v", err)
+		}
+		if !verified.PhoneVerified() {
+			t.Errorf("expected phone number to be verified")
+		}
+	})
+
+	t.Run("Testing changing the phone number clears its verification", func(t *testing.T) {
+		dbUser, err := userService.GetUserById(ctx, user.UserId)
+		if err != nil {
+			t.Fatalf("error getting user: %v", err)
+		}
+		if !dbUser.PhoneVerified() {
+			t.Fatalf("expected phone number to be verified")
+		}
+
+		dbUser.PhoneNumber = "+254 722 000 112"
+		dbUser.UpdatedAt = time.Now()
+		dbUser, err = userService.UpdateUser(ctx, *dbUser)
+		if err != nil {
+			t.Fatalf("error updating user: %v", err)
+		}
+		if dbUser.PhoneNumber != "+254722000112" || dbUser.PhoneVerified() {
+			t.Errorf("expected new unverified phone number +254722000112, got %s verified at %v", dbUser.PhoneNumber, dbUser.PhoneVerifiedAt)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
 	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
 	"github.com/google/uuid"
@@ -17,23 +18,49 @@ func NewRoleService(repo ports.RoleRepository) *roleService {
 	return &service
 }
 
-func (svc roleService) CreateRole(role domain.Role) (*domain.Role, error) {
+func (svc roleService) CreateRole(ctx context.Context, role domain.Role) (*domain.Role, error) {
 	role.RoleId = uuid.New().String()
-	return svc.repo.CreateRole(role)
+	return svc.repo.CreateRole(ctx, role)
 }
 
-func (svc roleService) GetRoleById(roleId string) (*domain.Role, error) {
-	return svc.repo.GetRoleById(roleId)
+func (svc roleService) GetRoleById(ctx context.Context, roleId string) (*domain.Role, error) {
+	return svc.repo.GetRoleById(ctx, roleId)
 }
 
-func (svc roleService) GetRoles() ([]*domain.Role, error) {
-	return svc.repo.GetRoles()
+func (svc roleService) GetRoles(ctx context.Context) ([]*domain.Role, error) {
+	return svc.repo.GetRoles(ctx)
 }
 
-func (svc roleService) UpdateRole(role domain.Role) error {
-	return svc.repo.UpdateRole(role)
+func (svc roleService) UpdateRole(ctx context.Context, role domain.Role) error {
+	return svc.repo.UpdateRole(ctx, role)
 }
 
-func (svc roleService) DeleteRole(roleId string) error {
-	return svc.repo.DeleteRole(roleId)
+func (svc roleService) DeleteRole(ctx context.Context, roleId string) error {
+	return svc.repo.DeleteRole(ctx, roleId)
+}
+
+func (svc roleService) CreatePermission(ctx context.Context, permission domain.Permission) (*domain.Permission, error) {
+	permission.PermissionId = uuid.New().String()
+	return svc.repo.CreatePermission(ctx, permission)
+}
+
+func (svc roleService) GetPermissions(ctx context.Context) ([]*domain.Permission, error) {
+	return svc.repo.GetPermissions(ctx)
+}
+
+func (svc roleService) GetRolePermissions(ctx context.Context, roleId string) ([]*domain.Permission, error) {
+	return svc.repo.GetRolePermissions(ctx, roleId)
+}
+
+func (svc roleService) GrantPermission(ctx context.Context, rolePermission domain.RolePermission) error {
+	return svc.repo.GrantPermission(ctx, rolePermission)
+}
+
+func (svc roleService) RevokePermission(ctx context.Context, rolePermission domain.RolePermission) error {
+	return svc.repo.RevokePermission(ctx, rolePermission)
+}
+
+// GetUserPermissions returns the names of every permission granted to any of the user's roles.
+func (svc roleService) GetUserPermissions(ctx context.Context, userId string) ([]string, error) {
+	return svc.repo.GetUserPermissions(ctx, userId)
 }
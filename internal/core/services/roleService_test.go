@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"testing"
 
 	"github.com/AntonyIS/usafi-hub-user-service/config"
@@ -10,6 +11,7 @@ import (
 )
 
 func TestRoleService(t *testing.T) {
+	requireDatabase(t)
 	logger, err := logger.NewDefaultLogger()
 	if err != nil {
 		panic(err)
@@ -20,7 +22,10 @@ func TestRoleService(t *testing.T) {
 		panic(err)
 	}
 
-	roleRepo, _ := repository.NewRolePostgresClient(*config)
+	db, _ := repository.NewPostgresDB(*config)
+	factory := repository.NewRepositoryFactory(db, *config)
+	ctx := context.Background()
+	roleRepo := factory.RoleRepository()
 	roleService := NewRoleService(roleRepo)
 
 	t.Run("Testing CreateRole", func(t *testing.T) {
@@ -29,7 +34,7 @@ func TestRoleService(t *testing.T) {
 			Description: "UsafiHub Customer",
 		}
 
-		newRole, err := roleService.CreateRole(role)
+		newRole, err := roleService.CreateRole(ctx, role)
 		if err != nil {
 			t.Errorf("error adding role: %v", err)
 		}
@@ -44,12 +49,12 @@ func TestRoleService(t *testing.T) {
 	})
 
 	t.Run("Testing GetRoleById", func(t *testing.T) {
-		roles, err := roleService.GetRoles()
+		roles, err := roleService.GetRoles(ctx)
 		if err != nil {
 			t.Errorf("error reading roles: %v", err)
 		}
 		roleId := roles[0].RoleId
-		dbRole, err := roleService.GetRoleById(roleId)
+		dbRole, err := roleService.GetRoleById(ctx, roleId)
 		if err != nil {
 			t.Errorf("error reading role: %v", err)
 		}
@@ -59,7 +64,7 @@ func TestRoleService(t *testing.T) {
 	})
 
 	t.Run("Testing GetRoles", func(t *testing.T) {
-		roles, err := roleService.GetRoles()
+		roles, err := roleService.GetRoles(ctx)
 		if err != nil {
 			t.Errorf("error reading roles: %v", err)
 		}
@@ -74,7 +79,7 @@ func TestRoleService(t *testing.T) {
 	})
 
 	t.Run("Testing UpdateRole", func(t *testing.T) {
-		roles, err := roleService.GetRoles()
+		roles, err := roleService.GetRoles(ctx)
 		if err != nil {
 			t.Errorf("error reading roles: %v", err)
 		}
@@ -89,13 +94,13 @@ func TestRoleService(t *testing.T) {
 		role := roles[0]
 		roleId := role.RoleId
 		role.Name = "Administrator"
-		err = roleService.UpdateRole(*role)
+		err = roleService.UpdateRole(ctx, *role)
 
 		if err != nil {
 			t.Errorf("error updating role: %v", err)
 		}
 
-		dbRole, err := roleService.GetRoleById(roleId)
+		dbRole, err := roleService.GetRoleById(ctx, roleId)
 
 		if err != nil {
 			t.Errorf("error reading role while updating: %v", err)
@@ -108,7 +113,7 @@ func TestRoleService(t *testing.T) {
 	})
 
 	t.Run("Testing deleting role", func(t *testing.T) {
-		roles, err := roleService.GetRoles()
+		roles, err := roleService.GetRoles(ctx)
 		if err != nil {
 			t.Errorf("error reading roles: %v", err)
 		}
@@ -123,12 +128,12 @@ func TestRoleService(t *testing.T) {
 		role := roles[0]
 		roleId := role.RoleId
 
-		err = roleService.DeleteRole(roleId)
+		err = roleService.DeleteRole(ctx, roleId)
 		if err != nil {
 			t.Errorf("error deleting role: %v", err)
 		}
 
-		dbRole, err := roleService.GetRoleById(roleId)
+		dbRole, err := roleService.GetRoleById(ctx, roleId)
 		if err == nil {
 			t.Errorf("error reading role: %v", err)
 		}
@@ -138,3 +143,75 @@ func TestRoleService(t *testing.T) {
 
 	})
 }
+
+func TestRolePermissions(t *testing.T) {
+	requireDatabase(t)
+	logger, err := logger.NewDefaultLogger()
+	if err != nil {
+		panic(err)
+	}
+
+	config, err := config.NewConfig(logger)
+	if err != nil {
+		panic(err)
+	}
+
+	db, _ := repository.NewPostgresDB(*config)
+	factory := repository.NewRepositoryFactory(db, *config)
+	ctx := context.Background()
+	roleRepo := factory.RoleRepository()
+	roleService := NewRoleService(roleRepo)
+
+	role, err := roleService.CreateRole(ctx, domain.Role{
+		Name:        "Dispatcher",
+		Description: "UsafiHub Dispatcher",
+	})
+	if err != nil {
+		t.Fatalf("error adding role: %v", err)
+	}
+	defer roleService.DeleteRole(ctx, role.RoleId)
+
+	permission, err := roleService.CreatePermission(ctx, domain.Permission{
+		Name:        domain.PermissionUsersRead,
+		Description: "Read user profiles",
+	})
+	if err != nil {
+		t.Fatalf("error adding permission: %v", err)
+	}
+
+	t.Run("Testing GrantPermission", func(t *testing.T) {
+		err := roleService.GrantPermission(ctx, domain.RolePermission{
+			RoleId:       role.RoleId,
+			PermissionId: permission.PermissionId,
+		})
+		if err != nil {
+			t.Errorf("error granting permission: %v", err)
+		}
+
+		permissions, err := roleService.GetRolePermissions(ctx, role.RoleId)
+		if err != nil {
+			t.Errorf("error reading role permissions: %v", err)
+		}
+		if len(permissions) != 1 || permissions[0].Name != domain.PermissionUsersRead {
+			t.Errorf("expected role to have permission %s, got %v", domain.PermissionUsersRead, permissions)
+		}
+	})
+
+	t.Run("Testing RevokePermission", func(t *testing.T) {
+		err := roleService.RevokePermission(ctx, domain.RolePermission{
+			RoleId:       role.RoleId,
+			PermissionId: permission.PermissionId,
+		})
+		if err != nil {
+			t.Errorf("error revoking permission: %v", err)
+		}
+
+		permissions, err := roleService.GetRolePermissions(ctx, role.RoleId)
+		if err != nil {
+			t.Errorf("error reading role permissions: %v", err)
+		}
+		if len(permissions) != 0 {
+			t.Errorf("expected role to have no permissions, got %v", permissions)
+		}
+	})
+}
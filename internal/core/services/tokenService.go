@@ -0,0 +1,434 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+)
+
+type tokenService struct {
+	repo           ports.TokenRepository
+	revocationRepo ports.RevocationRepository
+	sessionRepo    ports.SessionRepository
+	userRepo       ports.UserRepository
+	userRoleRepo   ports.UserRoleRepository
+	logger         ports.LoggerService
+	keyRing        ports.KeyRingService
+	accessTTL      time.Duration
+	refreshTTL     time.Duration
+}
+
+func NewTokenService(repo ports.TokenRepository, revocationRepo ports.RevocationRepository, sessionRepo ports.SessionRepository, userRepo ports.UserRepository, userRoleRepo ports.UserRoleRepository, logger ports.LoggerService, keyRing ports.KeyRingService, accessTTL, refreshTTL time.Duration) *tokenService {
+	service := tokenService{
+		repo:           repo,
+		revocationRepo: revocationRepo,
+		sessionRepo:    sessionRepo,
+		userRepo:       userRepo,
+		userRoleRepo:   userRoleRepo,
+		logger:         logger,
+		keyRing:        keyRing,
+		accessTTL:      accessTTL,
+		refreshTTL:     refreshTTL,
+	}
+	return &service
+}
+
+// IssueTokens starts a new session on the device, backed by a new refresh
+// token family, and returns a short-lived access token together with its
+// first refresh token. Access tokens only carry the mfa claim for sessions
+// started with a second factor.
+func (svc tokenService) IssueTokens(ctx context.Context, user domain.User, auth domain.Authentication) (*domain.TokenPair, error) {
+	return svc.IssueScopedTokens(ctx, user, "", auth)
+}
+
+// IssueScopedTokens is IssueTokens for tokens granted to an OAuth client. The
+// scope is carried in the access token and kept across refreshes; an empty
+// scope marks a first-party token.
+func (svc tokenService) IssueScopedTokens(ctx context.Context, user domain.User, scope string, auth domain.Authentication) (*domain.TokenPair, error) {
+	refreshToken, token, err := svc.newRefreshToken(user.UserId, uuid.New().String(), scope)
+	if err != nil {
+		return nil, err
+	}
+	authTime := auth.AuthTime
+	if authTime.IsZero() {
+		authTime = refreshToken.CreatedAt
+	}
+
+	session := domain.Session{
+		SessionId:  refreshToken.FamilyId,
+		UserId:     user.UserId,
+		UserAgent:  auth.UserAgent,
+		IPAddress:  auth.IPAddress,
+		CreatedAt:  refreshToken.CreatedAt,
+		LastSeenAt: refreshToken.CreatedAt,
+		ExpiresAt:  refreshToken.ExpiresAt,
+		MFA:        auth.MFA,
+		ClientId:   auth.ClientId,
+		AuthTime:   authTime,
+	}
+	if err := svc.sessionRepo.CreateSession(ctx, session); err != nil {
+		svc.logger.Error(fmt.Sprintf("issue tokens: failed to store session: %v", err))
+		return nil, fmt.Errorf("issue tokens: failed to store session: %w", err)
+	}
+	if err := svc.repo.CreateRefreshToken(ctx, *refreshToken); err != nil {
+		svc.logger.Error(fmt.Sprintf("issue tokens: failed to store refresh token: %v", err))
+		return nil, fmt.Errorf("issue tokens: failed to store refresh token: %w", err)
+	}
+
+	return svc.newTokenPair(ctx, user, token, scope, session)
+}
+
+// IssueImpersonationToken issues an access token for the user naming the
+// admin acting as them in an act claim (RFC 8693, section 4.1). It comes
+// without a refresh token or session, so the impersonation ends when it
+// expires or is logged out.
+func (svc tokenService) IssueImpersonationToken(ctx context.Context, user domain.User, actor domain.Claims, ttl time.Duration) (*domain.TokenPair, error) {
+	claims, err := svc.accessClaims(ctx, user, ttl)
+	if err != nil {
+		return nil, err
+	}
+	claims["act"] = map[string]interface{}{"sub": actor.UserId}
+	// A second factor is only as good as whoever is really using the token.
+	claims["mfa"] = actor.MFA
+	accessToken, err := svc.keyRing.SignToken(ctx, claims)
+	if err != nil {
+		svc.logger.Error(err.Error())
+		return nil, err
+	}
+
+	return &domain.TokenPair{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(ttl.Seconds()),
+	}, nil
+}
+
+// RefreshTokens exchanges a refresh token for a new token pair. The presented
+// token is revoked on use; presenting it again revokes its whole family.
+// Refreshing also records that the token's session was seen. Only the OAuth
+// client a session was granted to, named by clientId, may refresh it; the
+// first-party apps pass an empty clientId.
+func (svc tokenService) RefreshTokens(ctx context.Context, token, clientId string) (*domain.TokenPair, error) {
+	refreshToken, err := svc.repo.GetRefreshTokenByHash(ctx, hashOpaqueToken(token))
+	if err != nil {
+		svc.logger.Warning(fmt.Sprintf("refresh tokens: unknown refresh token: %v", err))
+		return nil, domain.ErrInvalidRefreshToken
+	}
+
+	session, err := svc.sessionRepo.GetSession(ctx, refreshToken.FamilyId)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, domain.ErrInvalidRefreshToken
+	}
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("refresh tokens: failed to get session: %v", err))
+		return nil, fmt.Errorf("refresh tokens: failed to get session: %w", err)
+	}
+	if session.RevokedAt != nil {
+		return nil, domain.ErrInvalidRefreshToken
+	}
+	if session.ClientId != clientId {
+		svc.logger.Warning(fmt.Sprintf("refresh tokens: session %s was not granted to client %q", session.SessionId, clientId))
+		return nil, domain.ErrInvalidRefreshToken
+	}
+
+	if refreshToken.RevokedAt != nil {
+		return nil, svc.revokeFamily(ctx, refreshToken)
+	}
+
+	if time.Now().After(refreshToken.ExpiresAt) {
+		return nil, domain.ErrInvalidRefreshToken
+	}
+
+	user, err := svc.userRepo.GetUserById(ctx, refreshToken.UserId)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("refresh tokens: failed to get user: %v", err))
+		return nil, domain.ErrInvalidRefreshToken
+	}
+
+	replacement, newToken, err := svc.newRefreshToken(refreshToken.UserId, refreshToken.FamilyId, refreshToken.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	rotated, err := svc.repo.RotateRefreshToken(ctx, refreshToken.TokenId, *replacement)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("refresh tokens: failed to rotate refresh token: %v", err))
+		return nil, fmt.Errorf("refresh tokens: failed to rotate refresh token: %w", err)
+	}
+	if !rotated {
+		return nil, svc.revokeFamily(ctx, refreshToken)
+	}
+	// The tokens are valid either way, so a failed write only costs accuracy.
+	if err := svc.sessionRepo.TouchSession(ctx, refreshToken.FamilyId, replacement.CreatedAt, replacement.ExpiresAt); err != nil {
+		svc.logger.Warning(fmt.Sprintf("refresh tokens: failed to record use of session %s: %v", refreshToken.FamilyId, err))
+	}
+
+	return svc.newTokenPair(ctx, *user, newToken, refreshToken.Scope, *session)
+}
+
+// ValidateAccessToken verifies the signature and expiry of an access token
+// and rejects tokens that have been revoked individually, with their session
+// or by a user-wide logout.
+func (svc tokenService) ValidateAccessToken(ctx context.Context, accessToken string) (*domain.Claims, error) {
+	mapClaims, err := svc.keyRing.ParseToken(ctx, accessToken)
+	if err != nil {
+		svc.logger.Warning(fmt.Sprintf("validate access token: %v", err))
+		return nil, domain.ErrInvalidAccessToken
+	}
+	claims, err := claimsFromMap(mapClaims)
+	if err != nil {
+		svc.logger.Warning(fmt.Sprintf("validate access token: %v", err))
+		return nil, domain.ErrInvalidAccessToken
+	}
+
+	revoked, err := svc.revocationRepo.IsTokenRevoked(ctx, claims.TokenId)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("validate access token: failed to check revocation: %v", err))
+		return nil, fmt.Errorf("validate access token: failed to check revocation: %w", err)
+	}
+	if revoked {
+		return nil, domain.ErrTokenRevoked
+	}
+
+	revokedAt, err := svc.revocationRepo.GetUserTokensRevokedAt(ctx, claims.UserId)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("validate access token: failed to check user revocation: %v", err))
+		return nil, fmt.Errorf("validate access token: failed to check user revocation: %w", err)
+	}
+	if revokedAt != nil && !claims.IssuedAt.After(*revokedAt) {
+		return nil, domain.ErrTokenRevoked
+	}
+
+	// Tokens issued before sessions were recorded name no session.
+	if claims.SessionId != "" {
+		revoked, err := svc.revocationRepo.IsSessionRevoked(ctx, claims.SessionId)
+		if err != nil {
+			svc.logger.Error(fmt.Sprintf("validate access token: failed to check session: %v", err))
+			return nil, fmt.Errorf("validate access token: failed to check session: %w", err)
+		}
+		if revoked {
+			return nil, domain.ErrTokenRevoked
+		}
+	}
+
+	return claims, nil
+}
+
+// Logout revokes the presented access token and ends its session. A refresh
+// token, when supplied, has its family revoked too, which covers tokens issued
+// before sessions were recorded.
+func (svc tokenService) Logout(ctx context.Context, claims domain.Claims, refreshToken string) error {
+	err := svc.revocationRepo.RevokeToken(ctx, domain.RevokedToken{
+		TokenId:   claims.TokenId,
+		UserId:    claims.UserId,
+		ExpiresAt: claims.ExpiresAt,
+		RevokedAt: time.Now(),
+	})
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("logout: failed to revoke access token: %v", err))
+		return fmt.Errorf("logout: failed to revoke access token: %w", err)
+	}
+	if claims.SessionId != "" {
+		if err := svc.endSession(ctx, claims.SessionId); err != nil {
+			svc.logger.Error(fmt.Sprintf("logout: %v", err))
+			return fmt.Errorf("logout: %w", err)
+		}
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+	storedToken, err := svc.repo.GetRefreshTokenByHash(ctx, hashOpaqueToken(refreshToken))
+	if err != nil || storedToken.UserId != claims.UserId {
+		svc.logger.Warning(fmt.Sprintf("logout: ignoring unknown refresh token for user %s", claims.UserId))
+		return nil
+	}
+	if err := svc.repo.RevokeRefreshTokenFamily(ctx, storedToken.FamilyId); err != nil {
+		svc.logger.Error(fmt.Sprintf("logout: failed to revoke refresh token: %v", err))
+		return fmt.Errorf("logout: failed to revoke refresh token: %w", err)
+	}
+	return nil
+}
+
+// LogoutEverywhere revokes every access and refresh token issued to the user
+// so far, ending all of their sessions.
+func (svc tokenService) LogoutEverywhere(ctx context.Context, userId string) error {
+	// Access tokens record when they were issued to the microsecond, which is
+	// also all the database keeps.
+	if err := svc.revocationRepo.RevokeUserTokens(ctx, userId, time.Now().Truncate(time.Microsecond)); err != nil {
+		svc.logger.Error(fmt.Sprintf("logout everywhere: failed to revoke access tokens: %v", err))
+		return fmt.Errorf("logout everywhere: failed to revoke access tokens: %w", err)
+	}
+	if err := svc.repo.RevokeUserRefreshTokens(ctx, userId); err != nil {
+		svc.logger.Error(fmt.Sprintf("logout everywhere: failed to revoke refresh tokens: %v", err))
+		return fmt.Errorf("logout everywhere: failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// GetSessions lists the user's sessions that have not ended.
+func (svc tokenService) GetSessions(ctx context.Context, userId string) ([]*domain.Session, error) {
+	sessions, err := svc.sessionRepo.GetSessions(ctx, userId, time.Now())
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("get sessions: %v", err))
+		return nil, fmt.Errorf("get sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// RevokeSession ends one of the user's sessions. Its refresh tokens stop
+// working and its access tokens are refused from the next request on.
+func (svc tokenService) RevokeSession(ctx context.Context, userId, sessionId string) error {
+	session, err := svc.sessionRepo.GetSession(ctx, sessionId)
+	if errors.Is(err, domain.ErrNotFound) || (err == nil && session.UserId != userId) {
+		return domain.ErrSessionNotFound
+	}
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("revoke session: failed to get session: %v", err))
+		return fmt.Errorf("revoke session: failed to get session: %w", err)
+	}
+	if err := svc.endSession(ctx, sessionId); err != nil {
+		svc.logger.Error(fmt.Sprintf("revoke session: %v", err))
+		return fmt.Errorf("revoke session: %w", err)
+	}
+	return nil
+}
+
+// endSession revokes the session and the refresh token family behind it.
+func (svc tokenService) endSession(ctx context.Context, sessionId string) error {
+	if err := svc.revocationRepo.RevokeSession(ctx, sessionId, time.Now()); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if err := svc.repo.RevokeRefreshTokenFamily(ctx, sessionId); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// revokeFamily ends the session of a refresh token that was presented again,
+// since either its holder or whoever copied it is not the legitimate user.
+func (svc tokenService) revokeFamily(ctx context.Context, refreshToken *domain.RefreshToken) error {
+	svc.logger.Warning(fmt.Sprintf("refresh tokens: reuse detected for family %s of user %s", refreshToken.FamilyId, refreshToken.UserId))
+	if err := svc.endSession(ctx, refreshToken.FamilyId); err != nil {
+		svc.logger.Error(fmt.Sprintf("refresh tokens: failed to revoke family: %v", err))
+		return fmt.Errorf("refresh tokens: failed to revoke family: %w", err)
+	}
+	return domain.ErrRefreshTokenReused
+}
+
+func (svc tokenService) newRefreshToken(userId, familyId, scope string) (*domain.RefreshToken, string, error) {
+	token, err := generateOpaqueToken()
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("failed to generate refresh token: %v", err))
+		return nil, "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	now := time.Now()
+	refreshToken := &domain.RefreshToken{
+		TokenId:   uuid.New().String(),
+		FamilyId:  familyId,
+		UserId:    userId,
+		TokenHash: hashOpaqueToken(token),
+		ExpiresAt: now.Add(svc.refreshTTL),
+		CreatedAt: now,
+		Scope:     scope,
+	}
+	return refreshToken, token, nil
+}
+
+func (svc tokenService) newTokenPair(ctx context.Context, user domain.User, refreshToken, scope string, session domain.Session) (*domain.TokenPair, error) {
+	claims, err := svc.accessClaims(ctx, user, svc.accessTTL)
+	if err != nil {
+		return nil, err
+	}
+	claims["sid"] = session.SessionId
+	claims["mfa"] = session.MFA
+	if scope != "" {
+		claims["scope"] = scope
+	}
+	accessToken, err := svc.keyRing.SignToken(ctx, claims)
+	if err != nil {
+		svc.logger.Error(err.Error())
+		return nil, err
+	}
+
+	return &domain.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(svc.accessTTL.Seconds()),
+	}, nil
+}
+
+// accessClaims returns the claims of an access token for the user that
+// expires after ttl.
+func (svc tokenService) accessClaims(ctx context.Context, user domain.User, ttl time.Duration) (jwt.MapClaims, error) {
+	roles, err := svc.userRoleRepo.GetUserRoles(ctx, user.UserId)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("failed to get user roles: %v", err))
+		return nil, fmt.Errorf("failed to get user roles: %w", err)
+	}
+	roleNames := []string{}
+	for _, role := range roles {
+		roleNames = append(roleNames, role.Name)
+	}
+
+	now := time.Now()
+	return jwt.MapClaims{
+		"jti":            uuid.New().String(),
+		"user_id":        user.UserId,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified(),
+		"roles":          roleNames,
+		"iat":            numericDate(now),
+		"exp":            now.Add(ttl).Unix(),
+	}, nil
+}
+
+func claimsFromMap(mapClaims jwt.MapClaims) (*domain.Claims, error) {
+	tokenId, _ := mapClaims["jti"].(string)
+	userId, _ := mapClaims["user_id"].(string)
+	email, _ := mapClaims["email"].(string)
+	emailVerified, _ := mapClaims["email_verified"].(bool)
+	mfa, _ := mapClaims["mfa"].(bool)
+	scope, _ := mapClaims["scope"].(string)
+	sessionId, _ := mapClaims["sid"].(string)
+	actor := ""
+	if act, ok := mapClaims["act"].(map[string]interface{}); ok {
+		actor, _ = act["sub"].(string)
+	}
+	issuedAt, _ := mapClaims["iat"].(float64)
+	expiresAt, _ := mapClaims["exp"].(float64)
+	if tokenId == "" || userId == "" || issuedAt == 0 || expiresAt == 0 {
+		return nil, errors.New("token is missing required claims")
+	}
+
+	roles := []string{}
+	if claimRoles, ok := mapClaims["roles"].([]interface{}); ok {
+		for _, claimRole := range claimRoles {
+			if role, ok := claimRole.(string); ok {
+				roles = append(roles, role)
+			}
+		}
+	}
+
+	return &domain.Claims{
+		TokenId:       tokenId,
+		UserId:        userId,
+		Email:         email,
+		Roles:         roles,
+		EmailVerified: emailVerified,
+		MFA:           mfa,
+		Scope:         scope,
+		SessionId:     sessionId,
+		Actor:         actor,
+		IssuedAt:      timeFromNumericDate(issuedAt),
+		ExpiresAt:     time.Unix(int64(expiresAt), 0),
+	}, nil
+}
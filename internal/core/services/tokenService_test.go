@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/AntonyIS/usafi-hub-user-service/config"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/logger"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/adapter/repository"
+	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
+)
+
+func TestTokenService(t *testing.T) {
+	requireDatabase(t)
+	logger, err := logger.NewDefaultLogger()
+	if err != nil {
+		panic(err)
+	}
+
+	config, err := config.NewConfig(logger)
+	if err != nil {
+		panic(err)
+	}
+
+	db, _ := repository.NewPostgresDB(*config)
+	factory := repository.NewRepositoryFactory(db, *config)
+	ctx := context.Background()
+	userRepo := factory.UserRepository()
+	tokenRepo := factory.TokenRepository()
+	revocationRepo := factory.RevocationRepository()
+	userRoleRepo := factory.UserRoleRepository()
+
+	tokenService := NewTokenService(tokenRepo, revocationRepo, factory.SessionRepository(), userRepo, userRoleRepo, logger, newTestKeyRing(factory.SigningKeyRepository(), *config, logger), config.ACCESS_TOKEN_TTL, config.REFRESH_TOKEN_TTL)
+	loginThrottle := newTestLoginThrottle(factory.LoginAttemptRepository(), *config, logger)
+	mfaService := newTestMFAService(userRepo, factory.MFARepository(), tokenService, loginThrottle, *config, logger)
+	userService := NewUserService(userRepo, factory.UserRoleRepository(), tokenService, mfaService, newTestPasswordPolicy(*config, logger), loginThrottle, domain.EmailVerificationOptional, logger)
+
+	user, err := userService.CreateUser(ctx, domain.User{
+		Username:     "token_doe",
+		PasswordHash: "Token_Password1",
+		Email:        "token.doe@example.com",
+		FullName:     "Token Doe",
+	})
+	if err != nil {
+		t.Fatalf("error adding user: %v", err)
+	}
+	defer userService.DeleteUser(ctx, user.UserId)
+
+	t.Run("Testing LoginUser issues a token pair", func(t *testing.T) {
+		tokens, err := userService.LoginUser(ctx, domain.LoginRequest{Email: user.Email, Password: "Token_Password1"})
+		if err != nil {
+			t.Fatalf("error logging in: %v", err)
+		}
+		if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+			t.Errorf("expected access and refresh tokens, got %+v", tokens)
+		}
+	})
+
+	t.Run("Testing RefreshTokens rotates and detects reuse", func(t *testing.T) {
+		tokens, err := userService.LoginUser(ctx, domain.LoginRequest{Email: user.Email, Password: "Token_Password1"})
+		if err != nil {
+			t.Fatalf("error logging in: %v", err)
+		}
+
+		rotated, err := tokenService.RefreshTokens(ctx, tokens.RefreshToken, "")
+		if err != nil {
+			t.Fatalf("error refreshing tokens: %v", err)
+		}
+		if rotated.RefreshToken == tokens.RefreshToken {
+			t.Error("expected refresh token to be rotated")
+		}
+
+		_, err = tokenService.RefreshTokens(ctx, tokens.RefreshToken, "")
+		if !errors.Is(err, domain.ErrRefreshTokenReused) {
+			t.Errorf("expected reuse to be detected, got %v", err)
+		}
+
+		_, err = tokenService.RefreshTokens(ctx, rotated.RefreshToken, "")
+		if err == nil {
+			t.Error("expected token family to be revoked after reuse")
+		}
+	})
+
+	t.Run("Testing Logout revokes the access token", func(t *testing.T) {
+		tokens, err := userService.LoginUser(ctx, domain.LoginRequest{Email: user.Email, Password: "Token_Password1"})
+		if err != nil {
+			t.Fatalf("error logging in: %v", err)
+		}
+
+		claims, err := tokenService.ValidateAccessToken(ctx, tokens.AccessToken)
+		if err != nil {
+			t.Fatalf("error validating access token: %v", err)
+		}
+
+		if err := tokenService.Logout(ctx, *claims, tokens.RefreshToken); err != nil {
+			t.Fatalf("error logging out: %v", err)
+		}
+
+		_, err = tokenService.ValidateAccessToken(ctx, tokens.AccessToken)
+		if !errors.Is(err, domain.ErrTokenRevoked) {
+			t.Errorf("expected access token to be revoked, got %v", err)
+		}
+
+		_, err = tokenService.RefreshTokens(ctx, tokens.RefreshToken, "")
+		if err == nil {
+			t.Error("expected refresh token to be revoked after logout")
+		}
+	})
+
+	t.Run("Testing RevokeSession invalidates the session's tokens", func(t *testing.T) {
+		tokens, err := userService.LoginUser(ctx, domain.LoginRequest{Email: user.Email, Password: "Token_Password1", IPAddress: "192.0.2.1", UserAgent: "UsafiHub/1.0 (Android)"})
+		if err != nil {
+			t.Fatalf("error logging in: %v", err)
+		}
+		claims, err := tokenService.ValidateAccessToken(ctx, tokens.AccessToken)
+		if err != nil || claims.SessionId == "" {
+			t.Fatalf("expected an access token naming its session, got %+v: %v", claims, err)
+		}
+
+		sessions, err := tokenService.GetSessions(ctx, user.UserId)
+		if err != nil {
+			t.Fatalf("error getting sessions: %v", err)
+		}
+		found := false
+		for _, session := range sessions {
+			if session.SessionId == claims.SessionId {
+				found = session.UserAgent == "UsafiHub/1.0 (Android)" && session.IPAddress == "192.0.2.1"
+			}
+		}
+		if !found {
+			t.Errorf("expected the session to be listed with its device, got %+v", sessions)
+		}
+
+		if err := tokenService.RevokeSession(ctx, "someone-else", claims.SessionId); !errors.Is(err, domain.ErrSessionNotFound) {
+			t.Errorf("expected ErrSessionNotFound for another user's session, got %v", err)
+		}
+		if err := tokenService.RevokeSession(ctx, user.UserId, claims.SessionId); err != nil {
+			t.Fatalf("error revoking session: %v", err)
+		}
+
+		if _, err := tokenService.ValidateAccessToken(ctx, tokens.AccessToken); !errors.Is(err, domain.ErrTokenRevoked) {
+			t.Errorf("expected access token to be revoked, got %v", err)
+		}
+		if _, err := tokenService.RefreshTokens(ctx, tokens.RefreshToken, ""); !errors.Is(err, domain.ErrInvalidRefreshToken) {
+			t.Errorf("expected refresh token to be rejected, got %v", err)
+		}
+		sessions, _ = tokenService.GetSessions(ctx, user.UserId)
+		for _, session := range sessions {
+			if session.SessionId == claims.SessionId {
+				t.Error("expected a revoked session not to be listed")
+			}
+		}
+	})
+
+	t.Run("Testing LogoutEverywhere revokes all tokens", func(t *testing.T) {
+		tokens, err := userService.LoginUser(ctx, domain.LoginRequest{Email: user.Email, Password: "Token_Password1"})
+		if err != nil {
+			t.Fatalf("error logging in: %v", err)
+		}
+
+		if err := tokenService.LogoutEverywhere(ctx, user.UserId); err != nil {
+			t.Fatalf("error logging out everywhere: %v", err)
+		}
+
+		_, err = tokenService.ValidateAccessToken(ctx, tokens.AccessToken)
+		if !errors.Is(err, domain.ErrTokenRevoked) {
+			t.Errorf("expected access token to be revoked, got %v", err)
+		}
+	})
+
+	t.Run("Testing tokens issued right after LogoutEverywhere are accepted", func(t *testing.T) {
+		if err := tokenService.LogoutEverywhere(ctx, user.UserId); err != nil {
+			t.Fatalf("error logging out everywhere: %v", err)
+		}
+		tokens, err := userService.LoginUser(ctx, domain.LoginRequest{Email: user.Email, Password: "Token_Password1"})
+		if err != nil {
+			t.Fatalf("error logging in: %v", err)
+		}
+		if _, err := tokenService.ValidateAccessToken(ctx, tokens.AccessToken); err != nil {
+			t.Errorf("expected a token issued after the logout to be valid, got %v", err)
+		}
+	})
+}
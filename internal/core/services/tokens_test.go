@@ -0,0 +1,67 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpaqueTokens(t *testing.T) {
+	t.Run("Testing generateOpaqueToken", func(t *testing.T) {
+		first, err := generateOpaqueToken()
+		if err != nil {
+			t.Fatalf("error generating token: %v", err)
+		}
+		second, err := generateOpaqueToken()
+		if err != nil {
+			t.Fatalf("error generating token: %v", err)
+		}
+		if first == second {
+			t.Error("expected generated tokens to differ")
+		}
+	})
+
+	t.Run("Testing hashOpaqueToken", func(t *testing.T) {
+		if hashOpaqueToken("token") != hashOpaqueToken("token") {
+			t.Error("expected hashing to be deterministic")
+		}
+		if hashOpaqueToken("token") == "token" {
+			t.Error("expected hash to differ from token")
+		}
+		if len(hashOpaqueToken("token")) != 64 {
+			t.Errorf("expected 64 character digest, got %d", len(hashOpaqueToken("token")))
+		}
+	})
+
+	t.Run("Testing sealSecret and openSecret", func(t *testing.T) {
+		key := deriveKey([]byte("secret"), "test")
+		sealed, err := sealSecret(key, "secret")
+		if err != nil {
+			t.Fatalf("error sealing secret: %v", err)
+		}
+		if strings.Contains(sealed, "secret") {
+			t.Error("expected sealed secret not to contain the secret")
+		}
+		opened, err := openSecret(key, sealed)
+		if err != nil || opened != "secret" {
+			t.Errorf("expected secret, got %s: %v", opened, err)
+		}
+		if _, err := openSecret(deriveKey([]byte("other"), "test"), sealed); err == nil {
+			t.Error("expected opening with the wrong key to fail")
+		}
+	})
+
+	t.Run("Testing numericDate orders tokens within a second", func(t *testing.T) {
+		revokedAt := time.Date(2024, 5, 1, 12, 0, 0, 250*int(time.Millisecond), time.UTC)
+		issuedAt := timeFromNumericDate(numericDate(revokedAt.Add(time.Millisecond)))
+		if !issuedAt.After(revokedAt) {
+			t.Errorf("expected a token issued after the revocation in the same second to be later, got %v", issuedAt)
+		}
+		if !timeFromNumericDate(numericDate(revokedAt)).Equal(revokedAt) {
+			t.Error("expected microsecond dates to round-trip")
+		}
+		if !timeFromNumericDate(float64(revokedAt.Unix())).Equal(revokedAt.Truncate(time.Second)) {
+			t.Error("expected whole-second dates to be read unchanged")
+		}
+	})
+}
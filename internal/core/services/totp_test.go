@@ -0,0 +1,54 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTP(t *testing.T) {
+	// The SHA1 secret from RFC 6238 appendix B, "12345678901234567890".
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	t.Run("Testing totpCode against the RFC 6238 test vectors", func(t *testing.T) {
+		vectors := map[int64]string{
+			59:          "287082",
+			1111111109:  "081804",
+			1111111111:  "050471",
+			1234567890:  "005924",
+			2000000000:  "279037",
+			20000000000: "353130",
+		}
+		for unix, want := range vectors {
+			code, err := totpCode(secret, totpStep(time.Unix(unix, 0)))
+			if err != nil {
+				t.Fatalf("error generating code: %v", err)
+			}
+			if code != want {
+				t.Errorf("expected %s at %d, got %s", want, unix, code)
+			}
+		}
+	})
+
+	t.Run("Testing matchTOTP allows one step of clock drift", func(t *testing.T) {
+		now := time.Unix(1111111111, 0)
+		previous, _ := totpCode(secret, totpStep(now)-1)
+		step, ok, err := matchTOTP(secret, previous, now)
+		if err != nil || !ok || step != totpStep(now)-1 {
+			t.Errorf("expected previous step's code to match, got step %d, %v: %v", step, ok, err)
+		}
+
+		stale, _ := totpCode(secret, totpStep(now)-2)
+		if _, ok, _ := matchTOTP(secret, stale, now); ok {
+			t.Error("expected code from two steps ago to be rejected")
+		}
+	})
+
+	t.Run("Testing totpURI", func(t *testing.T) {
+		uri := totpURI("UsafiHub", "jane@example.com", "ABC")
+		if !strings.HasPrefix(uri, "otpauth://totp/UsafiHub:jane@example.com?") || !strings.Contains(uri, "secret=ABC") || !strings.Contains(uri, "issuer=UsafiHub") {
+			t.Errorf("unexpected otpauth uri %s", uri)
+		}
+	})
+
+}
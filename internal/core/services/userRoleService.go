@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
 	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
 )
@@ -16,10 +17,14 @@ func NewUserRoleService(repo ports.UserRoleRepository) *userRoleService {
 	return &service
 }
 
-func (svc userRoleService) AddUserRole(userRole domain.UserRole) error {
-	return svc.repo.AddUserRole(userRole)
+func (svc userRoleService) AddUserRole(ctx context.Context, userRole domain.UserRole) error {
+	return svc.repo.AddUserRole(ctx, userRole)
 }
 
-func (svc userRoleService) RemoveUserRole(userRole domain.UserRole) error {
-	return svc.repo.RemoveUserRole(userRole)
+func (svc userRoleService) RemoveUserRole(ctx context.Context, userRole domain.UserRole) error {
+	return svc.repo.RemoveUserRole(ctx, userRole)
+}
+
+func (svc userRoleService) GetUserRoles(ctx context.Context, userId string) ([]*domain.Role, error) {
+	return svc.repo.GetUserRoles(ctx, userId)
 }
@@ -1,68 +1,100 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/AntonyIS/usafi-hub-user-service/internal/core/domain"
 	"github.com/AntonyIS/usafi-hub-user-service/internal/core/ports"
-	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type userService struct {
-	repo   ports.UserRepository
-	logger ports.LoggerService
-	jwtKey []byte
+	repo              ports.UserRepository
+	userRoleRepo      ports.UserRoleRepository
+	tokenService      ports.TokenService
+	mfaService        ports.MFAService
+	passwordPolicy    ports.PasswordPolicy
+	loginThrottle     ports.LoginThrottleService
+	emailPolicy       domain.EmailVerificationPolicy
+	logger            ports.LoggerService
+	dummyPasswordHash []byte
 }
 
-func NewUserService(repo ports.UserRepository, logger ports.LoggerService, jwtKey []byte) *userService {
+func NewUserService(repo ports.UserRepository, userRoleRepo ports.UserRoleRepository, tokenService ports.TokenService, mfaService ports.MFAService, passwordPolicy ports.PasswordPolicy, loginThrottle ports.LoginThrottleService, emailPolicy domain.EmailVerificationPolicy, logger ports.LoggerService) *userService {
+	// Logins for unknown emails are checked against this hash so that they take
+	// as long as logins with a wrong password.
+	dummyPasswordHash, _ := bcrypt.GenerateFromPassword([]byte(uuid.New().String()), bcrypt.DefaultCost)
 	service := userService{
-		repo:   repo,
-		logger: logger,
-		jwtKey: jwtKey,
+		repo:              repo,
+		userRoleRepo:      userRoleRepo,
+		tokenService:      tokenService,
+		mfaService:        mfaService,
+		passwordPolicy:    passwordPolicy,
+		loginThrottle:     loginThrottle,
+		emailPolicy:       emailPolicy,
+		logger:            logger,
+		dummyPasswordHash: dummyPasswordHash,
 	}
 	return &service
 }
 
-func (svc userService) LoginUser(email, password string) (string, error) {
-	user, err := svc.GetUserByEmail(email)
+// LoginUser checks the credentials and issues a token pair, or an MFA challenge
+// for users with two-factor authentication enabled. Unknown emails and wrong
+// passwords fail the same way, in about the same time, and both count towards
+// the brute-force limits of the account and the client IP address.
+func (svc userService) LoginUser(ctx context.Context, request domain.LoginRequest) (*domain.LoginResult, error) {
+	if err := svc.loginThrottle.CheckLogin(ctx, request.Email, request.IPAddress); err != nil {
+		svc.logger.Warning(fmt.Sprintf("login: throttled login for %s from %s", request.Email, request.IPAddress))
+		return nil, err
+	}
 
-	if err != nil {
+	user, err := svc.repo.GetUserByEmail(ctx, request.Email)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
 		svc.logger.Error(fmt.Sprintf("Failed to get user: %v", err))
-		return "", err
+		return nil, err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
-
-	if err != nil {
-		svc.logger.Error(fmt.Sprintf("Password comparison error: %v", err))
-		return "", fmt.Errorf("password comparison error: %v", err)
+	passwordHash := svc.dummyPasswordHash
+	if user != nil {
+		passwordHash = []byte(user.PasswordHash)
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.UserId,
-		"email":   user.Email,
-		"exp":     time.Now().Add(time.Hour * 72).Unix(),
-	})
-
-	tokenString, err := token.SignedString(svc.jwtKey)
-	if err != nil {
-		svc.logger.Error(err.Error())
-		return "", err
+	err = bcrypt.CompareHashAndPassword(passwordHash, []byte(request.Password))
+	if user == nil || err != nil {
+		svc.logger.Warning(fmt.Sprintf("login: failed login for %s from %s", request.Email, request.IPAddress))
+		if err := svc.loginThrottle.RecordLoginFailure(ctx, request.Email, request.IPAddress); err != nil {
+			return nil, err
+		}
+		return nil, domain.ErrInvalidLogin
 	}
 
-	return tokenString, nil
+	if svc.emailPolicy == domain.EmailVerificationRequired && !user.EmailVerified() {
+		return nil, domain.ErrEmailNotVerified
+	}
+	return svc.mfaService.BeginLogin(ctx, *user, domain.Device{IPAddress: request.IPAddress, UserAgent: request.UserAgent})
 }
 
-func (svc userService) CreateUser(user domain.User) (*domain.User, error) {
-	dbUser, _ := svc.GetUserByEmail(user.Email)
+func (svc userService) CreateUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	if err := svc.passwordPolicy.Validate(user.PasswordHash, user); err != nil {
+		return nil, err
+	}
+	phoneNumber, err := domain.NormalizePhoneNumber(user.PhoneNumber)
+	if err != nil {
+		return nil, err
+	}
+	user.PhoneNumber = phoneNumber
 
+	dbUser, err := svc.repo.GetUserByEmail(ctx, user.Email)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		svc.logger.Error(fmt.Sprintf("create user : failed to check for existing user: %v", err))
+		return nil, fmt.Errorf("create user: failed to check for existing user: %w", err)
+	}
 	if dbUser != nil {
 		svc.logger.Error("create user : user with email exists")
-		return nil, errors.New("user with email exists")
+		return nil, domain.ErrUserAlreadyExists
 	}
 	user.UserId = uuid.New().String()
 	user.CreatedAt = time.Now()
@@ -70,63 +102,174 @@ func (svc userService) CreateUser(user domain.User) (*domain.User, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(user.PasswordHash), bcrypt.DefaultCost)
 	if err != nil {
 		svc.logger.Error(fmt.Sprintf("create user : failed to hash password: %v", err))
-		return nil, fmt.Errorf("create user: failed to hash password: %v", err)
+		return nil, fmt.Errorf("create user: failed to hash password: %w", err)
 	}
 	user.PasswordHash = string(bytes)
-	return svc.repo.CreateUser(user)
+	return svc.repo.CreateUser(ctx, user)
 }
 
-func (svc userService) GetUserById(userId string) (*domain.User, error) {
-	user, err := svc.repo.GetUserById(userId)
+func (svc userService) GetUserById(ctx context.Context, userId string) (*domain.User, error) {
+	user, err := svc.repo.GetUserById(ctx, userId)
 	if err != nil {
 		svc.logger.Error(fmt.Sprintf("get user by id : failed to get user by id: %v", err))
-		return nil, fmt.Errorf("get user by id : failed to get user by id: %v", err)
+		return nil, fmt.Errorf("get user by id : failed to get user by id: %w", err)
 	}
 	return user, nil
 }
 
-func (svc userService) GetUserByEmail(email string) (*domain.User, error) {
-	user, err := svc.repo.GetUserByEmail(email)
+func (svc userService) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	user, err := svc.repo.GetUserByEmail(ctx, email)
 	if err != nil {
 		svc.logger.Error(fmt.Sprintf("get user by email : failed to get user by email: %v", err))
-		return nil, fmt.Errorf("get user by email : failed to get user by email: %v", err)
+		return nil, fmt.Errorf("get user by email : failed to get user by email: %w", err)
 	}
 	return user, nil
 }
 
-func (svc userService) GetUsers() ([]*domain.User, error) {
-	users, err := svc.repo.GetUsers()
+func (svc userService) GetUsers(ctx context.Context) ([]*domain.User, error) {
+	users, err := svc.repo.GetUsers(ctx)
 	if err != nil {
 		svc.logger.Error(fmt.Sprintf("get users: failed to get users: %v", err))
-		return nil, fmt.Errorf("get users: failed to get users: %v", err)
+		return nil, fmt.Errorf("get users: failed to get users: %w", err)
 	}
 	return users, nil
 }
 
-func (svc userService) GetUsersWithRole(roleName string) ([]*domain.User, error) {
-	users, err := svc.repo.GetUsersWithRole(roleName)
+func (svc userService) GetUsersWithRole(ctx context.Context, roleName string) ([]*domain.User, error) {
+	users, err := svc.repo.GetUsersWithRole(ctx, roleName)
 	if err != nil {
 		svc.logger.Error(fmt.Sprintf("get users with role: failed to get users with role: %v", err))
-		return nil, fmt.Errorf("get users with role: failed to get users with role: %v", err)
+		return nil, fmt.Errorf("get users with role: failed to get users with role: %w", err)
 	}
 	return users, nil
 }
 
-func (svc userService) UpdateUser(user domain.User) (*domain.User, error) {
+func (svc userService) UpdateUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	phoneNumber, err := domain.NormalizePhoneNumber(user.PhoneNumber)
+	if err != nil {
+		return nil, err
+	}
+	user.PhoneNumber = phoneNumber
 	user.UpdatedAt = time.Now()
-	dbUser, err := svc.repo.UpdateUser(user)
+	dbUser, err := svc.repo.UpdateUser(ctx, user)
 	if err != nil {
 		svc.logger.Error(fmt.Sprintf("update user: failed to update user: %v", err))
-		return nil, fmt.Errorf("update user: failed to update user: %v", err)
+		return nil, fmt.Errorf("update user: failed to update user: %w", err)
 	}
 	return dbUser, nil
 }
 
-func (svc userService) DeleteUser(userId string) error {
-	err := svc.repo.DeleteUser(userId)
+func (svc userService) DeleteUser(ctx context.Context, userId string) error {
+	err := svc.repo.DeleteUser(ctx, userId)
 	if err != nil {
 		svc.logger.Error(fmt.Sprintf("delete user with id user: failed to delete user with id user: %v", err))
-		return fmt.Errorf("delete user with id user: failed to delete user with id user: %v", err)
+		return fmt.Errorf("delete user with id user: failed to delete user with id user: %w", err)
 	}
 	return nil
 }
+
+// ChangePassword replaces the user's password after verifying the current one.
+// Every existing session is revoked, so the user has to log in again.
+func (svc userService) ChangePassword(ctx context.Context, userId, currentPassword, newPassword string) error {
+	user, err := svc.GetUserById(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(currentPassword))
+	if err != nil {
+		svc.logger.Warning(fmt.Sprintf("change password: incorrect current password for user %s", userId))
+		return domain.ErrIncorrectPassword
+	}
+
+	return svc.setPassword(ctx, *user, newPassword)
+}
+
+// SetPassword replaces the user's password without verifying the current one
+// and revokes every existing session. It is meant for administrators: only
+// admins may set an admin's password, so that users:write cannot be turned
+// into admin access.
+func (svc userService) SetPassword(ctx context.Context, actor domain.Claims, userId, newPassword string) error {
+	if err := svc.AuthorizeCredentialChange(ctx, actor, userId); err != nil {
+		return err
+	}
+	user, err := svc.GetUserById(ctx, userId)
+	if err != nil {
+		return err
+	}
+	return svc.setPassword(ctx, *user, newPassword)
+}
+
+func (svc userService) setPassword(ctx context.Context, user domain.User, newPassword string) error {
+	if err := svc.passwordPolicy.Validate(newPassword, user); err != nil {
+		return err
+	}
+
+	bytes, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("set password: failed to hash password: %v", err))
+		return fmt.Errorf("set password: failed to hash password: %w", err)
+	}
+
+	err = svc.repo.UpdatePassword(ctx, user.UserId, string(bytes))
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("set password: failed to update password: %v", err))
+		return fmt.Errorf("set password: failed to update password: %w", err)
+	}
+
+	err = svc.tokenService.LogoutEverywhere(ctx, user.UserId)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("set password: failed to revoke sessions: %v", err))
+		return fmt.Errorf("set password: failed to revoke sessions: %w", err)
+	}
+	return nil
+}
+
+// AuthorizeCredentialChange refuses an actor who is not an admin when the user
+// is one, for changes to the password or email address that would let the
+// actor log in as the user. Service accounts are never admins.
+func (svc userService) AuthorizeCredentialChange(ctx context.Context, actor domain.Claims, userId string) error {
+	targetAdmin, err := hasAdminRole(ctx, svc.userRoleRepo, userId)
+	if err != nil {
+		svc.logger.Error(fmt.Sprintf("authorize credential change: failed to get user roles: %v", err))
+		return fmt.Errorf("authorize credential change: failed to get user roles: %w", err)
+	}
+	if !targetAdmin {
+		return nil
+	}
+	if !actor.ServiceAccount() {
+		actorAdmin, err := hasAdminRole(ctx, svc.userRoleRepo, actor.UserId)
+		if err != nil {
+			svc.logger.Error(fmt.Sprintf("authorize credential change: failed to get actor roles: %v", err))
+			return fmt.Errorf("authorize credential change: failed to get actor roles: %w", err)
+		}
+		if actorAdmin {
+			return nil
+		}
+	}
+	svc.logger.Warning(fmt.Sprintf("%s may not change the credentials of admin %s", actor.UserId, userId))
+	return domain.ErrPermissionDenied
+}
+
+// hasAdminRole reports whether the user currently holds the Admin role.
+func hasAdminRole(ctx context.Context, userRoleRepo ports.UserRoleRepository, userId string) (bool, error) {
+	roles, err := userRoleRepo.GetUserRoles(ctx, userId)
+	if err != nil {
+		return false, err
+	}
+	for _, role := range roles {
+		if role.Name == domain.RoleAdmin {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// UnlockUser lifts a lockout caused by failed logins on the user's account.
+func (svc userService) UnlockUser(ctx context.Context, userId string) error {
+	user, err := svc.GetUserById(ctx, userId)
+	if err != nil {
+		return err
+	}
+	return svc.loginThrottle.Unlock(ctx, user.Email)
+}
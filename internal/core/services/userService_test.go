@@ -1,6 +1,8 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -11,6 +13,7 @@ import (
 )
 
 func TestUserService(t *testing.T) {
+	requireDatabase(t)
 	logger, err := logger.NewDefaultLogger()
 	if err != nil {
 		panic(err)
@@ -21,12 +24,20 @@ func TestUserService(t *testing.T) {
 		panic(err)
 	}
 
-	repo, _ := repository.NewUserPostgresClient(*config)
-	roleRepo, _ := repository.NewRolePostgresClient(*config)
-	userRoleRepo, _ := repository.NewUserRolePostgresClient(*config)
-	baseRepo, _ := repository.NewBasePostgresClient(*config)
-
-	userService := NewUserService(repo, logger, []byte(config.SECRET_KEY))
+	db, _ := repository.NewPostgresDB(*config)
+	factory := repository.NewRepositoryFactory(db, *config)
+	ctx := context.Background()
+	repo := factory.UserRepository()
+	tokenRepo := factory.TokenRepository()
+	revocationRepo := factory.RevocationRepository()
+	roleRepo := factory.RoleRepository()
+	userRoleRepo := factory.UserRoleRepository()
+	baseRepo := factory.BaseRepository()
+
+	tokenService := NewTokenService(tokenRepo, revocationRepo, factory.SessionRepository(), repo, userRoleRepo, logger, newTestKeyRing(factory.SigningKeyRepository(), *config, logger), config.ACCESS_TOKEN_TTL, config.REFRESH_TOKEN_TTL)
+	loginThrottle := newTestLoginThrottle(factory.LoginAttemptRepository(), *config, logger)
+	mfaService := newTestMFAService(repo, factory.MFARepository(), tokenService, loginThrottle, *config, logger)
+	userService := NewUserService(repo, factory.UserRoleRepository(), tokenService, mfaService, newTestPasswordPolicy(*config, logger), loginThrottle, domain.EmailVerificationOptional, logger)
 	roleService := NewRoleService(roleRepo)
 	userRoleService := NewUserRoleService(userRoleRepo)
 	baseService := NewBaseService(baseRepo)
@@ -34,16 +45,16 @@ func TestUserService(t *testing.T) {
 	t.Run("Testing CreateUser", func(t *testing.T) {
 		user := domain.User{
 			Username:     "john_doe",
-			PasswordHash: "hashed_password",
+			PasswordHash: "Hashed_Password1",
 			Email:        "john.doe@example.com",
 			FullName:     "John Doe",
-			PhoneNumber:  "1234567890",
+			PhoneNumber:  "0712 345 670",
 			Avatar:       "avatar_url",
 			Address:      "123 Main St",
 			CreatedAt:    time.Now(),
 			UpdatedAt:    time.Now(),
 		}
-		newUser, err := userService.CreateUser(user)
+		newUser, err := userService.CreateUser(ctx, user)
 		if err != nil {
 			t.Errorf("error adding user: %v", err)
 		}
@@ -51,10 +62,19 @@ func TestUserService(t *testing.T) {
 		if newUser.Email != "john.doe@example.com" {
 			t.Errorf("expected at email john.doe@example.com, got : %v", newUser.Email)
 		}
+		if newUser.PhoneNumber != "+254712345670" {
+			t.Errorf("expected phone number +254712345670, got : %v", newUser.PhoneNumber)
+		}
+
+		user.Email = "invalid.phone@example.com"
+		user.PhoneNumber = "12345"
+		if _, err := userService.CreateUser(ctx, user); !errors.Is(err, domain.ErrInvalidPhoneNumber) {
+			t.Errorf("expected ErrInvalidPhoneNumber, got %v", err)
+		}
 	})
 
 	t.Run("Testing GetUsers", func(t *testing.T) {
-		users, err := userService.GetUsers()
+		users, err := userService.GetUsers(ctx)
 		if err != nil {
 			t.Errorf("error getting users: %v", err)
 		}
@@ -70,7 +90,7 @@ func TestUserService(t *testing.T) {
 	})
 
 	t.Run("Testing GetUserById", func(t *testing.T) {
-		dbusers, err := userService.GetUsers()
+		dbusers, err := userService.GetUsers(ctx)
 		if err != nil {
 			t.Errorf("error getting users when testing GetUserById: %v", err)
 		}
@@ -78,7 +98,7 @@ func TestUserService(t *testing.T) {
 		dbUser := dbusers[0]
 		userID := dbUser.UserId
 
-		user, err := userService.GetUserById(userID)
+		user, err := userService.GetUserById(ctx, userID)
 
 		if err != nil {
 			t.Errorf("error getting user with ID %s: %v", userID, err)
@@ -91,7 +111,7 @@ func TestUserService(t *testing.T) {
 
 	t.Run("Testing GetUserByEmail", func(t *testing.T) {
 		email := "john.doe@example.com"
-		dbuser, err := userService.GetUserByEmail(email)
+		dbuser, err := userService.GetUserByEmail(ctx, email)
 		if err != nil {
 			t.Errorf("error getting users when testing GetUserById: %v", err)
 		}
@@ -109,7 +129,7 @@ func TestUserService(t *testing.T) {
 	t.Run("Testing UpdateUser", func(t *testing.T) {
 		user := domain.User{
 			Username:     "mary_doe",
-			PasswordHash: "hashed_password",
+			PasswordHash: "Hashed_Password1",
 			Email:        "mary.doe@example.com",
 			FullName:     "mary Doe",
 			PhoneNumber:  "0987654321",
@@ -118,7 +138,7 @@ func TestUserService(t *testing.T) {
 			CreatedAt:    time.Now(),
 			UpdatedAt:    time.Now(),
 		}
-		newUser, err := userService.CreateUser(user)
+		newUser, err := userService.CreateUser(ctx, user)
 		if err != nil {
 			t.Fatalf("error adding user: %v", err)
 		}
@@ -126,7 +146,7 @@ func TestUserService(t *testing.T) {
 		avatarURL := "https://img.freepik.com/free-psd/3d-illustration-person-with-sunglasses_23-2149436188.jpg?size=338&ext=jpg&ga=GA1.1.1369675164.1715385600&semt=ais_user"
 		newUser.Avatar = avatarURL
 		newUser.Email = newEmail
-		updatedUser, err := userService.UpdateUser(*newUser)
+		updatedUser, err := userService.UpdateUser(ctx, *newUser)
 		if err != nil {
 			t.Fatalf("error updating user: %v", err)
 		}
@@ -140,10 +160,135 @@ func TestUserService(t *testing.T) {
 		}
 	})
 
+	t.Run("Testing ChangePassword", func(t *testing.T) {
+		user := domain.User{
+			Username:     "jane_doe",
+			PasswordHash: "Old_Password1",
+			Email:        "jane.doe@example.com",
+			FullName:     "Jane Doe",
+			PhoneNumber:  "0712345678",
+			Avatar:       "avatar_url",
+			Address:      "501 Main St",
+		}
+		newUser, err := userService.CreateUser(ctx, user)
+		if err != nil {
+			t.Fatalf("error adding user: %v", err)
+		}
+		defer userService.DeleteUser(ctx, newUser.UserId)
+
+		err = userService.ChangePassword(ctx, newUser.UserId, "Wrong_Password1", "New_Password1")
+		if !errors.Is(err, domain.ErrIncorrectPassword) {
+			t.Errorf("expected ErrIncorrectPassword, got %v", err)
+		}
+
+		err = userService.ChangePassword(ctx, newUser.UserId, "Old_Password1", "New_Password1")
+		if err != nil {
+			t.Fatalf("error changing password: %v", err)
+		}
+
+		if _, err := userService.LoginUser(ctx, domain.LoginRequest{Email: user.Email, Password: "Old_Password1"}); !errors.Is(err, domain.ErrInvalidLogin) {
+			t.Errorf("expected old password to be rejected, got %v", err)
+		}
+		if _, err := userService.LoginUser(ctx, domain.LoginRequest{Email: user.Email, Password: "New_Password1"}); err != nil {
+			t.Errorf("expected new password to be accepted, got %v", err)
+		}
+	})
+
+	t.Run("Testing only admins may change an admin's credentials", func(t *testing.T) {
+		admin, err := userService.CreateUser(ctx, domain.User{
+			Username:     "admin_doe",
+			PasswordHash: "Admin_Password1",
+			Email:        "admin.doe@example.com",
+			FullName:     "Admin Doe",
+		})
+		if err != nil {
+			t.Fatalf("error adding user: %v", err)
+		}
+		defer userService.DeleteUser(ctx, admin.UserId)
+		adminRole, err := roleService.CreateRole(ctx, domain.Role{Name: domain.RoleAdmin, Description: "UsafiHub Administrator"})
+		if err != nil {
+			t.Fatalf("error adding role: %v", err)
+		}
+		defer roleService.DeleteRole(ctx, adminRole.RoleId)
+		if err := userRoleService.AddUserRole(ctx, domain.UserRole{UserId: admin.UserId, RoleId: adminRole.RoleId}); err != nil {
+			t.Fatalf("error adding user role: %v", err)
+		}
+		writer, err := userService.GetUserByEmail(ctx, "john.doe@example.com")
+		if err != nil {
+			t.Fatalf("error getting user: %v", err)
+		}
+
+		serviceAccount := domain.Claims{UserId: "service-account", APIKeyId: "key", Scope: domain.PermissionUsersWrite}
+		if err := userService.SetPassword(ctx, serviceAccount, admin.UserId, "Taken_Password1"); !errors.Is(err, domain.ErrPermissionDenied) {
+			t.Errorf("expected ErrPermissionDenied for an API key, got %v", err)
+		}
+		if err := userService.SetPassword(ctx, domain.Claims{UserId: writer.UserId}, admin.UserId, "Taken_Password1"); !errors.Is(err, domain.ErrPermissionDenied) {
+			t.Errorf("expected ErrPermissionDenied for a user who is not an admin, got %v", err)
+		}
+		if err := userService.AuthorizeCredentialChange(ctx, serviceAccount, admin.UserId); !errors.Is(err, domain.ErrPermissionDenied) {
+			t.Errorf("expected an API key not to change an admin's email, got %v", err)
+		}
+		if err := userService.AuthorizeCredentialChange(ctx, domain.Claims{UserId: writer.UserId}, admin.UserId); !errors.Is(err, domain.ErrPermissionDenied) {
+			t.Errorf("expected a user who is not an admin not to change an admin's email, got %v", err)
+		}
+		if err := userService.AuthorizeCredentialChange(ctx, domain.Claims{UserId: admin.UserId}, admin.UserId); err != nil {
+			t.Errorf("expected an admin to change an admin's email, got %v", err)
+		}
+		if err := userService.AuthorizeCredentialChange(ctx, serviceAccount, writer.UserId); err != nil {
+			t.Errorf("expected an API key to change a user's email, got %v", err)
+		}
+		if _, err := userService.LoginUser(ctx, domain.LoginRequest{Email: admin.Email, Password: "Admin_Password1"}); err != nil {
+			t.Errorf("expected the admin's password to be unchanged, got %v", err)
+		}
+
+		if err := userService.SetPassword(ctx, domain.Claims{UserId: admin.UserId}, admin.UserId, "Reset_Password1"); err != nil {
+			t.Errorf("expected an admin to set an admin's password, got %v", err)
+		}
+		if err := userService.SetPassword(ctx, serviceAccount, writer.UserId, "Hashed_Password1"); err != nil {
+			t.Errorf("expected an API key to set a user's password, got %v", err)
+		}
+	})
+
+	t.Run("Testing UpdateUser keeps the password", func(t *testing.T) {
+		dbUser, err := userService.GetUserByEmail(ctx, "john.doe@example.com")
+		if err != nil {
+			t.Fatalf("error getting user: %v", err)
+		}
+		dbUser.PasswordHash = "raw_hash"
+		if _, err := userService.UpdateUser(ctx, *dbUser); err != nil {
+			t.Fatalf("error updating user: %v", err)
+		}
+		if _, err := userService.LoginUser(ctx, domain.LoginRequest{Email: dbUser.Email, Password: "Hashed_Password1"}); err != nil {
+			t.Errorf("expected password to be unchanged, got %v", err)
+		}
+	})
+
+	t.Run("Testing LoginUser locks out and UnlockUser unlocks", func(t *testing.T) {
+		dbUser, err := userService.GetUserByEmail(ctx, "john.doe@example.com")
+		if err != nil {
+			t.Fatalf("error getting user: %v", err)
+		}
+		for i := 0; i < config.LOGIN_MAX_FAILURES; i++ {
+			if _, err := userService.LoginUser(ctx, domain.LoginRequest{Email: dbUser.Email, Password: "Wrong_Password1"}); !errors.Is(err, domain.ErrInvalidLogin) {
+				t.Fatalf("expected ErrInvalidLogin, got %v", err)
+			}
+		}
+		if _, err := userService.LoginUser(ctx, domain.LoginRequest{Email: dbUser.Email, Password: "Hashed_Password1"}); !errors.Is(err, domain.ErrLoginThrottled) {
+			t.Fatalf("expected ErrLoginThrottled, got %v", err)
+		}
+
+		if err := userService.UnlockUser(ctx, dbUser.UserId); err != nil {
+			t.Fatalf("error unlocking user: %v", err)
+		}
+		if _, err := userService.LoginUser(ctx, domain.LoginRequest{Email: dbUser.Email, Password: "Hashed_Password1"}); err != nil {
+			t.Errorf("expected unlocked user to log in, got %v", err)
+		}
+	})
+
 	t.Run("Testing DeleteUser", func(t *testing.T) {
 		user := domain.User{
 			Username:     "joe_doe",
-			PasswordHash: "hashed_password",
+			PasswordHash: "Hashed_Password1",
 			Email:        "joe.doe@example.com",
 			FullName:     "joe Doe",
 			PhoneNumber:  "0567654321",
@@ -152,24 +297,24 @@ func TestUserService(t *testing.T) {
 			CreatedAt:    time.Now(),
 			UpdatedAt:    time.Now(),
 		}
-		newUser, err := userService.CreateUser(user)
+		newUser, err := userService.CreateUser(ctx, user)
 		if err != nil {
 			t.Fatalf("error adding user: %v", err)
 		}
 
-		err = userService.DeleteUser(newUser.UserId)
+		err = userService.DeleteUser(ctx, newUser.UserId)
 		if err != nil {
 			t.Fatalf("error deleting user: %v", err)
 		}
 
-		deletedUser, err := userService.GetUserById(newUser.UserId)
+		deletedUser, err := userService.GetUserById(ctx, newUser.UserId)
 		if deletedUser != nil || err == nil {
 			t.Error("expected user to be deleted, but user still exists")
 		}
 	})
 
 	t.Run("Testing GetUsersWithRole", func(t *testing.T) {
-		_, err := userService.GetUsers()
+		_, err := userService.GetUsers(ctx)
 		if err != nil {
 			t.Error("error getting users")
 		}
@@ -179,12 +324,12 @@ func TestUserService(t *testing.T) {
 			Description: "UsafiHub Administrator",
 		}
 
-		newRole, err := roleService.CreateRole(role)
+		newRole, err := roleService.CreateRole(ctx, role)
 		if err != nil {
 			t.Errorf("error adding role: %v", err)
 		}
 
-		users, err := userService.GetUsers()
+		users, err := userService.GetUsers(ctx)
 		if err != nil {
 			t.Errorf("error reading users while testing GetUsersWithRole: %v", err)
 		}
@@ -194,7 +339,7 @@ func TestUserService(t *testing.T) {
 			RoleId: newRole.RoleId,
 		}
 
-		err = userRoleService.AddUserRole(userRole)
+		err = userRoleService.AddUserRole(ctx, userRole)
 
 		if err != nil {
 			t.Errorf("error adding user role %v: %v", userRole, err)
@@ -202,7 +347,7 @@ func TestUserService(t *testing.T) {
 	})
 
 	t.Run("Testing Deleting tables", func(t *testing.T) {
-		err := baseService.DropTables()
+		err := baseService.DropTables(ctx)
 		if err != nil {
 			t.Errorf("error deleting tables: %v", err)
 		}
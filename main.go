@@ -1,9 +1,15 @@
 package main
 
 import (
+	"os"
+
 	"github.com/AntonyIS/usafi-hub-user-service/cmd"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		cmd.RunMigrations(os.Args[2:])
+		return
+	}
 	cmd.RunService()
 }